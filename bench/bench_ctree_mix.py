@@ -13,6 +13,7 @@ CelestialTree 压测脚本（多场景）
 用法示例：
   python bench_celestialtree.py --base http://127.0.0.1:7777 scenario emit --n 20000 --c 200 --payload-bytes 256
   python bench_celestialtree.py --base http://127.0.0.1:7777 scenario mixed --seconds 15 --c 200 --write-ratio 0.2
+  python bench_celestialtree.py --base http://127.0.0.1:7777 scenario mixed --seconds 15 --c 4 --read-ops descendants --view meta --build-n 50000 --parents-mode fork
   python bench_celestialtree.py --base http://127.0.0.1:7777 scenario descendants --seconds 10 --c 50
   python bench_celestialtree.py --base http://127.0.0.1:7777 scenario sse --subs 300 --emit-rate 200 --seconds 10
 """
@@ -133,7 +134,7 @@ class CTClient:
     async def heads(self) -> List[int]:
         r = await self.client.get(f"{self.base}/heads")
         r.raise_for_status()
-        return r.json().get("heads", [])
+        return r.json() or []
 
     async def get_event(self, eid: int) -> Dict[str, Any]:
         r = await self.client.get(f"{self.base}/event/{eid}")
@@ -143,17 +144,19 @@ class CTClient:
     async def children(self, eid: int) -> List[int]:
         r = await self.client.get(f"{self.base}/children/{eid}")
         r.raise_for_status()
-        return r.json().get("children", [])
+        return r.json() or []
 
-    async def descendants(self, eid: int) -> Dict[str, Any]:
-        r = await self.client.get(f"{self.base}/descendants/{eid}")
+    async def descendants(self, eid: int, view: str = "struct") -> int:
+        r = await self.client.get(f"{self.base}/descendants/{eid}", params={"view": view})
         r.raise_for_status()
-        return r.json()
+        # 深层嵌套的树会超出 json 模块的递归深度，只返回响应字节数
+        return len(r.content)
 
     async def emit(self, typ: str, parents: List[int], payload: Dict[str, Any], meta: Dict[str, Any]) -> Dict[str, Any]:
         r = await self.client.post(
             f"{self.base}/emit",
-            json={"type": typ, "parents": parents, "payload": payload, "meta": meta},
+            # 服务端拒绝未知字段，meta 随 payload 一起提交
+            json={"type": typ, "parents": parents, "payload": {**payload, "meta": meta}},
         )
         r.raise_for_status()
         return r.json()
@@ -221,7 +224,7 @@ async def scenario_emit(args) -> None:
                     payload = make_payload(args.payload_bytes)
                     meta = {"bench": "emit", "i": i}
                     out = await ct.emit(args.type, parents, payload, meta)
-                    eid = int(out["event"]["id"])
+                    eid = int(out["id"])
                     # 更新 pool（不加锁也行：近似即可；想严谨可加 asyncio.Lock）
                     pool.append(eid)
                     stats.add_ok(now_ms() - t0)
@@ -275,7 +278,7 @@ async def scenario_read(args) -> None:
                     elif args.read_op == "heads":
                         await ct.heads()
                     elif args.read_op == "descendants":
-                        await ct.descendants(eid)
+                        await ct.descendants(eid, args.view)
                     else:
                         raise ValueError("bad read_op")
                     stats.add_ok(now_ms() - t0)
@@ -310,6 +313,24 @@ async def scenario_mixed(args) -> None:
         heads = await ensure_genesis_heads(ct)
         pool: List[int] = heads[:] if heads else []
 
+        # 读操作包含 descendants 时先构建一棵较大的子树，观察大范围遍历期间写入延迟是否被拖慢
+        tree_root: Optional[int] = None
+        if "descendants" in args.read_ops.split(",") and pool:
+            tree_root = pool[-1]
+            build_sem = asyncio.Semaphore(min(args.c, args.build_c))
+
+            async def build_one(i: int):
+                async with build_sem:
+                    try:
+                        parents = pick_parents(args.parents_mode, pool, args.parents_k)
+                        out = await ct.emit("node", parents, make_payload(args.payload_bytes), {"bench": "mixed-build", "i": i})
+                        pool.append(int(out["id"]))
+                    except Exception:
+                        pass
+
+            await asyncio.gather(*[asyncio.create_task(build_one(i)) for i in range(args.build_n)])
+            print(f"[mixed] built subtree root={tree_root} events={args.build_n}")
+
         sem = asyncio.Semaphore(args.c)
         stats_w = Stats()
         stats_r = Stats()
@@ -326,7 +347,7 @@ async def scenario_mixed(args) -> None:
                     payload = make_payload(args.payload_bytes)
                     meta = {"bench": "mixed", "kind": "write", "i": i}
                     out = await ct.emit(args.type, parents, payload, meta)
-                    eid = int(out["event"]["id"])
+                    eid = int(out["id"])
                     pool.append(eid)
                     stats_w.add_ok(now_ms() - t0)
                 except Exception:
@@ -348,7 +369,7 @@ async def scenario_mixed(args) -> None:
                         elif op == "heads":
                             await ct.heads()
                         elif op == "descendants":
-                            await ct.descendants(eid)
+                            await ct.descendants(tree_root or eid, args.view)
                         else:
                             await ct.get_event(eid)
                     stats_r.add_ok(now_ms() - t0)
@@ -401,7 +422,7 @@ async def scenario_descendants(args) -> None:
                     payload = make_payload(args.payload_bytes)
                     meta = {"bench": "descendants-build", "i": i}
                     out = await ct.emit("node", parents, payload, meta)
-                    pool.append(int(out["event"]["id"]))
+                    pool.append(int(out["id"]))
                 except Exception:
                     pass
 
@@ -420,7 +441,7 @@ async def scenario_descendants(args) -> None:
             async with sem2:
                 t0 = now_ms()
                 try:
-                    await ct.descendants(root)
+                    await ct.descendants(root, args.view)
                     stats.add_ok(now_ms() - t0)
                 except Exception:
                     stats.add_fail(now_ms() - t0)
@@ -497,7 +518,7 @@ async def scenario_sse(args) -> None:
             try:
                 parents = [pool[-1]] if pool else []
                 out = await ct.emit("sse", parents, {"msg": "tick"}, {"bench": "sse"})
-                pool.append(int(out["event"]["id"]))
+                pool.append(int(out["id"]))
                 emitted += 1
             except Exception:
                 pass
@@ -564,12 +585,13 @@ def build_parser() -> argparse.ArgumentParser:
     sp.add_argument("--read-op", choices=["event", "children", "heads", "descendants"], default="event")
     sp.add_argument("--warm-depth", type=int, default=2, help="warm up depth for read pool")
     sp.add_argument("--read-ops", default="event,children,heads", help="mixed read ops, comma-separated")
+    sp.add_argument("--view", choices=["struct", "meta"], default="struct", help="view for descendants reads")
 
     # mixed
     sp.add_argument("--write-ratio", type=float, default=0.2, help="mixed: probability of write (0-1)")
 
     # descendants scenario: build tree first
-    sp.add_argument("--build-n", type=int, default=5000, help="descendants: number of emits to build a subtree")
+    sp.add_argument("--build-n", type=int, default=5000, help="descendants/mixed: number of emits to build a subtree")
     sp.add_argument("--build-c", type=int, default=200, help="descendants: build concurrency")
 
     # sse scenario
@@ -610,7 +632,7 @@ async def main_async():
                             payload = make_payload(args.payload_bytes)
                             meta = {"bench": "emit-seconds", "i": i}
                             out = await ct.emit(args.type, parents, payload, meta)
-                            pool.append(int(out["event"]["id"]))
+                            pool.append(int(out["id"]))
                             stats.add_ok(now_ms() - t0)
                         except Exception:
                             stats.add_fail(now_ms() - t0)
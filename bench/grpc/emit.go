@@ -21,6 +21,7 @@ func main() {
 	n := flag.Int("n", 10000, "total requests")
 	c := flag.Int("c", 20, "concurrency")
 	timeout := flag.Duration("timeout", 10*time.Second, "per-request timeout")
+	stream := flag.Bool("stream", false, "use one EmitStream per worker instead of unary Emit")
 	flag.Parse()
 
 	// 建议：一个 grpc 连接共享，多 goroutine 并发复用（gRPC client 是并发安全的）
@@ -69,6 +70,17 @@ func main() {
 	wg.Add(*c)
 
 	for w := 0; w < *c; w++ {
+		if *stream {
+			go func() {
+				defer wg.Done()
+				streamWorker(client, req, jobs, &ok, &fail, func(dt time.Duration) {
+					latMu.Lock()
+					lat = append(lat, dt)
+					latMu.Unlock()
+				})
+			}()
+			continue
+		}
 		go func() {
 			defer wg.Done()
 
@@ -110,9 +122,14 @@ func main() {
 		return lat[i]
 	}
 
+	mode := "grpc"
+	if *stream {
+		mode = "grpc-stream"
+	}
 	fmt.Printf(
-		"[go-bench-grpc] total=%d ok=%d fail=%d rps=%.1f "+
+		"[go-bench-%s] total=%d ok=%d fail=%d rps=%.1f "+
 			"lat_ms(p50=%.2f p90=%.2f p99=%.2f max=%.2f)\n",
+		mode,
 		total,
 		ok,
 		fail,
@@ -123,3 +140,46 @@ func main() {
 		float64(p(1.00).Milliseconds()),
 	)
 }
+
+// streamWorker 在一条 EmitStream 上发送 jobs 中的请求，另一个 goroutine 按顺序读取应答；
+// 应答与请求一一对应，延迟为发送到收到对应应答的时间。
+func streamWorker(client pb.CelestialTreeServiceClient, req *pb.EmitRequest, jobs <-chan struct{}, ok, fail *uint64, record func(time.Duration)) {
+	st, err := client.EmitStream(context.Background())
+	if err != nil {
+		panic(fmt.Errorf("open stream failed: %w", err))
+	}
+
+	sent := make(chan time.Time, 1024)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for t0 := range sent {
+			ack, err := st.Recv()
+			if err != nil {
+				// 流已中断：剩余已发送的请求都记为失败
+				atomic.AddUint64(fail, 1)
+				for range sent {
+					atomic.AddUint64(fail, 1)
+				}
+				return
+			}
+			record(time.Since(t0))
+			if ack.Code != 0 {
+				atomic.AddUint64(fail, 1)
+				continue
+			}
+			atomic.AddUint64(ok, 1)
+		}
+	}()
+
+	for range jobs {
+		t0 := time.Now()
+		if err := st.Send(req); err != nil {
+			break
+		}
+		sent <- t0
+	}
+	close(sent)
+	_ = st.CloseSend()
+	<-done
+}
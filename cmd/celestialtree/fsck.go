@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// runFsck 实现 `celestialtree fsck -data_dir DIR`：离线检查数据目录，不修改任何文件。
+// 返回 false 表示发现了违规，main 以退出码 1 结束。
+func runFsck(args []string) (bool, error) {
+	fs := flag.NewFlagSet("fsck", flag.ExitOnError)
+	dataDir := fs.String("data_dir", "", "data directory to check (required)")
+	asJSON := fs.Bool("json", false, "print the report as JSON")
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: %s fsck -data_dir DIR [-json]\n", os.Args[0])
+		fs.PrintDefaults()
+	}
+	_ = fs.Parse(args)
+
+	if *dataDir == "" {
+		return false, errors.New("-data_dir is required")
+	}
+
+	rep, err := memory.Fsck(*dataDir)
+	if err != nil {
+		return false, err
+	}
+
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return rep.OK, enc.Encode(rep)
+	}
+
+	printViolations := func(level string, vs []tree.Violation) {
+		for _, v := range vs {
+			fmt.Printf("%-9s %-18s", level, v.Check)
+			if v.ID != 0 {
+				fmt.Printf(" id=%d", v.ID)
+			}
+			if v.File != "" {
+				fmt.Printf(" file=%s", v.File)
+			}
+			fmt.Printf(" %s\n", v.Detail)
+		}
+	}
+	printViolations("VIOLATION", rep.Violations)
+	printViolations("WARNING", rep.Warnings)
+	if rep.Omitted > 0 {
+		fmt.Printf("... %d more violations omitted\n", rep.Omitted)
+	}
+
+	status := "ok"
+	if !rep.OK {
+		status = fmt.Sprintf("%d violations", len(rep.Violations)+rep.Omitted)
+	}
+	fmt.Printf("%s: %d events, %d files checked, %d warnings: %s\n", *dataDir, rep.Events, rep.Files, len(rep.Warnings), status)
+	return rep.OK, nil
+}
@@ -10,12 +10,14 @@ import (
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
 	"github.com/Mr-xiaotian/CelestialTree/internal/grpcapi"
 	"github.com/Mr-xiaotian/CelestialTree/internal/httpapi"
 	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 	"github.com/Mr-xiaotian/CelestialTree/internal/version"
 	pb "github.com/Mr-xiaotian/CelestialTree/proto"
@@ -24,10 +26,13 @@ import (
 	"google.golang.org/grpc/reflection"
 )
 
-// Config 包含 HTTP 和 gRPC 服务的监听地址配置。
+// Config 包含 HTTP 和 gRPC 服务的监听地址配置，以及存储后端的选择与持久化配置。
 type Config struct {
 	HTTPAddr string
 	GRPCAddr string
+	Storage  string
+	Store    memory.Options
+	Genesis  bool // 存储为空时在启动时写入创世事件
 }
 
 // parseConfig 从命令行参数解析服务配置，支持 http_addr/grpc_addr 或 host+port 组合。
@@ -38,9 +43,17 @@ func parseConfig() Config {
 	host := flag.String("host", "0.0.0.0", "server listen host (http/grpc)")
 	httpPort := flag.Int("http_port", 7777, "http listen port")
 	grpcPort := flag.Int("grpc_port", 7778, "grpc listen port")
+	genesis := flag.Bool("genesis", true, "write a genesis event when the store is empty at startup (disable to POST /import a full export)")
+
+	storeConfig := storeFlags(flag.CommandLine)
 
 	flag.Parse()
 
+	storageName, opts, err := storeConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	httpAddr := *httpAddrFlag
 	if httpAddr == "" {
 		httpAddr = net.JoinHostPort(*host, strconv.Itoa(*httpPort))
@@ -51,27 +64,117 @@ func parseConfig() Config {
 		grpcAddr = net.JoinHostPort(*host, strconv.Itoa(*grpcPort))
 	}
 
-	return Config{HTTPAddr: httpAddr, GRPCAddr: grpcAddr}
+	return Config{
+		HTTPAddr: httpAddr,
+		GRPCAddr: grpcAddr,
+		Storage:  storageName,
+		Store:    opts,
+		Genesis:  *genesis,
+	}
 }
 
-// newStoreWithGenesis 创建 Store 并写入创世事件（Genesis），作为 DAG 的起点。
-func newStoreWithGenesis() (*memory.Store, error) {
-	store := memory.NewStore()
+// storeFlags 在 fs 上注册存储后端与 memory.Options 的参数，返回在 fs.Parse 之后解析它们的函数。
+// 服务与 import 子命令共用，保证导入写出的数据目录与服务启动时的配置一致。
+func storeFlags(fs *flag.FlagSet) func() (string, memory.Options, error) {
+	storageName := fs.String("storage", "memory", "storage backend: memory")
+	dataDir := fs.String("data_dir", "", "data directory for the write-ahead log (empty = memory only)")
+	walSync := fs.String("wal_sync", "interval", "wal fsync policy: always|interval|never")
+	walSyncInterval := fs.Duration("wal_sync_interval", time.Second, "wal fsync interval when -wal_sync=interval")
+	checkpointInterval := fs.Duration("checkpoint_interval", 10*time.Minute, "periodic checkpoint interval (0 = manual only)")
+	coldAfter := fs.Duration("cold_after", 0, "move events older than this to on-disk cold segments at checkpoint time (0 = disabled)")
+	hotWindow := fs.Uint64("hot_window", 0, "keep only the newest N event ids in memory, older ones move to cold segments (0 = disabled)")
+	retainAge := fs.Duration("retain_age", 0, "archive root trees whose newest event is older than this before each periodic checkpoint (0 = disabled)")
+	retainEvents := fs.Int("retain_events", 0, "archive the oldest root trees while more than N events are online (0 = unlimited)")
+	payloadCompressMin := fs.Int("payload_compress_min", 1024, "store payloads of at least this many bytes flate-compressed (0 = disabled)")
+	maxEvents := fs.Int("max_events", 0, "maximum number of events held in memory (0 = unlimited)")
+	maxMemoryBytes := fs.Int64("max_memory_bytes", 0, "maximum estimated memory used by in-memory events and indexes (0 = unlimited)")
+	onLimit := fs.String("on_limit", "reject", "what to do when a memory limit is reached: reject|spill (spill needs -data_dir)")
+	eventLayout := fs.String("event_layout", "struct", "in-memory layout of hot events: struct|compact (compact uses less memory per event)")
+	forestWorkers := fs.Int("forest_workers", 0, "maximum goroutines building the trees of one batch descendants/provenance request (0 = GOMAXPROCS)")
+	payloadIndex := fs.String("payload_index", "", "comma-separated payload fields to index for /lookup, e.g. task_id,meta.run_id (more can be added via /admin/indexes)")
+	textIndex := fs.Bool("text_index", true, "maintain a full-text index over event messages for /search (about 8 bytes per word per event)")
+
+	return func() (string, memory.Options, error) {
+		syncPolicy, err := memory.ParseSyncPolicy(*walSync)
+		if err != nil {
+			return "", memory.Options{}, fmt.Errorf("bad -wal_sync: %w", err)
+		}
+		limitPolicy, err := memory.ParseLimitPolicy(*onLimit)
+		if err != nil {
+			return "", memory.Options{}, fmt.Errorf("bad -on_limit: %w", err)
+		}
+		layout, err := memory.ParseEventLayout(*eventLayout)
+		if err != nil {
+			return "", memory.Options{}, fmt.Errorf("bad -event_layout: %w", err)
+		}
+		return *storageName, memory.Options{
+			DataDir:            *dataDir,
+			Sync:               syncPolicy,
+			SyncInterval:       *walSyncInterval,
+			CheckpointInterval: *checkpointInterval,
+			ColdAfter:          *coldAfter,
+			HotWindow:          *hotWindow,
+			RetainAge:          *retainAge,
+			RetainEvents:       *retainEvents,
+			PayloadCompressMin: *payloadCompressMin,
+			MaxEvents:          *maxEvents,
+			MaxMemoryBytes:     *maxMemoryBytes,
+			OnLimit:            limitPolicy,
+			Layout:             layout,
+			ForestWorkers:      *forestWorkers,
+			PayloadIndexes:     splitList(*payloadIndex),
+			NoTextIndex:        !*textIndex,
+		}, nil
+	}
+}
+
+// splitList 将逗号分隔的参数拆成列表，忽略空项与首尾空白。
+func splitList(s string) []string {
+	var out []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+// openBackend 根据 -storage 参数创建对应的存储后端。
+func openBackend(cfg Config) (storage.Backend, error) {
+	switch cfg.Storage {
+	case "memory":
+		return memory.Open(cfg.Store)
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", cfg.Storage)
+	}
+}
+
+// newStoreWithGenesis 打开存储后端（恢复已持久化的数据），仅当 cfg.Genesis 为 true 且 DAG 为空时写入创世事件（Genesis）作为起点。
+// 以 -genesis=false 启动的空服务可以经 POST /import 导入从 ID 1 开始的完整导出。
+func newStoreWithGenesis(cfg Config) (storage.Backend, error) {
+	store, err := openBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if !cfg.Genesis || store.Snapshot().NextEventID > 0 {
+		return store, nil
+	}
 
 	// 创世事件（Genesis）
-	_, err := store.Emit(tree.EmitRequest{
+	_, err = store.Emit(tree.EmitRequest{
 		Type:    "genesis",
 		Parents: nil,
 		Message: "CelestialTree begins.",
 	})
 	if err != nil {
+		store.Close()
 		return nil, err
 	}
 	return store, nil
 }
 
 // newHTTPServer 创建并配置 HTTP 服务器，注册所有 API 路由。
-func newHTTPServer(addr string, store *memory.Store) *http.Server {
+func newHTTPServer(addr string, store storage.Backend) *http.Server {
 	mux := http.NewServeMux()
 	httpapi.RegisterRoutes(mux, store)
 
@@ -84,7 +187,7 @@ func newHTTPServer(addr string, store *memory.Store) *http.Server {
 }
 
 // newGRPCServer 创建 gRPC 服务器并监听指定地址，注册 reflection 以支持调试。
-func newGRPCServer(addr string, store *memory.Store) (*grpc.Server, net.Listener, error) {
+func newGRPCServer(addr string, store storage.Backend) (*grpc.Server, net.Listener, error) {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		return nil, nil, err
@@ -100,12 +203,34 @@ func newGRPCServer(addr string, store *memory.Store) (*grpc.Server, net.Listener
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "import":
+			if err := runImport(os.Args[2:]); err != nil {
+				log.Fatalf("import failed: %v", err)
+			}
+			return
+		case "fsck":
+			ok, err := runFsck(os.Args[2:])
+			if err != nil {
+				log.Fatalf("fsck failed: %v", err)
+			}
+			if !ok {
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	cfg := parseConfig()
 
-	store, err := newStoreWithGenesis()
+	store, err := newStoreWithGenesis(cfg)
 	if err != nil {
 		log.Fatalf("genesis failed: %v", err)
 	}
+	if cfg.Store.DataDir != "" {
+		log.Printf("CelestialTree restored up to event %d from %s (storage=%s, wal_sync=%s)", store.Snapshot().NextEventID, cfg.Store.DataDir, cfg.Storage, cfg.Store.Sync)
+	}
 
 	httpSrv := newHTTPServer(cfg.HTTPAddr, store)
 
@@ -149,5 +274,10 @@ func main() {
 	if err := httpSrv.Shutdown(ctx); err != nil {
 		log.Printf("http shutdown error: %v", err)
 	}
+
+	// 最后关闭 Store，确保 WAL 落盘
+	if err := store.Close(); err != nil {
+		log.Printf("store close error: %v", err)
+	}
 	log.Printf("bye.")
 }
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestGenesisOnlyInEmptyDir 检查创世事件只写入空的数据目录，重启时不会重复写入。
+func TestGenesisOnlyInEmptyDir(t *testing.T) {
+	cfg := Config{Storage: "memory", Store: memory.Options{DataDir: t.TempDir(), Sync: memory.SyncAlways}, Genesis: true}
+
+	store, err := newStoreWithGenesis(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ev, ok := store.Get(1)
+	if !ok || ev.Type != "genesis" {
+		t.Fatalf("event 1 = %+v, %v; want genesis", ev, ok)
+	}
+	if _, err := store.Emit(tree.EmitRequest{Type: "work", Parents: []uint64{1}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = newStoreWithGenesis(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if got := store.Snapshot().NextEventID; got != 2 {
+		t.Fatalf("next event id after restart = %d, want 2", got)
+	}
+	if roots := store.Roots(); len(roots) != 1 || roots[0] != 1 {
+		t.Fatalf("roots after restart = %v, want [1]", roots)
+	}
+}
+
+// TestImportFullExportOverHTTP 检查完整导出（从 ID 1 开始）只能导入以 -genesis=false 启动的空服务，
+// 默认启动的服务已有创世事件，导入返回 409。
+func TestImportFullExportOverHTTP(t *testing.T) {
+	src := memory.NewStore()
+	root, _ := src.Emit(tree.EmitRequest{Type: "genesis"})
+	if _, err := src.Emit(tree.EmitRequest{Type: "work", Payload: json.RawMessage(`{"k":1}`), Parents: []uint64{root.ID}}); err != nil {
+		t.Fatal(err)
+	}
+	var dump bytes.Buffer
+	enc := json.NewEncoder(&dump)
+	if err := src.Export(0, 0, func(ev tree.Event) error { return enc.Encode(ev) }); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		genesis bool
+		status  int
+	}{
+		{false, http.StatusOK},
+		{true, http.StatusConflict},
+	}
+	for _, c := range cases {
+		t.Run(fmt.Sprintf("genesis=%v", c.genesis), func(t *testing.T) {
+			cfg := Config{Storage: "memory", Store: memory.Options{DataDir: t.TempDir(), Sync: memory.SyncNever}, Genesis: c.genesis}
+			store, err := newStoreWithGenesis(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			srv := httptest.NewServer(newHTTPServer("", store).Handler)
+			defer srv.Close()
+
+			resp, err := http.Post(srv.URL+"/import", "application/x-ndjson", bytes.NewReader(dump.Bytes()))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+			if resp.StatusCode != c.status {
+				t.Fatalf("POST /import = %d, want %d", resp.StatusCode, c.status)
+			}
+			if c.status != http.StatusOK {
+				return
+			}
+			ev, ok := store.Get(2)
+			if !ok || ev.Type != "work" || string(ev.Payload) != `{"k":1}` || len(ev.Parents) != 1 || ev.Parents[0] != 1 {
+				t.Fatalf("imported event 2 = %+v, %v", ev, ok)
+			}
+		})
+	}
+}
+
+// TestImportCommandUsesStoreFlags 检查 import 子命令按与服务相同的参数打开数据目录：字段索引、布局与压缩都生效。
+func TestImportCommandUsesStoreFlags(t *testing.T) {
+	var dump bytes.Buffer
+	enc := json.NewEncoder(&dump)
+	for i := uint64(1); i <= 3; i++ {
+		ev := tree.Event{ID: i, Type: "task", Payload: json.RawMessage(fmt.Sprintf(`{"task_id":"t%d"}`, i%2)), Parents: []uint64{}}
+		if i > 1 {
+			ev.Parents = []uint64{i - 1}
+		}
+		if err := enc.Encode(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input := filepath.Join(t.TempDir(), "dump.ndjson")
+	if err := os.WriteFile(input, dump.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	if err := runImport([]string{"-data_dir", dir, "-wal_sync", "never", "-payload_index", "task_id", "-event_layout", "compact", "-payload_compress_min", "1", input}); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := memory.Open(memory.Options{DataDir: dir, Layout: memory.LayoutCompact, PayloadCompressMin: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	if idx := store.FieldIndexes(); len(idx) != 1 || idx[0].Field != "task_id" || idx[0].Events != 3 {
+		t.Fatalf("field indexes after import = %+v, want task_id over 3 events", idx)
+	}
+	page, err := store.LookupField(tree.FieldLookup{Field: "task_id", Value: "t1"})
+	if err != nil || len(page.IDs) != 2 {
+		t.Fatalf("lookup task_id=t1 = %+v, %v; want 2 events", page, err)
+	}
+	if snap := store.Snapshot(); snap.NextEventID != 3 {
+		t.Fatalf("next event id = %d, want 3", snap.NextEventID)
+	}
+}
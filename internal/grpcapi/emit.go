@@ -3,13 +3,16 @@ package grpcapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 	pb "github.com/Mr-xiaotian/CelestialTree/proto"
 
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
 // Emit 处理 gRPC Emit 请求，将 protobuf 请求转换为内部 EmitRequest 后写入 DAG。
@@ -18,15 +21,19 @@ func (s *Server) Emit(ctx context.Context, req *pb.EmitRequest) (*pb.EmitRespons
 		return nil, status.Error(codes.InvalidArgument, "nil request")
 	}
 
+	id, err := s.emit(req)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.EmitResponse{Id: id}, nil
+}
+
+// emit 写入一条 pb.EmitRequest，错误已映射为 gRPC 状态；Emit 与 EmitStream 共用。
+func (s *Server) emit(req *pb.EmitRequest) (uint64, error) {
 	// 把 google.protobuf.Struct 转成 JSON bytes，再塞给你现有的 store.Emit(req)
-	var payload json.RawMessage
-	if req.Payload != nil {
-		b, err := protojson.Marshal(req.Payload)
-		if err != nil {
-			return nil, status.Errorf(codes.InvalidArgument, "invalid payload: %v", err)
-		}
-		// 注意：这里得到的是标准 JSON
-		payload = json.RawMessage(b)
+	payload, err := structPayload(req.Payload)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid payload: %v", err)
 	}
 
 	ev, err := s.store.Emit(tree.EmitRequest{
@@ -36,10 +43,77 @@ func (s *Server) Emit(ctx context.Context, req *pb.EmitRequest) (*pb.EmitRespons
 		Parents: req.Parents,
 	})
 	if err != nil {
-		// 你 store.Emit 现在对参数问题会返回 fmt.Errorf(...)
-		// 这里建议先粗分一下错误码（先跑通也可以统一 InvalidArgument）
-		return nil, status.Errorf(codes.InvalidArgument, "emit failed: %v", err)
+		return 0, emitStatus(err)
+	}
+	return ev.ID, nil
+}
+
+// EmitBatch 处理 gRPC EmitBatch 请求，以一次提交写入一批事件；local_parents 按下标引用同一批中更早的项。
+func (s *Server) EmitBatch(ctx context.Context, req *pb.EmitBatchRequest) (*pb.EmitBatchResponse, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "nil request")
+	}
+	be, ok := s.store.(storage.BatchEmitter)
+	if !ok {
+		return nil, status.Error(codes.Unimplemented, "batch emit not supported by storage backend")
 	}
 
-	return &pb.EmitResponse{Id: ev.ID}, nil
+	items := make([]tree.BatchEmitItem, len(req.Events))
+	for i, e := range req.Events {
+		payload, err := structPayload(e.Payload)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "item %d: invalid payload: %v", i, err)
+		}
+		local := make([]int, len(e.LocalParents))
+		for k, j := range e.LocalParents {
+			local[k] = int(j)
+		}
+		items[i] = tree.BatchEmitItem{
+			EmitRequest: tree.EmitRequest{
+				Type:    e.Type,
+				Message: e.Message,
+				Payload: payload,
+				Parents: e.Parents,
+			},
+			LocalParents: local,
+		}
+	}
+
+	events, err := be.EmitBatch(items)
+	if err != nil {
+		return nil, emitStatus(err)
+	}
+
+	ids := make([]uint64, len(events))
+	for i, ev := range events {
+		ids[i] = ev.ID
+	}
+	return &pb.EmitBatchResponse{Ids: ids}, nil
+}
+
+// emitStatus 把写入错误映射为 gRPC 状态：请求无效为 InvalidArgument，达到容量上限为 ResourceExhausted，
+// 其余（如 WAL 写入失败）为 Internal。
+func emitStatus(err error) error {
+	var emitErr *tree.EmitError
+	switch {
+	case errors.As(err, &emitErr):
+		return status.Errorf(codes.InvalidArgument, "emit failed: %v", err)
+	case errors.Is(err, storage.ErrCapacity):
+		return status.Errorf(codes.ResourceExhausted, "emit rejected: %v", err)
+	default:
+		return status.Errorf(codes.Internal, "emit failed: %v", err)
+	}
+}
+
+// structPayload 把 google.protobuf.Struct 转为 JSON payload；nil 表示没有 payload。
+func structPayload(p *structpb.Struct) (json.RawMessage, error) {
+	if p == nil {
+		return nil, nil
+	}
+	// 注意：这里得到的是标准 JSON
+	b, err := protojson.Marshal(p)
+	if err != nil {
+		return nil, err
+	}
+	return json.RawMessage(b), nil
 }
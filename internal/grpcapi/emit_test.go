@@ -0,0 +1,46 @@
+package grpcapi
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	pb "github.com/Mr-xiaotian/CelestialTree/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// TestEmitStatus 检查写入错误的状态码：请求无效为 InvalidArgument，达到内存上限（storage.ErrCapacity）为 ResourceExhausted。
+func TestEmitStatus(t *testing.T) {
+	store, err := memory.Open(memory.Options{MaxEvents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New(store)
+	ctx := context.Background()
+	emit := func(req *pb.EmitRequest) error { _, err := srv.Emit(ctx, req); return err }
+	batch := func(items ...*pb.EmitBatchItem) error {
+		_, err := srv.EmitBatch(ctx, &pb.EmitBatchRequest{Events: items})
+		return err
+	}
+
+	// 按顺序执行：前两次写入占满上限
+	tests := []struct {
+		name string
+		call func() error
+		want codes.Code
+	}{
+		{"emit", func() error { return emit(&pb.EmitRequest{Type: "root"}) }, codes.OK},
+		{"missing parent", func() error { return emit(&pb.EmitRequest{Type: "child", Parents: []uint64{99}}) }, codes.InvalidArgument},
+		{"emit up to the limit", func() error { return emit(&pb.EmitRequest{Type: "child", Parents: []uint64{1}}) }, codes.OK},
+		{"emit over the limit", func() error { return emit(&pb.EmitRequest{Type: "child", Parents: []uint64{1}}) }, codes.ResourceExhausted},
+		{"batch over the limit", func() error { return batch(&pb.EmitBatchItem{Type: "root"}) }, codes.ResourceExhausted},
+		{"invalid request over the limit", func() error { return emit(&pb.EmitRequest{Parents: []uint64{1}}) }, codes.InvalidArgument},
+	}
+	for _, tc := range tests {
+		if got := status.Code(tc.call()); got != tc.want {
+			t.Errorf("%s: code = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
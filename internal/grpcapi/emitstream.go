@@ -0,0 +1,66 @@
+package grpcapi
+
+import (
+	"io"
+
+	pb "github.com/Mr-xiaotian/CelestialTree/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// emitStreamWindow 是 EmitStream 每条流最多预读、尚未写入的请求数。
+// 窗口满时服务端停止接收，HTTP/2 流控随之让生产者的 Send 阻塞。
+const emitStreamWindow = 64
+
+// EmitStream 处理双向流式写入：生产者在一条流上持续发送 EmitRequest，
+// 服务端按接收顺序逐条写入，并为每条请求返回一个 EmitAck（成功带 ID，失败带状态码与原因）。
+// 单条写入失败不会结束整条流；只有接收或发送出错（如客户端取消）时流才会终止。
+func (s *Server) EmitStream(stream grpc.BidiStreamingServer[pb.EmitRequest, pb.EmitAck]) error {
+	ctx := stream.Context()
+	reqs := make(chan *pb.EmitRequest, emitStreamWindow)
+	recvErr := make(chan error, 1)
+
+	// 接收与写入分离：写入当前请求的同时预读后续请求，预读量受 emitStreamWindow 限制
+	go func() {
+		defer close(reqs)
+		for {
+			req, err := stream.Recv()
+			if err != nil {
+				if err != io.EOF {
+					recvErr <- err
+				}
+				return
+			}
+			select {
+			case reqs <- req:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var seq uint64
+	for req := range reqs {
+		seq++
+		ack := &pb.EmitAck{Seq: seq}
+		if id, err := s.emit(req); err != nil {
+			st := status.Convert(err)
+			ack.Code = uint32(st.Code())
+			ack.Error = st.Message()
+		} else {
+			ack.Id = id
+		}
+		// 客户端不读取应答时 Send 会阻塞，写入随之暂停
+		if err := stream.Send(ack); err != nil {
+			return err
+		}
+	}
+
+	select {
+	case err := <-recvErr:
+		return err
+	default:
+		return nil
+	}
+}
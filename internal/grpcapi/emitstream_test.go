@@ -0,0 +1,148 @@
+package grpcapi
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	pb "github.com/Mr-xiaotian/CelestialTree/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+)
+
+// fakeEmitStream 是内存中的 EmitStream 服务端流：Recv 依次取出 reqs，之后返回 end；
+// Send 把应答交给 acks（无缓冲，测试不读取时 Send 阻塞，相当于客户端不读应答）。
+type fakeEmitStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	reqs []*pb.EmitRequest
+	end  error
+	recv atomic.Int64
+	acks chan *pb.EmitAck
+}
+
+func (f *fakeEmitStream) Context() context.Context { return f.ctx }
+
+func (f *fakeEmitStream) Recv() (*pb.EmitRequest, error) {
+	i := f.recv.Load()
+	if int(i) >= len(f.reqs) {
+		return nil, f.end
+	}
+	f.recv.Add(1)
+	return f.reqs[i], nil
+}
+
+func (f *fakeEmitStream) Send(ack *pb.EmitAck) error {
+	select {
+	case f.acks <- ack:
+		return nil
+	case <-f.ctx.Done():
+		return f.ctx.Err()
+	}
+}
+
+// TestEmitStreamAcks 检查应答按请求顺序返回、ID 随序号递增，单条失败只体现在该条应答中而不结束流；
+// 接收出错时流在应答完已接收的请求后以该错误结束。
+func TestEmitStreamAcks(t *testing.T) {
+	cases := []struct {
+		name string
+		end  error
+	}{
+		{"client closes", io.EOF},
+		{"client cancels", errors.New("stream reset")},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store, err := memory.Open(memory.Options{MaxEvents: 6})
+			if err != nil {
+				t.Fatal(err)
+			}
+			reqs := []*pb.EmitRequest{
+				{Type: "root"},
+				{Type: "child", Parents: []uint64{1}},
+				{Type: ""}, // 缺少类型
+				{Type: "child", Parents: []uint64{99}},
+				{Type: "child", Parents: []uint64{2}},
+			}
+			for range 5 {
+				reqs = append(reqs, &pb.EmitRequest{Type: "leaf", Parents: []uint64{1}})
+			}
+			want := []codes.Code{codes.OK, codes.OK, codes.InvalidArgument, codes.InvalidArgument, codes.OK,
+				codes.OK, codes.OK, codes.OK, codes.ResourceExhausted, codes.ResourceExhausted}
+
+			f := &fakeEmitStream{ctx: context.Background(), reqs: reqs, end: tc.end, acks: make(chan *pb.EmitAck, len(reqs))}
+			err = New(store).EmitStream(f)
+			if tc.end == io.EOF && err != nil || tc.end != io.EOF && !errors.Is(err, tc.end) {
+				t.Fatalf("stream ended with %v, want %v", err, tc.end)
+			}
+			close(f.acks)
+
+			var seq, lastID uint64
+			for ack := range f.acks {
+				seq++
+				if ack.Seq != seq {
+					t.Fatalf("ack seq %d, want %d", ack.Seq, seq)
+				}
+				if got := codes.Code(ack.Code); got != want[seq-1] {
+					t.Fatalf("ack %d: code %v (%s), want %v", seq, got, ack.Error, want[seq-1])
+				}
+				switch {
+				case ack.Code == 0 && ack.Id <= lastID:
+					t.Fatalf("ack %d: id %d not above %d", seq, ack.Id, lastID)
+				case ack.Code == 0:
+					lastID = ack.Id
+				case ack.Id != 0 || ack.Error == "":
+					t.Fatalf("failed ack %d = %+v, want an error without an id", seq, ack)
+				}
+			}
+			if seq != uint64(len(reqs)) {
+				t.Fatalf("got %d acks for %d requests", seq, len(reqs))
+			}
+		})
+	}
+}
+
+// TestEmitStreamFlowControl 检查客户端不读应答时服务端最多预读 emitStreamWindow 条请求并停止写入，
+// 读取应答后剩余请求继续按顺序写入。
+func TestEmitStreamFlowControl(t *testing.T) {
+	const total = 4 * emitStreamWindow
+	store := memory.NewStore()
+	reqs := make([]*pb.EmitRequest, total)
+	for i := range reqs {
+		reqs[i] = &pb.EmitRequest{Type: "event"}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	f := &fakeEmitStream{ctx: ctx, reqs: reqs, end: io.EOF, acks: make(chan *pb.EmitAck)}
+	done := make(chan error, 1)
+	go func() { done <- New(store).EmitStream(f) }()
+
+	// 第一条写入后 Send 阻塞：预读通道装满 emitStreamWindow 条，接收协程还持有一条
+	const limit = 1 + emitStreamWindow + 1
+	deadline := time.Now().Add(5 * time.Second)
+	for f.recv.Load() < limit && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := f.recv.Load(); got != limit {
+		t.Fatalf("server received %d requests while acks were not read, want %d", got, limit)
+	}
+	if n := store.Snapshot().NextEventID; n != 1 {
+		t.Fatalf("store holds %d events while acks were not read, want 1", n)
+	}
+
+	for i := range total {
+		ack := <-f.acks
+		if ack.Seq != uint64(i+1) || ack.Id != uint64(i+1) {
+			t.Fatalf("ack %d = %+v, want seq and id %d", i, ack, i+1)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -1,17 +1,17 @@
 package grpcapi
 
 import (
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	pb "github.com/Mr-xiaotian/CelestialTree/proto"
 )
 
-// Server 是 gRPC 服务的实现，持有底层 Store 引用。
+// Server 是 gRPC 服务的实现，持有底层存储后端引用。
 type Server struct {
 	pb.UnimplementedCelestialTreeServiceServer
-	store *memory.Store
+	store storage.Backend
 }
 
-// New 创建一个绑定到指定 Store 的 gRPC Server 实例。
-func New(store *memory.Store) *Server {
+// New 创建一个绑定到指定存储后端的 gRPC Server 实例。
+func New(store storage.Backend) *Server {
 	return &Server{store: store}
 }
@@ -0,0 +1,76 @@
+package grpcapi
+
+import (
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+	pb "github.com/Mr-xiaotian/CelestialTree/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DescendantsStream 处理 gRPC DescendantsStream 请求，按前序逐条发送后代树的节点，服务端不构建整棵树。
+func (s *Server) DescendantsStream(req *pb.TreeRequest, stream grpc.ServerStreamingServer[pb.TreeRecord]) error {
+	return s.streamTree(req, stream, "descendants", storage.TreeStreamer.StreamDescendants)
+}
+
+// ProvenanceStream 处理 gRPC ProvenanceStream 请求，按前序逐条发送溯源树的节点。
+func (s *Server) ProvenanceStream(req *pb.TreeRequest, stream grpc.ServerStreamingServer[pb.TreeRecord]) error {
+	return s.streamTree(req, stream, "provenance", storage.TreeStreamer.StreamProvenance)
+}
+
+func (s *Server) streamTree(req *pb.TreeRequest, stream grpc.ServerStreamingServer[pb.TreeRecord], op string,
+	walk func(storage.TreeStreamer, uint64, tree.StreamOptions, func(tree.TreeRecord) error) error) error {
+	if req == nil {
+		return status.Error(codes.InvalidArgument, "nil request")
+	}
+	st, ok := s.store.(storage.TreeStreamer)
+	if !ok {
+		return status.Error(codes.Unimplemented, "stream not supported by storage backend")
+	}
+	if req.MaxNodes != 0 || req.Cursor != "" {
+		return status.Error(codes.InvalidArgument, "max_nodes and cursor are not supported by streaming rpcs")
+	}
+
+	opts := tree.StreamOptions{MaxDepth: int(req.MaxDepth), UntilID: req.UntilId}
+	switch view := strings.ToLower(strings.TrimSpace(req.View)); view {
+	case "", "struct":
+	case "meta":
+		opts.Meta = true
+	default:
+		return status.Errorf(codes.InvalidArgument, "unknown view: %s", view)
+	}
+
+	sent := false
+	err := walk(st, req.Id, opts, func(rec tree.TreeRecord) error {
+		sent = true
+		return stream.Send(treeRecord(rec))
+	})
+	if err != nil && !sent {
+		return treeStatus(op, err)
+	}
+	// 发送失败通常是客户端取消，Send 返回的错误已带有相应的状态码
+	return err
+}
+
+func treeRecord(rec tree.TreeRecord) *pb.TreeRecord {
+	out := &pb.TreeRecord{
+		Id:           rec.ID,
+		From:         rec.From,
+		Depth:        uint32(rec.Depth),
+		IsRef:        rec.IsRef,
+		Truncated:    rec.Truncated,
+		Watermark:    rec.Watermark,
+		TimeUnixNano: rec.TimeUnixNano,
+		Type:         rec.Type,
+		Message:      rec.Message,
+		Payload:      payloadValue(rec.Payload),
+	}
+	if rec.Archived != nil {
+		out.Archived = archiveStub(rec.Archived)
+	}
+	return out
+}
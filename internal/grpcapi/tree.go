@@ -0,0 +1,165 @@
+package grpcapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+	pb "github.com/Mr-xiaotian/CelestialTree/proto"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Descendants 处理 gRPC Descendants 请求，按深度与节点数限制返回后代树的一页。
+func (s *Server) Descendants(ctx context.Context, req *pb.TreeRequest) (*pb.TreePage, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "nil request")
+	}
+	opts := traverseOptions(req)
+
+	switch view := strings.ToLower(strings.TrimSpace(req.View)); view {
+	case "", "struct":
+		p, err := s.store.DescendantsPage(req.Id, opts)
+		if err != nil {
+			return nil, treeStatus("descendants", err)
+		}
+		return &pb.TreePage{Trees: convertNodes(p.Trees, descendantsNode), Truncated: p.Truncated, Cursor: p.Cursor}, nil
+
+	case "meta":
+		p, err := s.store.DescendantsPageMeta(req.Id, opts)
+		if err != nil {
+			return nil, treeStatus("descendants", err)
+		}
+		return &pb.TreePage{Trees: convertNodes(p.Trees, descendantsMetaNode), Truncated: p.Truncated, Cursor: p.Cursor}, nil
+
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown view: %s", view)
+	}
+}
+
+// Provenance 处理 gRPC Provenance 请求，按深度与节点数限制返回溯源树的一页；节点的 children 为其父事件。
+func (s *Server) Provenance(ctx context.Context, req *pb.TreeRequest) (*pb.TreePage, error) {
+	if req == nil {
+		return nil, status.Error(codes.InvalidArgument, "nil request")
+	}
+	opts := traverseOptions(req)
+
+	switch view := strings.ToLower(strings.TrimSpace(req.View)); view {
+	case "", "struct":
+		p, err := s.store.ProvenancePage(req.Id, opts)
+		if err != nil {
+			return nil, treeStatus("provenance", err)
+		}
+		return &pb.TreePage{Trees: convertNodes(p.Trees, provenanceNode), Truncated: p.Truncated, Cursor: p.Cursor}, nil
+
+	case "meta":
+		p, err := s.store.ProvenancePageMeta(req.Id, opts)
+		if err != nil {
+			return nil, treeStatus("provenance", err)
+		}
+		return &pb.TreePage{Trees: convertNodes(p.Trees, provenanceMetaNode), Truncated: p.Truncated, Cursor: p.Cursor}, nil
+
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown view: %s", view)
+	}
+}
+
+func traverseOptions(req *pb.TreeRequest) tree.TraverseOptions {
+	return tree.TraverseOptions{
+		MaxDepth: int(req.MaxDepth),
+		MaxNodes: int(req.MaxNodes),
+		Cursor:   req.Cursor,
+	}
+}
+
+// treeStatus 将遍历错误映射为 gRPC 状态：游标无效为 InvalidArgument，根 ID 无效为 NotFound。
+func treeStatus(op string, err error) error {
+	var cursorErr *tree.CursorError
+	if errors.As(err, &cursorErr) {
+		return status.Errorf(codes.InvalidArgument, "%s failed: %v", op, err)
+	}
+	return status.Errorf(codes.NotFound, "%s failed: %v", op, err)
+}
+
+func convertNodes[N any](nodes []N, conv func(N) *pb.TreeNode) []*pb.TreeNode {
+	out := make([]*pb.TreeNode, 0, len(nodes))
+	for _, n := range nodes {
+		out = append(out, conv(n))
+	}
+	return out
+}
+
+func descendantsNode(n tree.DescendantsTree) *pb.TreeNode {
+	return &pb.TreeNode{
+		Id:        n.ID,
+		IsRef:     n.IsRef,
+		Truncated: n.Truncated,
+		Children:  convertNodes(n.Children, descendantsNode),
+	}
+}
+
+func descendantsMetaNode(n tree.DescendantsTreeMeta) *pb.TreeNode {
+	out := &pb.TreeNode{
+		Id:           n.ID,
+		IsRef:        n.IsRef,
+		Truncated:    n.Truncated,
+		Children:     convertNodes(n.Children, descendantsMetaNode),
+		TimeUnixNano: n.TimeUnixNano,
+		Type:         n.Type,
+		Message:      n.Message,
+		Payload:      payloadValue(n.Payload),
+	}
+	if n.Archived != nil {
+		out.Archived = archiveStub(n.Archived)
+	}
+	return out
+}
+
+func archiveStub(a *tree.ArchiveStub) *pb.ArchiveStub {
+	return &pb.ArchiveStub{
+		Root:        a.Root,
+		Events:      int64(a.Events),
+		LastEventId: a.LastEventID,
+		ArchivedAt:  a.ArchivedAt,
+	}
+}
+
+func provenanceNode(n tree.ProvenanceTree) *pb.TreeNode {
+	return &pb.TreeNode{
+		Id:        n.ID,
+		IsRef:     n.IsRef,
+		Truncated: n.Truncated,
+		Children:  convertNodes(n.Parents, provenanceNode),
+	}
+}
+
+func provenanceMetaNode(n tree.ProvenanceTreeMeta) *pb.TreeNode {
+	return &pb.TreeNode{
+		Id:           n.ID,
+		IsRef:        n.IsRef,
+		Truncated:    n.Truncated,
+		Children:     convertNodes(n.Parents, provenanceMetaNode),
+		TimeUnixNano: n.TimeUnixNano,
+		Type:         n.Type,
+		Message:      n.Message,
+		Payload:      payloadValue(n.Payload),
+	}
+}
+
+// payloadValue 将 JSON payload 转为 google.protobuf.Value；payload 为空时返回 nil。
+func payloadValue(p json.RawMessage) *structpb.Value {
+	if len(p) == 0 {
+		return nil
+	}
+	v := &structpb.Value{}
+	if err := protojson.Unmarshal(p, v); err != nil {
+		// 写入时已校验为合法 JSON，只有数据损坏才会走到这里
+		return nil
+	}
+	return v
+}
@@ -0,0 +1,180 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handleCheckpoint 处理 /admin/checkpoint：GET 返回最近一次快照信息，POST 立即写入一个新快照。
+func handleCheckpoint(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cp, ok := store.(storage.Checkpointer)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "checkpoint not supported"})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			info, ok := cp.LastCheckpoint()
+			if !ok {
+				writeJSON(w, 404, tree.ResponseError{Error: "no checkpoint yet"})
+				return
+			}
+			writeJSON(w, 200, info)
+
+		case http.MethodPost:
+			info, err := cp.Checkpoint()
+			if errors.Is(err, storage.ErrNotSupported) {
+				writeJSON(w, 501, tree.ResponseError{Error: "checkpoint failed", Detail: err.Error()})
+				return
+			}
+			if err != nil {
+				writeJSON(w, 500, tree.ResponseError{Error: "checkpoint failed", Detail: err.Error()})
+				return
+			}
+			writeJSON(w, 200, info)
+
+		default:
+			writeJSON(w, 405, tree.ResponseError{Error: "method not allowed"})
+		}
+	}
+}
+
+// handleVerify 处理 GET /admin/verify，运行一致性检查并返回结构化报告；发现违规时仍返回 200，由 ok 字段区分。
+func handleVerify(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		vf, ok := store.(storage.Verifier)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "verify not supported"})
+			return
+		}
+		rep, err := vf.Verify()
+		if err != nil {
+			writeJSON(w, 500, tree.ResponseError{Error: "verify failed", Detail: err.Error()})
+			return
+		}
+		writeJSON(w, 200, rep)
+	}
+}
+
+// handleArchives 处理 GET /admin/archive，返回所有已归档树的存根。
+func handleArchives(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		ar, ok := store.(storage.Archiver)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "archive not supported"})
+			return
+		}
+		writeJSON(w, 200, ar.Archives())
+	}
+}
+
+// handleArchive 处理 POST /admin/archive/{id}，立即归档以 id 为根的树。
+func handleArchive(store storage.Backend) http.HandlerFunc {
+	return handleArchiveOp(store, "/admin/archive/", "archive failed", storage.Archiver.Archive)
+}
+
+// handleRehydrate 处理 POST /admin/rehydrate/{id}，将已归档的树恢复到在线存储。
+func handleRehydrate(store storage.Backend) http.HandlerFunc {
+	return handleArchiveOp(store, "/admin/rehydrate/", "rehydrate failed", storage.Archiver.Rehydrate)
+}
+
+// handleArchiveOp 是归档与恢复共用的处理逻辑：解析路径中的根 ID，并将存储层错误映射为 HTTP 状态码。
+func handleArchiveOp(store storage.Backend, prefix, msg string, op func(storage.Archiver, uint64) (tree.ArchiveStub, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		ar, ok := store.(storage.Archiver)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "archive not supported"})
+			return
+		}
+		id, ok := parsePathUint64(w, r.URL.Path, prefix)
+		if !ok {
+			return
+		}
+
+		stub, err := op(ar, id)
+		switch {
+		case errors.Is(err, storage.ErrNotSupported):
+			writeJSON(w, 501, tree.ResponseError{Error: msg, Detail: err.Error()})
+		case errors.Is(err, storage.ErrNotFound):
+			writeJSON(w, 404, tree.ResponseError{Error: msg, Detail: err.Error()})
+		case errors.Is(err, storage.ErrConflict):
+			writeJSON(w, 409, tree.ResponseError{Error: msg, Detail: err.Error()})
+		case errors.Is(err, storage.ErrCapacity):
+			writeJSON(w, 507, tree.ResponseError{Error: msg, Detail: err.Error()})
+		case err != nil:
+			writeJSON(w, 500, tree.ResponseError{Error: msg, Detail: err.Error()})
+		default:
+			writeJSON(w, 200, stub)
+		}
+	}
+}
+
+// handleFieldIndexes 处理 GET /admin/indexes，返回全部 payload 字段索引的概况。
+func handleFieldIndexes(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		fi, ok := store.(storage.FieldIndexer)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "field index not supported"})
+			return
+		}
+		writeJSON(w, 200, fi.FieldIndexes())
+	}
+}
+
+// handleFieldIndex 处理 /admin/indexes/{field}：POST 建立索引并回填已有事件（已存在时直接返回），DELETE 删除索引。
+func handleFieldIndex(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		fi, ok := store.(storage.FieldIndexer)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "field index not supported"})
+			return
+		}
+		field := strings.TrimPrefix(r.URL.Path, "/admin/indexes/")
+
+		switch r.Method {
+		case http.MethodPost:
+			info, err := fi.AddFieldIndex(field)
+			var queryErr *tree.QueryError
+			switch {
+			case errors.As(err, &queryErr):
+				writeJSON(w, 400, tree.ResponseError{Error: "bad field", Detail: err.Error()})
+			case err != nil:
+				writeJSON(w, 500, tree.ResponseError{Error: "add index failed", Detail: err.Error()})
+			default:
+				writeJSON(w, 200, info)
+			}
+
+		case http.MethodDelete:
+			err := fi.DropFieldIndex(field)
+			switch {
+			case errors.Is(err, storage.ErrNotFound):
+				writeJSON(w, 404, tree.ResponseError{Error: "drop index failed", Detail: err.Error()})
+			case err != nil:
+				writeJSON(w, 500, tree.ResponseError{Error: "drop index failed", Detail: err.Error()})
+			default:
+				writeJSON(w, 200, map[string]any{"ok": true, "field": field})
+			}
+
+		default:
+			writeJSON(w, 405, tree.ResponseError{Error: "method not allowed"})
+		}
+	}
+}
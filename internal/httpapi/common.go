@@ -2,6 +2,8 @@ package httpapi
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
@@ -29,6 +31,62 @@ func parsePathUint64(w http.ResponseWriter, path, prefix string) (uint64, bool)
 	return id, true
 }
 
+// parseQueryUint64 解析可选的 uint64 查询参数，缺省时为 0；格式错误则返回 400。
+func parseQueryUint64(w http.ResponseWriter, r *http.Request, name string) (uint64, bool) {
+	s := strings.TrimSpace(r.URL.Query().Get(name))
+	if s == "" {
+		return 0, true
+	}
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		writeJSON(w, 400, tree.ResponseError{Error: "bad " + name})
+		return 0, false
+	}
+	return v, true
+}
+
+// parseTraverseOptions 解析后代树/溯源树查询的 max_depth、max_nodes、cursor 参数。
+// 三者都缺省时 paged 为 false，响应沿用完整树的格式；否则响应为分页格式。
+func parseTraverseOptions(w http.ResponseWriter, r *http.Request) (opts tree.TraverseOptions, paged, ok bool) {
+	maxDepth, ok := parseQueryUint64(w, r, "max_depth")
+	if !ok {
+		return opts, false, false
+	}
+	maxNodes, ok := parseQueryUint64(w, r, "max_nodes")
+	if !ok {
+		return opts, false, false
+	}
+	opts = tree.TraverseOptions{
+		MaxDepth: int(min(maxDepth, math.MaxInt32)),
+		MaxNodes: int(min(maxNodes, math.MaxInt32)),
+		Cursor:   strings.TrimSpace(r.URL.Query().Get("cursor")),
+	}
+	return opts, opts != (tree.TraverseOptions{}), true
+}
+
+// pagesOf 对每个根 ID 按 opts 分别取第一页，任一失败即返回错误。
+func pagesOf[P any](ids []uint64, opts tree.TraverseOptions, page func(uint64, tree.TraverseOptions) (P, error)) ([]P, error) {
+	out := make([]P, 0, len(ids))
+	for _, id := range ids {
+		p, err := page(id, opts)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, p)
+	}
+	return out, nil
+}
+
+// writeTreeError 输出后代树/溯源树查询的错误：续页游标无效返回 400，其余（根 ID 无效）返回 404。
+func writeTreeError(w http.ResponseWriter, msg string, err error) {
+	var cursorErr *tree.CursorError
+	if errors.As(err, &cursorErr) {
+		writeJSON(w, 400, tree.ResponseError{Error: "bad cursor", Detail: err.Error()})
+		return
+	}
+	writeJSON(w, 404, tree.ResponseError{Error: msg, Detail: err.Error()})
+}
+
 // normalizeView 将 view 参数统一为小写并去除首尾空白。
 func normalizeView(s string) string {
 	return strings.ToLower(strings.TrimSpace(s))
@@ -41,9 +99,13 @@ func writeJSON(w http.ResponseWriter, status int, v any) {
 	_ = json.NewEncoder(w).Encode(v)
 }
 
-// readJSON 从请求体解码 JSON，拒绝未知字段。
-func readJSON(r *http.Request, v any) error {
-	dec := json.NewDecoder(r.Body)
+// maxJSONBody 是 JSON 请求体的字节数上限。单个事件（或一批事件）编码后不能超过 64 MiB 的存储记录上限，
+// JSON 形式比编码形式更长，这里留出一倍余量；更细的大小校验由存储层完成。
+const maxJSONBody = 128 << 20
+
+// readJSON 从请求体解码 JSON，拒绝未知字段；请求体超过 maxJSONBody 时返回错误。
+func readJSON(w http.ResponseWriter, r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxJSONBody))
 	dec.DisallowUnknownFields()
 	return dec.Decode(v)
 }
@@ -1,31 +1,79 @@
 package httpapi
 
 import (
+	"errors"
 	"net/http"
 
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 )
 
 // handleEmit 处理 POST /emit，将客户端提交的事件写入 DAG。
-func handleEmit(store *memory.Store) http.HandlerFunc {
+func handleEmit(store storage.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !requireMethod(w, r, http.MethodPost) {
 			return
 		}
 
 		var req tree.EmitRequest
-		if err := readJSON(r, &req); err != nil {
+		if err := readJSON(w, r, &req); err != nil {
 			writeJSON(w, 400, tree.ResponseError{Error: "invalid json", Detail: err.Error()})
 			return
 		}
 
 		ev, err := store.Emit(req)
-		if err != nil {
-			writeJSON(w, 400, tree.ResponseError{Error: "emit failed", Detail: err.Error()})
+		switch {
+		case err != nil:
+			writeEmitError(w, err)
 			return
 		}
 
 		writeJSON(w, 200, tree.EmitResponse{ID: ev.ID})
 	}
 }
+
+// handleEmitBatch 处理 POST /emit/batch，以一次提交写入一批事件，返回与请求各项对应的 ID。
+func handleEmitBatch(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		be, ok := store.(storage.BatchEmitter)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "batch emit not supported"})
+			return
+		}
+
+		var req tree.EmitBatchRequest
+		if err := readJSON(w, r, &req); err != nil {
+			writeJSON(w, 400, tree.ResponseError{Error: "invalid json", Detail: err.Error()})
+			return
+		}
+
+		events, err := be.EmitBatch(req.Events)
+		switch {
+		case err != nil:
+			writeEmitError(w, err)
+			return
+		}
+
+		ids := make([]uint64, len(events))
+		for i, ev := range events {
+			ids[i] = ev.ID
+		}
+		writeJSON(w, 200, tree.EmitBatchResponse{IDs: ids})
+	}
+}
+
+// writeEmitError 输出写入失败的错误：请求无效返回 400，达到容量上限返回 507，其余（如 WAL 写入失败）返回 500。
+func writeEmitError(w http.ResponseWriter, err error) {
+	var emitErr *tree.EmitError
+	switch {
+	case errors.As(err, &emitErr):
+		writeJSON(w, 400, tree.ResponseError{Error: "emit failed", Detail: err.Error()})
+	case errors.Is(err, storage.ErrCapacity):
+		writeJSON(w, 507, tree.ResponseError{Error: "emit rejected", Detail: err.Error()})
+	default:
+		writeJSON(w, 500, tree.ResponseError{Error: "emit failed", Detail: err.Error()})
+	}
+}
@@ -0,0 +1,55 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestEmitStatus 检查写入错误的状态码：请求无效为 400，达到内存上限（storage.ErrCapacity）为 507。
+func TestEmitStatus(t *testing.T) {
+	store, err := memory.Open(memory.Options{MaxEvents: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, store)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	// 按顺序执行：前两次写入占满上限
+	tests := []struct {
+		name, path, body string
+		status           int
+	}{
+		{"emit", "/emit", `{"type":"root"}`, 200},
+		{"missing parent", "/emit", `{"type":"child","parents":[99]}`, 400},
+		{"emit up to the limit", "/emit", `{"type":"child","parents":[1]}`, 200},
+		{"emit over the limit", "/emit", `{"type":"child","parents":[1]}`, 507},
+		{"batch over the limit", "/emit/batch", `{"events":[{"type":"root"}]}`, 507},
+		{"invalid request over the limit", "/emit", `{"parents":[1]}`, 400},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Post(srv.URL+tc.path, "application/json", strings.NewReader(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tc.status)
+			}
+			if tc.status != 200 {
+				var e tree.ResponseError
+				if err := json.NewDecoder(resp.Body).Decode(&e); err != nil || e.Detail == "" {
+					t.Fatalf("error body = %+v, %v", e, err)
+				}
+			}
+		})
+	}
+}
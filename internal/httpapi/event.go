@@ -3,12 +3,12 @@ package httpapi
 import (
 	"net/http"
 
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 )
 
 // handleGetEvent 处理 GET /event/{id}，返回指定 ID 的事件。
-func handleGetEvent(store *memory.Store) http.HandlerFunc {
+func handleGetEvent(store storage.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !requireMethod(w, r, http.MethodGet) {
 			return
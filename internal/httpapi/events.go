@@ -0,0 +1,127 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handleEvents 处理 GET /events?type=&from=&to=&after_id=&limit=，按 ID 升序返回一页满足条件的事件。
+// type 与时间范围 [from, to) 至少给出一个；format=ndjson 时不分页，逐行流式输出全部结果（忽略 limit）。
+func handleEvents(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		qr, ok := store.(storage.EventQuerier)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "event query not supported"})
+			return
+		}
+		serveEventQuery(w, r, qr, tree.EventQuery{Type: r.URL.Query().Get("type")})
+	}
+}
+
+// serveEventQuery 解析 /events 与 /search 共用的参数（from、to、after_id、limit、format）补全 q，输出一页结果或 NDJSON 流。
+func serveEventQuery(w http.ResponseWriter, r *http.Request, qr storage.EventQuerier, q tree.EventQuery) {
+	format, ok := parseTreeFormat(w, r)
+	if !ok {
+		return
+	}
+	if q.From, ok = parseQueryTime(w, r, "from"); !ok {
+		return
+	}
+	if q.To, ok = parseQueryTime(w, r, "to"); !ok {
+		return
+	}
+	if q.AfterID, ok = parseQueryUint64(w, r, "after_id"); !ok {
+		return
+	}
+	limit, ok := parseQueryUint64(w, r, "limit")
+	if !ok {
+		return
+	}
+	q.Limit = int(min(limit, math.MaxInt32))
+
+	if format == "ndjson" {
+		serveEventStream(w, qr, q)
+		return
+	}
+	page, err := qr.QueryEvents(q)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	writeJSON(w, 200, page)
+}
+
+// serveEventStream 逐行输出满足 q 的全部事件。
+func serveEventStream(w http.ResponseWriter, qr storage.EventQuerier, q tree.EventQuery) {
+	// 响应头推迟到第一个事件：条件无效时仍可返回 400
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(200)
+		started = true
+	}
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	n := 0
+	err := qr.StreamEvents(q, func(ev tree.Event) error {
+		if !started {
+			start()
+		}
+		if err := enc.Encode(ev); err != nil {
+			return err
+		}
+		if n++; flusher != nil && n%1024 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	switch {
+	case err != nil && !started:
+		writeQueryError(w, err)
+	case !started:
+		// 没有匹配的事件
+		start()
+	}
+	// 响应头已发出后出错（通常是客户端断开）只能终止输出
+}
+
+// parseQueryTime 解析时间参数：Unix 纳秒整数或 RFC3339 时间（如 2024-05-01T08:00:00Z），缺省为 0（不限）。
+func parseQueryTime(w http.ResponseWriter, r *http.Request, name string) (int64, bool) {
+	s := strings.TrimSpace(r.URL.Query().Get(name))
+	if s == "" {
+		return 0, true
+	}
+	if v, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return v, true
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		writeJSON(w, 400, tree.ResponseError{Error: "bad " + name, Detail: "expected unix nanoseconds or RFC3339 time"})
+		return 0, false
+	}
+	return t.UnixNano(), true
+}
+
+// writeQueryError 输出事件查询的错误：条件无效返回 400，后端关闭了所需的索引返回 501，其余返回 500。
+func writeQueryError(w http.ResponseWriter, err error) {
+	var queryErr *tree.QueryError
+	switch {
+	case errors.As(err, &queryErr):
+		writeJSON(w, 400, tree.ResponseError{Error: "bad query", Detail: err.Error()})
+	case errors.Is(err, storage.ErrNotSupported):
+		writeJSON(w, 501, tree.ResponseError{Error: "query not supported", Detail: err.Error()})
+	default:
+		writeJSON(w, 500, tree.ResponseError{Error: "query failed", Detail: err.Error()})
+	}
+}
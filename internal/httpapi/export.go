@@ -0,0 +1,91 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handleExport 处理 GET /export?since_id=&until_id=，按 ID 升序以 NDJSON 流式输出 (since_id, until_id] 内的事件。
+func handleExport(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		ex, ok := store.(storage.Exporter)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "export not supported"})
+			return
+		}
+		sinceID, ok := parseQueryUint64(w, r, "since_id")
+		if !ok {
+			return
+		}
+		untilID, ok := parseQueryUint64(w, r, "until_id")
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.WriteHeader(200)
+		flusher, _ := w.(http.Flusher)
+		enc := json.NewEncoder(w)
+		n := 0
+		// 响应头已发出，中途出错（通常是客户端断开）只能终止输出
+		_ = ex.Export(sinceID, untilID, func(ev tree.Event) error {
+			if err := enc.Encode(ev); err != nil {
+				return err
+			}
+			if n++; flusher != nil && n%1024 == 0 {
+				flusher.Flush()
+			}
+			return nil
+		})
+	}
+}
+
+// handleImport 处理 POST /import，按原 ID 流式导入请求体中的 NDJSON 事件（/export 的输出），请求体不会整体读入内存。
+func handleImport(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodPost) {
+			return
+		}
+		im, ok := store.(storage.Importer)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "import not supported"})
+			return
+		}
+
+		// 解码错误单独记录：它们是请求的问题，与存储端的失败区分
+		rd := tree.NewNDJSONReader(r.Body)
+		var decodeErr error
+		res, err := im.Import(func() (tree.Event, error) {
+			ev, err := rd.Next()
+			if err != nil && err != io.EOF {
+				decodeErr = err
+			}
+			return ev, err
+		})
+		var emitErr *tree.EmitError
+		switch {
+		case decodeErr != nil:
+			writeJSON(w, 400, tree.ResponseError{Error: "invalid ndjson", Detail: decodeErr.Error()})
+		case errors.As(err, &emitErr):
+			writeJSON(w, 400, tree.ResponseError{Error: "import failed", Detail: err.Error()})
+		case errors.Is(err, storage.ErrNotSupported):
+			writeJSON(w, 501, tree.ResponseError{Error: "import failed", Detail: err.Error()})
+		case errors.Is(err, storage.ErrConflict):
+			writeJSON(w, 409, tree.ResponseError{Error: "import failed", Detail: err.Error()})
+		case errors.Is(err, storage.ErrCapacity):
+			writeJSON(w, 507, tree.ResponseError{Error: "import rejected", Detail: err.Error()})
+		case err != nil:
+			writeJSON(w, 500, tree.ResponseError{Error: "import failed", Detail: err.Error()})
+		default:
+			writeJSON(w, 200, res)
+		}
+	}
+}
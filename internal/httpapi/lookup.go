@@ -0,0 +1,51 @@
+package httpapi
+
+import (
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handleLookup 处理 GET /lookup?field=&value=&after_id=&limit=，按 ID 升序返回一页 payload 字段值匹配的事件 ID。
+// 字段必须已建立索引（启动参数 -payload_index 或 POST /admin/indexes/{field}），否则返回 400。
+func handleLookup(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		fi, ok := store.(storage.FieldIndexer)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "field lookup not supported"})
+			return
+		}
+		q := r.URL.Query()
+		field := strings.TrimSpace(q.Get("field"))
+		if field == "" || !q.Has("value") {
+			writeJSON(w, 400, tree.ResponseError{Error: "field and value are required"})
+			return
+		}
+		afterID, ok := parseQueryUint64(w, r, "after_id")
+		if !ok {
+			return
+		}
+		limit, ok := parseQueryUint64(w, r, "limit")
+		if !ok {
+			return
+		}
+
+		page, err := fi.LookupField(tree.FieldLookup{
+			Field:   field,
+			Value:   q.Get("value"),
+			AfterID: afterID,
+			Limit:   int(min(limit, math.MaxInt32)),
+		})
+		if err != nil {
+			writeQueryError(w, err)
+			return
+		}
+		writeJSON(w, 200, page)
+	}
+}
@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handlePath 处理 GET /path?from=&to=&limit=&view=，返回从 from 到 to 沿父子边的最短因果链。
+// limit 大于 1 时按长度升序返回至多 limit 条路径；view=meta 时路径上的事件带有元数据。from 不是 to 的祖先时返回 404。
+func handlePath(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		pf, ok := store.(storage.PathFinder)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "causal path not supported"})
+			return
+		}
+		from, ok := parseQueryUint64(w, r, "from")
+		if !ok {
+			return
+		}
+		to, ok := parseQueryUint64(w, r, "to")
+		if !ok {
+			return
+		}
+		if from == 0 || to == 0 {
+			writeJSON(w, 400, tree.ResponseError{Error: "from and to are required"})
+			return
+		}
+		limit, ok := parseQueryUint64(w, r, "limit")
+		if !ok {
+			return
+		}
+		n := int(min(limit, math.MaxInt32))
+
+		var (
+			pm    any
+			found bool
+			err   error
+		)
+		view := normalizeView(r.URL.Query().Get("view"))
+		switch view {
+		case "", "struct":
+			var res tree.CausalPaths
+			res, err = pf.CausalPaths(from, to, n)
+			pm, found = res, len(res.Paths) > 0
+
+		case "meta":
+			var res tree.CausalPathsMeta
+			res, err = pf.CausalPathsMeta(from, to, n)
+			pm, found = res, len(res.Paths) > 0
+
+		default:
+			writeJSON(w, 400, tree.ResponseError{Error: "bad view", Detail: fmt.Sprintf("unknown view: %s", view)})
+			return
+		}
+
+		switch {
+		case errors.Is(err, storage.ErrNotFound):
+			writeJSON(w, 404, tree.ResponseError{Error: "not found", Detail: err.Error()})
+		case err != nil:
+			writeJSON(w, 500, tree.ResponseError{Error: "path failed", Detail: err.Error()})
+		case !found:
+			writeJSON(w, 404, tree.ResponseError{Error: "no causal path", Detail: noPathDetail(store, from, to)})
+		default:
+			writeJSON(w, 200, pm)
+		}
+	}
+}
+
+// noPathDetail 说明 from 与 to 之间没有因果联系；方向反了（to 是 from 的祖先）时提示交换两者。
+func noPathDetail(store storage.Backend, from, to uint64) string {
+	if rc, ok := store.(storage.Reacher); ok {
+		if reversed, err := rc.Reachable(to, from); err == nil && reversed {
+			return fmt.Sprintf("event %d is not an ancestor of event %d, but event %d is an ancestor of event %d: swap from and to", from, to, to, from)
+		}
+	}
+	return fmt.Sprintf("event %d is not an ancestor of event %d", from, to)
+}
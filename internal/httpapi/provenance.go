@@ -4,12 +4,14 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 )
 
 // handleProvenance 处理 GET /provenance/{id}，返回单个事件的溯源树。
-func handleProvenance(store *memory.Store) http.HandlerFunc {
+// 带 max_depth、max_nodes 或 cursor 参数时按限制遍历，返回 tree.ProvenancePage（或其 meta 视图）。
+// format=ndjson 时改为逐行流式输出节点（见 serveTreeStream）。
+func handleProvenance(store storage.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !requireMethod(w, r, http.MethodGet) {
 			return
@@ -18,43 +20,62 @@ func handleProvenance(store *memory.Store) http.HandlerFunc {
 		if !ok {
 			return
 		}
+		format, ok := parseTreeFormat(w, r)
+		if !ok {
+			return
+		}
+		if format == "ndjson" {
+			serveTreeStream(w, r, store, id, true, "provenance process failed")
+			return
+		}
+		opts, paged, ok := parseTraverseOptions(w, r)
+		if !ok {
+			return
+		}
 
+		var (
+			pt  any
+			err error
+		)
 		view := normalizeView(r.URL.Query().Get("view"))
 		switch view {
 		case "", "struct":
-			pt, err := store.ProvenanceTree(id)
-			if err != nil {
-				writeJSON(w, 404, tree.ResponseError{Error: "provenance process failed", Detail: err.Error()})
-				return
+			if paged {
+				pt, err = store.ProvenancePage(id, opts)
+			} else {
+				pt, err = store.ProvenanceTree(id)
 			}
-			writeJSON(w, 200, pt)
-			return
 
 		case "meta":
-			pt, err := store.ProvenanceTreeMeta(id)
-			if err != nil {
-				writeJSON(w, 404, tree.ResponseError{Error: "provenance process failed", Detail: err.Error()})
-				return
+			if paged {
+				pt, err = store.ProvenancePageMeta(id, opts)
+			} else {
+				pt, err = store.ProvenanceTreeMeta(id)
 			}
-			writeJSON(w, 200, pt)
-			return
 
 		default:
 			writeJSON(w, 400, tree.ResponseError{Error: "bad view", Detail: fmt.Sprintf("unknown view: %s", view)})
 			return
 		}
+
+		if err != nil {
+			writeTreeError(w, "provenance process failed", err)
+			return
+		}
+		writeJSON(w, 200, pt)
 	}
 }
 
 // handleProvenanceBatch 处理 POST /provenance，批量返回多个事件的溯源树。
-func handleProvenanceBatch(store *memory.Store) http.HandlerFunc {
+// 请求带 max_depth 或 max_nodes 时每个 ID 分别按限制遍历，返回与 ids 一一对应的第一页；续页通过 GET 单独获取。
+func handleProvenanceBatch(store storage.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !requireMethod(w, r, http.MethodPost) {
 			return
 		}
 
 		var req tree.TreeBatchRequest
-		if err := readJSON(r, &req); err != nil {
+		if err := readJSON(w, r, &req); err != nil {
 			writeJSON(w, 400, tree.ResponseError{Error: "invalid json", Detail: err.Error()})
 			return
 		}
@@ -62,25 +83,39 @@ func handleProvenanceBatch(store *memory.Store) http.HandlerFunc {
 			writeJSON(w, 400, tree.ResponseError{Error: "ids is required"})
 			return
 		}
+		if req.MaxDepth < 0 || req.MaxNodes < 0 {
+			writeJSON(w, 400, tree.ResponseError{Error: "bad max_depth or max_nodes"})
+			return
+		}
+		opts := tree.TraverseOptions{MaxDepth: req.MaxDepth, MaxNodes: req.MaxNodes}
+		paged := opts != (tree.TraverseOptions{})
 
 		view := normalizeView(req.View)
 		switch view {
 		case "", "struct":
-			forest, err := store.ProvenanceForest(req.IDs)
-			if err != nil {
-				writeJSON(w, 404, tree.ResponseError{Error: "provenance process failed", Detail: err.Error()})
+			if paged {
+				pages, err := pagesOf(req.IDs, opts, store.ProvenancePage)
+				if err != nil {
+					writeTreeError(w, "provenance process failed", err)
+					return
+				}
+				writeJSON(w, 200, pages)
 				return
 			}
-			writeJSON(w, 200, forest)
+			writeJSON(w, 200, store.ProvenanceForest(req.IDs))
 			return
 
 		case "meta":
-			forest, err := store.ProvenanceForestMeta(req.IDs)
-			if err != nil {
-				writeJSON(w, 404, tree.ResponseError{Error: "provenance process failed", Detail: err.Error()})
+			if paged {
+				pages, err := pagesOf(req.IDs, opts, store.ProvenancePageMeta)
+				if err != nil {
+					writeTreeError(w, "provenance process failed", err)
+					return
+				}
+				writeJSON(w, 200, pages)
 				return
 			}
-			writeJSON(w, 200, forest)
+			writeJSON(w, 200, store.ProvenanceForestMeta(req.IDs))
 			return
 
 		default:
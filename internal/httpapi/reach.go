@@ -0,0 +1,72 @@
+package httpapi
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handleReachable 处理 GET /reachable?from=&to= 与 POST /reachable {pairs:[...]}，回答 from 是否是 to 的祖先。
+func handleReachable(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		rc, ok := store.(storage.Reacher)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "reachability not supported"})
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			from, ok := parseQueryUint64(w, r, "from")
+			if !ok {
+				return
+			}
+			to, ok := parseQueryUint64(w, r, "to")
+			if !ok {
+				return
+			}
+			if from == 0 || to == 0 {
+				writeJSON(w, 400, tree.ResponseError{Error: "from and to are required"})
+				return
+			}
+
+			reachable, err := rc.Reachable(from, to)
+			if err != nil {
+				writeReachError(w, err)
+				return
+			}
+			writeJSON(w, 200, tree.ReachResult{From: from, To: to, Reachable: reachable})
+
+		case http.MethodPost:
+			var req tree.ReachBatchRequest
+			if err := readJSON(w, r, &req); err != nil {
+				writeJSON(w, 400, tree.ResponseError{Error: "invalid json", Detail: err.Error()})
+				return
+			}
+
+			reachable, err := rc.ReachableBatch(req.Pairs)
+			if err != nil {
+				writeReachError(w, err)
+				return
+			}
+			results := make([]tree.ReachResult, len(req.Pairs))
+			for i, p := range req.Pairs {
+				results[i] = tree.ReachResult{From: p.From, To: p.To, Reachable: reachable[i]}
+			}
+			writeJSON(w, 200, tree.ReachBatchResponse{Results: results})
+
+		default:
+			writeJSON(w, 405, tree.ResponseError{Error: "method not allowed"})
+		}
+	}
+}
+
+func writeReachError(w http.ResponseWriter, err error) {
+	if errors.Is(err, storage.ErrNotFound) {
+		writeJSON(w, 404, tree.ResponseError{Error: "not found", Detail: err.Error()})
+		return
+	}
+	writeJSON(w, 500, tree.ResponseError{Error: "reachable failed", Detail: err.Error()})
+}
@@ -3,16 +3,32 @@ package httpapi
 import (
 	"net/http"
 
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 )
 
 // RegisterRoutes 将所有 HTTP API 路由注册到 mux 上。
-func RegisterRoutes(mux *http.ServeMux, store *memory.Store) {
+func RegisterRoutes(mux *http.ServeMux, store storage.Backend) {
 	mux.HandleFunc("/emit", handleEmit(store))
+	mux.HandleFunc("/emit/batch", handleEmitBatch(store))
 	mux.HandleFunc("/event/", handleGetEvent(store))
 	mux.HandleFunc("/children/", handleChildren(store))
 	mux.HandleFunc("/ancestors/", handleAncestors(store))
 
+	// reachable: GET /reachable?from=&to=  &  POST /reachable {pairs:[...]}
+	mux.HandleFunc("/reachable", handleReachable(store))
+
+	// path: GET /path?from=&to=&limit=&view=
+	mux.HandleFunc("/path", handlePath(store))
+
+	// events: GET /events?type=&from=&to=&after_id=&limit=&format=
+	mux.HandleFunc("/events", handleEvents(store))
+
+	// search: GET /search?q=&type=&from=&to=&after_id=&limit=&format=
+	mux.HandleFunc("/search", handleSearch(store))
+
+	// lookup: GET /lookup?field=&value=&after_id=&limit=
+	mux.HandleFunc("/lookup", handleLookup(store))
+
 	mux.HandleFunc("/heads", handleHeads(store))
 	mux.HandleFunc("/roots", handleRoots(store))
 	mux.HandleFunc("/snapshot", handleSnapshot(store))
@@ -29,4 +45,23 @@ func RegisterRoutes(mux *http.ServeMux, store *memory.Store) {
 
 	// subscribe: GET /subscribe {id:...}
 	mux.HandleFunc("/subscribe", handleSubscribe(store))
+
+	// export/import: GET /export?since_id=&until_id=  &  POST /import (NDJSON)
+	mux.HandleFunc("/export", handleExport(store))
+	mux.HandleFunc("/import", handleImport(store))
+
+	// admin: GET/POST /admin/checkpoint
+	mux.HandleFunc("/admin/checkpoint", handleCheckpoint(store))
+
+	// verify: GET /admin/verify
+	mux.HandleFunc("/admin/verify", handleVerify(store))
+
+	// archive: GET /admin/archive  &  POST /admin/archive/{id}  &  POST /admin/rehydrate/{id}
+	mux.HandleFunc("/admin/archive", handleArchives(store))
+	mux.HandleFunc("/admin/archive/", handleArchive(store))
+	mux.HandleFunc("/admin/rehydrate/", handleRehydrate(store))
+
+	// payload field indexes: GET /admin/indexes  &  POST/DELETE /admin/indexes/{field}
+	mux.HandleFunc("/admin/indexes", handleFieldIndexes(store))
+	mux.HandleFunc("/admin/indexes/", handleFieldIndex(store))
 }
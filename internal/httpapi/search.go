@@ -0,0 +1,30 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// handleSearch 处理 GET /search?q=&type=&from=&to=&after_id=&limit=，按 ID 升序返回一页 Message 满足全文查询的事件。
+// q 由词、以 * 结尾的前缀与双引号包围的短语组成，全部满足才匹配；其余参数与 /events 相同，同时给出时取交集。
+func handleSearch(store storage.Backend) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !requireMethod(w, r, http.MethodGet) {
+			return
+		}
+		qr, ok := store.(storage.EventQuerier)
+		if !ok {
+			writeJSON(w, 501, tree.ResponseError{Error: "event query not supported"})
+			return
+		}
+		text := strings.TrimSpace(r.URL.Query().Get("q"))
+		if text == "" {
+			writeJSON(w, 400, tree.ResponseError{Error: "q is required"})
+			return
+		}
+		serveEventQuery(w, r, qr, tree.EventQuery{Type: r.URL.Query().Get("type"), Text: text})
+	}
+}
@@ -3,11 +3,11 @@ package httpapi
 import (
 	"net/http"
 
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 )
 
 // handleSnapshot 处理 GET /snapshot，返回系统状态快照。
-func handleSnapshot(store *memory.Store) http.HandlerFunc {
+func handleSnapshot(store storage.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !requireMethod(w, r, http.MethodGet) {
 			return
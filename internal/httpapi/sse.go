@@ -5,12 +5,12 @@ import (
 	"fmt"
 	"net/http"
 
-	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 )
 
 // handleSubscribe 处理 GET /subscribe，建立 SSE 长连接实时推送新事件。
-func handleSubscribe(store *memory.Store) http.HandlerFunc {
+func handleSubscribe(store storage.Backend) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
 			writeJSON(w, 405, tree.ResponseError{Error: "method not allowed"})
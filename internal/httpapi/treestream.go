@@ -0,0 +1,86 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// parseTreeFormat 解析树查询的 format 参数：空或 "json" 返回嵌套的树，"ndjson" 逐行流式输出节点。
+func parseTreeFormat(w http.ResponseWriter, r *http.Request) (string, bool) {
+	format := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("format")))
+	switch format {
+	case "", "json", "ndjson":
+		return format, true
+	default:
+		writeJSON(w, 400, tree.ResponseError{Error: "bad format", Detail: fmt.Sprintf("unknown format: %s", format)})
+		return "", false
+	}
+}
+
+// serveTreeStream 处理 format=ndjson 的后代树/溯源树查询：按前序逐行输出 tree.TreeRecord，
+// 边遍历边写出，服务端不构建整棵树。第一行是根节点，携带本次遍历的 ID 水位线。
+func serveTreeStream(w http.ResponseWriter, r *http.Request, store storage.Backend, id uint64, provenance bool, msg string) {
+	st, ok := store.(storage.TreeStreamer)
+	if !ok {
+		writeJSON(w, 501, tree.ResponseError{Error: "stream not supported"})
+		return
+	}
+
+	q := r.URL.Query()
+	if q.Has("max_nodes") || q.Has("cursor") {
+		writeJSON(w, 400, tree.ResponseError{Error: "max_nodes and cursor are not supported with format=ndjson"})
+		return
+	}
+	var opts tree.StreamOptions
+	switch view := normalizeView(q.Get("view")); view {
+	case "", "struct":
+	case "meta":
+		opts.Meta = true
+	default:
+		writeJSON(w, 400, tree.ResponseError{Error: "bad view", Detail: fmt.Sprintf("unknown view: %s", view)})
+		return
+	}
+	maxDepth, ok := parseQueryUint64(w, r, "max_depth")
+	if !ok {
+		return
+	}
+	opts.MaxDepth = int(min(maxDepth, math.MaxInt32))
+	if opts.UntilID, ok = parseQueryUint64(w, r, "until_id"); !ok {
+		return
+	}
+
+	stream := st.StreamDescendants
+	if provenance {
+		stream = st.StreamProvenance
+	}
+
+	// 响应头推迟到第一条记录：根 ID 无效时仍可返回 404
+	started := false
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	n := 0
+	err := stream(id, opts, func(rec tree.TreeRecord) error {
+		if !started {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			w.WriteHeader(200)
+			started = true
+		}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+		if n++; flusher != nil && n%1024 == 0 {
+			flusher.Flush()
+		}
+		return nil
+	})
+	if err != nil && !started {
+		writeTreeError(w, msg, err)
+	}
+	// 响应头已发出后出错（通常是客户端断开）只能终止输出
+}
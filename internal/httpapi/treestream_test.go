@@ -0,0 +1,76 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/memory"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestTreeStreamStatus 检查 format=ndjson 在输出第一条记录之前校验根 ID：无效的根返回 404 与 JSON 错误，而不是空的 200 流。
+func TestTreeStreamStatus(t *testing.T) {
+	store := memory.NewStore()
+	root, err := store.Emit(tree.EmitRequest{Type: "root"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Emit(tree.EmitRequest{Type: "child", Parents: []uint64{root.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	RegisterRoutes(mux, store)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		name, path string
+		status     int
+		records    int
+	}{
+		{"descendants", "/descendants/1?format=ndjson", 200, 2},
+		{"provenance", "/provenance/2?format=ndjson", 200, 2},
+		{"descendants of a missing root", "/descendants/99?format=ndjson", 404, 0},
+		{"provenance of a missing root", "/provenance/99?format=ndjson", 404, 0},
+		{"root above until_id", "/descendants/2?format=ndjson&until_id=1", 404, 0},
+		{"bad id", "/descendants/x?format=ndjson", 400, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			resp, err := http.Get(srv.URL + tc.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+			if resp.StatusCode != tc.status {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tc.status)
+			}
+			dec := json.NewDecoder(resp.Body)
+			if tc.status != 200 {
+				if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/json") {
+					t.Fatalf("content type = %q, want a JSON error", ct)
+				}
+				var e tree.ResponseError
+				if err := dec.Decode(&e); err != nil || e.Error == "" {
+					t.Fatalf("error body = %+v, %v", e, err)
+				}
+				return
+			}
+			var recs []tree.TreeRecord
+			for dec.More() {
+				var rec tree.TreeRecord
+				if err := dec.Decode(&rec); err != nil {
+					t.Fatal(err)
+				}
+				recs = append(recs, rec)
+			}
+			if len(recs) != tc.records {
+				t.Fatalf("got %d records %+v, want %d", len(recs), recs, tc.records)
+			}
+		})
+	}
+}
@@ -0,0 +1,516 @@
+package memory
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// 归档文件记录类型。
+const (
+	archiveRecordHeader byte = 1 // uvarint(root) | varint(archivedAt)
+	archiveRecordEvent  byte = 2 // appendEvent，payload 按整个文件的字典去重
+	archiveRecordEnd    byte = 3 // uvarint(events)
+)
+
+const (
+	archiveMagic      = "CTARCH01"
+	archiveSubdir     = "archive"
+	archiveFilePrefix = "tree-"
+	archiveFileSuffix = ".ctar.gz"
+)
+
+// archiveEntry 是一棵已归档根树在内存中的记录。
+// coldIDs 是归档时位于冷数据层的后代：冷数据段不可变，这些事件只是被隐藏，加载快照时需要重新隐藏。
+type archiveEntry struct {
+	stub    tree.ArchiveStub
+	coldIDs []uint64
+}
+
+// archivePath 返回根事件 root 对应的归档文件路径。
+func archivePath(dataDir string, root uint64) string {
+	return filepath.Join(dataDir, archiveSubdir, fmt.Sprintf("%s%020d%s", archiveFilePrefix, root, archiveFileSuffix))
+}
+
+// Archive 将以 rootID 为根的整棵树写入压缩归档文件，并把后代事件移出在线存储，根事件作为存根保留。
+func (s *Store) Archive(rootID uint64) (tree.ArchiveStub, error) {
+	if s.wal == nil {
+		return tree.ArchiveStub{}, ErrNotPersistent
+	}
+
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	return s.archive(rootID, nil)
+}
+
+// archive 归档一棵树（需持有 ckptMu）。keep 非空时先以整棵树的事件调用它，返回 true 则放弃归档。
+// 序列化与落盘在锁外完成，之后重新加锁确认树在此期间没有长出新的子事件。
+func (s *Store) archive(rootID uint64, keep func(events []tree.Event) bool) (tree.ArchiveStub, error) {
+	s.mu.RLock()
+	events, err := s.treeLocked(rootID)
+	if err != nil {
+		s.mu.RUnlock()
+		return tree.ArchiveStub{}, err
+	}
+	if keep != nil && keep(events) {
+		s.mu.RUnlock()
+		return tree.ArchiveStub{}, nil
+	}
+	edges := make([]int, len(events))
+	for i, ev := range events {
+		edges[i] = len(s.children[ev.ID])
+	}
+	s.mu.RUnlock()
+
+	stub := tree.ArchiveStub{
+		Root:        rootID,
+		Events:      len(events) - 1,
+		LastEventID: events[len(events)-1].ID,
+		ArchivedAt:  time.Now().Unix(),
+	}
+	path := archivePath(s.opts.DataDir, rootID)
+	if err := writeArchive(path, stub, events); err != nil {
+		return tree.ArchiveStub{}, fmt.Errorf("write archive: %w", err)
+	}
+
+	// 关闭提交闸门：已通过父事件校验、尚未发布的写入可能以树中的事件为父事件
+	s.commitGate.Lock()
+	defer s.commitGate.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// children 只会在末尾追加，长度不变即说明树没有变化
+	for i, ev := range events {
+		if len(s.children[ev.ID]) != edges[i] {
+			_ = os.Remove(path)
+			return tree.ArchiveStub{}, fmt.Errorf("tree %d changed during archival: %w", rootID, storage.ErrConflict)
+		}
+	}
+
+	ids := make([]uint64, 0, len(events)-1)
+	for _, ev := range events[1:] {
+		ids = append(ids, ev.ID)
+	}
+	// 大树的 ID 列表可能超过单条记录上限，按片段写入，回放时拼回一条记录
+	encode := func(body []byte, _ *payloadDict) []byte {
+		body = binary.AppendUvarint(body, stub.Root)
+		body = binary.AppendVarint(body, stub.ArchivedAt)
+		body = binary.AppendUvarint(body, stub.LastEventID)
+		return appendIDs(body, ids)
+	}
+	if err := s.wal.appendLarge(walRecordArchive, encode); err != nil {
+		_ = os.Remove(path)
+		return tree.ArchiveStub{}, fmt.Errorf("wal append failed: %w", err)
+	}
+
+	s.archiveLocked(stub, ids)
+	return stub, nil
+}
+
+// treeLocked 返回以 rootID 为根的整棵树（根事件在前，其余按 ID 升序），并确认它可以归档（需持有 s.mu）：
+// 树中每个事件的父事件都必须在树内。否则该事件同时属于另一棵根树，归档会让树外的事件失去父事件或子事件。
+func (s *Store) treeLocked(rootID uint64) ([]tree.Event, error) {
+	if !s.isEventIDValid(rootID) {
+		return nil, fmt.Errorf("event %d: %w", rootID, storage.ErrNotFound)
+	}
+	if _, ok := s.roots[rootID]; !ok {
+		return nil, fmt.Errorf("event %d is not a root: %w", rootID, storage.ErrConflict)
+	}
+	if _, ok := s.archived[rootID]; ok {
+		return nil, fmt.Errorf("tree %d is already archived: %w", rootID, storage.ErrConflict)
+	}
+
+	members := map[uint64]struct{}{rootID: {}}
+	queue := []uint64{rootID}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, c := range s.children[cur] {
+			if _, seen := members[c]; !seen {
+				members[c] = struct{}{}
+				queue = append(queue, c)
+			}
+		}
+	}
+	if len(members) == 1 {
+		return nil, fmt.Errorf("tree %d has no descendants to archive: %w", rootID, storage.ErrConflict)
+	}
+
+	ids := slices.Sorted(maps.Keys(members))
+	events := make([]tree.Event, 0, len(ids))
+	for _, id := range ids {
+		ev, ok := s.lookupLocked(id)
+		if !ok {
+			return nil, fmt.Errorf("event %d: %w", id, storage.ErrNotFound)
+		}
+		for _, p := range ev.Parents {
+			if _, in := members[p]; !in {
+				return nil, fmt.Errorf("event %d in tree %d has parent %d outside the tree: %w", id, rootID, p, storage.ErrConflict)
+			}
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+// archiveLocked 将已写入归档文件的后代事件移出在线存储，根事件变为存根（需持有 s.mu）。
+func (s *Store) archiveLocked(stub tree.ArchiveStub, ids []uint64) {
+	var coldIDs []uint64
+	for _, id := range ids {
+		switch {
+		case id >= s.hotBase:
+			if i, ok := s.hotIndex(id); ok {
+				if ev, ok := s.events.get(i); ok {
+					s.stats.removeEvent(ev)
+					s.byType.remove(s.types.ids[ev.Type])
+					s.forEachFieldValue(ev, (*fieldIndex).remove)
+					s.unindexTextLocked(ev)
+					s.residentOutLocked(ev, s.hotMemSize(ev))
+					s.events.clear(i)
+					s.hotCount--
+				}
+			}
+		case s.revived[id].ID != 0:
+			s.stats.removeEvent(s.revived[id])
+			s.byType.remove(s.types.ids[s.revived[id].Type])
+			s.forEachFieldValue(s.revived[id], (*fieldIndex).remove)
+			s.unindexTextLocked(s.revived[id])
+			s.residentOutLocked(s.revived[id], eventMemSize(s.revived[id]))
+			delete(s.revived, id)
+		case s.cold != nil && s.cold.has(id):
+			// 隐藏前读出事件以扣减统计与索引，读取失败时 lookupLocked 已记录日志
+			if ev, ok := s.lookupLocked(id); ok {
+				s.stats.removeEvent(ev)
+				s.byType.remove(s.types.ids[ev.Type])
+				s.forEachFieldValue(ev, (*fieldIndex).remove)
+				s.unindexTextLocked(ev)
+			}
+			s.cold.hide(id)
+			coldIDs = append(coldIDs, id)
+		}
+		s.stats.removeEdges(len(s.children[id]))
+		delete(s.children, id)
+		delete(s.heads, id)
+	}
+	s.stats.removeEdges(len(s.children[stub.Root]))
+	delete(s.children, stub.Root)
+	s.heads[stub.Root] = struct{}{}
+	s.archived[stub.Root] = archiveEntry{stub: stub, coldIDs: coldIDs}
+	s.byType.compact(s.isEventIDValid)
+	for _, x := range s.fields {
+		x.compact(s.isEventIDValid)
+	}
+	if s.text != nil {
+		s.text.compact(s.isEventIDValid)
+	}
+}
+
+// Rehydrate 从归档文件读回一棵已归档的树，重新放入在线存储并删除归档文件。
+func (s *Store) Rehydrate(rootID uint64) (tree.ArchiveStub, error) {
+	if s.wal == nil {
+		return tree.ArchiveStub{}, ErrNotPersistent
+	}
+
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	s.mu.RLock()
+	entry, ok := s.archived[rootID]
+	s.mu.RUnlock()
+	if !ok {
+		return tree.ArchiveStub{}, fmt.Errorf("tree %d is not archived: %w", rootID, storage.ErrNotFound)
+	}
+
+	path := archivePath(s.opts.DataDir, rootID)
+	events, err := readArchive(path, entry.stub)
+	if err != nil {
+		return tree.ArchiveStub{}, fmt.Errorf("read archive %s: %w", path, err)
+	}
+
+	// WAL 记录携带完整事件，回放时不依赖归档文件；大树超过单条记录上限时按片段写入
+	var buf []byte
+	encode := func(body []byte, dict *payloadDict) []byte {
+		body = binary.AppendUvarint(body, rootID)
+		body = binary.AppendUvarint(body, uint64(len(events)))
+		for _, ev := range events {
+			buf = appendEvent(buf[:0], ev, dict)
+			body = appendBytes(body, buf)
+		}
+		return body
+	}
+
+	// 恢复记录与 Emit 共用日志段字典，写出时不能有暂存的记录
+	s.commitGate.Lock()
+	defer s.commitGate.Unlock()
+	s.mu.Lock()
+	// 恢复的事件重新常驻内存，与写入一样先经过内存上限检查；归档时仍在冷数据段中的事件只是取消隐藏，不占内存
+	coldIDs := make(map[uint64]struct{}, len(entry.coldIDs))
+	for _, id := range entry.coldIDs {
+		coldIDs[id] = struct{}{}
+	}
+	var (
+		resident int
+		size     int64
+	)
+	for _, ev := range events {
+		switch _, cold := coldIDs[ev.ID]; {
+		case cold:
+		case ev.ID >= s.hotBase:
+			resident++
+			size += s.hotMemSize(ev) + int64(len(ev.Payload))
+		default:
+			resident++
+			size += eventMemSize(ev) + int64(len(ev.Payload))
+		}
+	}
+	if err := s.admitLocked(resident, size); err != nil {
+		s.mu.Unlock()
+		return tree.ArchiveStub{}, err
+	}
+	if err := s.wal.appendLarge(walRecordRehydrate, encode); err != nil {
+		s.mu.Unlock()
+		return tree.ArchiveStub{}, fmt.Errorf("wal append failed: %w", err)
+	}
+	s.rehydrateLocked(rootID, events)
+	s.mu.Unlock()
+
+	if err := os.Remove(path); err != nil {
+		log.Printf("archive: remove %s: %v", path, err)
+	}
+	return entry.stub, nil
+}
+
+// rehydrateLocked 将归档的后代事件按 ID 升序放回 DAG（需持有 s.mu）。
+func (s *Store) rehydrateLocked(rootID uint64, events []tree.Event) {
+	delete(s.archived, rootID)
+	for _, ev := range events {
+		ev.Type = s.internType(ev.Type)
+		s.applyLocked(ev, indexKeys{})
+	}
+	s.byType.settle()
+	for _, x := range s.fields {
+		x.settle()
+	}
+	if s.text != nil {
+		s.text.settle()
+	}
+}
+
+// Archives 返回所有已归档树的存根（按根 ID 升序）。
+func (s *Store) Archives() []tree.ArchiveStub {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]tree.ArchiveStub, 0, len(s.archived))
+	for _, root := range slices.Sorted(maps.Keys(s.archived)) {
+		out = append(out, s.archived[root].stub)
+	}
+	return out
+}
+
+// enforceRetention 按保留策略从最旧的根树开始归档，返回本次归档的树数量。
+// 超过 RetainEvents 时依次归档最旧的树；RetainAge 只归档最新事件也早于该时长的树。与外部相连的树会被跳过。
+func (s *Store) enforceRetention() int {
+	if s.opts.RetainAge <= 0 && s.opts.RetainEvents <= 0 {
+		return 0
+	}
+
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	s.mu.RLock()
+	roots := slices.Sorted(maps.Keys(s.roots))
+	s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-s.opts.RetainAge).UnixNano()
+	archived := 0
+	for _, root := range roots {
+		s.mu.RLock()
+		overCount := s.opts.RetainEvents > 0 && s.liveEventsLocked() > s.opts.RetainEvents
+		rootEv, _ := s.lookupLocked(root)
+		s.mu.RUnlock()
+
+		// 根事件按 ID 递增，时间也大致递增：根事件都不够旧时后面的树更不会满足年龄条件
+		if !overCount && (s.opts.RetainAge <= 0 || rootEv.TimeUnixNano >= cutoff) {
+			break
+		}
+
+		stub, err := s.archive(root, func(events []tree.Event) bool {
+			if overCount {
+				return false
+			}
+			for _, ev := range events {
+				if ev.TimeUnixNano >= cutoff {
+					return true
+				}
+			}
+			return false
+		})
+		switch {
+		case errors.Is(err, storage.ErrConflict) || errors.Is(err, storage.ErrNotFound):
+			continue
+		case err != nil:
+			log.Printf("retention: archive tree %d: %v", root, err)
+			return archived
+		case stub.Root != 0:
+			archived++
+		}
+	}
+	return archived
+}
+
+// liveEventsLocked 返回在线存储中的事件总数（热数据、恢复事件与未隐藏的冷事件）。
+func (s *Store) liveEventsLocked() int {
+	n := s.hotCount + len(s.revived)
+	if s.cold != nil {
+		cold, _ := s.cold.stats()
+		n += cold
+	}
+	return n
+}
+
+// writeArchive 将整棵树写成 gzip 压缩的归档文件，fsync 后原子 rename 到位。
+func writeArchive(path string, stub tree.ArchiveStub, events []tree.Event) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	zw := gzip.NewWriter(f)
+	bw := bufio.NewWriterSize(zw, 1<<20)
+	var rec, body []byte
+	dict := newPayloadDict()
+	emit := func(kind byte) {
+		rec = appendRecord(rec[:0], kind, body)
+		_, _ = bw.Write(rec)
+	}
+
+	_, _ = bw.WriteString(archiveMagic)
+	body = binary.AppendUvarint(body[:0], stub.Root)
+	body = binary.AppendVarint(body, stub.ArchivedAt)
+	emit(archiveRecordHeader)
+	for _, ev := range events {
+		body = appendEvent(body[:0], ev, dict)
+		emit(archiveRecordEvent)
+	}
+	body = binary.AppendUvarint(body[:0], uint64(len(events)))
+	emit(archiveRecordEnd)
+
+	err = bw.Flush()
+	if cerr := zw.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// readArchive 读取并校验归档文件，返回根事件之外的全部后代事件（ID 升序）。
+func readArchive(path string, stub tree.ArchiveStub) ([]tree.Event, error) {
+	root, events, err := readArchiveFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if root != stub.Root {
+		return nil, fmt.Errorf("archive is for tree %d, want %d", root, stub.Root)
+	}
+	if len(events) != stub.Events+1 || events[0].ID != stub.Root {
+		return nil, fmt.Errorf("archive does not match stub of tree %d", stub.Root)
+	}
+	return events[1:], nil
+}
+
+// readArchiveFile 读取归档文件并校验魔数、每条记录的校验和以及头/尾记录，返回根 ID 与整棵树的事件（根事件在前）。
+func readArchiveFile(path string) (uint64, []tree.Event, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer f.Close()
+
+	zr, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer zr.Close()
+
+	br := bufio.NewReaderSize(zr, 1<<20)
+	magic := make([]byte, len(archiveMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != archiveMagic {
+		return 0, nil, fmt.Errorf("bad archive magic")
+	}
+
+	var (
+		root   uint64
+		events []tree.Event
+		header bool
+		ended  bool
+		dict   = newPayloadDict()
+	)
+	_, err = readRecords(br, func(kind byte, body []byte) error {
+		if ended {
+			return fmt.Errorf("record after end")
+		}
+		d := decoder{buf: body}
+		switch kind {
+		case archiveRecordHeader:
+			root = d.uvarint()
+			header = true
+		case archiveRecordEvent:
+			if !header {
+				return fmt.Errorf("missing header")
+			}
+			ev, _, err := decodeEvent(body, dict)
+			if err != nil {
+				return err
+			}
+			events = append(events, ev)
+		case archiveRecordEnd:
+			if n := d.uvarint(); d.err == nil && n != uint64(len(events)) {
+				return fmt.Errorf("event count mismatch: end=%d read=%d", n, len(events))
+			}
+			ended = true
+		default:
+			return fmt.Errorf("unknown archive record kind %d", kind)
+		}
+		return d.err
+	})
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ended {
+		return 0, nil, fmt.Errorf("missing end record")
+	}
+	if len(events) == 0 || events[0].ID != root {
+		return 0, nil, fmt.Errorf("archive does not start with root %d", root)
+	}
+	return root, events, nil
+}
@@ -0,0 +1,270 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// treeMembers 返回 ids 中属于以 root 为根的树的事件（含根）。
+func treeMembers(t *testing.T, s *Store, ids []uint64, root uint64) []uint64 {
+	t.Helper()
+	var out []uint64
+	for _, id := range ids {
+		anc, _ := s.Ancestors(id)
+		if id == root || slices.Contains(anc, root) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// checkArchived 检查 members 所在的树处于归档状态：根事件是带存根的事件，后代事件不可读也不能作为父事件，
+// 其余事件不受影响，在线事件数扣除了后代事件。
+func checkArchived(t *testing.T, s *Store, want dagView, ids, members []uint64, stub tree.ArchiveStub) {
+	t.Helper()
+	for i, id := range ids {
+		ev, ok := s.Get(id)
+		switch {
+		case id == stub.Root:
+			if !ok || ev.Archived == nil || *ev.Archived != stub {
+				t.Fatalf("root %d: %+v, %v, want a stub %+v", id, ev, ok, stub)
+			}
+		case slices.Contains(members, id):
+			if ok {
+				t.Fatalf("archived event %d is still readable", id)
+			}
+		case !ok || !reflect.DeepEqual(ev, want.events[i]):
+			t.Fatalf("event %d outside the tree changed: %+v, %v", id, ev, ok)
+		}
+	}
+	if got := s.Archives(); !reflect.DeepEqual(got, []tree.ArchiveStub{stub}) {
+		t.Fatalf("archives = %+v, want %+v", got, stub)
+	}
+	if got := s.Snapshot().TotalEvents; got != len(ids)-stub.Events {
+		t.Fatalf("total events = %d, want %d", got, len(ids)-stub.Events)
+	}
+	var emitErr *tree.EmitError
+	if _, err := s.Emit(tree.EmitRequest{Type: "x", Parents: []uint64{members[1]}}); !errors.As(err, &emitErr) {
+		t.Fatalf("emit under an archived event: %v, want *tree.EmitError", err)
+	}
+	if rep, err := s.Verify(); err != nil || !rep.OK {
+		t.Fatalf("verify: %+v, %v", rep, err)
+	}
+}
+
+// TestArchiveRehydrate 检查归档与恢复一棵树（全部在内存中、部分已降冷、紧凑布局），
+// 归档状态在快照或 WAL 回放后保持不变，恢复后读取结果与归档前完全相同并在重新打开后保持。
+func TestArchiveRehydrate(t *testing.T) {
+	cases := []struct {
+		name       string
+		opts       Options
+		demote     bool // 归档前写快照，使树的前半部分位于冷数据段
+		checkpoint bool // 归档后写快照，重新打开时从快照而不是 WAL 得到归档状态
+	}{
+		{name: "hot, replayed from the wal", opts: Options{}},
+		{name: "hot, loaded from a checkpoint", opts: Options{}, checkpoint: true},
+		{name: "partly cold, replayed from the wal", opts: Options{HotWindow: 30}, demote: true},
+		{name: "partly cold, loaded from a checkpoint", opts: Options{HotWindow: 30}, demote: true, checkpoint: true},
+		{name: "compact layout", opts: Options{Layout: LayoutCompact, PayloadCompressMin: 1}, checkpoint: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.DataDir, opts.Sync = t.TempDir(), SyncNever
+			s := mustOpen(t, opts)
+			ids, roots := buildLayers(t, s, 2, 6, 4, nil)
+			want := readDAG(t, s, ids, roots)
+			members := treeMembers(t, s, ids, roots[0])
+			if tc.demote {
+				if _, err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+				if s.Snapshot().ColdEvents == 0 {
+					t.Fatal("nothing was demoted")
+				}
+			}
+
+			stub, err := s.Archive(roots[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if stub.Root != roots[0] || stub.Events != len(members)-1 || stub.LastEventID != members[len(members)-1] {
+				t.Fatalf("stub = %+v, want %d events up to %d", stub, len(members)-1, members[len(members)-1])
+			}
+			path := archivePath(opts.DataDir, roots[0])
+			if _, err := os.Stat(path); err != nil {
+				t.Fatal(err)
+			}
+			checkArchived(t, s, want, ids, members, stub)
+
+			if tc.checkpoint {
+				if _, err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = mustOpen(t, opts)
+			checkArchived(t, s, want, ids, members, stub)
+
+			if got, err := s.Rehydrate(roots[0]); err != nil || got != stub {
+				t.Fatalf("rehydrate = %+v, %v, want %+v", got, err, stub)
+			}
+			if _, err := os.Stat(path); !errors.Is(err, os.ErrNotExist) {
+				t.Fatalf("archive file after rehydrate: %v", err)
+			}
+			if got := readDAG(t, s, ids, roots); !reflect.DeepEqual(got, want) {
+				t.Fatal("reads after rehydrate differ from reads before archival")
+			}
+			if len(s.Archives()) != 0 {
+				t.Fatalf("archives after rehydrate = %+v", s.Archives())
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = mustOpen(t, opts)
+			if got := readDAG(t, s, ids, roots); !reflect.DeepEqual(got, want) {
+				t.Fatal("reads after reopening a rehydrated tree differ from reads before archival")
+			}
+			if rep, err := s.Verify(); err != nil || !rep.OK {
+				t.Fatalf("verify: %+v, %v", rep, err)
+			}
+		})
+	}
+}
+
+// TestArchiveErrors 检查不能归档或恢复的情况返回的错误类别。
+func TestArchiveErrors(t *testing.T) {
+	s := mustOpen(t, Options{DataDir: t.TempDir(), Sync: SyncNever})
+	a := mustEmit(t, s, "root", "")
+	b := mustEmit(t, s, "root", "")
+	aChild := mustEmit(t, s, "node", "", a)
+	mustEmit(t, s, "bridge", "", aChild, b)
+	lone := mustEmit(t, s, "root", "")
+	c := mustEmit(t, s, "root", "")
+	mustEmit(t, s, "node", "", c)
+	if _, err := s.Archive(c); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name string
+		call func() error
+		want error
+	}{
+		{"missing root", func() error { _, err := s.Archive(999); return err }, storage.ErrNotFound},
+		{"not a root", func() error { _, err := s.Archive(aChild); return err }, storage.ErrConflict},
+		{"no descendants", func() error { _, err := s.Archive(lone); return err }, storage.ErrConflict},
+		{"shared with another tree", func() error { _, err := s.Archive(a); return err }, storage.ErrConflict},
+		{"already archived", func() error { _, err := s.Archive(c); return err }, storage.ErrConflict},
+		{"rehydrate a live tree", func() error { _, err := s.Rehydrate(a); return err }, storage.ErrNotFound},
+		{"memory-only archive", func() error { _, err := NewStore().Archive(1); return err }, ErrNotPersistent},
+		{"memory-only rehydrate", func() error { _, err := NewStore().Rehydrate(1); return err }, ErrNotPersistent},
+	}
+	for _, tc := range cases {
+		if err := tc.call(); !errors.Is(err, tc.want) {
+			t.Errorf("%s: err = %v, want %v", tc.name, err, tc.want)
+		}
+	}
+}
+
+// TestRetention 检查保留策略从最旧的树开始归档、跳过与其他树相连的树，只按年龄归档时保留仍有新事件的树，
+// 归档结果在重新打开后保持，再次执行不会继续归档。
+func TestRetention(t *testing.T) {
+	const perTree = 1 + 3*2 // buildLayers(1, 3, 2)
+
+	cases := []struct {
+		name string
+		opts Options
+		// build 写入若干树，返回全部根（按 ID 升序）
+		build func(t *testing.T, s *Store) []uint64
+		want  []int // 应被归档的树在 build 返回值中的下标
+	}{
+		{
+			name: "event limit skips connected trees",
+			opts: Options{RetainEvents: 4 * perTree},
+			build: func(t *testing.T, s *Store) []uint64 {
+				var roots []uint64
+				for range 5 {
+					_, r := buildLayers(t, s, 1, 3, 2, nil)
+					roots = append(roots, r[0])
+				}
+				// 最旧的两棵树由一个事件相连，两棵都不能单独归档
+				ka, _ := s.Children(roots[0])
+				kb, _ := s.Children(roots[1])
+				mustEmit(t, s, "bridge", "", ka[0], kb[0])
+				return roots
+			},
+			// 超出的 perTree+1 个事件需要归档第 3、4 棵树的后代才能抵扣
+			want: []int{2, 3},
+		},
+		{
+			name: "age keeps trees with recent events",
+			opts: Options{RetainAge: time.Second},
+			build: func(t *testing.T, s *Store) []uint64 {
+				var roots []uint64
+				for range 3 {
+					_, r := buildLayers(t, s, 1, 3, 2, nil)
+					roots = append(roots, r[0])
+				}
+				time.Sleep(time.Second + 50*time.Millisecond)
+				mustEmit(t, s, "late", "", roots[1])
+				_, r := buildLayers(t, s, 1, 3, 2, nil)
+				return append(roots, r[0])
+			},
+			want: []int{0, 2},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.DataDir, opts.Sync = t.TempDir(), SyncNever
+			s := mustOpen(t, opts)
+			roots := tc.build(t, s)
+
+			if n := s.enforceRetention(); n != len(tc.want) {
+				t.Fatalf("archived %d trees, want %d", n, len(tc.want))
+			}
+			var want []uint64
+			for _, i := range tc.want {
+				want = append(want, roots[i])
+			}
+			check := func() {
+				t.Helper()
+				var got []uint64
+				for _, stub := range s.Archives() {
+					got = append(got, stub.Root)
+				}
+				if !slices.Equal(got, want) {
+					t.Fatalf("archived roots = %v, want %v", got, want)
+				}
+				if rep, err := s.Verify(); err != nil || !rep.OK {
+					t.Fatalf("verify: %+v, %v", rep, err)
+				}
+			}
+			check()
+			live := s.Snapshot().TotalEvents
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = mustOpen(t, opts)
+			check()
+			if n := s.enforceRetention(); n != 0 {
+				t.Fatalf("archived %d more trees after reopen", n)
+			}
+			if got := s.Snapshot().TotalEvents; got != live {
+				t.Fatalf("total events after reopen = %d, want %d", got, live)
+			}
+		})
+	}
+}
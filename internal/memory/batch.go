@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"encoding/binary"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// maxBatchItems 是一批事件的最大条数。
+const maxBatchItems = 10000
+
+// EmitBatch 以一次提交写入一批事件：校验、内存上限检查与 WAL 都以整批为单位，要么全部成功，要么不留下任何状态。
+// 各项的 LocalParents 按下标引用同一批中更早的项，分配 ID 后换算为对应的事件 ID。
+func (s *Store) EmitBatch(items []tree.BatchEmitItem) ([]tree.Event, error) {
+	if len(items) == 0 {
+		return nil, emitErrorf("batch is empty")
+	}
+	if len(items) > maxBatchItems {
+		return nil, emitErrorf("batch too large: %d items, max %d", len(items), maxBatchItems)
+	}
+
+	// 锁外完成与现有事件无关的校验、payload 压缩与索引键的提取
+	events := make([]tree.Event, len(items))
+	keys := make([]indexKeys, len(items))
+	local := make([][]int, len(items))
+	var size int64
+	encoded := binary.MaxVarintLen64 // 整批写成一条 WAL 记录，按编码上界检查记录大小
+	for i, it := range items {
+		if strings.TrimSpace(it.Type) == "" {
+			return nil, emitErrorf("item %d: type is required", i)
+		}
+		seen := make(map[int]struct{}, len(it.LocalParents))
+		for _, j := range it.LocalParents {
+			if j < 0 || j >= i {
+				return nil, emitErrorf("item %d: local parent %d must refer to an earlier item", i, j)
+			}
+			if _, dup := seen[j]; dup {
+				continue
+			}
+			seen[j] = struct{}{}
+			local[i] = append(local[i], j)
+		}
+		events[i] = tree.Event{
+			Message: it.Message,
+			Payload: s.compressPayload(it.Payload),
+			Parents: normalizeParents(it.Parents),
+		}
+		keys[i] = s.indexKeysOf(it.Payload, it.Message)
+		size += s.hotMemSize(events[i]) + int64(len(local[i]))*16 + int64(len(events[i].Payload))
+		encoded += binary.MaxVarintLen64 + eventSizeBound(events[i]) + len(it.Type) + len(local[i])*binary.MaxVarintLen64
+		if encoded > maxRecordBody {
+			return nil, emitErrorf("batch too large: item %d exceeds %d encoded bytes", i, maxRecordBody)
+		}
+	}
+
+	s.commitGate.RLock()
+	defer s.commitGate.RUnlock()
+	s.mu.Lock()
+
+	// 外部父事件必须已经存在；批内的事件只能经 LocalParents 引用
+	for i, ev := range events {
+		for _, p := range ev.Parents {
+			if !s.isEventIDValid(p) {
+				s.mu.Unlock()
+				return nil, emitErrorf("item %d: parent %d not found", i, p)
+			}
+		}
+	}
+	if err := s.admitLocked(len(events), size); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+
+	// 与 Emit 相同：校验全部通过后才分配 ID，整批 ID 连续，共用同一个时间戳
+	base := s.nextID + uint64(s.reserved) + 1
+	now := time.Now().UnixNano()
+	for i := range events {
+		ev := &events[i]
+		ev.ID = base + uint64(i)
+		ev.TimeUnixNano = now
+		ev.Type = s.internType(items[i].Type)
+		for _, j := range local[i] {
+			ev.Parents = append(ev.Parents, base+uint64(j))
+		}
+	}
+
+	// 返回值与广播使用原始 payload
+	out := make([]tree.Event, len(events))
+	for i, ev := range events {
+		out[i] = ev
+		out[i].Payload = items[i].Payload
+	}
+
+	// 整批写成一条 WAL 记录：崩溃后要么整批回放，要么整批丢弃
+	var buf []byte
+	encode := func(body []byte, dict *payloadDict) []byte {
+		body = binary.AppendUvarint(body, uint64(len(events)))
+		for _, ev := range events {
+			buf = appendEvent(buf[:0], ev, dict)
+			body = appendBytes(body, buf)
+		}
+		return body
+	}
+	if err := s.commitLocked(len(events), size, walRecordBatch, encode, func() {
+		for i, ev := range events {
+			s.applyLocked(ev, keys[i])
+		}
+		atomic.StoreUint64(&s.nextID, base+uint64(len(events))-1)
+		s.rate.add(time.Unix(0, now), len(events))
+		// 广播在锁内按 ID 顺序进行
+		for _, ev := range out {
+			s.broadcast(ev)
+		}
+	}); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
@@ -0,0 +1,178 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestEmitBatchFanOut 写入一个扇出 500 个任务再汇合的子 DAG：ID 连续，LocalParents 换算为批内事件的 ID，
+// 订阅者按 ID 顺序收到整批事件，重新打开后内容不变。
+func TestEmitBatchFanOut(t *testing.T) {
+	const fan = 500
+	opts := Options{DataDir: t.TempDir(), Sync: SyncNever}
+	s := mustOpen(t, opts)
+	root := mustEmit(t, s, "workflow", "")
+	_, sub, cancel := s.Subscribe()
+	received := make(chan []uint64)
+	go func() {
+		var ids []uint64
+		for ev := range sub {
+			ids = append(ids, ev.ID)
+		}
+		received <- ids
+	}()
+
+	items := []tree.BatchEmitItem{{EmitRequest: tree.EmitRequest{Type: "plan", Parents: []uint64{root}}}}
+	join := tree.BatchEmitItem{EmitRequest: tree.EmitRequest{Type: "join"}}
+	for i := range fan {
+		items = append(items, tree.BatchEmitItem{
+			EmitRequest:  tree.EmitRequest{Type: "task", Payload: json.RawMessage(fmt.Sprintf(`{"i":%d}`, i))},
+			LocalParents: []int{0, 0}, // 重复的下标只算一次
+		})
+		join.LocalParents = append(join.LocalParents, i+1)
+	}
+	items = append(items, join)
+
+	events, err := s.EmitBatch(items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(items) {
+		t.Fatalf("got %d events for %d items", len(events), len(items))
+	}
+	for i, ev := range events {
+		if ev.ID != root+1+uint64(i) || ev.TimeUnixNano != events[0].TimeUnixNano {
+			t.Fatalf("item %d: id %d at %d, want id %d at the batch time", i, ev.ID, ev.TimeUnixNano, root+1+uint64(i))
+		}
+	}
+	// 订阅者跟不上时会丢弃事件，收到的部分必须按 ID 升序且来自这一批
+	cancel()
+	got := <-received
+	if !slices.IsSorted(got) || len(got) > 0 && (got[0] < events[0].ID || got[len(got)-1] > events[len(events)-1].ID) {
+		t.Fatalf("subscriber got ids %v, want ascending ids from the batch", got)
+	}
+	if dropped := s.Snapshot().SSEDropped; len(got)+int(dropped) != len(events) {
+		t.Fatalf("subscriber got %d events and %d were dropped, want %d in total", len(got), dropped, len(events))
+	}
+	plan, last := events[0].ID, events[len(events)-1]
+	if len(last.Parents) != fan || last.Parents[0] != plan+1 || last.Parents[fan-1] != plan+fan {
+		t.Fatalf("join parents = %d ids from %d, want %d..%d", len(last.Parents), last.Parents[0], plan+1, plan+fan)
+	}
+
+	check := func(stage string) {
+		t.Helper()
+		if got, _ := s.Children(plan); len(got) != fan {
+			t.Fatalf("%s: plan has %d children, want %d", stage, len(got), fan)
+		}
+		if heads := s.Heads(); !slices.Equal(heads, []uint64{last.ID}) {
+			t.Fatalf("%s: heads = %v, want [%d]", stage, heads, last.ID)
+		}
+		for _, ev := range events {
+			if got, ok := s.Get(ev.ID); !ok || !reflect.DeepEqual(got, ev) {
+				t.Fatalf("%s: Get(%d) = %+v, %v, want %+v", stage, ev.ID, got, ok, ev)
+			}
+		}
+	}
+	check("after emit")
+	s.Close()
+	s = mustOpen(t, opts)
+	check("after reopen")
+}
+
+// TestEmitBatchAllOrNothing 检查被拒绝的批次（请求无效、超出条数或记录大小上限、WAL 写入失败）不分配 ID、
+// 不通知订阅者、不改变 DAG，重新打开后也没有任何一项。
+func TestEmitBatchAllOrNothing(t *testing.T) {
+	item := func(typ string, local ...int) tree.BatchEmitItem {
+		return tree.BatchEmitItem{EmitRequest: tree.EmitRequest{Type: typ}, LocalParents: local}
+	}
+	// 单个 payload 不超过记录上限，整批的编码超过
+	big := json.RawMessage(`"` + strings.Repeat("x", maxRecordBody/4) + `"`)
+
+	cases := []struct {
+		name    string
+		items   func(root uint64) []tree.BatchEmitItem
+		broken  bool // 把 WAL 换成只读句柄
+		emitErr bool // 错误是 *tree.EmitError（请求无效），否则是服务端故障
+	}{
+		{name: "empty", items: func(uint64) []tree.BatchEmitItem { return nil }, emitErr: true},
+		{name: "too many items", items: func(uint64) []tree.BatchEmitItem {
+			return slices.Repeat([]tree.BatchEmitItem{item("x")}, maxBatchItems+1)
+		}, emitErr: true},
+		{name: "record too large", items: func(uint64) []tree.BatchEmitItem {
+			its := make([]tree.BatchEmitItem, 5)
+			for i := range its {
+				its[i] = tree.BatchEmitItem{EmitRequest: tree.EmitRequest{Type: "blob", Payload: big}}
+			}
+			return its
+		}, emitErr: true},
+		{name: "forward local parent", items: func(uint64) []tree.BatchEmitItem { return []tree.BatchEmitItem{item("a"), item("b", 2), item("c")} }, emitErr: true},
+		{name: "self local parent", items: func(uint64) []tree.BatchEmitItem { return []tree.BatchEmitItem{item("a"), item("b", 1)} }, emitErr: true},
+		{name: "negative local parent", items: func(uint64) []tree.BatchEmitItem { return []tree.BatchEmitItem{item("a"), item("b", -1)} }, emitErr: true},
+		{name: "missing type in a later item", items: func(uint64) []tree.BatchEmitItem { return []tree.BatchEmitItem{item("a"), item("b", 0), item(" ", 1)} }, emitErr: true},
+		{name: "missing parent in a later item", items: func(root uint64) []tree.BatchEmitItem {
+			last := item("c", 1)
+			last.Parents = []uint64{root, root + 100}
+			return []tree.BatchEmitItem{item("a"), item("b", 0), last}
+		}, emitErr: true},
+		{name: "wal failure", items: func(root uint64) []tree.BatchEmitItem {
+			first := item("a")
+			first.Parents = []uint64{root}
+			return []tree.BatchEmitItem{first, item("b", 0)}
+		}, broken: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{DataDir: t.TempDir(), Sync: SyncNever}
+			s, err := Open(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := mustEmit(t, s, "root", "")
+			_, sub, cancel := s.Subscribe()
+			if tc.broken {
+				ro, err := os.Open(s.wal.f.Name())
+				if err != nil {
+					t.Fatal(err)
+				}
+				s.wal.f.Close()
+				s.wal.f = ro
+			}
+
+			_, err = s.EmitBatch(tc.items(root))
+			var emitErr *tree.EmitError
+			if err == nil || errors.As(err, &emitErr) != tc.emitErr {
+				t.Fatalf("err = %v, want EmitError %v", err, tc.emitErr)
+			}
+			cancel()
+			if ev, ok := <-sub; ok {
+				t.Fatalf("subscriber got event %d from a rejected batch", ev.ID)
+			}
+			check := func(stage string) {
+				t.Helper()
+				snap := s.Snapshot()
+				if snap.NextEventID != root || snap.TotalEvents != 1 {
+					t.Fatalf("%s: next id %d with %d events, want %d and 1", stage, snap.NextEventID, snap.TotalEvents, root)
+				}
+				if kids, _ := s.Children(root); len(kids) != 0 {
+					t.Fatalf("%s: root has children %v", stage, kids)
+				}
+			}
+			check("after the rejected batch")
+			s.Close()
+
+			s = mustOpen(t, opts)
+			check("after reopen")
+			if id := mustEmit(t, s, "ok", "", root); id != root+1 {
+				t.Fatalf("next id after the rejected batch = %d, want %d", id, root+1)
+			}
+		})
+	}
+}
@@ -0,0 +1,194 @@
+package memory
+
+import (
+	"fmt"
+	"log"
+	"unsafe"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// LimitPolicy 决定常驻内存的事件达到 MaxEvents / MaxMemoryBytes 上限时的行为。
+type LimitPolicy int
+
+const (
+	LimitReject LimitPolicy = iota // 拒绝新的写入，返回 storage.ErrCapacity（默认）
+	LimitSpill                     // 接受写入，并触发一次快照把最旧的热事件移入冷数据层（需要 DataDir）
+)
+
+const (
+	softLimitRatio  = 0.9 // 内存占用超过上限的该比例时在 Snapshot 中告警；LimitSpill 下同时开始降冷
+	spillTargetRate = 0.8 // LimitSpill 降冷的目标：把内存占用降到上限的该比例以下
+)
+
+// 索引内存估算中各类 map 项的固定开销（键、值与桶的摊销）。
+const (
+	setEntryBytes   = 16  // heads / roots：uint64 -> struct{}
+	childEntryBytes = 48  // children：uint64 -> []uint64 的切片头，列表中的 ID 已由 eventMemSize 按父事件计入
+	dedupEntryBytes = 112 // payload 去重表：SHA-256 键、*sharedPayload 及其指向的结构
+)
+
+// ParseLimitPolicy 将 "reject" / "spill" 解析为 LimitPolicy。
+func ParseLimitPolicy(s string) (LimitPolicy, error) {
+	switch s {
+	case "", "reject":
+		return LimitReject, nil
+	case "spill":
+		return LimitSpill, nil
+	default:
+		return 0, fmt.Errorf("unknown limit policy: %s", s)
+	}
+}
+
+func (p LimitPolicy) String() string {
+	if p == LimitSpill {
+		return "spill"
+	}
+	return "reject"
+}
+
+// eventMemSize 估算一个常驻内存事件除 payload 之外占用的字节数：事件结构本身、Message、Parents，
+// 以及父事件 children 列表中的对应项。payload 按压缩、去重后的实际占用单独统计（payloadStored）。
+func eventMemSize(ev tree.Event) int64 {
+	return int64(unsafe.Sizeof(ev)) + int64(len(ev.Message)) + int64(len(ev.Parents))*16
+}
+
+// residentInLocked 在事件进入内存（热数据或恢复事件）时调用：共享去重后的 payload，并把 size 计入内存占用（需持有 s.mu）。
+// size 按事件所在的存储估算：热数据用 hotMemSize，恢复事件用 eventMemSize。
+func (s *Store) residentInLocked(ev *tree.Event, size int64) {
+	ev.Payload = s.retainPayloadLocked(ev.Payload)
+	s.eventBytes += size
+}
+
+// residentOutLocked 在事件离开内存（降冷或归档）时调用，size 与进入时相同（需持有 s.mu）。
+func (s *Store) residentOutLocked(ev tree.Event, size int64) {
+	s.releasePayloadLocked(ev.Payload)
+	s.eventBytes -= size
+}
+
+// memBytesLocked 返回内存占用的估算：常驻内存事件（含 payload）加上各类索引（需持有 s.mu）。
+func (s *Store) memBytesLocked() int64 {
+	return s.eventBytes + s.payloadStored + s.indexMemBytesLocked()
+}
+
+// indexMemBytesLocked 估算事件本体之外的内存：children、heads/roots、可达性标签、类型/时间/字段/全文索引，
+// 以及 payload 去重表（需持有 s.mu）。除去重表外，这些结构都不随降冷释放。只用增量维护的计数，耗时与事件数无关。
+func (s *Store) indexMemBytesLocked() int64 {
+	n := int64(len(s.children))*childEntryBytes + int64(len(s.heads)+len(s.roots))*setEntryBytes
+	n += int64(len(s.payloads)) * dedupEntryBytes
+	n += s.reach.memBytes() + s.byType.memBytes() + s.byTime.memBytes()
+	for _, x := range s.fields {
+		n += x.memBytes()
+	}
+	if s.text != nil {
+		n += s.text.memBytes()
+	}
+	return n
+}
+
+// limited 报告是否配置了内存上限。
+func (s *Store) limited() bool {
+	return s.opts.MaxEvents > 0 || s.opts.MaxMemoryBytes > 0
+}
+
+// spilling 报告达到上限时是否降冷而不是拒绝写入。
+func (s *Store) spilling() bool {
+	return s.limited() && s.opts.OnLimit == LimitSpill && s.wal != nil
+}
+
+// admitLocked 在写入 n 个、估算共 size 字节的事件之前检查内存上限（需持有 s.mu），等待组提交的事件一并计入。
+// LimitReject 下超出上限返回包装 storage.ErrCapacity 的错误；LimitSpill 下总是接受，越过软限制时通知后台降冷。
+func (s *Store) admitLocked(n int, size int64) error {
+	if !s.limited() {
+		return nil
+	}
+	n += s.reserved
+	size += s.reservedBytes
+	events, bytes := s.hotCount+len(s.revived)+n, s.memBytesLocked()+size
+
+	if s.spilling() {
+		if s.overLimit(events, bytes, softLimitRatio) {
+			select {
+			case s.spillCh <- struct{}{}:
+			default:
+			}
+		}
+		return nil
+	}
+
+	switch {
+	case s.opts.MaxEvents > 0 && events > s.opts.MaxEvents:
+		s.rejected++
+		return fmt.Errorf("memory limit reached: %d events in memory, max %d: %w", events-n, s.opts.MaxEvents, storage.ErrCapacity)
+	case s.opts.MaxMemoryBytes > 0 && bytes > s.opts.MaxMemoryBytes:
+		s.rejected++
+		return fmt.Errorf("memory limit reached: %d bytes in memory, max %d: %w", bytes-size, s.opts.MaxMemoryBytes, storage.ErrCapacity)
+	}
+	return nil
+}
+
+// overLimit 报告内存占用是否超过上限的 ratio 倍。
+func (s *Store) overLimit(events int, bytes int64, ratio float64) bool {
+	return (s.opts.MaxEvents > 0 && float64(events) > ratio*float64(s.opts.MaxEvents)) ||
+		(s.opts.MaxMemoryBytes > 0 && float64(bytes) > ratio*float64(s.opts.MaxMemoryBytes))
+}
+
+// limitWarningsLocked 返回软限制告警（需持有 s.mu）。
+func (s *Store) limitWarningsLocked() []string {
+	var out []string
+	events, bytes := s.hotCount+len(s.revived), s.memBytesLocked()
+	if limit := s.opts.MaxEvents; limit > 0 && float64(events) > softLimitRatio*float64(limit) {
+		out = append(out, fmt.Sprintf("%d events in memory, %.0f%% of max_events %d (on limit: %s)", events, 100*float64(events)/float64(limit), limit, s.opts.OnLimit))
+	}
+	if limit := s.opts.MaxMemoryBytes; limit > 0 && float64(bytes) > softLimitRatio*float64(limit) {
+		out = append(out, fmt.Sprintf("%d bytes in memory, %.0f%% of max_memory_bytes %d (on limit: %s)", bytes, 100*float64(bytes)/float64(limit), limit, s.opts.OnLimit))
+	}
+	return out
+}
+
+// budgetWatermarkLocked 返回 LimitSpill 下使内存占用回到 spillTargetRate 以下所需的冷水位线（需持有 s.mu）。
+// 从最旧的热事件开始累计可释放的事件数与字节数；共享的 payload 未必随之释放，不足部分留待下一次降冷。
+// 索引不随降冷释放：索引本身已超过目标时，全部热事件都会被移入冷数据层。
+func (s *Store) budgetWatermarkLocked() uint64 {
+	if !s.spilling() {
+		return s.hotBase
+	}
+	var (
+		evOver   int
+		byteOver int64
+	)
+	if s.opts.MaxEvents > 0 {
+		evOver = s.hotCount + len(s.revived) - int(spillTargetRate*float64(s.opts.MaxEvents))
+	}
+	if s.opts.MaxMemoryBytes > 0 {
+		byteOver = s.memBytesLocked() - int64(spillTargetRate*float64(s.opts.MaxMemoryBytes))
+	}
+
+	i := 0
+	for i < s.events.len() && (evOver > 0 || byteOver > 0) {
+		if ev, ok := s.events.get(i); ok {
+			_, stored := payloadSizes(ev.Payload)
+			evOver--
+			byteOver -= s.hotMemSize(ev) + int64(stored)
+		}
+		i++
+	}
+	return s.hotBase + uint64(i)
+}
+
+// spillLoop 在收到 admitLocked 的通知后写一次快照，借助其中的降冷把内存占用降回预算以内，直到 Close 被调用。
+func (s *Store) spillLoop() {
+	defer s.bgWG.Done()
+
+	for {
+		select {
+		case <-s.bgStop:
+			return
+		case <-s.spillCh:
+			if _, err := s.Checkpoint(); err != nil {
+				log.Printf("spill: %v", err)
+			}
+		}
+	}
+}
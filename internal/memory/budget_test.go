@@ -0,0 +1,139 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestBudgetReject 检查 LimitReject 下达到事件数或字节数上限的写入（含整个批次）返回 storage.ErrCapacity、
+// 不改变 DAG 并计入 RejectedEmits，Snapshot 在越过软限制后告警；归档释放内存后写入恢复，恢复归档同样受上限约束。
+func TestBudgetReject(t *testing.T) {
+	payload := fmt.Sprintf(`{"pad":%q}`, strings.Repeat("x", 200))
+	cases := []struct {
+		name string
+		opts Options
+	}{
+		{"max events", Options{MaxEvents: 20}},
+		{"max memory bytes", Options{MaxMemoryBytes: 8 << 10}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.DataDir, opts.Sync = t.TempDir(), SyncNever
+			s := mustOpen(t, opts)
+
+			// 写到第一次被拒绝为止
+			root := mustEmit(t, s, "root", payload)
+			accepted := 1
+			for ; accepted < 1000; accepted++ {
+				_, err := s.Emit(tree.EmitRequest{Type: "node", Payload: []byte(payload), Parents: []uint64{root}})
+				if errors.Is(err, storage.ErrCapacity) {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if opts.MaxEvents > 0 && accepted != opts.MaxEvents || accepted < 10 || accepted == 1000 {
+				t.Fatalf("accepted %d events before the first rejection", accepted)
+			}
+			snap := s.Snapshot()
+			if len(snap.Warnings) == 0 {
+				t.Fatal("no soft-limit warning at the limit")
+			}
+
+			before := snap.NextEventID
+			emits := []struct {
+				name string
+				emit func() error
+			}{
+				{"emit", func() error {
+					_, err := s.Emit(tree.EmitRequest{Type: "node", Payload: []byte(payload), Parents: []uint64{root}})
+					return err
+				}},
+				{"batch", func() error {
+					_, err := s.EmitBatch([]tree.BatchEmitItem{
+						{EmitRequest: tree.EmitRequest{Type: "node", Payload: []byte(payload), Parents: []uint64{root}}},
+						{EmitRequest: tree.EmitRequest{Type: "node"}, LocalParents: []int{0}},
+					})
+					return err
+				}},
+			}
+			for i, e := range emits {
+				if err := e.emit(); !errors.Is(err, storage.ErrCapacity) {
+					t.Fatalf("%s over the limit: %v, want storage.ErrCapacity", e.name, err)
+				}
+				if snap := s.Snapshot(); snap.NextEventID != before || snap.RejectedEmits != uint64(i+2) {
+					t.Fatalf("%s: next id %d, rejected %d after the rejection, want %d and %d", e.name, snap.NextEventID, snap.RejectedEmits, before, i+2)
+				}
+			}
+
+			// 归档释放内存后可以继续写入，此时恢复归档会超出上限
+			if _, err := s.Archive(root); err != nil {
+				t.Fatal(err)
+			}
+			for range 10 {
+				mustEmit(t, s, "root", payload)
+			}
+			if _, err := s.Rehydrate(root); !errors.Is(err, storage.ErrCapacity) {
+				t.Fatalf("rehydrate over the limit: %v, want storage.ErrCapacity", err)
+			}
+			if len(s.Archives()) != 1 {
+				t.Fatal("rejected rehydrate changed the archive")
+			}
+			if rep, err := s.Verify(); err != nil || !rep.OK {
+				t.Fatalf("verify: %+v, %v", rep, err)
+			}
+		})
+	}
+}
+
+// TestBudgetSpill 检查 LimitSpill 下写入不会被拒绝：快照把最旧的热事件移入冷数据层，使内存占用回到上限以内，事件仍可读。
+func TestBudgetSpill(t *testing.T) {
+	cases := []struct {
+		name string
+		opts Options
+	}{
+		{"max events", Options{MaxEvents: 50}},
+		{"max memory bytes", Options{MaxMemoryBytes: 64 << 10}},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.DataDir, opts.Sync, opts.OnLimit = t.TempDir(), SyncNever, LimitSpill
+			s := mustOpen(t, opts)
+
+			var ids []uint64
+			parent := uint64(0)
+			for i := range 500 {
+				parent = mustEmit(t, s, "node", fmt.Sprintf(`{"i":%d,"pad":"%0200d"}`, i, i), parent)
+				ids = append(ids, parent)
+			}
+			// 后台降冷可能尚未完成，手动快照后必须回到上限以内
+			if _, err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			snap := s.Snapshot()
+			if snap.ColdEvents == 0 || snap.RejectedEmits != 0 {
+				t.Fatalf("cold %d, rejected %d: want spilled events and no rejections", snap.ColdEvents, snap.RejectedEmits)
+			}
+			if opts.MaxEvents > 0 && snap.HotEvents > opts.MaxEvents || opts.MaxMemoryBytes > 0 && snap.MemoryBytes > opts.MaxMemoryBytes {
+				t.Fatalf("%d events, %d bytes in memory after spilling, limits %d and %d", snap.HotEvents, snap.MemoryBytes, opts.MaxEvents, opts.MaxMemoryBytes)
+			}
+			for i, id := range ids {
+				ev, ok := s.Get(id)
+				if want := fmt.Sprintf(`{"i":%d,"pad":"%0200d"}`, i, i); !ok || string(ev.Payload) != want {
+					t.Fatalf("Get(%d) = %.40q, %v after spilling", id, ev.Payload, ok)
+				}
+			}
+			if rep, err := s.Verify(); err != nil || !rep.OK {
+				t.Fatalf("verify: %+v, %v", rep, err)
+			}
+		})
+	}
+}
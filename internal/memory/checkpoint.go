@@ -0,0 +1,784 @@
+package memory
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// 快照文件记录类型（与 WAL 记录类型相互独立）。
+const (
+	ckptRecordHeader   byte = 1  // uvarint(seq) | uvarint(nextID) | varint(createdUnixNano)
+	ckptRecordEvent    byte = 2  // appendEvent，payload 按整个文件的字典去重
+	ckptRecordChildren byte = 3  // uvarint(parent) | uvarint(n) | uvarint(child)...，同一父事件的列表按 ckptIDsPerRec 拆成多条
+	ckptRecordRoots    byte = 4  // uvarint(n) | uvarint(id)...
+	ckptRecordHeads    byte = 5  // uvarint(n) | uvarint(id)...
+	ckptRecordEnd      byte = 6  // uvarint(events)
+	ckptRecordCold     byte = 7  // uvarint(hotBase) | uvarint(n) | [uvarint(first) uvarint(last)]...，紧跟头记录
+	ckptRecordArchive  byte = 8  // uvarint(root) | varint(archivedAt) | uvarint(events) | uvarint(lastEventID) | appendIDs(coldIDs)，coldIDs 按 ckptIDsPerRec 拆成多条，后续记录重复存根字段
+	ckptRecordStats    byte = 9  // uvarint(payloadBytes) | uvarint(n) | [bytes(type) uvarint(count)]...
+	ckptRecordTypes    byte = 10 // bytes(type) | appendSortedIDs(ids)，同一类型的列表按 ckptIDsPerRec 拆成多条
+	ckptRecordTimes    byte = 11 // uvarint(firstBlock) | uvarint(n) | [varint(min) varint(max)]...，按 ckptIDsPerRec 块拆成多条
+	ckptRecordField    byte = 12 // bytes(field)，声明一个 payload 字段索引
+	ckptRecordValues   byte = 13 // bytes(field) | [bytes(value) appendSortedIDs(ids)]... 直到记录末尾，每条最多 ckptIDsPerRec 个 ID
+	ckptRecordTerms    byte = 14 // [bytes(term) appendSortedIDs(ids)]... 直到记录末尾，每条最多 ckptIDsPerRec 个 ID；启用全文索引时至少一条
+)
+
+const (
+	ckptMagic      = "CTCKPT01"
+	ckptFilePrefix = "checkpoint-"
+	ckptFileSuffix = ".ckpt"
+	ckptKeep       = 2    // 保留最近的快照数量，最新快照损坏时可回退到上一个
+	ckptIDsPerRec  = 4096 // 每条记录携带的 ID 数上限，较长的列表拆成多条，使单条记录远小于 recordMaxSize
+)
+
+// ErrNotPersistent 表示 Store 未配置数据目录，无法执行持久化相关操作。
+var ErrNotPersistent = fmt.Errorf("store is not persistent: %w", storage.ErrNotSupported)
+
+// ckptState 是一次快照的完整内容：DAG 结构与它之后第一个 WAL 日志段的序号。
+// ID 小于 hotBase 的事件不写入快照，而是引用 coldSegs 中的冷数据段。
+type ckptState struct {
+	seq      uint64
+	nextID   uint64
+	created  int64
+	hotBase  uint64
+	coldSegs []coldSegMeta
+	events   []tree.Event // 读出的热事件，下标为 id - hotBase
+	hot      hotEvents    // 待写出的热事件：Checkpoint 时热数据的只读拷贝
+	revived  []tree.Event // 从归档恢复、ID 低于 hotBase 的事件
+	archives []archiveEntry
+	children map[uint64][]uint64
+	roots    map[uint64]struct{}
+	heads    map[uint64]struct{}
+	stats    *dagStats                      // 在线事件的 payload 字节数与类型分布；旧快照没有统计记录时为 nil，加载时重新计算
+	types    map[string][]uint64            // 类型索引，可能含已归档的 ID；旧快照没有类型索引记录时为 nil，加载时重建
+	times    *timeIndex                     // 时间索引；旧快照没有时间索引记录时为 nil，加载时重建
+	fields   map[string]map[string][]uint64 // payload 字段索引：字段 -> 值 -> ID 列表，可能含已归档的 ID
+	text     map[string][]uint64            // 全文索引：词 -> ID 列表，可能含已归档的 ID；没有全文索引记录时为 nil
+}
+
+// Checkpoint 将当前 DAG 写入一个新的快照文件，并清理不再需要的旧快照与 WAL 日志段。
+// 持锁时间仅包括 WAL 切段与结构拷贝，序列化与落盘在锁外完成。
+func (s *Store) Checkpoint() (tree.CheckpointInfo, error) {
+	if s.wal == nil {
+		return tree.CheckpointInfo{}, ErrNotPersistent
+	}
+
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	// 先把低于冷水位线的事件降冷，本次快照随即记录新的冷数据段
+	if err := s.demote(); err != nil {
+		return tree.CheckpointInfo{}, err
+	}
+
+	// 关闭提交闸门：切段时没有已暂存、未发布的写入，快照中的 nextID 之前的事件都在旧日志段中
+	s.commitGate.Lock()
+	s.mu.Lock()
+	seq, err := s.wal.rotate()
+	if err != nil {
+		s.mu.Unlock()
+		s.commitGate.Unlock()
+		return tree.CheckpointInfo{}, fmt.Errorf("wal rotate failed: %w", err)
+	}
+	// 已写入的事件不可变，children 只会在 slice 末尾追加，因此浅拷贝即可得到一致视图
+	st := &ckptState{
+		seq:      seq,
+		nextID:   s.nextID,
+		created:  time.Now().UnixNano(),
+		hotBase:  s.hotBase,
+		coldSegs: s.cold.metas(),
+		hot:      s.events.clone(),
+		revived:  slices.SortedFunc(maps.Values(s.revived), func(a, b tree.Event) int { return cmp.Compare(a.ID, b.ID) }),
+		archives: slices.Collect(maps.Values(s.archived)),
+		children: maps.Clone(s.children),
+		roots:    maps.Clone(s.roots),
+		heads:    maps.Clone(s.heads),
+		stats:    &dagStats{payloadBytes: s.stats.payloadBytes, types: s.stats.typeCounts()},
+		types:    s.byType.byName(s.types),
+		times:    s.byTime.clone(),
+		fields:   s.fieldListsLocked(),
+	}
+	if s.text != nil {
+		st.text = s.text.clone()
+	}
+	s.mu.Unlock()
+	s.commitGate.Unlock()
+
+	info, err := writeCheckpoint(s.opts.DataDir, st)
+	if err != nil {
+		return tree.CheckpointInfo{}, err
+	}
+	s.lastCkpt.Store(&info)
+
+	if err := pruneCheckpoints(s.opts.DataDir); err != nil {
+		log.Printf("checkpoint: prune failed: %v", err)
+	}
+	return info, nil
+}
+
+// LastCheckpoint 返回最近一次成功写入（或启动时加载）的快照信息。
+func (s *Store) LastCheckpoint() (tree.CheckpointInfo, bool) {
+	p := s.lastCkpt.Load()
+	if p == nil {
+		return tree.CheckpointInfo{}, false
+	}
+	info := *p
+	info.AgeSeconds = time.Since(time.Unix(info.CreatedAt, 0)).Seconds()
+	return info, true
+}
+
+// checkpointLoop 按固定间隔执行保留策略并写快照；自上次快照以来既没有新事件也没有归档时跳过。
+func (s *Store) checkpointLoop(interval time.Duration) {
+	defer s.bgWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.bgStop:
+			return
+		case <-ticker.C:
+			archived := s.enforceRetention()
+			if last, ok := s.LastCheckpoint(); ok && archived == 0 && last.LastEventID == s.Snapshot().NextEventID {
+				continue
+			}
+			if _, err := s.Checkpoint(); err != nil {
+				log.Printf("checkpoint: %v", err)
+			}
+		}
+	}
+}
+
+// loadCheckpoint 用快照内容替换 Store 的 DAG 结构并打开其引用的冷数据段（仅在 Open 期间单线程调用）。
+func (s *Store) loadCheckpoint(st *ckptState) error {
+	cold := newColdTier(s.opts.DataDir)
+	for _, m := range st.coldSegs {
+		seg, presence, err := openColdSegment(s.opts.DataDir, m)
+		if err != nil {
+			_ = cold.close()
+			return err
+		}
+		cold.add(seg, presence)
+	}
+
+	for _, a := range st.archives {
+		for _, id := range a.coldIDs {
+			cold.hide(id)
+		}
+		s.archived[a.stub.Root] = a
+	}
+	s.resetPayloadsLocked()
+	s.eventBytes = 0
+	for _, ev := range st.revived {
+		ev.Type = s.internType(ev.Type)
+		s.residentInLocked(&ev, eventMemSize(ev))
+		s.revived[ev.ID] = ev
+	}
+
+	// 默认布局直接沿用读出的 slice，紧凑布局逐个转换
+	var events hotEvents = &structEvents{evs: st.events}
+	if s.opts.Layout == LayoutCompact {
+		events = newCompactEvents(s.types, st.hotBase)
+	}
+	hot := 0
+	for i, ev := range st.events {
+		if ev.ID == 0 {
+			continue
+		}
+		ev.Type = s.internType(ev.Type)
+		s.residentInLocked(&ev, s.hotMemSize(ev))
+		events.put(i, ev)
+		hot++
+	}
+	s.cold = cold
+	s.hotBase = st.hotBase
+	s.hotCount = hot
+	s.events = events
+	s.children = st.children
+	s.roots = st.roots
+	s.heads = st.heads
+	s.nextID = st.nextID
+	s.rebuildReachLocked()
+
+	// 统计、类型索引、时间索引与全文索引沿用快照中的记录；旧版本写出的快照缺少其中某些记录（或写快照时全文索引关闭）时，
+	// 遍历一次在线事件重建缺少的部分，冷数据需要逐个读盘。边数与扇出不写入快照，总是由 children 重新计算
+	var rebuild []func(ev tree.Event)
+	s.stats = newDAGStats()
+	if st.stats != nil {
+		s.stats.payloadBytes, s.stats.types = st.stats.payloadBytes, st.stats.types
+	} else {
+		rebuild = append(rebuild, s.stats.addEvent)
+	}
+	s.stats.countEdges(s.children)
+	if st.types != nil {
+		s.loadTypeIndexLocked(st.types)
+	} else {
+		s.byType = typeIndex{}
+		rebuild = append(rebuild, func(ev tree.Event) { s.byType.add(s.types.intern(ev.Type), ev.ID) })
+	}
+	if st.times != nil {
+		s.byTime = *st.times
+	} else {
+		s.byTime = timeIndex{}
+		rebuild = append(rebuild, func(ev tree.Event) { s.byTime.add(ev.ID, ev.TimeUnixNano) })
+	}
+	switch {
+	case s.text == nil:
+	case st.text != nil:
+		s.text.load(st.text, s.isEventIDValid)
+	default:
+		s.text = newTextIndex()
+		rebuild = append(rebuild, func(ev tree.Event) { s.indexTextLocked(ev, nil) })
+	}
+	if len(rebuild) > 0 {
+		s.forEachOnlineLocked("checkpoint", func(ev tree.Event) {
+			for _, fn := range rebuild {
+				fn(ev)
+			}
+		})
+		s.byType.settle()
+		if s.text != nil {
+			s.text.settle()
+		}
+	}
+	return s.loadFieldIndexesLocked(st.fields)
+}
+
+// checkpointPath 返回编号为 seq 的快照文件路径。
+func checkpointPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%016d%s", ckptFilePrefix, seq, ckptFileSuffix))
+}
+
+// listCheckpoints 返回 dir 下所有快照编号（升序）。
+func listCheckpoints(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, ckptFilePrefix) || !strings.HasSuffix(name, ckptFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, ckptFilePrefix), ckptFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+// writeCheckpoint 先写临时文件，fsync 后原子 rename，保证目录中只会出现完整的快照。
+func writeCheckpoint(dir string, st *ckptState) (tree.CheckpointInfo, error) {
+	path := checkpointPath(dir, st.seq)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return tree.CheckpointInfo{}, err
+	}
+	defer os.Remove(tmp)
+
+	bw := bufio.NewWriterSize(f, 1<<20)
+	var (
+		rec    []byte
+		body   []byte
+		events int
+		lastID uint64
+		dict   = newPayloadDict()
+	)
+	emit := func(kind byte) {
+		rec = appendRecord(rec[:0], kind, body)
+		_, _ = bw.Write(rec)
+	}
+
+	if n := len(st.coldSegs); n > 0 {
+		lastID = st.coldSegs[n-1].last
+	}
+
+	_, _ = bw.WriteString(ckptMagic)
+
+	body = binary.AppendUvarint(body[:0], st.seq)
+	body = binary.AppendUvarint(body, st.nextID)
+	body = binary.AppendVarint(body, st.created)
+	emit(ckptRecordHeader)
+
+	if st.hotBase > 0 || len(st.coldSegs) > 0 {
+		body = binary.AppendUvarint(body[:0], st.hotBase)
+		body = binary.AppendUvarint(body, uint64(len(st.coldSegs)))
+		for _, m := range st.coldSegs {
+			body = binary.AppendUvarint(body, m.first)
+			body = binary.AppendUvarint(body, m.last)
+		}
+		emit(ckptRecordCold)
+	}
+
+	writeEvent := func(ev tree.Event) {
+		body = appendEvent(body[:0], ev, dict)
+		emit(ckptRecordEvent)
+		events++
+		lastID = ev.ID
+	}
+	for _, ev := range st.revived {
+		writeEvent(ev)
+	}
+	for i := range st.hot.len() {
+		if ev, ok := st.hot.get(i); ok {
+			writeEvent(ev)
+		}
+	}
+	slices.SortFunc(st.archives, func(a, b archiveEntry) int { return cmp.Compare(a.stub.Root, b.stub.Root) })
+	for _, a := range st.archives {
+		// 没有冷事件的存根也写出一条记录
+		ids := a.coldIDs
+		for first := true; first || len(ids) > 0; first = false {
+			n := min(len(ids), ckptIDsPerRec)
+			body = binary.AppendUvarint(body[:0], a.stub.Root)
+			body = binary.AppendVarint(body, a.stub.ArchivedAt)
+			body = binary.AppendUvarint(body, uint64(a.stub.Events))
+			body = binary.AppendUvarint(body, a.stub.LastEventID)
+			body = appendIDs(body, ids[:n])
+			emit(ckptRecordArchive)
+			ids = ids[n:]
+		}
+	}
+	// children 覆盖冷热全部事件，按父事件 ID 升序写出
+	for _, parent := range slices.Sorted(maps.Keys(st.children)) {
+		for ids := st.children[parent]; len(ids) > 0; {
+			n := min(len(ids), ckptIDsPerRec)
+			body = binary.AppendUvarint(body[:0], parent)
+			body = appendIDs(body, ids[:n])
+			emit(ckptRecordChildren)
+			ids = ids[n:]
+		}
+	}
+	for _, kv := range []struct {
+		kind byte
+		set  map[uint64]struct{}
+	}{{ckptRecordRoots, st.roots}, {ckptRecordHeads, st.heads}} {
+		ids := slices.Sorted(maps.Keys(kv.set))
+		for len(ids) > 0 {
+			n := min(len(ids), ckptIDsPerRec)
+			body = appendIDs(body[:0], ids[:n])
+			emit(kv.kind)
+			ids = ids[n:]
+		}
+	}
+
+	body = binary.AppendUvarint(body[:0], uint64(st.stats.payloadBytes))
+	body = binary.AppendUvarint(body, uint64(len(st.stats.types)))
+	for _, t := range slices.Sorted(maps.Keys(st.stats.types)) {
+		body = appendBytes(body, []byte(t))
+		body = binary.AppendUvarint(body, uint64(st.stats.types[t]))
+	}
+	emit(ckptRecordStats)
+
+	for _, t := range slices.Sorted(maps.Keys(st.types)) {
+		ids := st.types[t]
+		for len(ids) > 0 {
+			n := min(len(ids), ckptIDsPerRec)
+			body = appendBytes(body[:0], []byte(t))
+			body = appendSortedIDs(body, ids[:n])
+			emit(ckptRecordTypes)
+			ids = ids[n:]
+		}
+	}
+
+	for first := 0; first < len(st.times.min); first += ckptIDsPerRec {
+		n := min(len(st.times.min)-first, ckptIDsPerRec)
+		body = binary.AppendUvarint(body[:0], uint64(first))
+		body = binary.AppendUvarint(body, uint64(n))
+		for b := first; b < first+n; b++ {
+			body = binary.AppendVarint(body, st.times.min[b])
+			body = binary.AppendVarint(body, st.times.max[b])
+		}
+		emit(ckptRecordTimes)
+	}
+
+	// 倒排表（字段值、全文索引的词）的键可能很多，多个键的列表合并写进同一条记录，过长的列表拆到后续记录中继续；
+	// head 是每条记录开头的固定部分，返回写出的记录数
+	writeLists := func(kind byte, head []byte, lists map[string][]uint64) int {
+		body = append(body[:0], head...)
+		n, recs := 0, 0
+		for _, key := range slices.Sorted(maps.Keys(lists)) {
+			for ids := lists[key]; len(ids) > 0; {
+				k := min(len(ids), ckptIDsPerRec-n)
+				body = appendBytes(body, []byte(key))
+				body = appendSortedIDs(body, ids[:k])
+				ids, n = ids[k:], n+k
+				if n == ckptIDsPerRec {
+					emit(kind)
+					body, n, recs = append(body[:0], head...), 0, recs+1
+				}
+			}
+		}
+		if n > 0 {
+			emit(kind)
+			recs++
+		}
+		return recs
+	}
+	for _, field := range slices.Sorted(maps.Keys(st.fields)) {
+		body = appendBytes(body[:0], []byte(field))
+		emit(ckptRecordField)
+		writeLists(ckptRecordValues, appendBytes(nil, []byte(field)), st.fields[field])
+	}
+	// 全文索引为空时也写出一条空记录，加载时据此区分空索引与没有全文索引的旧快照
+	if st.text != nil && writeLists(ckptRecordTerms, nil, st.text) == 0 {
+		emit(ckptRecordTerms)
+	}
+
+	body = binary.AppendUvarint(body[:0], uint64(events))
+	emit(ckptRecordEnd)
+
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return tree.CheckpointInfo{}, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return tree.CheckpointInfo{}, err
+	}
+	fi, err := f.Stat()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return tree.CheckpointInfo{}, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return tree.CheckpointInfo{}, err
+	}
+	if err := syncDir(dir); err != nil {
+		return tree.CheckpointInfo{}, err
+	}
+
+	return tree.CheckpointInfo{
+		ID:          st.seq,
+		LastEventID: lastID,
+		Events:      events,
+		SizeBytes:   fi.Size(),
+		CreatedAt:   time.Unix(0, st.created).Unix(),
+	}, nil
+}
+
+// readCheckpoint 读取并校验一个快照文件：魔数、每条记录的校验和、头记录与结束记录都必须完整。
+func readCheckpoint(path string) (*ckptState, tree.CheckpointInfo, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, tree.CheckpointInfo{}, err
+	}
+	defer f.Close()
+
+	br := bufio.NewReaderSize(f, 1<<20)
+	magic := make([]byte, len(ckptMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || string(magic) != ckptMagic {
+		return nil, tree.CheckpointInfo{}, fmt.Errorf("bad checkpoint magic")
+	}
+
+	var (
+		st     *ckptState
+		events int
+		lastID uint64
+		ended  bool
+		dict   = newPayloadDict()
+	)
+	_, err = readRecords(br, func(kind byte, body []byte) error {
+		if ended {
+			return fmt.Errorf("record after end")
+		}
+		if st == nil && kind != ckptRecordHeader {
+			return fmt.Errorf("missing header")
+		}
+		if st != nil && st.events == nil && kind != ckptRecordHeader && kind != ckptRecordCold {
+			st.events = make([]tree.Event, st.nextID+1-st.hotBase)
+		}
+		d := decoder{buf: body}
+		switch kind {
+		case ckptRecordHeader:
+			if st != nil {
+				return fmt.Errorf("duplicate header")
+			}
+			st = &ckptState{
+				seq:      d.uvarint(),
+				nextID:   d.uvarint(),
+				created:  d.varint(),
+				children: make(map[uint64][]uint64),
+				roots:    make(map[uint64]struct{}),
+				heads:    make(map[uint64]struct{}),
+			}
+		case ckptRecordCold:
+			if st.events != nil || st.hotBase != 0 || len(st.coldSegs) != 0 {
+				return fmt.Errorf("cold record must follow header")
+			}
+			st.hotBase = d.uvarint()
+			n := d.uvarint()
+			if d.err == nil && (st.hotBase > st.nextID+1 || n > uint64(len(body))) {
+				return fmt.Errorf("bad cold record")
+			}
+			for i := uint64(0); i < n && d.err == nil; i++ {
+				st.coldSegs = append(st.coldSegs, coldSegMeta{first: d.uvarint(), last: d.uvarint()})
+			}
+			if k := len(st.coldSegs); k > 0 {
+				lastID = st.coldSegs[k-1].last
+			}
+		case ckptRecordEvent:
+			ev, _, err := decodeEvent(body, dict)
+			if err != nil {
+				return err
+			}
+			if ev.ID == 0 || ev.ID > st.nextID || (ev.ID >= st.hotBase && st.events[ev.ID-st.hotBase].ID != 0) {
+				return fmt.Errorf("bad event id %d", ev.ID)
+			}
+			if ev.ID < st.hotBase {
+				st.revived = append(st.revived, ev)
+			} else {
+				st.events[ev.ID-st.hotBase] = ev
+			}
+			events++
+			lastID = max(lastID, ev.ID)
+		case ckptRecordArchive:
+			var a archiveEntry
+			a.stub.Root = d.uvarint()
+			a.stub.ArchivedAt = d.varint()
+			a.stub.Events = int(d.uvarint())
+			a.stub.LastEventID = d.uvarint()
+			a.coldIDs = d.ids()
+			// 同一存根的后续记录只追加 coldIDs
+			if n := len(st.archives); d.err == nil && n > 0 && st.archives[n-1].stub.Root == a.stub.Root {
+				if st.archives[n-1].stub != a.stub {
+					return fmt.Errorf("archive %d: inconsistent continuation record", a.stub.Root)
+				}
+				st.archives[n-1].coldIDs = append(st.archives[n-1].coldIDs, a.coldIDs...)
+				break
+			}
+			st.archives = append(st.archives, a)
+		case ckptRecordChildren:
+			parent := d.uvarint()
+			st.children[parent] = append(st.children[parent], d.ids()...)
+		case ckptRecordRoots:
+			for _, id := range d.ids() {
+				st.roots[id] = struct{}{}
+			}
+		case ckptRecordHeads:
+			for _, id := range d.ids() {
+				st.heads[id] = struct{}{}
+			}
+		case ckptRecordStats:
+			stats := &dagStats{payloadBytes: int64(d.uvarint()), types: make(map[string]int)}
+			n := d.uvarint()
+			if d.err == nil && n > uint64(len(body)) {
+				return fmt.Errorf("bad stats record")
+			}
+			for i := uint64(0); i < n && d.err == nil; i++ {
+				t := string(d.bytes())
+				stats.types[t] = int(d.uvarint())
+			}
+			st.stats = stats
+		case ckptRecordTypes:
+			if st.types == nil {
+				st.types = make(map[string][]uint64)
+			}
+			t := string(d.bytes())
+			ids := d.sortedIDs()
+			if n := len(st.types[t]); d.err == nil && n > 0 && len(ids) > 0 && ids[0] <= st.types[t][n-1] {
+				return fmt.Errorf("bad type index record for %q", t)
+			}
+			st.types[t] = append(st.types[t], ids...)
+		case ckptRecordTimes:
+			if st.times == nil {
+				st.times = &timeIndex{}
+			}
+			first, n := d.uvarint(), d.uvarint()
+			if d.err == nil && (first != uint64(len(st.times.min)) || n > uint64(len(body))) {
+				return fmt.Errorf("bad time index record")
+			}
+			for i := uint64(0); i < n && d.err == nil; i++ {
+				st.times.min = append(st.times.min, d.varint())
+				st.times.max = append(st.times.max, d.varint())
+			}
+		case ckptRecordField:
+			if st.fields == nil {
+				st.fields = make(map[string]map[string][]uint64)
+			}
+			st.fields[string(d.bytes())] = make(map[string][]uint64)
+		case ckptRecordValues:
+			field := string(d.bytes())
+			values, ok := st.fields[field]
+			if d.err == nil && !ok {
+				return fmt.Errorf("values for undeclared field index %q", field)
+			}
+			if !d.readLists(values) {
+				return fmt.Errorf("bad field index record for %q", field)
+			}
+		case ckptRecordTerms:
+			if st.text == nil {
+				st.text = make(map[string][]uint64)
+			}
+			if !d.readLists(st.text) {
+				return fmt.Errorf("bad full-text index record")
+			}
+		case ckptRecordEnd:
+			if n := d.uvarint(); d.err == nil && n != uint64(events) {
+				return fmt.Errorf("event count mismatch: end=%d read=%d", n, events)
+			}
+			ended = true
+		default:
+			return fmt.Errorf("unknown checkpoint record kind %d", kind)
+		}
+		return d.err
+	})
+	if err != nil {
+		return nil, tree.CheckpointInfo{}, err
+	}
+	if !ended {
+		return nil, tree.CheckpointInfo{}, fmt.Errorf("missing end record")
+	}
+	if st.events == nil {
+		st.events = make([]tree.Event, st.nextID+1-st.hotBase)
+	}
+
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, tree.CheckpointInfo{}, err
+	}
+	info := tree.CheckpointInfo{
+		ID:          st.seq,
+		LastEventID: lastID,
+		Events:      events,
+		SizeBytes:   fi.Size(),
+		CreatedAt:   time.Unix(0, st.created).Unix(),
+	}
+	return st, info, nil
+}
+
+// pruneCheckpoints 只保留最近 ckptKeep 个快照，并删除最旧保留快照之前的 WAL 日志段。
+func pruneCheckpoints(dir string) error {
+	seqs, err := listCheckpoints(dir)
+	if err != nil || len(seqs) == 0 {
+		return err
+	}
+	keepFrom := max(len(seqs)-ckptKeep, 0)
+	for _, seq := range seqs[:keepFrom] {
+		if err := os.Remove(checkpointPath(dir, seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	oldest := seqs[keepFrom]
+	walSeqs, err := listWALSegments(dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range walSeqs {
+		if seq >= oldest {
+			break
+		}
+		if err := os.Remove(walSegmentPath(dir, seq)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncDir fsync 目录本身，使 rename/create 在掉电后仍然可见。
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// appendIDs 以 uvarint(n) + uvarint(id)... 的形式追加一组 ID。
+func appendIDs(buf []byte, ids []uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(ids)))
+	for _, id := range ids {
+		buf = binary.AppendUvarint(buf, id)
+	}
+	return buf
+}
+
+// ids 读取一组由 appendIDs 编码的 ID。
+func (d *decoder) ids() []uint64 {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)-d.off) {
+		d.err = errShortRecord
+		return nil
+	}
+	out := make([]uint64, 0, n)
+	for i := uint64(0); i < n; i++ {
+		out = append(out, d.uvarint())
+	}
+	return out
+}
+
+// appendSortedIDs 以 uvarint(n) + uvarint(与前一个 ID 的差)... 的形式追加一组严格升序的 ID，第一个 ID 与 0 相减。
+func appendSortedIDs(buf []byte, ids []uint64) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(ids)))
+	var prev uint64
+	for _, id := range ids {
+		buf = binary.AppendUvarint(buf, id-prev)
+		prev = id
+	}
+	return buf
+}
+
+// sortedIDs 读取一组由 appendSortedIDs 编码的 ID，差值为 0 视为记录损坏。
+func (d *decoder) sortedIDs() []uint64 {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)-d.off) {
+		d.err = errShortRecord
+		return nil
+	}
+	out := make([]uint64, 0, n)
+	var prev uint64
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		delta := d.uvarint()
+		if delta == 0 && d.err == nil {
+			d.err = fmt.Errorf("ids not strictly increasing")
+			return nil
+		}
+		prev += delta
+		out = append(out, prev)
+	}
+	return out
+}
+
+// readLists 读出记录剩余部分的（键, 升序 ID 列表）并追加到 lists；同一个键跨记录时 ID 必须继续升序，否则返回 false。
+func (d *decoder) readLists(lists map[string][]uint64) bool {
+	for d.err == nil && d.off < len(d.buf) {
+		key := string(d.bytes())
+		ids := d.sortedIDs()
+		if n := len(lists[key]); d.err == nil && n > 0 && len(ids) > 0 && ids[0] <= lists[key][n-1] {
+			return false
+		}
+		lists[key] = append(lists[key], ids...)
+	}
+	return true
+}
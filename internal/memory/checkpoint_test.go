@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// emitFanOut 在 parent 下写入 n 个子事件，按 EmitBatch 的上限分批。
+func emitFanOut(t *testing.T, s *Store, parent uint64, n int) {
+	t.Helper()
+	for n > 0 {
+		k := min(n, maxBatchItems)
+		items := make([]tree.BatchEmitItem, k)
+		for i := range items {
+			items[i] = tree.BatchEmitItem{EmitRequest: tree.EmitRequest{Type: "leaf", Parents: []uint64{parent}}}
+		}
+		if _, err := s.EmitBatch(items); err != nil {
+			t.Fatal(err)
+		}
+		n -= k
+	}
+}
+
+// TestCheckpointLargeFanOut 检查扇出与冷事件数超过 ckptIDsPerRec 的 children 与归档存根拆成多条记录后能完整读回。
+func TestCheckpointLargeFanOut(t *testing.T) {
+	const fanOut = 3*ckptIDsPerRec + 5
+	cases := []struct {
+		name    string
+		archive bool
+	}{
+		{"children", false},
+		{"archived cold tree", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			dir := t.TempDir()
+			opts := Options{DataDir: dir, Sync: SyncNever}
+			if c.archive {
+				opts.HotWindow = 16
+			}
+			s, err := Open(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			root := mustEmit(t, s, "root", "")
+			emitFanOut(t, s, root, fanOut)
+			keep := mustEmit(t, s, "other", "")
+			if _, err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			if c.archive {
+				if s.Snapshot().ColdEvents < fanOut-16 {
+					t.Fatalf("cold events = %d, want most of the fan-out", s.Snapshot().ColdEvents)
+				}
+				if _, err := s.Archive(root); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = mustOpen(t, opts)
+			if c.archive {
+				stubs := s.Archives()
+				if len(stubs) != 1 || stubs[0].Root != root || stubs[0].Events != fanOut {
+					t.Fatalf("archives after reopen = %+v", stubs)
+				}
+				if _, ok := s.Get(root + 1); ok {
+					t.Fatal("archived cold event visible after reopen")
+				}
+				if _, err := s.Rehydrate(root); err != nil {
+					t.Fatal(err)
+				}
+			}
+			kids, ok := s.Children(root)
+			if !ok || len(kids) != fanOut {
+				t.Fatalf("children of %d after reopen = %d, want %d", root, len(kids), fanOut)
+			}
+			for i, id := range kids {
+				if id != root+1+uint64(i) {
+					t.Fatalf("child %d = %d, want %d", i, id, root+1+uint64(i))
+				}
+			}
+			if heads := s.Snapshot().Heads; heads != fanOut+1 {
+				t.Fatalf("heads = %d, want %d", heads, fanOut+1)
+			}
+			if _, ok := s.Get(keep); !ok {
+				t.Fatalf("event %d lost", keep)
+			}
+			if r, err := s.Verify(); err != nil || !r.OK {
+				t.Fatalf("verify after reopen: %+v, %v", r.Violations, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// errShortRecord 表示二进制记录在解码过程中提前结束。
+var errShortRecord = errors.New("short record")
+
+// appendEvent 将事件以紧凑二进制格式追加到 buf 末尾：
+// uvarint(ID) | varint(TimeUnixNano) | bytes(Type) | bytes(Message) | bytes(Payload) | uvarint(len(Parents)) | uvarint(parent)...
+// dict 非空时，作用域内重复的 payload 写为引用（见 dedup.go）。
+func appendEvent(buf []byte, ev tree.Event, dict *payloadDict) []byte {
+	buf = binary.AppendUvarint(buf, ev.ID)
+	buf = binary.AppendVarint(buf, ev.TimeUnixNano)
+	buf = appendBytes(buf, []byte(ev.Type))
+	buf = appendBytes(buf, []byte(ev.Message))
+	buf = appendBytes(buf, dict.encode(ev.Payload))
+	buf = binary.AppendUvarint(buf, uint64(len(ev.Parents)))
+	for _, p := range ev.Parents {
+		buf = binary.AppendUvarint(buf, p)
+	}
+	return buf
+}
+
+// eventSizeBound 返回 appendEvent 编码 ev 的字节数上界（payload 按未去重计算）。
+func eventSizeBound(ev tree.Event) int {
+	return (5+len(ev.Parents))*binary.MaxVarintLen64 + binary.MaxVarintLen64 + len(ev.Type) + len(ev.Message) + len(ev.Payload)
+}
+
+// decodeEvent 从 b 中解码一个由 appendEvent 编码的事件，返回事件与消耗的字节数。
+// dict 必须与编码时处于同一作用域，并且已按顺序解码过该作用域内此前的全部事件。
+func decodeEvent(b []byte, dict *payloadDict) (tree.Event, int, error) {
+	var ev tree.Event
+	d := decoder{buf: b}
+
+	ev.ID = d.uvarint()
+	ev.TimeUnixNano = d.varint()
+	ev.Type = string(d.bytes())
+	ev.Message = string(d.bytes())
+	if payload := d.bytes(); len(payload) > 0 {
+		ev.Payload = append([]byte(nil), payload...)
+	}
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(d.buf)-d.off) {
+		d.err = errShortRecord
+	}
+	if d.err != nil {
+		return tree.Event{}, 0, d.err
+	}
+	payload, err := dict.decode(ev.Payload)
+	if err != nil {
+		return tree.Event{}, 0, err
+	}
+	ev.Payload = payload
+	ev.Parents = make([]uint64, 0, n)
+	for i := uint64(0); i < n; i++ {
+		ev.Parents = append(ev.Parents, d.uvarint())
+	}
+	if d.err != nil {
+		return tree.Event{}, 0, d.err
+	}
+	return ev, d.off, nil
+}
+
+// appendBytes 以 uvarint(len) + 原始字节的形式追加一段数据。
+func appendBytes(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(b)))
+	return append(buf, b...)
+}
+
+// decoder 是一个带错误粘滞的顺序解码器，出错后后续读取全部返回零值。
+type decoder struct {
+	buf []byte
+	off int
+	err error
+}
+
+func (d *decoder) uvarint() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Uvarint(d.buf[d.off:])
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, n := binary.Varint(d.buf[d.off:])
+	if n <= 0 {
+		d.err = errShortRecord
+		return 0
+	}
+	d.off += n
+	return v
+}
+
+// bytes 读取一段 uvarint(len) 前缀的数据，返回的切片引用原始 buf。
+func (d *decoder) bytes() []byte {
+	n := d.uvarint()
+	if d.err != nil {
+		return nil
+	}
+	if n > uint64(len(d.buf)-d.off) {
+		d.err = errShortRecord
+		return nil
+	}
+	b := d.buf[d.off : d.off+int(n)]
+	d.off += int(n)
+	return b
+}
@@ -0,0 +1,573 @@
+package memory
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// 冷数据段文件记录类型。
+const (
+	coldRecordEvent byte = 1 // appendEvent，payload 按所在索引块的字典去重
+	coldRecordIndex byte = 2 // uvarint(first) | uvarint(last) | uvarint(count) | uvarint(n) | [uvarint(id) uvarint(off)]... | bytes(presence)
+)
+
+const (
+	coldMagic       = "CTCOLD01"
+	coldFooterMagic = "CTCOLDFT"
+	coldFooterSize  = 16 // uint64(index 记录偏移) + coldFooterMagic
+	coldFilePrefix  = "cold-"
+	coldFileSuffix  = ".seg"
+	coldIndexEvery  = 64  // 稀疏索引：每 64 个事件记录一个 (id, offset)
+	coldCacheBlocks = 256 // 最近读取的块缓存数量
+)
+
+// coldSegMeta 标识一个冷数据段覆盖的 ID 范围，记录在快照中。
+type coldSegMeta struct {
+	first uint64
+	last  uint64
+}
+
+// coldIndexEntry 是稀疏索引的一项：块内第一个事件的 ID 及其记录在文件中的偏移。
+type coldIndexEntry struct {
+	id  uint64
+	off int64
+}
+
+// coldSegment 是一个不可变的冷数据段文件，事件按 ID 升序存放。
+type coldSegment struct {
+	coldSegMeta
+	count   int
+	f       *os.File
+	index   []coldIndexEntry
+	dataEnd int64 // 事件记录区的结束偏移（即 index 记录的起始偏移）
+}
+
+// coldBlockKey 标识某个冷数据段中的一个索引块。
+type coldBlockKey struct {
+	seg   uint64
+	block int
+}
+
+// coldTier 管理所有冷数据段：按 ID 定位段与块，并缓存最近读取的块。
+// present 是覆盖所有冷 ID 的位图，使存在性检查（Emit 校验父事件）无需读盘。
+type coldTier struct {
+	mu      sync.Mutex
+	dir     string
+	segs    []*coldSegment // 按 first 升序
+	present []uint64
+	hidden  []uint64 // 随根树归档而隐藏的冷事件，数据仍在段文件中
+	count   int
+
+	cache     map[coldBlockKey][]tree.Event
+	cacheRing []coldBlockKey
+	cacheNext int
+}
+
+// newColdTier 创建一个空的冷数据层。
+func newColdTier(dir string) *coldTier {
+	return &coldTier{
+		dir:   dir,
+		cache: make(map[coldBlockKey][]tree.Event),
+	}
+}
+
+// coldSegmentPath 返回覆盖 [first, last] 的冷数据段文件路径。
+func coldSegmentPath(dir string, m coldSegMeta) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%020d-%020d%s", coldFilePrefix, m.first, m.last, coldFileSuffix))
+}
+
+// has 报告 id 是否存在于冷数据层。
+func (c *coldTier) has(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return bitsetHas(c.present, id)
+}
+
+// hide 隐藏一个冷事件（其所在根树已归档）；事件不存在时返回 false。
+func (c *coldTier) hide(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !bitsetHas(c.present, id) {
+		return false
+	}
+	bitsetClear(c.present, id)
+	c.hidden = bitsetSet(c.hidden, id)
+	c.count--
+	return true
+}
+
+// unhide 恢复一个被 hide 隐藏的冷事件；id 未被隐藏时返回 false。
+func (c *coldTier) unhide(id uint64) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !bitsetHas(c.hidden, id) {
+		return false
+	}
+	bitsetClear(c.hidden, id)
+	c.present = bitsetSet(c.present, id)
+	c.count++
+	return true
+}
+
+// metas 返回所有冷数据段的 ID 范围（升序）。
+func (c *coldTier) metas() []coldSegMeta {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out := make([]coldSegMeta, 0, len(c.segs))
+	for _, seg := range c.segs {
+		out = append(out, seg.coldSegMeta)
+	}
+	return out
+}
+
+// stats 返回冷事件总数与冷数据段数量。
+func (c *coldTier) stats() (events int, segments int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.count, len(c.segs)
+}
+
+// add 将一个已写好的冷数据段挂入冷数据层。
+func (c *coldTier) add(seg *coldSegment, presence []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	i, _ := slices.BinarySearchFunc(c.segs, seg.first, func(s *coldSegment, id uint64) int {
+		switch {
+		case s.first < id:
+			return -1
+		case s.first > id:
+			return 1
+		}
+		return 0
+	})
+	c.segs = slices.Insert(c.segs, i, seg)
+	for bit := range len(presence) * 8 {
+		if presence[bit/8]&(1<<(bit%8)) != 0 {
+			c.present = bitsetSet(c.present, seg.first+uint64(bit))
+		}
+	}
+	c.count += seg.count
+}
+
+// get 从冷数据层读取一个事件；命中块缓存时无需读盘。
+// c.mu 只保护定位与缓存，读盘在锁外经 ReadAt 完成，并发的冷读取互不阻塞；同一块可能被并发读取多次，结果相同。
+func (c *coldTier) get(id uint64) (tree.Event, bool, error) {
+	c.mu.Lock()
+	seg, key, ok := c.locateLocked(id)
+	if !ok {
+		c.mu.Unlock()
+		return tree.Event{}, false, nil
+	}
+	events, cached := c.cache[key]
+	c.mu.Unlock()
+
+	if !cached {
+		var err error
+		events, err = seg.readBlock(key.block)
+		if err != nil {
+			return tree.Event{}, false, err
+		}
+		c.mu.Lock()
+		if _, ok := c.cache[key]; !ok {
+			c.putCache(key, events)
+		}
+		c.mu.Unlock()
+	}
+
+	j, found := slices.BinarySearchFunc(events, id, func(ev tree.Event, id uint64) int {
+		switch {
+		case ev.ID < id:
+			return -1
+		case ev.ID > id:
+			return 1
+		}
+		return 0
+	})
+	if !found {
+		return tree.Event{}, false, nil
+	}
+	return events[j], true, nil
+}
+
+// locateLocked 返回 id 所在的冷数据段及其索引块；id 不在冷数据层中时返回 false（需持有 c.mu）。
+func (c *coldTier) locateLocked(id uint64) (*coldSegment, coldBlockKey, bool) {
+	if !bitsetHas(c.present, id) {
+		return nil, coldBlockKey{}, false
+	}
+	i, found := slices.BinarySearchFunc(c.segs, id, func(s *coldSegment, id uint64) int {
+		switch {
+		case s.last < id:
+			return -1
+		case s.first > id:
+			return 1
+		}
+		return 0
+	})
+	if !found {
+		return nil, coldBlockKey{}, false
+	}
+	seg := c.segs[i]
+
+	block, _ := slices.BinarySearchFunc(seg.index, id, func(e coldIndexEntry, id uint64) int {
+		if e.id <= id {
+			return -1
+		}
+		return 1
+	})
+	block-- // 最后一个 e.id <= id 的块
+	return seg, coldBlockKey{seg: seg.first, block: block}, true
+}
+
+// putCache 以环形替换的方式缓存一个块（需持有 c.mu）。
+func (c *coldTier) putCache(key coldBlockKey, events []tree.Event) {
+	if len(c.cacheRing) < coldCacheBlocks {
+		c.cacheRing = append(c.cacheRing, key)
+	} else {
+		delete(c.cache, c.cacheRing[c.cacheNext])
+		c.cacheRing[c.cacheNext] = key
+		c.cacheNext = (c.cacheNext + 1) % coldCacheBlocks
+	}
+	c.cache[key] = events
+}
+
+// close 关闭所有冷数据段文件。
+func (c *coldTier) close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var first error
+	for _, seg := range c.segs {
+		if err := seg.f.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	c.segs = nil
+	return first
+}
+
+// readBlock 读取并解码稀疏索引中第 block 个块内的全部事件。段文件不可变，读取经 ReadAt 进行，可并发调用。
+func (seg *coldSegment) readBlock(block int) ([]tree.Event, error) {
+	start := seg.index[block].off
+	end := seg.dataEnd
+	if block+1 < len(seg.index) {
+		end = seg.index[block+1].off
+	}
+
+	var events []tree.Event
+	dict := newPayloadDict()
+	_, err := readRecords(io.NewSectionReader(seg.f, start, end-start), func(kind byte, body []byte) error {
+		if kind != coldRecordEvent {
+			return fmt.Errorf("unexpected cold record kind %d", kind)
+		}
+		ev, _, err := decodeEvent(body, dict)
+		if err != nil {
+			return err
+		}
+		events = append(events, ev)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("read cold segment %d block %d: %w", seg.first, block, err)
+	}
+	return events, nil
+}
+
+// writeColdSegment 将一批按 ID 升序排列的事件写成不可变的冷数据段，fsync 后原子 rename 到位。
+func writeColdSegment(dir string, events []tree.Event) (*coldSegment, []byte, error) {
+	m := coldSegMeta{first: events[0].ID, last: events[len(events)-1].ID}
+	path := coldSegmentPath(dir, m)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(tmp)
+
+	bw := bufio.NewWriterSize(f, 1<<20)
+	var (
+		rec      []byte
+		body     []byte
+		off      = int64(len(coldMagic))
+		index    []coldIndexEntry
+		presence = make([]byte, (m.last-m.first)/8+1)
+		dict     *payloadDict
+	)
+	_, _ = bw.WriteString(coldMagic)
+	for i, ev := range events {
+		// 每个索引块可以单独解码，payload 字典随块重置
+		if i%coldIndexEvery == 0 {
+			index = append(index, coldIndexEntry{id: ev.ID, off: off})
+			dict = newPayloadDict()
+		}
+		rel := ev.ID - m.first
+		presence[rel/8] |= 1 << (rel % 8)
+
+		body = appendEvent(body[:0], ev, dict)
+		rec = appendRecord(rec[:0], coldRecordEvent, body)
+		_, _ = bw.Write(rec)
+		off += int64(len(rec))
+	}
+
+	body = binary.AppendUvarint(body[:0], m.first)
+	body = binary.AppendUvarint(body, m.last)
+	body = binary.AppendUvarint(body, uint64(len(events)))
+	body = binary.AppendUvarint(body, uint64(len(index)))
+	for _, e := range index {
+		body = binary.AppendUvarint(body, e.id)
+		body = binary.AppendUvarint(body, uint64(e.off))
+	}
+	body = appendBytes(body, presence)
+	rec = appendRecord(rec[:0], coldRecordIndex, body)
+	_, _ = bw.Write(rec)
+
+	var footer [coldFooterSize]byte
+	binary.LittleEndian.PutUint64(footer[:8], uint64(off))
+	copy(footer[8:], coldFooterMagic)
+	_, _ = bw.Write(footer[:])
+
+	if err := bw.Flush(); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	if err := f.Close(); err != nil {
+		return nil, nil, err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return nil, nil, err
+	}
+	if err := syncDir(dir); err != nil {
+		return nil, nil, err
+	}
+	return openColdSegment(dir, m)
+}
+
+// openColdSegment 打开一个冷数据段：校验魔数与尾部，加载稀疏索引与存在性位图。
+func openColdSegment(dir string, m coldSegMeta) (*coldSegment, []byte, error) {
+	f, err := os.Open(coldSegmentPath(dir, m))
+	if err != nil {
+		return nil, nil, err
+	}
+	seg, presence, err := loadColdSegment(f, m)
+	if err != nil {
+		f.Close()
+		return nil, nil, fmt.Errorf("open cold segment %s: %w", f.Name(), err)
+	}
+	return seg, presence, nil
+}
+
+func loadColdSegment(f *os.File, m coldSegMeta) (*coldSegment, []byte, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, nil, err
+	}
+	size := fi.Size()
+	if size < int64(len(coldMagic))+coldFooterSize {
+		return nil, nil, fmt.Errorf("file too short")
+	}
+
+	magic := make([]byte, len(coldMagic))
+	if _, err := f.ReadAt(magic, 0); err != nil || string(magic) != coldMagic {
+		return nil, nil, fmt.Errorf("bad cold segment magic")
+	}
+	var footer [coldFooterSize]byte
+	if _, err := f.ReadAt(footer[:], size-coldFooterSize); err != nil {
+		return nil, nil, err
+	}
+	if string(footer[8:]) != coldFooterMagic {
+		return nil, nil, fmt.Errorf("bad cold segment footer")
+	}
+	indexOff := int64(binary.LittleEndian.Uint64(footer[:8]))
+	if indexOff < int64(len(coldMagic)) || indexOff > size-coldFooterSize {
+		return nil, nil, fmt.Errorf("bad index offset %d", indexOff)
+	}
+
+	seg := &coldSegment{coldSegMeta: m, f: f, dataEnd: indexOff}
+	var presence []byte
+	_, err = readRecords(io.NewSectionReader(f, indexOff, size-coldFooterSize-indexOff), func(kind byte, body []byte) error {
+		if kind != coldRecordIndex {
+			return fmt.Errorf("unexpected cold record kind %d", kind)
+		}
+		d := decoder{buf: body}
+		first, last := d.uvarint(), d.uvarint()
+		seg.count = int(d.uvarint())
+		n := d.uvarint()
+		if d.err == nil && n > uint64(len(body)) {
+			return errShortRecord
+		}
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			seg.index = append(seg.index, coldIndexEntry{id: d.uvarint(), off: int64(d.uvarint())})
+		}
+		presence = bytes.Clone(d.bytes())
+		if d.err != nil {
+			return d.err
+		}
+		if first != m.first || last != m.last {
+			return fmt.Errorf("range mismatch: file [%d, %d], expected [%d, %d]", first, last, m.first, m.last)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(seg.index) == 0 {
+		return nil, nil, fmt.Errorf("empty index")
+	}
+	return seg, presence, nil
+}
+
+// removeOrphanColdSegments 删除不在 keep 中的冷数据段文件（写入后未被快照引用，通常源于崩溃）。
+func removeOrphanColdSegments(dir string, keep []coldSegMeta) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	want := make(map[string]struct{}, len(keep))
+	for _, m := range keep {
+		want[filepath.Base(coldSegmentPath(dir, m))] = struct{}{}
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, coldFilePrefix) {
+			continue
+		}
+		if _, ok := want[name]; ok {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// demote 把低于冷水位线的热事件写入新的冷数据段，并从 events 中移除。
+// 需持有 ckptMu（由 Checkpoint 调用），新的 hotBase 与冷数据段列表随后由同一次快照持久化。
+func (s *Store) demote() error {
+	if s.opts.ColdAfter <= 0 && s.opts.HotWindow == 0 && !s.spilling() {
+		return nil
+	}
+
+	s.mu.RLock()
+	base := s.hotBase
+	w := s.coldWatermarkLocked(time.Now())
+	w = min(w, base+uint64(s.events.len()))
+	if w <= base {
+		s.mu.RUnlock()
+		return nil
+	}
+	n := int(w - base)
+	var events []tree.Event
+	for i := range n {
+		if ev, ok := s.events.get(i); ok {
+			events = append(events, ev)
+		}
+	}
+	s.mu.RUnlock()
+
+	var (
+		seg      *coldSegment
+		presence []byte
+	)
+	if len(events) > 0 {
+		var err error
+		seg, presence, err = writeColdSegment(s.opts.DataDir, events)
+		if err != nil {
+			return fmt.Errorf("write cold segment: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 拷贝之后这段槽位若有变化（期间有事件被归档），本轮放弃，下次快照时重试
+	k := 0
+	for i := range n {
+		if !s.events.has(i) {
+			continue
+		}
+		if k >= len(events) || events[k].ID != base+uint64(i) {
+			k = -1
+			break
+		}
+		k++
+	}
+	if k != len(events) {
+		if seg != nil {
+			seg.f.Close()
+			os.Remove(coldSegmentPath(s.opts.DataDir, seg.coldSegMeta))
+		}
+		return nil
+	}
+	if seg != nil {
+		s.cold.add(seg, presence)
+	}
+	for _, ev := range events {
+		s.residentOutLocked(ev, s.hotMemSize(ev))
+	}
+	s.events.drop(n)
+	s.hotBase = w
+	s.hotCount -= len(events)
+	return nil
+}
+
+// coldWatermarkLocked 计算冷水位线：ID 小于返回值的热事件都应进入冷数据层（需持有 s.mu）。
+// 满足任一条件即降冷：早于 ColdAfter，不在最新的 HotWindow 个 ID 之内，或 LimitSpill 下超出内存预算。
+func (s *Store) coldWatermarkLocked(now time.Time) uint64 {
+	w := s.budgetWatermarkLocked()
+	if s.opts.HotWindow > 0 && s.nextID >= s.opts.HotWindow {
+		w = max(w, s.nextID-s.opts.HotWindow+1)
+	}
+	if s.opts.ColdAfter > 0 {
+		cutoff := now.Add(-s.opts.ColdAfter).UnixNano()
+		i := 0
+		for i < s.events.len() && (!s.events.has(i) || s.events.timeAt(i) < cutoff) {
+			i++
+		}
+		w = max(w, s.hotBase+uint64(i))
+	}
+	// 不能越过已分配的最大 ID
+	return min(w, s.nextID+1)
+}
+
+// bitsetHas 报告位图中第 i 位是否置位。
+func bitsetHas(bits []uint64, i uint64) bool {
+	w := i / 64
+	return w < uint64(len(bits)) && bits[w]&(1<<(i%64)) != 0
+}
+
+// bitsetClear 清除第 i 位。
+func bitsetClear(bits []uint64, i uint64) {
+	if w := i / 64; w < uint64(len(bits)) {
+		bits[w] &^= 1 << (i % 64)
+	}
+}
+
+// bitsetSet 置位第 i 位，必要时扩展位图。
+func bitsetSet(bits []uint64, i uint64) []uint64 {
+	w := i / 64
+	for uint64(len(bits)) <= w {
+		bits = append(bits, 0)
+	}
+	bits[w] |= 1 << (i % 64)
+	return bits
+}
@@ -0,0 +1,168 @@
+package memory
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// buildLayers 写入 roots 棵树，每棵树是宽为 width、共 layers 层的菱形 DAG；每个事件的 payload 各不相同。
+// before 在 emit 第 i 层之前调用，返回全部事件 ID（升序）与各树的根。
+func buildLayers(t *testing.T, s *Store, roots, layers, width int, before func(layer int)) (ids, rootIDs []uint64) {
+	t.Helper()
+	emit := func(typ string, n int, parents ...uint64) uint64 {
+		id := mustEmit(t, s, typ, fmt.Sprintf(`{"n":%d,"pad":"%040d"}`, n, n), parents...)
+		ids = append(ids, id)
+		return id
+	}
+	prev := make([][]uint64, roots)
+	for r := range roots {
+		root := emit("root", r)
+		rootIDs = append(rootIDs, root)
+		prev[r] = []uint64{root}
+	}
+	for l := range layers {
+		if before != nil {
+			before(l)
+		}
+		for r := range roots {
+			cur := make([]uint64, width)
+			for i := range cur {
+				a, b := prev[r][i%len(prev[r])], prev[r][(i+1)%len(prev[r])]
+				cur[i] = emit("node", len(ids), a, b)
+			}
+			prev[r] = cur
+		}
+	}
+	return ids, rootIDs
+}
+
+// dagView 是与存储位置无关的读取结果，降冷前后、重新打开后应完全相同。
+type dagView struct {
+	events      []tree.Event
+	children    [][]uint64
+	ancestors   [][]uint64
+	descendants []tree.DescendantsTree
+	provenance  tree.ProvenanceTree
+	roots       []uint64
+	heads       []uint64
+}
+
+func readDAG(t *testing.T, s *Store, ids, roots []uint64) dagView {
+	t.Helper()
+	var v dagView
+	for _, id := range ids {
+		ev, ok := s.Get(id)
+		if !ok {
+			t.Fatalf("Get(%d): not found", id)
+		}
+		kids, _ := s.Children(id)
+		anc, _ := s.Ancestors(id)
+		v.events = append(v.events, ev)
+		v.children = append(v.children, sorted(kids))
+		v.ancestors = append(v.ancestors, anc)
+	}
+	for _, r := range roots {
+		d, err := s.DescendantsTree(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		v.descendants = append(v.descendants, d)
+	}
+	p, err := s.ProvenanceTree(ids[len(ids)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.provenance = p
+	v.roots, v.heads = sorted(s.Roots()), sorted(s.Heads())
+	return v
+}
+
+// TestColdTier 检查按 ID 窗口或按时间降冷后，事件、子事件、祖先与后代/溯源树从冷数据段透明读回，Snapshot 分别报告冷热计数，
+// 冷事件可以作为新事件的父事件，重新打开后内容不变。
+func TestColdTier(t *testing.T) {
+	cases := []struct {
+		name          string
+		opts          Options
+		roots, layers int
+		width         int
+		pause         int // ColdAfter：在第 pause 层之前等待，使更早的事件超过 ColdAfter
+		wantCold      func(ids []uint64) int
+	}{
+		{
+			name: "hot window", opts: Options{HotWindow: 100},
+			roots: 3, layers: 10, width: 8,
+			wantCold: func(ids []uint64) int { return len(ids) - 100 },
+		},
+		{
+			name: "compact layout with compressed payloads", opts: Options{HotWindow: 1, Layout: LayoutCompact, PayloadCompressMin: 1},
+			roots: 2, layers: 6, width: 5,
+			wantCold: func(ids []uint64) int { return len(ids) - 1 },
+		},
+		{
+			name: "more blocks than the cache", opts: Options{HotWindow: 10},
+			roots: 1, layers: 20, width: coldIndexEvery * coldCacheBlocks / 16,
+			wantCold: func(ids []uint64) int { return len(ids) - 10 },
+		},
+		{
+			name: "cold after", opts: Options{ColdAfter: 300 * time.Millisecond},
+			roots: 2, layers: 6, width: 4, pause: 3,
+			wantCold: func([]uint64) int { return 2 + 3*2*4 },
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			opts.DataDir, opts.Sync = t.TempDir(), SyncNever
+			s, err := Open(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids, roots := buildLayers(t, s, tc.roots, tc.layers, tc.width, func(l int) {
+				if tc.pause > 0 && l == tc.pause {
+					time.Sleep(opts.ColdAfter + 50*time.Millisecond)
+				}
+			})
+			want := readDAG(t, s, ids, roots)
+
+			if _, err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			snap := s.Snapshot()
+			if cold := tc.wantCold(ids); snap.ColdEvents != cold || snap.HotEvents != len(ids)-cold || snap.ColdSegments != 1 {
+				t.Fatalf("hot/cold/segments = %d/%d/%d, want %d/%d/1", snap.HotEvents, snap.ColdEvents, snap.ColdSegments, len(ids)-cold, cold)
+			}
+			if got := readDAG(t, s, ids, roots); !reflect.DeepEqual(got, want) {
+				t.Fatal("reads after demotion differ from reads before")
+			}
+			if rep, err := s.Verify(); err != nil || !rep.OK {
+				t.Fatalf("verify: %+v, %v", rep, err)
+			}
+
+			// 冷事件作为父事件：存在性检查只看位图，children 在内存中
+			child := mustEmit(t, s, "late", "", ids[0])
+			want.children[0] = append(want.children[0], child)
+			want.heads = sorted(append(want.heads, child))
+			want.descendants = nil
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = mustOpen(t, opts)
+			if snap := s.Snapshot(); snap.ColdEvents != tc.wantCold(ids) {
+				t.Fatalf("cold events after reopen = %d, want %d", snap.ColdEvents, tc.wantCold(ids))
+			}
+			got := readDAG(t, s, ids, roots)
+			got.descendants = nil
+			if !reflect.DeepEqual(got, want) {
+				t.Fatal("reads after reopen differ from reads before demotion")
+			}
+			if rep, err := s.Verify(); err != nil || !rep.OK {
+				t.Fatalf("verify after reopen: %+v, %v", rep, err)
+			}
+		})
+	}
+}
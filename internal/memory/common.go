@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"log"
 	"slices"
 
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
@@ -24,23 +25,90 @@ func (s *Store) validateRootIDLocked(id uint64) error {
 	return nil
 }
 
-// validateRootIDsLocked 批量校验根 ID 列表（需在持锁状态调用）。
-func (s *Store) validateRootIDsLocked(rootIDs []uint64) error {
-	for _, id := range rootIDs {
-		err := s.validateRootIDLocked(id)
-		if err != nil {
-			return err
+// isEventIDValid 检查 ID 是否对应一个已存在的事件：热数据看 events 槽位，冷数据看存在性位图（需在持锁状态调用）。
+func (s *Store) isEventIDValid(id uint64) bool {
+	if id < s.hotBase {
+		if _, ok := s.revived[id]; ok {
+			return true
 		}
+		return s.cold != nil && s.cold.has(id)
 	}
-	return nil
+	i, ok := s.hotIndex(id)
+	return ok && s.events.has(i)
 }
 
-// isEventIDValid 检查 ID 对应的 events 槽位是否有效（非越界且非零值）。
-func (s *Store) isEventIDValid(id uint64) bool {
-	if id >= uint64(len(s.events)) || s.events[id].ID == 0 {
-		return false
+// hotIndex 返回 ID 在热数据中的槽位；ID 超出热数据的槽位范围时返回 false（需在持锁状态调用）。
+func (s *Store) hotIndex(id uint64) (int, bool) {
+	if id < s.hotBase || id-s.hotBase >= uint64(s.events.len()) {
+		return 0, false
+	}
+	return int(id - s.hotBase), true
+}
+
+// eventLocked 按 ID 读取事件，透明地覆盖热数据与冷数据；已归档根树的根事件会带上存根信息（需在持锁状态调用）。
+// 返回的 payload 是存储形式，需要时由调用方用 expandPayload 还原。
+func (s *Store) eventLocked(id uint64) (tree.Event, bool) {
+	ev, ok := s.lookupLocked(id)
+	if !ok {
+		return tree.Event{}, false
+	}
+	if a, archived := s.archived[id]; archived {
+		stub := a.stub
+		ev.Archived = &stub
+	}
+	return ev, true
+}
+
+// lookupLocked 依次在热数据、恢复事件与冷数据中查找事件。
+func (s *Store) lookupLocked(id uint64) (tree.Event, bool) {
+	if id >= s.hotBase {
+		i, ok := s.hotIndex(id)
+		if !ok {
+			return tree.Event{}, false
+		}
+		return s.events.get(i)
+	}
+	if ev, ok := s.revived[id]; ok {
+		return ev, true
+	}
+	if s.cold == nil {
+		return tree.Event{}, false
+	}
+	ev, ok, err := s.cold.get(id)
+	if err != nil {
+		log.Printf("cold: read event %d: %v", id, err)
+		return tree.Event{}, false
+	}
+	return ev, ok
+}
+
+// forEachOnlineLocked 对全部在线事件（热数据、恢复事件与冷数据）调用 fn，不保证 ID 顺序（需持有 s.mu）。
+// 冷事件需要逐个读盘，读不出的事件以 what 为前缀记录日志后跳过。
+func (s *Store) forEachOnlineLocked(what string, fn func(ev tree.Event)) {
+	for i := range s.events.len() {
+		if ev, ok := s.events.get(i); ok {
+			fn(ev)
+		}
+	}
+	for _, ev := range s.revived {
+		fn(ev)
+	}
+	if s.cold == nil {
+		return
+	}
+	for _, m := range s.cold.metas() {
+		for id := m.first; id <= m.last; id++ {
+			if !s.cold.has(id) {
+				continue
+			}
+			ev, ok := s.lookupLocked(id)
+			if !ok {
+				log.Printf("%s: cold event %d cannot be read", what, id)
+				continue
+			}
+			fn(ev)
+		}
 	}
-	return true
 }
 
 // sortedChildIDs 返回 children 列表的排序副本，不修改原 slice。
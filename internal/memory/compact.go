@@ -0,0 +1,267 @@
+package memory
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"unsafe"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+const (
+	compactChunkSize = 1024 // 每块的槽位数
+	compactInlineMax = 256  // 不超过该字节数的 Message 与父事件列表内联在块的字节区中，更长的单独保存
+)
+
+// compactEvents 是紧凑布局的热数据（LayoutCompact）。槽位按 compactChunkSize 分块，每块保存：
+//   - 三列定长数据：时间戳、类型编号（0 表示空槽位）、记录在字节区中的起始位置；
+//   - 字节区 data：每个事件一条变长记录，依次是 Message、payload、父事件列表三个字段；
+//   - blobs：不内联的字段内容，包括较长的 Message 与父事件列表，以及与去重表共享的 payload。
+//
+// 字段编码为 uvarint(n<<1) 加 n 字节内联内容，或 uvarint(k<<1|1) 表示 blobs[k]。
+// 父事件列表编码为每个父事件相对自身的 ID 差（uvarint），父事件通常紧挨着子事件，多数只占 1～2 字节。
+// 事件 ID 由槽位推出，不单独保存。
+//
+// 字节区只追加、不修改，读出的 Message 与 payload 直接引用其中的内容而不拷贝。
+// 清空槽位（归档）只释放 blobs 中的引用，记录本身留到整块随降冷移除时一并释放。
+type compactEvents struct {
+	types  *typeTable
+	base   uint64 // 槽位 0 对应的事件 ID
+	skip   int    // chunks[0] 中位于槽位 0 之前（已移除）的槽位数
+	n      int    // 槽位数
+	chunks []*compactChunk
+}
+
+// compactChunk 是 compactChunkSize 个连续槽位的列与字节区。
+type compactChunk struct {
+	time  []int64
+	typ   []uint32
+	off   []uint32
+	data  []byte
+	blobs [][]byte
+}
+
+func newCompactEvents(types *typeTable, base uint64) *compactEvents {
+	return &compactEvents{types: types, base: base}
+}
+
+// slot 返回槽位 i 所在的块与块内下标；槽位不存在时块为 nil。
+func (c *compactEvents) slot(i int) (*compactChunk, int) {
+	if i < 0 || i >= c.n {
+		return nil, 0
+	}
+	a := c.skip + i
+	return c.chunks[a/compactChunkSize], a % compactChunkSize
+}
+
+func (c *compactEvents) len() int { return c.n }
+
+func (c *compactEvents) has(i int) bool {
+	ch, j := c.slot(i)
+	return ch != nil && ch.typ[j] != 0
+}
+
+func (c *compactEvents) get(i int) (tree.Event, bool) {
+	ch, j := c.slot(i)
+	if ch == nil || ch.typ[j] == 0 {
+		return tree.Event{}, false
+	}
+	ev := tree.Event{
+		ID:           c.base + uint64(i),
+		TimeUnixNano: ch.time[j],
+		Type:         c.types.names[ch.typ[j]],
+	}
+
+	rec := ch.data[ch.off[j]:]
+	msg, rec := ch.field(rec)
+	if len(msg) > 0 {
+		ev.Message = unsafe.String(&msg[0], len(msg))
+	}
+	payload, rec := ch.field(rec)
+	if len(payload) > 0 {
+		ev.Payload = json.RawMessage(payload)
+	}
+	deltas, _ := ch.field(rec)
+	ev.Parents = make([]uint64, 0, parentCount(deltas))
+	for len(deltas) > 0 {
+		d, k := binary.Uvarint(deltas)
+		ev.Parents = append(ev.Parents, ev.ID-d)
+		deltas = deltas[k:]
+	}
+	return ev, true
+}
+
+func (c *compactEvents) timeAt(i int) int64 {
+	ch, j := c.slot(i)
+	return ch.time[j]
+}
+
+func (c *compactEvents) put(i int, ev tree.Event) {
+	if i >= c.n {
+		c.n = i + 1
+	}
+	for a := c.skip + i; len(c.chunks) <= a/compactChunkSize; {
+		c.chunks = append(c.chunks, &compactChunk{
+			time: make([]int64, compactChunkSize),
+			typ:  make([]uint32, compactChunkSize),
+			off:  make([]uint32, compactChunkSize),
+		})
+	}
+	ch, j := c.slot(i)
+	ch.time[j] = ev.TimeUnixNano
+	ch.typ[j] = c.types.intern(ev.Type)
+	ch.off[j] = uint32(len(ch.data))
+	ch.data = ch.appendRecord(ch.data, ev)
+
+	// 事件按 ID 顺序写入，块的最后一个槽位写完后收紧字节区，去掉 append 扩容留下的余量
+	if j == compactChunkSize-1 {
+		ch.data = slices.Clone(ch.data)
+	}
+}
+
+func (c *compactEvents) clear(i int) {
+	ch, j := c.slot(i)
+	if ch == nil || ch.typ[j] == 0 {
+		return
+	}
+	rec := ch.data[ch.off[j]:]
+	for range 3 {
+		tag, k := binary.Uvarint(rec)
+		rec = rec[k:]
+		if tag&1 == 1 {
+			ch.blobs[tag>>1] = nil
+		} else {
+			rec = rec[tag>>1:]
+		}
+	}
+	ch.typ[j] = 0
+}
+
+func (c *compactEvents) drop(n int) {
+	n = min(n, c.n)
+	a := c.skip + n
+	k := min(a/compactChunkSize, len(c.chunks))
+	c.chunks = slices.Clone(c.chunks[k:])
+	c.skip = a - k*compactChunkSize
+	c.base += uint64(n)
+	c.n -= n
+}
+
+// clone 拷贝每块的三列与 blobs；字节区只追加，共享即可。
+func (c *compactEvents) clone() hotEvents {
+	out := *c
+	out.chunks = make([]*compactChunk, len(c.chunks))
+	for k, ch := range c.chunks {
+		out.chunks[k] = &compactChunk{
+			time:  slices.Clone(ch.time),
+			typ:   slices.Clone(ch.typ),
+			off:   slices.Clone(ch.off),
+			data:  ch.data[:len(ch.data):len(ch.data)],
+			blobs: slices.Clone(ch.blobs),
+		}
+	}
+	// 克隆只用于读取，类型表在此之后仍可能登记新类型，但已有编号不会改变
+	out.types = &typeTable{names: slices.Clip(c.types.names)}
+	return &out
+}
+
+// appendRecord 追加事件的变长记录：Message、payload、父事件列表。
+// 不小于 payloadDedupMin 字节的 payload 来自去重表，以 blob 引用共享，不拷贝。
+func (ch *compactChunk) appendRecord(buf []byte, ev tree.Event) []byte {
+	buf = ch.appendField(buf, unsafe.Slice(unsafe.StringData(ev.Message), len(ev.Message)), len(ev.Message) <= compactInlineMax)
+	buf = ch.appendField(buf, ev.Payload, len(ev.Payload) < payloadDedupMin)
+
+	n := parentDeltaLen(ev)
+	var deltas []byte
+	if n <= compactInlineMax {
+		buf = binary.AppendUvarint(buf, uint64(n)<<1)
+		deltas = buf
+	} else {
+		deltas = make([]byte, 0, n)
+	}
+	for _, p := range ev.Parents {
+		deltas = binary.AppendUvarint(deltas, ev.ID-p)
+	}
+	if n <= compactInlineMax {
+		return deltas
+	}
+	return ch.appendBlob(buf, deltas)
+}
+
+// appendField 以内联或 blob 引用的形式追加一个字段。blob 直接引用 b：Message 的字符串与去重表中的 payload 都不会被修改。
+func (ch *compactChunk) appendField(buf, b []byte, inline bool) []byte {
+	if inline {
+		buf = binary.AppendUvarint(buf, uint64(len(b))<<1)
+		return append(buf, b...)
+	}
+	return ch.appendBlob(buf, b)
+}
+
+func (ch *compactChunk) appendBlob(buf, b []byte) []byte {
+	buf = binary.AppendUvarint(buf, uint64(len(ch.blobs))<<1|1)
+	ch.blobs = append(ch.blobs, b)
+	return buf
+}
+
+// field 读出一个字段的内容，返回内容与剩余的记录。内联内容的容量被截断，调用方不能借此改写字节区。
+func (ch *compactChunk) field(rec []byte) ([]byte, []byte) {
+	tag, k := binary.Uvarint(rec)
+	rec = rec[k:]
+	if tag&1 == 1 {
+		return ch.blobs[tag>>1], rec
+	}
+	n := tag >> 1
+	return rec[:n:n], rec[n:]
+}
+
+// parentDeltaLen 返回父事件列表编码后的字节数。
+func parentDeltaLen(ev tree.Event) int {
+	n := 0
+	for _, p := range ev.Parents {
+		n += uvarintLen(ev.ID - p)
+	}
+	return n
+}
+
+// parentCount 返回父事件列表编码中的父事件数：每个 uvarint 恰有一个最高位为 0 的字节。
+func parentCount(deltas []byte) int {
+	n := 0
+	for _, b := range deltas {
+		if b < 0x80 {
+			n++
+		}
+	}
+	return n
+}
+
+func uvarintLen(x uint64) int {
+	n := 1
+	for x >= 0x80 {
+		x >>= 7
+		n++
+	}
+	return n
+}
+
+// compactMemSize 估算紧凑布局下事件除 payload 外占用的字节数：三列共 16 字节，记录中的字段头与内联内容，
+// 单独保存的内容另加 24 字节的切片头，以及父事件 children 列表中的对应项（每个 8 字节）。
+// 内联的 payload 已计入 payloadStored，这里不重复计算。ID 尚未分配时父事件按最长编码估算，偏保守。
+func compactMemSize(ev tree.Event) int64 {
+	const blobHeader = int64(unsafe.Sizeof([]byte(nil)))
+	size := int64(16 + 3)
+	if len(ev.Message) <= compactInlineMax {
+		size += int64(len(ev.Message))
+	} else {
+		size += blobHeader + int64(len(ev.Message))
+	}
+	if len(ev.Payload) >= payloadDedupMin {
+		size += blobHeader
+	}
+	if n := int64(parentDeltaLen(ev)); n <= compactInlineMax {
+		size += n
+	} else {
+		size += blobHeader + n
+	}
+	return size + 8*int64(len(ev.Parents))
+}
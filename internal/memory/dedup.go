@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// payloadRef 是持久化格式中重复 payload 的首字节：payloadRef | uvarint(序号)。
+// 序号指向同一作用域（一个 WAL 日志段、快照文件、冷数据块或归档文件）内更早以原样写出的 payload。
+// 与 payloadFlate 一样，合法 JSON 不会以该字节开头，旧文件无需迁移即可读取。
+const payloadRef byte = 0x02
+
+// payloadDedupMin 是参与去重的最小 payload 存储字节数：更小的 payload 连一个去重表项都抵不上。
+const payloadDedupMin = 64
+
+// payloadKey 是 payload 存储形式的 SHA-256。
+type payloadKey [sha256.Size]byte
+
+// sharedPayload 是内存去重表中的一项：内容相同的事件共享 data，refs 为引用它的内存事件数。
+type sharedPayload struct {
+	data json.RawMessage
+	refs int
+}
+
+// retainPayloadLocked 在事件进入内存时调用：更新 payload 统计，并返回可共享的 payload（需持有 s.mu）。
+func (s *Store) retainPayloadLocked(p json.RawMessage) json.RawMessage {
+	raw, stored := payloadSizes(p)
+	s.payloadRaw += int64(raw)
+	if len(p) < payloadDedupMin {
+		s.payloadStored += int64(stored)
+		return p
+	}
+
+	key := payloadKey(sha256.Sum256(p))
+	sp, ok := s.payloads[key]
+	if ok {
+		s.payloadDedup += int64(stored)
+	} else {
+		sp = &sharedPayload{data: p}
+		s.payloads[key] = sp
+		s.payloadStored += int64(stored)
+	}
+	sp.refs++
+	s.payloadShared++
+	return sp.data
+}
+
+// resetPayloadsLocked 清空去重表与 payload 统计（加载快照前调用）。
+func (s *Store) resetPayloadsLocked() {
+	s.payloads = make(map[payloadKey]*sharedPayload)
+	s.payloadRaw, s.payloadStored, s.payloadDedup, s.payloadShared = 0, 0, 0, 0
+}
+
+// releasePayloadLocked 在事件离开内存（降冷或归档）时调用，引用数归零的共享 payload 随之释放（需持有 s.mu）。
+func (s *Store) releasePayloadLocked(p json.RawMessage) {
+	raw, stored := payloadSizes(p)
+	s.payloadRaw -= int64(raw)
+	if len(p) < payloadDedupMin {
+		s.payloadStored -= int64(stored)
+		return
+	}
+
+	key := payloadKey(sha256.Sum256(p))
+	sp, ok := s.payloads[key]
+	if !ok {
+		return
+	}
+	s.payloadShared--
+	if sp.refs--; sp.refs > 0 {
+		s.payloadDedup -= int64(stored)
+		return
+	}
+	delete(s.payloads, key)
+	s.payloadStored -= int64(stored)
+}
+
+// payloadDict 是一个持久化作用域内的 payload 字典，编码与解码两端以相同规则为原样写出的 payload 依次编号：
+// 不小于 payloadDedupMin 字节的 payload 第一次出现时原样写出并获得下一个序号，之后改写为 payloadRef 引用。
+// nil 字典表示不去重。
+type payloadDict struct {
+	list  []json.RawMessage     // 序号 -> payload（解码端）
+	index map[payloadKey]uint64 // payload -> 序号（编码端）
+	keys  []payloadKey          // 按序号排列的 index 键，用于回滚
+}
+
+// newPayloadDict 创建一个空字典。
+func newPayloadDict() *payloadDict {
+	return &payloadDict{index: make(map[payloadKey]uint64)}
+}
+
+// encode 返回 payload 在该作用域内的写出形式：已出现过的内容改写为引用，否则原样返回并登记序号。
+func (d *payloadDict) encode(p json.RawMessage) json.RawMessage {
+	if d == nil || len(p) < payloadDedupMin {
+		return p
+	}
+	key := payloadKey(sha256.Sum256(p))
+	if n, ok := d.index[key]; ok {
+		return binary.AppendUvarint([]byte{payloadRef}, n)
+	}
+	d.index[key] = uint64(len(d.keys))
+	d.keys = append(d.keys, key)
+	return p
+}
+
+// decode 将读出的 payload 还原为存储形式：引用按序号取回，原样写出的内容登记序号。
+func (d *payloadDict) decode(p json.RawMessage) (json.RawMessage, error) {
+	if len(p) == 0 || p[0] != payloadRef {
+		if d != nil && len(p) >= payloadDedupMin {
+			d.list = append(d.list, p)
+		}
+		return p, nil
+	}
+	n, k := binary.Uvarint(p[1:])
+	if d == nil || k <= 0 || k != len(p)-1 || n >= uint64(len(d.list)) {
+		return nil, fmt.Errorf("bad payload reference")
+	}
+	return d.list[n], nil
+}
+
+// mark 返回编码端当前的序号，供写入失败时 rollback。
+func (d *payloadDict) mark() int {
+	return len(d.keys)
+}
+
+// rollback 撤销 mark 之后登记的序号：对应的记录没有写出，后续内容不能引用它们。
+func (d *payloadDict) rollback(mark int) {
+	for _, key := range d.keys[mark:] {
+		delete(d.index, key)
+	}
+	d.keys = d.keys[:mark]
+}
+
+// writer 将解码端字典转为编码端字典，用于在已有日志段末尾继续追加。
+func (d *payloadDict) writer() *payloadDict {
+	w := newPayloadDict()
+	if d == nil {
+		return w
+	}
+	for i, p := range d.list {
+		key := payloadKey(sha256.Sum256(p))
+		if _, ok := w.index[key]; !ok {
+			w.index[key] = uint64(i)
+		}
+		w.keys = append(w.keys, key)
+	}
+	return w
+}
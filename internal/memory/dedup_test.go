@@ -0,0 +1,149 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestPayloadDedup 检查内容相同的 payload 在内存中共享一份、引用数与节省字节数正确，
+// 降冷时释放引用，持久化格式中重复的 payload 只写一次，快照与 WAL 回放后统计不变。
+func TestPayloadDedup(t *testing.T) {
+	cases := []struct {
+		name       string
+		persist    bool
+		opts       Options
+		checkpoint bool
+		hot        int // 应常驻内存的最新事件数，0 表示全部
+	}{
+		{name: "memory only"},
+		{name: "replayed from the wal", persist: true},
+		{name: "loaded from a checkpoint", persist: true, checkpoint: true},
+		{name: "compressed", persist: true, opts: Options{PayloadCompressMin: 1}, checkpoint: true},
+		{name: "cold segments release refs", persist: true, opts: Options{HotWindow: 10}, checkpoint: true, hot: 10},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := tc.opts
+			if tc.persist {
+				opts.DataDir, opts.Sync = t.TempDir(), SyncNever
+			}
+			s := mustOpen(t, opts)
+
+			// 三个大 payload 轮流出现（压缩后仍不小于 payloadDedupMin），小于 payloadDedupMin 的 payload 不参与去重
+			blobs := make([]string, 3)
+			for i := range blobs {
+				var body strings.Builder
+				for k := range 200 {
+					fmt.Fprintf(&body, "k%d=%d;", k, k*k*(i+7)%1009)
+				}
+				blobs[i] = fmt.Sprintf(`{"config":%d,"body":%q}`, i, body.String())
+			}
+			var (
+				ids      []uint64
+				payloads []string
+				raw      int64
+			)
+			for i := range 40 {
+				p := blobs[i%3]
+				if i%4 == 3 {
+					p = `{"small":true}`
+				}
+				ids = append(ids, mustEmit(t, s, "task.created", p))
+				payloads = append(payloads, p)
+				raw += int64(len(p))
+			}
+
+			// want 按应常驻内存的事件重新计算去重统计
+			type want struct {
+				unique, shared int
+				dedup          int64
+			}
+			demoted := false
+			expect := func() want {
+				var w want
+				seen := map[string]bool{}
+				start := 0
+				if demoted {
+					start = len(payloads) - tc.hot
+				}
+				for _, p := range payloads[start:] {
+					stored := len(s.compressPayload(json.RawMessage(p)))
+					if stored < payloadDedupMin {
+						continue
+					}
+					w.shared++
+					if seen[p] {
+						w.dedup += int64(stored)
+					} else {
+						seen[p] = true
+						w.unique++
+					}
+				}
+				return w
+			}
+			check := func(stage string) {
+				t.Helper()
+				snap := s.Snapshot()
+				w := expect()
+				if w.dedup == 0 {
+					t.Fatalf("%s: no payload is deduplicated", stage)
+				}
+				if got := (want{snap.PayloadUnique, snap.PayloadSharedRefs, snap.PayloadDedupBytes}); got != w {
+					t.Fatalf("%s: unique/shared/dedup = %+v, want %+v", stage, got, w)
+				}
+				if snap.TotalPayloadBytes != raw {
+					t.Fatalf("%s: total payload bytes = %d, want %d", stage, snap.TotalPayloadBytes, raw)
+				}
+				for i, id := range ids {
+					if ev, ok := s.Get(id); !ok || string(ev.Payload) != payloads[i] {
+						t.Fatalf("%s: Get(%d) payload = %.40q, want %.40q", stage, id, ev.Payload, payloads[i])
+					}
+				}
+				// 常驻内存的相同 payload 指向同一份数据
+				n := len(ids)
+				s.mu.RLock()
+				a, _ := s.lookupLocked(ids[n-3])
+				b, _ := s.lookupLocked(ids[n-6])
+				s.mu.RUnlock()
+				if string(a.Payload) != string(b.Payload) || &a.Payload[0] != &b.Payload[0] {
+					t.Fatalf("%s: events %d and %d do not share their payload", stage, a.ID, b.ID)
+				}
+				if rep, err := s.Verify(); err != nil || !rep.OK {
+					t.Fatalf("%s: verify: %+v, %v", stage, rep, err)
+				}
+			}
+			check("after emit")
+			if !tc.persist {
+				return
+			}
+
+			// WAL 中每个大 payload 只原样写出一次
+			seqs, err := listWALSegments(opts.DataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			fi, err := os.Stat(walSegmentPath(opts.DataDir, seqs[len(seqs)-1]))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Size() > raw/4 {
+				t.Fatalf("wal holds %d bytes for %d payload bytes, want duplicates written as references", fi.Size(), raw)
+			}
+			if tc.checkpoint {
+				if _, err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+				demoted = tc.hot > 0
+			}
+			check("after checkpoint")
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = mustOpen(t, opts)
+			check("after reopen")
+		})
+	}
+}
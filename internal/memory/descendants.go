@@ -2,115 +2,100 @@ package memory
 
 import "github.com/Mr-xiaotian/CelestialTree/internal/tree"
 
-// descendantsTreeLocked 递归构建以 rootID 为根的后代树（仅 ID），visited 用于环检测。
-func (s *Store) descendantsTreeLocked(rootID uint64, visited map[uint64]struct{}) tree.DescendantsTree {
-	if _, seen := visited[rootID]; seen {
-		return tree.DescendantsTree{ID: rootID, IsRef: true, Children: nil}
-	}
-	visited[rootID] = struct{}{}
-
-	node := tree.DescendantsTree{ID: rootID, Children: []tree.DescendantsTree{}}
-
-	childSli := s.children[rootID]
-	for _, childID := range sortedChildIDs(childSli) {
-		node.Children = append(node.Children, s.descendantsTreeLocked(childID, visited))
-	}
-	return node
+// descendantsShape 构建后代树（仅 ID）：下一层是视图内的直接子事件。
+var descendantsShape = treeShape[tree.DescendantsTree]{
+	kind:  cursorDescendants,
+	edges: (*readView).children,
+	node: func(_ *readView, id uint64, ref bool) tree.DescendantsTree {
+		if ref {
+			return tree.DescendantsTree{ID: id, IsRef: true, Children: nil}
+		}
+		return tree.DescendantsTree{ID: id, Children: []tree.DescendantsTree{}}
+	},
+	attach:   func(p *tree.DescendantsTree, c tree.DescendantsTree) { p.Children = append(p.Children, c) },
+	truncate: func(n *tree.DescendantsTree) { n.Truncated = true },
+	fail: func(id uint64, err error) tree.DescendantsTree {
+		return tree.DescendantsTree{ID: id, Error: err.Error()}
+	},
 }
 
-// descendantsTreeMetaLocked 递归构建以 rootID 为根的后代树（含元数据），visited 用于环检测。
-func (s *Store) descendantsTreeMetaLocked(rootID uint64, visited map[uint64]struct{}) tree.DescendantsTreeMeta {
-	ev := s.events[rootID]
-
-	if _, seen := visited[rootID]; seen {
-		return tree.DescendantsTreeMeta{
-			ID:           rootID,
+// descendantsMetaShape 构建后代树（含元数据）。
+var descendantsMetaShape = treeShape[tree.DescendantsTreeMeta]{
+	kind:  cursorDescendants,
+	edges: (*readView).children,
+	node: func(v *readView, id uint64, ref bool) tree.DescendantsTreeMeta {
+		ev, _ := v.event(id)
+		node := tree.DescendantsTreeMeta{
+			ID:           id,
 			TimeUnixNano: ev.TimeUnixNano,
 			Type:         ev.Type,
 			Message:      ev.Message,
-			Payload:      ev.Payload,
-			IsRef:        true,
+			Payload:      expandPayload(ev.Payload),
+			Archived:     ev.Archived,
+			IsRef:        ref,
 		}
-	}
-	visited[rootID] = struct{}{}
-
-	node := tree.DescendantsTreeMeta{
-		ID:           rootID,
-		TimeUnixNano: ev.TimeUnixNano,
-		Type:         ev.Type,
-		Message:      ev.Message,
-		Payload:      ev.Payload,
-		IsRef:        false,
-		Children:     []tree.DescendantsTreeMeta{},
-	}
-
-	childSet := s.children[rootID]
-	for _, childID := range sortedChildIDs(childSet) {
-		node.Children = append(node.Children, s.descendantsTreeMetaLocked(childID, visited))
-	}
-	return node
+		if !ref {
+			node.Children = []tree.DescendantsTreeMeta{}
+		}
+		return node
+	},
+	attach:   func(p *tree.DescendantsTreeMeta, c tree.DescendantsTreeMeta) { p.Children = append(p.Children, c) },
+	truncate: func(n *tree.DescendantsTreeMeta) { n.Truncated = true },
+	fail: func(id uint64, err error) tree.DescendantsTreeMeta {
+		return tree.DescendantsTreeMeta{ID: id, Error: err.Error()}
+	},
 }
 
 // DescendantsTree 返回以 rootID 为根的后代树（仅包含 ID 和结构）。
 func (s *Store) DescendantsTree(rootID uint64) (tree.DescendantsTree, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	v := s.openView()
+	defer v.close()
 
 	err := s.validateRootIDLocked(rootID)
 	if err != nil {
 		return tree.DescendantsTree{}, err
 	}
 
-	visited := make(map[uint64]struct{})
-	return s.descendantsTreeLocked(rootID, visited), nil
+	return walkTree(v, descendantsShape, rootID), nil
 }
 
 // DescendantsTreeMeta 返回以 rootID 为根的后代树（含事件元数据）。
 func (s *Store) DescendantsTreeMeta(rootID uint64) (tree.DescendantsTreeMeta, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	v := s.openView()
+	defer v.close()
 
 	err := s.validateRootIDLocked(rootID)
 	if err != nil {
 		return tree.DescendantsTreeMeta{}, err
 	}
 
-	visited := make(map[uint64]struct{})
-	return s.descendantsTreeMetaLocked(rootID, visited), nil
+	return walkTree(v, descendantsMetaShape, rootID), nil
 }
 
-// DescendantsForest 批量返回多个根节点的后代树（仅 ID）。
-func (s *Store) DescendantsForest(rootIDs []uint64) ([]tree.DescendantsTree, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	err := s.validateRootIDsLocked(rootIDs)
-	if err != nil {
-		return nil, err
-	}
-
-	out := make([]tree.DescendantsTree, 0, len(rootIDs))
-	for _, id := range rootIDs {
-		visited := make(map[uint64]struct{})
-		out = append(out, s.descendantsTreeLocked(id, visited))
-	}
-	return out, nil
+// DescendantsForest 批量返回多个根节点的后代树（仅 ID），各树并行构建；根 ID 无效的树只在对应位置带上 Error。
+func (s *Store) DescendantsForest(rootIDs []uint64) []tree.DescendantsTree {
+	return buildForest(s, descendantsShape, rootIDs)
 }
 
-// DescendantsForestMeta 批量返回多个根节点的后代树（含元数据）。
-func (s *Store) DescendantsForestMeta(rootIDs []uint64) ([]tree.DescendantsTreeMeta, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// DescendantsForestMeta 批量返回多个根节点的后代树（含元数据），各树并行构建；根 ID 无效的树只在对应位置带上 Error。
+func (s *Store) DescendantsForestMeta(rootIDs []uint64) []tree.DescendantsTreeMeta {
+	return buildForest(s, descendantsMetaShape, rootIDs)
+}
 
-	err := s.validateRootIDsLocked(rootIDs)
+// DescendantsPage 按 opts 的深度与节点数限制返回后代树（仅 ID）的一页。
+func (s *Store) DescendantsPage(rootID uint64, opts tree.TraverseOptions) (tree.DescendantsPage, error) {
+	trees, truncated, cursor, err := treePage(s, descendantsShape, rootID, opts)
 	if err != nil {
-		return nil, err
+		return tree.DescendantsPage{}, err
 	}
+	return tree.DescendantsPage{Trees: trees, Truncated: truncated, Cursor: cursor}, nil
+}
 
-	out := make([]tree.DescendantsTreeMeta, 0, len(rootIDs))
-	for _, id := range rootIDs {
-		visited := make(map[uint64]struct{})
-		out = append(out, s.descendantsTreeMetaLocked(id, visited))
+// DescendantsPageMeta 按 opts 的深度与节点数限制返回后代树（含元数据）的一页。
+func (s *Store) DescendantsPageMeta(rootID uint64, opts tree.TraverseOptions) (tree.DescendantsMetaPage, error) {
+	trees, truncated, cursor, err := treePage(s, descendantsMetaShape, rootID, opts)
+	if err != nil {
+		return tree.DescendantsMetaPage{}, err
 	}
-	return out, nil
+	return tree.DescendantsMetaPage{Trees: trees, Truncated: truncated, Cursor: cursor}, nil
 }
@@ -1,6 +1,7 @@
 package memory
 
 import (
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync/atomic"
@@ -12,13 +13,124 @@ import (
 // Emit 追加一个事件到 DAG 中。
 func (s *Store) Emit(req tree.EmitRequest) (tree.Event, error) {
 	if strings.TrimSpace(req.Type) == "" {
-		return tree.Event{}, fmt.Errorf("type is required")
+		return tree.Event{}, emitErrorf("type is required")
 	}
 
-	// parents 去重 + 过滤 0
-	parents := make([]uint64, 0, len(req.Parents))
+	parents := normalizeParents(req.Parents)
+
+	// 压缩与索引键的提取在锁外完成；WAL 与内存保存存储形式
+	stored := s.compressPayload(req.Payload)
+	keys := s.indexKeysOf(req.Payload, req.Message)
+
+	// 编码后超过单条 WAL 记录上限的事件写入后无法回放，在分配 ID 之前拒绝
+	if err := checkEventSize(tree.Event{Type: req.Type, Message: req.Message, Payload: stored, Parents: parents}); err != nil {
+		return tree.Event{}, err
+	}
+
+	s.commitGate.RLock()
+	defer s.commitGate.RUnlock()
+	s.mu.Lock()
+
+	// 父事件必须存在：否则历史图会断裂
+	for _, p := range parents {
+		if !s.isEventIDValid(p) {
+			s.mu.Unlock()
+			return tree.Event{}, emitErrorf("parent %d not found", p)
+		}
+	}
+
+	ev := tree.Event{
+		Message: req.Message,
+		Payload: stored,
+		Parents: parents,
+	}
+
+	// 内存达到上限时拒绝写入（LimitSpill 下只通知后台降冷）
+	size := s.hotMemSize(ev) + int64(len(stored))
+	if err := s.admitLocked(1, size); err != nil {
+		s.mu.Unlock()
+		return tree.Event{}, err
+	}
+
+	// 校验全部通过后才在锁内分配 ID 与时间戳：被拒绝的写入不消耗 ID，
+	// ID 连续且与提交顺序一致，时间戳随 ID 单调不减
+	ev.ID = s.nextID + uint64(s.reserved) + 1
+	ev.TimeUnixNano = time.Now().UnixNano()
+	ev.Type = s.internType(req.Type)
+
+	// 返回值与广播使用原始 payload
+	out := ev
+	out.Payload = req.Payload
+	encode := func(buf []byte, dict *payloadDict) []byte {
+		return appendEvent(buf, ev, dict)
+	}
+	// 先写 WAL，再修改内存：落盘失败则本次写入整体失败，ID 不前进。
+	// 追加事件到 DAG 中的过程是原子的：要么完全成功，要么完全失败，不会出现中间状态。
+	if err := s.commitLocked(1, size, walRecordEvent, encode, func() {
+		s.applyLocked(ev, keys)
+		atomic.StoreUint64(&s.nextID, ev.ID)
+		s.rate.add(time.Now(), 1)
+		// 广播在锁内完成，订阅者按 ID 顺序收到事件（非阻塞，慢订阅者可能丢事件：v0 的取舍）
+		s.broadcast(out)
+	}); err != nil {
+		return tree.Event{}, err
+	}
+	return out, nil
+}
+
+// commitLocked 把已分配 ID 的 n 个事件（估算共 size 字节）写入 WAL，落盘后在持有 s.mu 时调用 publish 修改内存。
+// 调用时需持有 s.mu 与 commitGate 的读锁，返回时 s.mu 已释放。纯内存 Store 直接在锁内发布；
+// 持久化 Store 在锁内以 stage 暂存记录并预留 ID，释放 s.mu 后经组提交写出与 fsync，读取与其他写入的暂存不必等待磁盘。
+// 组提交失败时预留被释放，ID 不前进。
+func (s *Store) commitLocked(n int, size int64, kind byte, encode func(buf []byte, dict *payloadDict) []byte, publish func()) error {
+	if s.wal == nil {
+		publish()
+		s.mu.Unlock()
+		return nil
+	}
+	s.reserved += n
+	s.reservedBytes += size
+	release := func() {
+		s.reserved -= n
+		s.reservedBytes -= size
+	}
+	c, err := s.wal.stage(kind, encode, func(err error) {
+		release()
+		if err == nil {
+			publish()
+		}
+	})
+	if err != nil {
+		release()
+		s.mu.Unlock()
+		return fmt.Errorf("wal append failed: %w", err)
+	}
+	s.mu.Unlock()
+
+	if err := s.wal.commit(c, &s.mu); err != nil {
+		return fmt.Errorf("wal append failed: %w", err)
+	}
+	return nil
+}
+
+// checkEventSize 拒绝编码后可能超过单条 WAL 记录上限（recordMaxSize）的事件。
+func checkEventSize(ev tree.Event) error {
+	if n := eventSizeBound(ev); n > maxRecordBody {
+		return emitErrorf("event too large: up to %d bytes encoded, limit is %d", n, maxRecordBody)
+	}
+	return nil
+}
+
+// emitErrorf 返回写入请求无效的 *tree.EmitError。
+func emitErrorf(format string, args ...any) error {
+	return &tree.EmitError{Reason: fmt.Sprintf(format, args...)}
+}
+
+// normalizeParents 对 parents 去重并过滤 0，保持原有顺序。
+func normalizeParents(ps []uint64) []uint64 {
+	parents := make([]uint64, 0, len(ps))
 	seen := map[uint64]struct{}{}
-	for _, p := range req.Parents {
+	for _, p := range ps {
 		if p == 0 {
 			continue
 		}
@@ -28,52 +140,62 @@ func (s *Store) Emit(req tree.EmitRequest) (tree.Event, error) {
 		seen[p] = struct{}{}
 		parents = append(parents, p)
 	}
+	return parents
+}
 
-	now := time.Now().UnixNano()
-	id := atomic.AddUint64(&s.nextID, 1)
-
-	ev := tree.Event{
-		ID:           id,
-		TimeUnixNano: now,
-		Type:         s.internType(req.Type),
-		Message:      req.Message,
-		Payload:      req.Payload,
-		Parents:      parents,
-	}
+// indexKeys 是事件在字段索引与全文索引中的键。写入路径在取锁之前用 indexKeysOf 提取，applyLocked 在锁内只做插入；
+// 零值表示未提取（WAL 回放、归档恢复），由 applyLocked 在锁内提取。
+type indexKeys struct {
+	fields fieldValues
+	terms  []string // Message 中不重复的词，见 messageTerms
+}
 
-	s.mu.Lock()
+// indexKeysOf 在锁外提取事件的索引键，payload 为原始 JSON 形式。
+func (s *Store) indexKeysOf(payload json.RawMessage, message string) indexKeys {
+	return indexKeys{fields: s.extractFieldValues(payload), terms: s.messageTerms(message)}
+}
 
-	// 父事件必须存在：否则历史图会断裂
-	for _, p := range parents {
-		if !s.isEventIDValid(p) {
-			s.mu.Unlock()
-			return tree.Event{}, fmt.Errorf("parent %d not found", p)
-		}
+// applyLocked 将已校验的事件（payload 为存储形式）写入 events，并维护 heads/roots/children、类型、时间、字段与全文索引以及统计计数（需在持锁状态调用）。
+// keys 是调用方在锁外提取的索引键；零值，或提取后字段索引集合已变化时，在锁内重新提取。
+func (s *Store) applyLocked(ev tree.Event, keys indexKeys) {
+	// 写入事件：Emit 与 WAL 回放的 ID 总是不低于 hotBase，更低的 ID 只会来自归档恢复
+	switch {
+	case ev.ID >= s.hotBase:
+		s.residentInLocked(&ev, s.hotMemSize(ev))
+		s.events.put(int(ev.ID-s.hotBase), ev)
+		s.hotCount++
+	case s.cold != nil && s.cold.unhide(ev.ID):
+		// 事件本体仍在冷数据段中，取消隐藏即可
+	default:
+		s.residentInLocked(&ev, eventMemSize(ev))
+		s.revived[ev.ID] = ev
 	}
-
-	// 写入事件
-	for uint64(len(s.events)) <= id {
-		s.events = append(s.events, tree.Event{})
+	s.stats.addEvent(ev)
+	s.byType.add(s.types.intern(ev.Type), ev.ID)
+	s.byTime.add(ev.ID, ev.TimeUnixNano)
+	if keys.fields.set != s.fieldSet.Load() {
+		keys.fields = s.extractFieldValues(expandPayload(ev.Payload))
 	}
-	s.events[id] = ev
+	for _, f := range keys.fields.vals {
+		f.x.add(f.v, ev.ID)
+	}
+	s.indexTextLocked(ev, keys.terms)
 
 	// 新事件默认是 head
-	s.heads[id] = struct{}{}
-	if len(parents) == 0 {
-		s.roots[id] = struct{}{}
+	s.heads[ev.ID] = struct{}{}
+	if len(ev.Parents) == 0 {
+		s.roots[ev.ID] = struct{}{}
 	}
 
 	// 有 parents -> parents 不再是 head；同时建立 parent -> child 边
-	for _, p := range parents {
-		s.children[p] = append(s.children[p], id)
+	for _, p := range ev.Parents {
+		s.children[p] = append(s.children[p], ev.ID)
+		s.stats.addEdge(len(s.children[p]) - 1)
 		delete(s.heads, p)
 	}
 
-	// 追加事件到 DAG 中的过程是原子的：要么完全成功，要么完全失败，不会出现中间状态。
-	s.mu.Unlock()
-
-	// 广播给订阅者（非阻塞，慢订阅者可能丢事件：v0 的取舍）
-	s.broadcast(ev)
-
-	return ev, nil
+	// 可达性标签只依赖祖先，归档期间保留；恢复的事件若仍有标签则沿用
+	if !s.reach.has(ev.ID) {
+		s.reach.add(ev.ID, ev.Parents)
+	}
 }
@@ -2,14 +2,14 @@ package memory
 
 import "github.com/Mr-xiaotian/CelestialTree/internal/tree"
 
-// Get 根据 ID 获取单个事件，返回事件和是否存在。
+// Get 根据 ID 获取单个事件，返回事件和是否存在。压缩存储的 payload 在锁外解压。
 func (s *Store) Get(id uint64) (tree.Event, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	ev, ok := s.eventLocked(id)
+	s.mu.RUnlock()
 
-	if !s.isEventIDValid(id) {
-		return tree.Event{}, false
+	if ok {
+		ev.Payload = expandPayload(ev.Payload)
 	}
-	ev := s.events[id]
-	return ev, true
+	return ev, ok
 }
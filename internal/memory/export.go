@@ -0,0 +1,397 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// exportBatch 是 Export 每次持锁扫描的 ID 数。
+const exportBatch = 1024
+
+// importBatch 是 Import 每批解码、校验并写成一条 WAL 记录的事件数，导入期间内存中只保存一批。
+const importBatch = 10000
+
+// Export 按 ID 升序对 (sinceID, untilID] 内的每个在线事件调用 fn；untilID 为 0 表示截至当前最大 ID。
+// 每批在锁内拷贝、锁外回调，导出期间写入不会被长时间阻塞。已归档树的后代不在在线存储中，不会被导出。
+func (s *Store) Export(sinceID, untilID uint64, fn func(tree.Event) error) error {
+	if last := atomic.LoadUint64(&s.nextID); untilID == 0 || untilID > last {
+		untilID = last
+	}
+
+	batch := make([]tree.Event, 0, exportBatch)
+	for id := sinceID + 1; id <= untilID; {
+		batch = batch[:0]
+		s.mu.RLock()
+		for end := min(id+exportBatch, untilID+1); id < end; id++ {
+			if ev, ok := s.eventLocked(id); ok {
+				batch = append(batch, ev)
+			}
+		}
+		s.mu.RUnlock()
+
+		for _, ev := range batch {
+			ev.Payload = expandPayload(ev.Payload)
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Import 从 next 逐个读取事件（通常来自 Export）并按原 ID 载入，重建 roots/heads/children；next 返回 io.EOF 表示输入结束。
+// ID 必须严格递增且全部高于存储中已分配的最大 ID，父事件必须已存在或在本次导入中更早出现。
+// 输入按 importBatch 分批校验并写入 WAL，前后由 begin/commit 记录包围：提交之前的任何失败或崩溃都不会留下导入的事件，
+// 提交后事件从 WAL 读回并在一次持锁中全部应用。导入的事件不会广播给订阅者。
+func (s *Store) Import(next func() (tree.Event, error)) (tree.ImportResult, error) {
+	// 与快照、归档串行：导入的记录都在同一个日志段中，已校验的父事件在提交之前也不会被归档
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	im := &importer{s: s}
+	for {
+		ev, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil {
+			err = im.add(ev)
+		}
+		if err == nil && len(im.batch) == importBatch {
+			err = im.flush()
+		}
+		if err != nil {
+			im.abort()
+			return tree.ImportResult{}, err
+		}
+	}
+	if im.events == 0 {
+		return tree.ImportResult{}, nil
+	}
+	if err := im.flush(); err != nil {
+		im.abort()
+		return tree.ImportResult{}, err
+	}
+	if err := im.commit(); err != nil {
+		return tree.ImportResult{}, err
+	}
+	return tree.ImportResult{Imported: im.events, FirstID: im.first, LastID: im.last}, nil
+}
+
+// idRange 是一段连续的事件 ID [first, last]。
+type idRange struct {
+	first, last uint64
+}
+
+// importer 是一次进行中的 Import。已接收的 ID 按连续区间保存（导出的 ID 通常连续，只占几个区间），
+// 事件本身每满 importBatch 个写成一条 WAL 记录后即释放；纯内存 Store 没有 WAL，事件暂存在 staged 中直到提交。
+type importer struct {
+	s      *Store
+	ids    []idRange
+	batch  []tree.Event
+	keys   []indexKeys // 纯内存 Store 的批次预先提取的索引键，与 batch 对应
+	staged [][]tree.Event
+	skeys  [][]indexKeys
+	dict   *payloadDict // 导入记录私有的 payload 字典：读回导入记录时不依赖日志段中其他记录
+	path   string       // 导入记录所在的日志段
+	from   int64        // begin 记录结束处的偏移，0 表示尚未写出 begin 记录
+	buf    []byte
+
+	events      int
+	size        int64
+	first, last uint64
+}
+
+// has 报告 id 是否已在本次导入中出现。
+func (im *importer) has(id uint64) bool {
+	i := sort.Search(len(im.ids), func(i int) bool { return im.ids[i].last >= id })
+	return i < len(im.ids) && im.ids[i].first <= id
+}
+
+// add 校验一个事件并加入当前批次；依赖存储中已有事件的检查在 flush 时进行。
+func (im *importer) add(ev tree.Event) error {
+	s := im.s
+	if im.events == 0 {
+		if cur := atomic.LoadUint64(&s.nextID); ev.ID <= cur {
+			return fmt.Errorf("import starts at id %d, which overlaps existing ids [1, %d]: %w", ev.ID, cur, storage.ErrConflict)
+		}
+		im.first = ev.ID
+	} else if ev.ID <= im.last {
+		return emitErrorf("event %d: ids must be strictly increasing", ev.ID)
+	}
+	if strings.TrimSpace(ev.Type) == "" {
+		return emitErrorf("event %d: type is required", ev.ID)
+	}
+	seen := make(map[uint64]struct{}, len(ev.Parents))
+	for _, p := range ev.Parents {
+		if _, dup := seen[p]; dup || p == 0 || p >= ev.ID {
+			return emitErrorf("event %d: invalid parent %d", ev.ID, p)
+		}
+		seen[p] = struct{}{}
+	}
+	if ev.Parents == nil {
+		ev.Parents = []uint64{}
+	}
+	ev.Archived = nil
+
+	if s.wal == nil {
+		im.keys = append(im.keys, s.indexKeysOf(ev.Payload, ev.Message))
+	}
+	ev.Payload = s.compressPayload(ev.Payload)
+	if err := checkEventSize(ev); err != nil {
+		return fmt.Errorf("event %d: %w", ev.ID, err)
+	}
+
+	if n := len(im.ids); n > 0 && im.ids[n-1].last+1 == ev.ID {
+		im.ids[n-1].last = ev.ID
+	} else {
+		im.ids = append(im.ids, idRange{ev.ID, ev.ID})
+	}
+	im.batch = append(im.batch, ev)
+	im.events++
+	im.size += s.hotMemSize(ev) + int64(len(ev.Payload))
+	im.last = ev.ID
+	return nil
+}
+
+// flush 检查当前批次引用的已有父事件与累计的内存占用，然后把批次写成一条 WAL 记录（第一批之前先写 begin 记录）。
+func (im *importer) flush() error {
+	s := im.s
+	if len(im.batch) == 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	for _, ev := range im.batch {
+		for _, p := range ev.Parents {
+			if !im.has(p) && !s.isEventIDValid(p) {
+				s.mu.Unlock()
+				return emitErrorf("event %d: parent %d not found", ev.ID, p)
+			}
+		}
+	}
+	err := s.admitLocked(im.events, im.size)
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if s.wal == nil {
+		im.staged = append(im.staged, im.batch)
+		im.skeys = append(im.skeys, im.keys)
+		im.batch, im.keys = nil, nil
+		return nil
+	}
+
+	if im.from == 0 {
+		if err := s.wal.append(walRecordImportBegin, binary.AppendUvarint(nil, im.first)); err != nil {
+			return fmt.Errorf("wal append failed: %w", err)
+		}
+		im.path, im.from = s.wal.position()
+		im.dict = newPayloadDict()
+	}
+	encode := func(body []byte, _ *payloadDict) []byte {
+		body = binary.AppendUvarint(body, uint64(len(im.batch)))
+		for _, ev := range im.batch {
+			im.buf = appendEvent(im.buf[:0], ev, im.dict)
+			body = appendBytes(body, im.buf)
+		}
+		return body
+	}
+	if err := s.wal.appendLarge(walRecordImportBatch, encode); err != nil {
+		return fmt.Errorf("wal append failed: %w", err)
+	}
+	im.batch = im.batch[:0]
+	return nil
+}
+
+// commit 在写锁内复查 ID 区间与内存上限，写出 commit 记录，再把导入的事件从 WAL 读回并应用到内存。
+func (im *importer) commit() error {
+	s := im.s
+	// 关闭提交闸门：已预留的 ID 都已发布，nextID 即已分配的最大 ID
+	s.commitGate.Lock()
+	defer s.commitGate.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// 导入期间并发的 Emit 可能已经用掉了导入区间中的 ID
+	if cur := s.nextID; im.first <= cur {
+		im.abort()
+		return fmt.Errorf("import ids [%d, %d] overlap existing ids [1, %d]: %w", im.first, im.last, cur, storage.ErrConflict)
+	}
+	if err := s.admitLocked(im.events, im.size); err != nil {
+		im.abort()
+		return err
+	}
+
+	if s.wal == nil {
+		for i, batch := range im.staged {
+			for j, ev := range batch {
+				ev.Type = s.internType(ev.Type)
+				s.applyLocked(ev, im.skeys[i][j])
+			}
+		}
+		atomic.StoreUint64(&s.nextID, im.last)
+		return nil
+	}
+
+	_, to := s.wal.position()
+	body := binary.AppendUvarint(nil, uint64(im.events))
+	body = binary.AppendUvarint(body, im.last)
+	if err := s.wal.append(walRecordImportCommit, body); err != nil {
+		im.abort()
+		return fmt.Errorf("wal append failed: %w", err)
+	}
+
+	// 提交已经落盘：读回失败时内存中只有部分导入，WAL 进入失败状态，重启回放时完整应用
+	type chunk struct {
+		events []tree.Event
+		keys   []indexKeys
+	}
+	chunks := make(chan chunk, 1)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(chunks)
+		// 解码与索引键的提取与应用并行，缩短持锁时间；导入期间字段索引集合不会变化
+		errc <- readImport(im.path, im.from, to, func(events []tree.Event) error {
+			keys := make([]indexKeys, len(events))
+			for i, ev := range events {
+				keys[i] = s.indexKeysOf(expandPayload(ev.Payload), ev.Message)
+			}
+			chunks <- chunk{events, keys}
+			return nil
+		})
+	}()
+	applied := 0
+	for c := range chunks {
+		for i, ev := range c.events {
+			ev.Type = s.internType(ev.Type)
+			s.applyLocked(ev, c.keys[i])
+		}
+		applied += len(c.events)
+	}
+	err := <-errc
+	if err == nil && applied != im.events {
+		err = fmt.Errorf("read back %d of %d events", applied, im.events)
+	}
+	atomic.StoreUint64(&s.nextID, im.last)
+	if err != nil {
+		err = fmt.Errorf("import committed but could not be applied, restart to replay it: %w", err)
+		s.wal.fail(err)
+		return err
+	}
+	return nil
+}
+
+// abort 放弃尚未提交的导入：已写出 begin 记录时补写 abort 记录（失败也无妨，没有 commit 记录的导入在回放时被忽略）。
+func (im *importer) abort() {
+	if im.from != 0 {
+		_ = im.s.wal.append(walRecordImportAbort, nil)
+		im.from = 0
+	}
+}
+
+// readImport 读取日志段 path 中 [from, to) 范围内的导入批次记录，按顺序对每批事件调用 fn，其他记录被跳过。
+// 导入批次使用从 begin 记录开始的私有 payload 字典。
+func readImport(path string, from, to int64, fn func([]tree.Event) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return err
+	}
+
+	dict := newPayloadDict()
+	var parts partAssembler
+	_, err = readRecords(bufio.NewReader(io.LimitReader(f, to-from)), func(kind byte, body []byte) error {
+		return parts.feed(kind, body, func(kind byte, body []byte) error {
+			if kind != walRecordImportBatch {
+				return nil
+			}
+			events, err := decodeEvents(body, dict)
+			if err != nil {
+				return err
+			}
+			return fn(events)
+		})
+	})
+	return err
+}
+
+// decodeEvents 解码 uvarint(n) | bytes(appendEvent)... 格式的一批事件（walRecordBatch 与导入批次共用）。
+func decodeEvents(body []byte, dict *payloadDict) ([]tree.Event, error) {
+	d := decoder{buf: body}
+	n := d.uvarint()
+	if d.err == nil && n > uint64(len(body)) {
+		return nil, errShortRecord
+	}
+	events := make([]tree.Event, 0, n)
+	for i := uint64(0); i < n && d.err == nil; i++ {
+		b := d.bytes()
+		if d.err != nil {
+			break
+		}
+		ev, _, err := decodeEvent(b, dict)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, ev)
+	}
+	return events, d.err
+}
+
+// importLog 在回放一个日志段时跟踪导入：begin 与 commit 之间的导入批次在读到 commit 记录时从日志段读回并恢复，
+// 没有 commit 记录（失败、abort 或崩溃）的导入被忽略。
+type importLog struct {
+	path string
+	from int64 // 未结束的导入的 begin 记录结束处的偏移，0 表示没有
+}
+
+// replay 处理一条导入相关的记录，start / end 是该记录在日志段中的起止偏移。
+func (l *importLog) replay(s *Store, kind byte, body []byte, start, end int64) error {
+	switch kind {
+	case walRecordImportBegin:
+		l.from = end
+	case walRecordImportAbort:
+		l.from = 0
+	case walRecordImportCommit:
+		d := decoder{buf: body}
+		events, last := d.uvarint(), d.uvarint()
+		if d.err != nil {
+			return d.err
+		}
+		if l.from == 0 {
+			return errors.New("import commit without begin")
+		}
+		var n uint64
+		err := readImport(l.path, l.from, start, func(batch []tree.Event) error {
+			for _, ev := range batch {
+				if err := s.restoreEvent(ev); err != nil {
+					return err
+				}
+			}
+			n += uint64(len(batch))
+			return nil
+		})
+		l.from = 0
+		if err != nil {
+			return fmt.Errorf("import: %w", err)
+		}
+		if n != events || (n > 0 && s.nextID != last) {
+			return fmt.Errorf("import: commit of %d events up to %d, replayed %d up to %d", events, last, n, s.nextID)
+		}
+	}
+	return nil
+}
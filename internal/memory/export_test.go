@@ -0,0 +1,209 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// exportAll 导出 s 的全部在线事件。
+func exportAll(t *testing.T, s *Store) []tree.Event {
+	t.Helper()
+	var out []tree.Event
+	if err := s.Export(0, 0, func(ev tree.Event) error {
+		out = append(out, ev)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+// source 返回依次产出 events 的 Import 输入；failAt 非负时在产出第 failAt 个事件之前返回错误。
+func source(events []tree.Event, failAt int) func() (tree.Event, error) {
+	i := 0
+	return func() (tree.Event, error) {
+		if i == failAt {
+			return tree.Event{}, errors.New("source broke")
+		}
+		if i == len(events) {
+			return tree.Event{}, io.EOF
+		}
+		i++
+		return events[i-1], nil
+	}
+}
+
+// buildImportSource 构造一个跨越多个导入批次的 DAG 并返回其导出。
+func buildImportSource(t *testing.T, n int) []tree.Event {
+	t.Helper()
+	s := NewStore()
+	root := mustEmit(t, s, "genesis", "")
+	prev := root
+	for i := 1; i < n; i++ {
+		parents := []uint64{prev}
+		if i%7 == 0 {
+			parents = append(parents, root)
+		}
+		ev, err := s.Emit(tree.EmitRequest{Type: fmt.Sprintf("t%d", i%3), Message: fmt.Sprintf("step %d", i), Payload: []byte(fmt.Sprintf(`{"i":%d}`, i%50)), Parents: parents})
+		if err != nil {
+			t.Fatal(err)
+		}
+		prev = ev.ID
+	}
+	return exportAll(t, s)
+}
+
+// sameEvents 比较两组导出的事件。
+func sameEvents(t *testing.T, got, want []tree.Event) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d events, want %d", len(got), len(want))
+	}
+	for i := range want {
+		g, w := got[i], want[i]
+		if g.ID != w.ID || g.Type != w.Type || g.Message != w.Message || g.TimeUnixNano != w.TimeUnixNano ||
+			string(g.Payload) != string(w.Payload) || !slices.Equal(g.Parents, w.Parents) {
+			t.Fatalf("event %d = %+v, want %+v", w.ID, g, w)
+		}
+	}
+}
+
+// TestImport 检查跨多个批次的流式导入在纯内存与持久化 Store 上都完整载入，并能在重启后恢复。
+func TestImport(t *testing.T) {
+	want := buildImportSource(t, 2*importBatch+123)
+	cases := []struct {
+		name string
+		opts func(t *testing.T) Options
+	}{
+		{"memory", func(*testing.T) Options { return Options{} }},
+		{"data-dir", func(t *testing.T) Options { return Options{DataDir: t.TempDir(), Sync: SyncNever} }},
+		{"compressed", func(t *testing.T) Options {
+			return Options{DataDir: t.TempDir(), Sync: SyncNever, PayloadCompressMin: 1}
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := c.opts(t)
+			s := mustOpen(t, opts)
+			res, err := s.Import(source(want, -1))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if res.Imported != len(want) || res.FirstID != 1 || res.LastID != want[len(want)-1].ID {
+				t.Fatalf("import result = %+v", res)
+			}
+			sameEvents(t, exportAll(t, s), want)
+			if opts.DataDir == "" {
+				return
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = mustOpen(t, opts)
+			sameEvents(t, exportAll(t, s), want)
+			if r, err := s.Verify(); err != nil || !r.OK {
+				t.Fatalf("verify after reopen: %+v, %v", r.Violations, err)
+			}
+		})
+	}
+}
+
+// TestImportAllOrNothing 检查导入在提交之前失败、冲突或崩溃时不留下任何事件，之后可以重新导入。
+func TestImportAllOrNothing(t *testing.T) {
+	want := buildImportSource(t, importBatch+500)
+	cases := []struct {
+		name string
+		run  func(t *testing.T, s *Store) error
+	}{
+		{"source error after a flushed batch", func(t *testing.T, s *Store) error {
+			_, err := s.Import(source(want, importBatch+10))
+			return err
+		}},
+		{"invalid event", func(t *testing.T, s *Store) error {
+			bad := slices.Clone(want)
+			bad[importBatch+1].Type = ""
+			_, err := s.Import(source(bad, -1))
+			var emitErr *tree.EmitError
+			if !errors.As(err, &emitErr) {
+				t.Fatalf("err = %v, want *tree.EmitError", err)
+			}
+			return err
+		}},
+		{"missing parent", func(t *testing.T, s *Store) error {
+			bad := slices.Clone(want)
+			bad[5].Parents = []uint64{want[len(want)-1].ID + 1}
+			_, err := s.Import(source(bad, -1))
+			return err
+		}},
+		{"concurrent emit takes an imported id", func(t *testing.T, s *Store) error {
+			// 第一批写出之后另一个写入者用掉了导入区间中的 ID
+			next := source(want, -1)
+			n := 0
+			_, err := s.Import(func() (tree.Event, error) {
+				if n++; n == importBatch+2 {
+					if _, err := s.Emit(tree.EmitRequest{Type: "racer"}); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return next()
+			})
+			if !errors.Is(err, storage.ErrConflict) {
+				t.Fatalf("err = %v, want ErrConflict", err)
+			}
+			return err
+		}},
+		{"crash before commit", func(t *testing.T, s *Store) error {
+			im := &importer{s: s}
+			for _, ev := range want[:importBatch+3] {
+				if err := im.add(ev); err != nil {
+					t.Fatal(err)
+				}
+				if len(im.batch) == importBatch {
+					if err := im.flush(); err != nil {
+						t.Fatal(err)
+					}
+				}
+			}
+			return errors.New("crashed")
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			opts := Options{DataDir: t.TempDir(), Sync: SyncNever}
+			s, err := Open(opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := c.run(t, s); err == nil {
+				t.Fatal("import succeeded, want an error")
+			}
+			before := len(exportAll(t, s))
+			if before > 1 {
+				t.Fatalf("%d events visible after a failed import", before)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = mustOpen(t, opts)
+			if got := len(exportAll(t, s)); got != before {
+				t.Fatalf("%d events after reopen, want %d", got, before)
+			}
+			if r, err := s.Verify(); err != nil || !r.OK {
+				t.Fatalf("verify after reopen: %+v, %v", r.Violations, err)
+			}
+			if before == 0 {
+				if _, err := s.Import(source(want, -1)); err != nil {
+					t.Fatalf("import after failed attempt: %v", err)
+				}
+				sameEvents(t, exportAll(t, s), want)
+			}
+		})
+	}
+}
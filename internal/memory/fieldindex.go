@@ -0,0 +1,283 @@
+package memory
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// fieldIndex 是一个 payload 字段的二级索引：字段值 -> 升序的在线事件 ID 列表（postings），覆盖热数据、恢复事件与冷数据。
+type fieldIndex struct {
+	field string
+	path  []string
+	*postings
+}
+
+func newFieldIndex(field string, path []string) *fieldIndex {
+	return &fieldIndex{field: field, path: path, postings: newPostings()}
+}
+
+// parseFieldPath 解析点分的 payload 字段路径（"task_id"、"meta.run_id"），每一段是一层对象的键。
+func parseFieldPath(field string) ([]string, error) {
+	path := strings.Split(field, ".")
+	if field == "" || slices.Contains(path, "") {
+		return nil, &tree.QueryError{Reason: fmt.Sprintf("bad payload field %q: want dot-separated object keys such as task_id or meta.run_id", field)}
+	}
+	return path, nil
+}
+
+// payloadObject 将原始 JSON 形式的 payload 解析为顶层对象；payload 为空或不是对象时返回 nil。
+func payloadObject(raw json.RawMessage) map[string]json.RawMessage {
+	if len(raw) == 0 {
+		return nil
+	}
+	var obj map[string]json.RawMessage
+	if json.Unmarshal(raw, &obj) != nil {
+		return nil
+	}
+	return obj
+}
+
+// value 返回字段在 payload 对象中的索引值：字符串取其内容，数字与布尔值取 JSON 原文；
+// 字段不存在、为 null、对象或数组时不参与索引。
+func (x *fieldIndex) value(obj map[string]json.RawMessage) (string, bool) {
+	raw, ok := obj[x.path[0]]
+	for _, key := range x.path[1:] {
+		if !ok {
+			return "", false
+		}
+		var next map[string]json.RawMessage
+		if json.Unmarshal(raw, &next) != nil {
+			return "", false
+		}
+		raw, ok = next[key]
+	}
+	raw = bytes.TrimSpace(raw)
+	if !ok || len(raw) == 0 {
+		return "", false
+	}
+	switch raw[0] {
+	case '"':
+		var s string
+		if json.Unmarshal(raw, &s) != nil {
+			return "", false
+		}
+		return s, true
+	case 'n', '{', '[':
+		return "", false
+	default:
+		return string(raw), true
+	}
+}
+
+// remove 记录一个带有该字段的事件离开了在线存储。
+func (x *fieldIndex) remove(string) {
+	x.expire(1)
+}
+
+func (x *fieldIndex) info() tree.FieldIndexInfo {
+	return tree.FieldIndexInfo{Field: x.field, Values: len(x.lists), Events: x.n - x.stale}
+}
+
+// fieldValue 是事件在一个字段索引中的值。
+type fieldValue struct {
+	x *fieldIndex
+	v string
+}
+
+// fieldValues 是事件在各字段索引中的值。set 是提取时的字段索引集合（fieldSet），
+// 持锁应用时集合已变化（期间增删了索引）则需要重新提取。
+type fieldValues struct {
+	set  *[]*fieldIndex
+	vals []fieldValue
+}
+
+// extractFieldValues 解析 payload（原始 JSON）并提取其在当前各字段索引中的值，不需要持有 s.mu。
+// 字段索引集合取自 fieldSet，字段路径创建后不再修改，因此可以在锁外读取。
+func (s *Store) extractFieldValues(payload json.RawMessage) fieldValues {
+	fv := fieldValues{set: s.fieldSet.Load()}
+	if fv.set == nil || len(*fv.set) == 0 || len(payload) == 0 {
+		return fv
+	}
+	obj := payloadObject(payload)
+	if obj == nil {
+		return fv
+	}
+	for _, x := range *fv.set {
+		if v, ok := x.value(obj); ok {
+			fv.vals = append(fv.vals, fieldValue{x: x, v: v})
+		}
+	}
+	return fv
+}
+
+// publishFieldsLocked 在 s.fields 变化后发布新的 fieldSet（需持有 s.mu 写锁）。
+func (s *Store) publishFieldsLocked() {
+	set := slices.Collect(maps.Values(s.fields))
+	s.fieldSet.Store(&set)
+}
+
+// forEachFieldValue 对事件在每个字段索引中的值调用 fn；没有字段索引时不解析 payload（需持有 s.mu）。
+func (s *Store) forEachFieldValue(ev tree.Event, fn func(x *fieldIndex, v string)) {
+	if len(s.fields) == 0 || len(ev.Payload) == 0 {
+		return
+	}
+	obj := payloadObject(expandPayload(ev.Payload))
+	if obj == nil {
+		return
+	}
+	for _, x := range s.fields {
+		if v, ok := x.value(obj); ok {
+			fn(x, v)
+		}
+	}
+}
+
+// AddFieldIndex 为 payload 字段建立索引并回填已有的在线事件，字段已有索引时直接返回。
+// 回填经 Export 分批读取，期间写入不会被长时间阻塞；持有 ckptMu 挡住归档与恢复，水位线以内的在线事件在回填期间不变，
+// 回填完成后在写锁内补上水位线之后写入的事件，再登记索引并写入 WAL。
+func (s *Store) AddFieldIndex(field string) (tree.FieldIndexInfo, error) {
+	path, err := parseFieldPath(field)
+	if err != nil {
+		return tree.FieldIndexInfo{}, err
+	}
+
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	s.mu.RLock()
+	if x, ok := s.fields[field]; ok {
+		info := x.info()
+		s.mu.RUnlock()
+		return info, nil
+	}
+	s.mu.RUnlock()
+
+	x := newFieldIndex(field, path)
+	index := func(ev tree.Event) {
+		if v, ok := x.value(payloadObject(expandPayload(ev.Payload))); ok {
+			x.add(v, ev.ID)
+		}
+	}
+	upTo := atomic.LoadUint64(&s.nextID)
+	if err := s.Export(0, upTo, func(ev tree.Event) error {
+		index(ev)
+		return nil
+	}); err != nil {
+		return tree.FieldIndexInfo{}, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id := upTo + 1; id <= s.nextID; id++ {
+		if ev, ok := s.eventLocked(id); ok {
+			index(ev)
+		}
+	}
+	if s.wal != nil {
+		if err := s.wal.append(walRecordFieldIndex, appendBytes(nil, []byte(field))); err != nil {
+			return tree.FieldIndexInfo{}, fmt.Errorf("wal append failed: %w", err)
+		}
+	}
+	s.fields[field] = x
+	s.publishFieldsLocked()
+	return x.info(), nil
+}
+
+// DropFieldIndex 删除字段索引；字段没有索引时返回 storage.ErrNotFound。
+// 与 AddFieldIndex 一样持有 ckptMu：Verify 在冷事件读盘时释放 s.mu，依赖 ckptMu 保证字段索引集合不变。
+func (s *Store) DropFieldIndex(field string) error {
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.fields[field]; !ok {
+		return fmt.Errorf("payload field %q is not indexed: %w", field, storage.ErrNotFound)
+	}
+	if s.wal != nil {
+		if err := s.wal.append(walRecordFieldDrop, appendBytes(nil, []byte(field))); err != nil {
+			return fmt.Errorf("wal append failed: %w", err)
+		}
+	}
+	delete(s.fields, field)
+	s.publishFieldsLocked()
+	return nil
+}
+
+// FieldIndexes 返回全部字段索引的概况，按字段名排序。
+func (s *Store) FieldIndexes() []tree.FieldIndexInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]tree.FieldIndexInfo, 0, len(s.fields))
+	for _, field := range slices.Sorted(maps.Keys(s.fields)) {
+		out = append(out, s.fields[field].info())
+	}
+	return out
+}
+
+// buildFieldIndexLocked 遍历全部在线事件为字段建立索引，替换已有的同名索引（需持有 s.mu）。
+// 用于 WAL 回放与 Open 时补建 Options.PayloadIndexes 中尚未建立的索引，冷数据需要逐个读盘。
+func (s *Store) buildFieldIndexLocked(field string) error {
+	path, err := parseFieldPath(field)
+	if err != nil {
+		return err
+	}
+	x := newFieldIndex(field, path)
+	s.forEachOnlineLocked("field index", func(ev tree.Event) {
+		if v, ok := x.value(payloadObject(expandPayload(ev.Payload))); ok {
+			x.add(v, ev.ID)
+		}
+	})
+	x.settle()
+	s.fields[field] = x
+	s.publishFieldsLocked()
+	return nil
+}
+
+// ensureFieldIndexesLocked 为 Options.PayloadIndexes 中尚未建立的字段补建索引（Open 期间调用）。
+// 快照或 WAL 中已有的索引直接沿用，启动参数中去掉的字段不会删除已有的索引。
+func (s *Store) ensureFieldIndexesLocked() error {
+	for _, field := range s.opts.PayloadIndexes {
+		if _, ok := s.fields[field]; ok {
+			continue
+		}
+		if err := s.buildFieldIndexLocked(field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fieldListsLocked 返回每个字段索引的列表（共享底层数组，Checkpoint 写出时使用）。
+func (s *Store) fieldListsLocked() map[string]map[string][]uint64 {
+	out := make(map[string]map[string][]uint64, len(s.fields))
+	for field, x := range s.fields {
+		out[field] = x.clone()
+	}
+	return out
+}
+
+// loadFieldIndexesLocked 载入快照中的字段索引，丢弃其中已不在线的 ID（需在冷数据层与热数据加载完成后调用）。
+func (s *Store) loadFieldIndexesLocked(fields map[string]map[string][]uint64) error {
+	s.fields = make(map[string]*fieldIndex, len(fields))
+	for field, values := range fields {
+		path, err := parseFieldPath(field)
+		if err != nil {
+			return err
+		}
+		x := newFieldIndex(field, path)
+		x.load(values, s.isEventIDValid)
+		s.fields[field] = x
+	}
+	s.publishFieldsLocked()
+	return nil
+}
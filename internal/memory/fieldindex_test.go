@@ -0,0 +1,146 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// lookupIDs 翻页取出字段值等于 value 的全部事件 ID，并检查每页不超过 limit、还有下一页时本页是满的。
+func lookupIDs(t *testing.T, s *Store, field, value string, limit int) []uint64 {
+	t.Helper()
+	size := limit
+	if size <= 0 {
+		size = queryDefaultLimit
+	}
+	var ids []uint64
+	q := tree.FieldLookup{Field: field, Value: value, Limit: limit}
+	for {
+		page, err := s.LookupField(q)
+		if err != nil {
+			t.Fatalf("LookupField(%+v): %v", q, err)
+		}
+		if n := len(page.IDs); n > size || page.NextAfterID != 0 && n < size {
+			t.Fatalf("LookupField(%+v): page of %d ids with next %d", q, n, page.NextAfterID)
+		}
+		ids = append(ids, page.IDs...)
+		if page.NextAfterID == 0 {
+			return ids
+		}
+		q.AfterID = page.NextAfterID
+	}
+}
+
+// TestLookupField 检查启动参数声明的索引与运行时添加并回填的索引：各字段值翻页查到的事件与写入时记录的相同，
+// 只取字符串、数字与布尔值；归档、降冷、重新打开与恢复之后仍然如此，删除的索引在重新打开后不会回来。
+func TestLookupField(t *testing.T) {
+	opts := Options{DataDir: t.TempDir(), Sync: SyncNever, HotWindow: 100, PayloadIndexes: []string{"task_id"}}
+	s := mustOpen(t, opts)
+
+	// want[field][value] 是写入时该字段取这个值的事件
+	want := map[string]map[string][]uint64{"task_id": {}, "meta.run_id": {}}
+	payload := func(i int) (string, map[string]string) {
+		task, run := fmt.Sprintf("A-%03d", i%7), fmt.Sprint(i%4)
+		switch i % 10 {
+		case 0:
+			return `"not an object"`, nil
+		case 1:
+			return `{"task_id":null,"meta":[1]}`, nil
+		case 2:
+			return `{"task_id":{"x":1},"meta":{"run_id":{"y":2}}}`, nil
+		case 3:
+			return fmt.Sprintf(`{"meta":{"run_id":%s}}`, run), map[string]string{"meta.run_id": run}
+		case 4:
+			return fmt.Sprintf(`{"task_id":"%s","meta":{"run_id":"%s"}}`, task, run), map[string]string{"task_id": task, "meta.run_id": run}
+		case 5:
+			return `{"task_id":true}`, map[string]string{"task_id": "true"}
+		default:
+			return fmt.Sprintf(`{"task_id":"%s","n":%d}`, task, i), map[string]string{"task_id": task}
+		}
+	}
+	var roots []uint64
+	for range 3 {
+		roots = append(roots, mustEmit(t, s, "run", `{"task_id":"root"}`))
+		want["task_id"]["root"] = append(want["task_id"]["root"], roots[len(roots)-1])
+	}
+	last := slices.Clone(roots)
+	emit := func(from, to int) {
+		for i := from; i < to; i++ {
+			p, vals := payload(i)
+			last[i%3] = mustEmit(t, s, "step", p, last[i%3])
+			for field, v := range vals {
+				if want[field] != nil {
+					want[field][v] = append(want[field][v], last[i%3])
+				}
+			}
+		}
+	}
+	emit(0, 200)
+	// 回填已有的事件，之后写入的事件直接维护
+	info, err := s.AddFieldIndex("meta.run_id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, err := s.AddFieldIndex("meta.run_id"); err != nil || again != info {
+		t.Fatalf("adding the index again = %+v, %v, want %+v", again, err, info)
+	}
+	emit(200, 400)
+
+	check := func(s *Store, stage string) {
+		t.Helper()
+		infos := map[string]int{}
+		for _, x := range s.FieldIndexes() {
+			infos[x.Field] = x.Events
+		}
+		for field, values := range want {
+			total := 0
+			for _, v := range append(slices.Sorted(maps.Keys(values)), "missing") {
+				live := liveEvents(s, func(ev tree.Event) bool { return slices.Contains(values[v], ev.ID) })
+				total += len(live)
+				for _, limit := range []int{1, 9, 0} {
+					if got := lookupIDs(t, s, field, v, limit); !slices.Equal(got, live) {
+						t.Fatalf("%s: %s=%s with limit %d = %v, want %v", stage, field, v, limit, got, live)
+					}
+				}
+			}
+			if infos[field] != total {
+				t.Fatalf("%s: index on %s reports %d events, want %d", stage, field, infos[field], total)
+			}
+		}
+	}
+	s = indexStages(t, opts, s, roots[:2], check)
+
+	var qe *tree.QueryError
+	for _, field := range []string{"n", "meta", ""} {
+		if _, err := s.LookupField(tree.FieldLookup{Field: field, Value: "1"}); !errors.As(err, &qe) {
+			t.Errorf("lookup on unindexed field %q: err = %v, want *tree.QueryError", field, err)
+		}
+	}
+	for _, field := range []string{"", "meta.", ".run_id", "a..b"} {
+		if _, err := s.AddFieldIndex(field); !errors.As(err, &qe) {
+			t.Errorf("AddFieldIndex(%q): err = %v, want *tree.QueryError", field, err)
+		}
+	}
+
+	if err := s.DropFieldIndex("meta.run_id"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.DropFieldIndex("meta.run_id"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("dropping twice: %v, want storage.ErrNotFound", err)
+	}
+	delete(want, "meta.run_id")
+	emit(400, 420)
+	s.Close()
+	// 启动参数中去掉的字段仍保留已有的索引
+	opts.PayloadIndexes = nil
+	s = mustOpen(t, opts)
+	if _, err := s.LookupField(tree.FieldLookup{Field: "meta.run_id", Value: "1"}); !errors.As(err, &qe) {
+		t.Fatalf("dropped index after reopen: err = %v, want *tree.QueryError", err)
+	}
+	check(s, "after dropping an index and reopening")
+}
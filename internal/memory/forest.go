@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// forestWorkers 返回批量树查询并行构建的 goroutine 数上限：Options.ForestWorkers，未配置时为 GOMAXPROCS。
+func (s *Store) forestWorkers() int {
+	if s.opts.ForestWorkers > 0 {
+		return s.opts.ForestWorkers
+	}
+	return runtime.GOMAXPROCS(0)
+}
+
+// buildForest 并行构建以 rootIDs 为根的多棵树，结果与 rootIDs 一一对应。
+// 所有树共用打开时的 ID 水位线，与串行构建看到的是同一个一致视图；每个 worker 打开自己的读视图，
+// 各自分批持有读锁，并从共享的下标中领取下一棵树。每棵树单独校验根 ID，无效的根由 shape.fail 生成带错误的节点，不影响其他树。
+func buildForest[N any](s *Store, shape treeShape[N], rootIDs []uint64) []N {
+	out := make([]N, len(rootIDs))
+	if len(rootIDs) == 0 {
+		return out
+	}
+
+	// 只取水位线，不持锁等待 worker：此时若有写入在等待写锁，worker 获取读锁会被阻塞，持锁等待即死锁
+	upTo := atomic.LoadUint64(&s.nextID)
+
+	var next atomic.Int64
+	work := func() {
+		v := s.openViewAt(upTo)
+		defer v.close()
+		for {
+			i := int(next.Add(1)) - 1
+			if i >= len(rootIDs) {
+				return
+			}
+			id := rootIDs[i]
+			err := s.validateRootIDLocked(id)
+			if err == nil && id > v.upTo {
+				// 水位线之后才写入的事件不在本次视图内
+				err = &tree.RootIDError{ID: id, Reason: "event not found"}
+			}
+			if err != nil {
+				out[i] = shape.fail(id, err)
+				continue
+			}
+			out[i] = walkTree(v, shape, id)
+		}
+	}
+
+	workers := min(s.forestWorkers(), len(rootIDs))
+	if workers <= 1 {
+		work()
+		return out
+	}
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			work()
+		}()
+	}
+	wg.Wait()
+	return out
+}
@@ -0,0 +1,127 @@
+package memory
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// checkForest 检查批量查询的每棵树：有效的根与单棵查询的结果相同，无效的根只在该树上带有错误。
+func checkForest[N any](t *testing.T, name string, roots []uint64, valid map[uint64]bool,
+	forest func([]uint64) []N, single func(uint64) (N, error), failed func(N) (uint64, string)) {
+	t.Helper()
+	got := forest(roots)
+	if len(got) != len(roots) {
+		t.Fatalf("%s: %d trees for %d roots", name, len(got), len(roots))
+	}
+	for i, id := range roots {
+		gotID, msg := failed(got[i])
+		if !valid[id] {
+			if gotID != id || msg == "" {
+				t.Fatalf("%s: tree %d for invalid root %d = id %d, error %q", name, i, id, gotID, msg)
+			}
+			continue
+		}
+		want, err := single(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if msg != "" || !reflect.DeepEqual(got[i], want) {
+			t.Fatalf("%s: tree %d for root %d differs from the single-tree query (error %q)", name, i, id, msg)
+		}
+	}
+}
+
+// TestForest 以不同的 worker 数构建四种批量树，每棵树与单棵查询一致；无效、已归档或重复的根只影响自己的那一项。
+func TestForest(t *testing.T) {
+	s := mustOpen(t, Options{DataDir: t.TempDir(), Sync: SyncNever})
+	ids, roots := buildLayers(t, s, 4, 5, 6, nil)
+	members := treeMembers(t, s, ids, roots[3])
+	if _, err := s.Archive(roots[3]); err != nil {
+		t.Fatal(err)
+	}
+
+	valid := map[uint64]bool{}
+	for _, id := range ids {
+		valid[id] = true
+	}
+	for _, id := range members[1:] {
+		valid[id] = false
+	}
+	query := []uint64{roots[0], 0, ids[len(ids)-1], 999, members[1], roots[1], roots[0], roots[3], ids[len(ids)/2], roots[2]}
+
+	for _, workers := range []int{1, 2, 8} {
+		s.opts.ForestWorkers = workers
+		t.Run(map[int]string{1: "serial", 2: "two workers", 8: "eight workers"}[workers], func(t *testing.T) {
+			checkForest(t, "descendants", query, valid, s.DescendantsForest, s.DescendantsTree,
+				func(n tree.DescendantsTree) (uint64, string) { return n.ID, n.Error })
+			checkForest(t, "descendants meta", query, valid, s.DescendantsForestMeta, s.DescendantsTreeMeta,
+				func(n tree.DescendantsTreeMeta) (uint64, string) { return n.ID, n.Error })
+			checkForest(t, "provenance", query, valid, s.ProvenanceForest, s.ProvenanceTree,
+				func(n tree.ProvenanceTree) (uint64, string) { return n.ID, n.Error })
+			checkForest(t, "provenance meta", query, valid, s.ProvenanceForestMeta, s.ProvenanceTreeMeta,
+				func(n tree.ProvenanceTreeMeta) (uint64, string) { return n.ID, n.Error })
+		})
+	}
+}
+
+// TestForestConcurrentEmits 在并行构建溯源树的同时持续写入：祖先不会改变，每棵树都与写入结束后的单棵查询相同；
+// 后代树中的 ID 都不超过查询返回时的 NextEventID。
+func TestForestConcurrentEmits(t *testing.T) {
+	s := NewStore()
+	s.opts.ForestWorkers = 4
+	ids, roots := buildLayers(t, s, 4, 6, 8, nil)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+				if _, err := s.Emit(tree.EmitRequest{Type: "late", Parents: []uint64{ids[i%len(ids)]}}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}
+	}()
+
+	var maxID func(n tree.DescendantsTree) uint64
+	maxID = func(n tree.DescendantsTree) uint64 {
+		m := n.ID
+		for _, c := range n.Children {
+			m = max(m, maxID(c))
+		}
+		return m
+	}
+	var prov [][]tree.ProvenanceTree
+	for range 20 {
+		prov = append(prov, s.ProvenanceForest(ids[len(ids)-40:]))
+		before := s.Snapshot().NextEventID
+		for _, d := range s.DescendantsForest(roots) {
+			if d.Error != "" {
+				t.Fatal(d.Error)
+			}
+			if m, after := maxID(d), s.Snapshot().NextEventID; m > after {
+				t.Fatalf("descendants tree holds event %d, next id was %d..%d", m, before, after)
+			}
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	for _, forest := range prov {
+		for i, got := range forest {
+			want, err := s.ProvenanceTree(ids[len(ids)-40+i])
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Fatalf("provenance of %d built during emits differs (err %v)", want.ID, err)
+			}
+		}
+	}
+}
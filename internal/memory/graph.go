@@ -4,8 +4,8 @@ import "slices"
 
 // Children 返回指定事件的所有直接子事件 ID（拷贝），不存在则返回 false。
 func (s *Store) Children(id uint64) ([]uint64, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	if !s.isEventIDValid(id) {
 		return nil, false
@@ -24,8 +24,8 @@ func (s *Store) Children(id uint64) ([]uint64, bool) {
 
 // Ancestors 通过 DFS 向上追溯，返回指定事件可达的所有根节点 ID（已排序）。
 func (s *Store) Ancestors(id uint64) ([]uint64, bool) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	v := s.openView()
+	defer v.close()
 
 	if !s.isEventIDValid(id) {
 		return nil, false
@@ -40,11 +40,12 @@ func (s *Store) Ancestors(id uint64) ([]uint64, bool) {
 			return true
 		}
 		visited[cur] = struct{}{}
+		v.step()
 
-		if !s.isEventIDValid(cur) {
+		ev, ok := v.event(cur)
+		if !ok {
 			return false
 		}
-		ev := s.events[cur]
 
 		// root：没有 parents
 		if len(ev.Parents) == 0 {
@@ -53,7 +54,7 @@ func (s *Store) Ancestors(id uint64) ([]uint64, bool) {
 		}
 
 		for _, p := range ev.Parents {
-			if !s.isEventIDValid(p) {
+			if !v.has(p) {
 				return false
 			}
 			if !dfs(p) {
@@ -79,8 +80,8 @@ func (s *Store) Ancestors(id uint64) ([]uint64, bool) {
 
 // Roots 返回 DAG 中所有根节点（无 parents 的事件）的 ID 列表。
 func (s *Store) Roots() []uint64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	out := make([]uint64, 0, len(s.roots))
 	for id := range s.roots {
@@ -91,8 +92,8 @@ func (s *Store) Roots() []uint64 {
 
 // Heads 返回 DAG 中所有叶子节点（无 children 的事件）的 ID 列表。
 func (s *Store) Heads() []uint64 {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 
 	out := make([]uint64, 0, len(s.heads))
 	for id := range s.heads {
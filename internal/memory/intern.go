@@ -1,9 +1,28 @@
 package memory
 
-func (s *Store) internType(t string) string {
-	if existing, ok := s.typeIntern[t]; ok {
-		return existing
+// typeTable 是事件类型的驻留表：每个类型名只保存一份字符串，并分配一个从 1 开始的编号。
+// 紧凑布局在类型列中只保存编号（见 compact.go）。读取需持有 s.mu 的读锁，登记需持有写锁。
+type typeTable struct {
+	ids   map[string]uint32
+	names []string // 下标为编号，names[0] 保留不用
+}
+
+func newTypeTable() *typeTable {
+	return &typeTable{ids: make(map[string]uint32), names: []string{""}}
+}
+
+// intern 返回类型名的编号，第一次出现时登记。
+func (t *typeTable) intern(name string) uint32 {
+	if id, ok := t.ids[name]; ok {
+		return id
 	}
-	s.typeIntern[t] = t
-	return t
+	id := uint32(len(t.names))
+	t.ids[name] = id
+	t.names = append(t.names, name)
+	return id
+}
+
+// internType 返回驻留后的类型字符串，相同类型的事件共享同一份字符串（需持有 s.mu 的写锁）。
+func (s *Store) internType(t string) string {
+	return s.types.names[s.types.intern(t)]
 }
@@ -0,0 +1,98 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// EventLayout 决定热事件在内存中的存储布局。两种布局对外返回完全相同的 tree.Event，
+// 持久化格式也相同，同一个数据目录可以随时切换。
+type EventLayout int
+
+const (
+	LayoutStruct  EventLayout = iota // 每个槽位一个 tree.Event（默认）
+	LayoutCompact                    // 时间与类型编号按列保存，Message、payload、父事件列表放入分块的字节区
+)
+
+// ParseEventLayout 将 "struct" / "compact" 解析为 EventLayout。
+func ParseEventLayout(s string) (EventLayout, error) {
+	switch s {
+	case "", "struct":
+		return LayoutStruct, nil
+	case "compact":
+		return LayoutCompact, nil
+	default:
+		return 0, fmt.Errorf("unknown event layout: %s", s)
+	}
+}
+
+func (l EventLayout) String() string {
+	if l == LayoutCompact {
+		return "compact"
+	}
+	return "struct"
+}
+
+// hotEvents 是热数据的存储：槽位 i 对应事件 ID hotBase+i，空槽位表示该 ID 已降冷、已归档或尚未写入。
+// 读方法可以在读锁下并发调用，写方法需持有写锁。get 返回的 payload 为存储形式。
+type hotEvents interface {
+	len() int
+	has(i int) bool
+	get(i int) (tree.Event, bool)
+	timeAt(i int) int64 // 仅对非空槽位有意义
+
+	put(i int, ev tree.Event) // 必要时扩展槽位
+	clear(i int)
+	drop(n int) // 移除前 n 个槽位，之后的槽位依次前移
+
+	clone() hotEvents // 只读拷贝，供快照在锁外序列化
+}
+
+// newHotEvents 按布局创建空的热数据存储，base 为槽位 0 对应的事件 ID。
+func newHotEvents(layout EventLayout, types *typeTable, base uint64) hotEvents {
+	if layout == LayoutCompact {
+		return newCompactEvents(types, base)
+	}
+	return &structEvents{evs: make([]tree.Event, 0, 1024)}
+}
+
+// hotMemSize 按热数据的布局估算事件除 payload 外占用的字节数。
+func (s *Store) hotMemSize(ev tree.Event) int64 {
+	if s.opts.Layout == LayoutCompact {
+		return compactMemSize(ev)
+	}
+	return eventMemSize(ev)
+}
+
+// structEvents 是默认布局：每个槽位一个 tree.Event，空槽位的 ID 为 0。
+type structEvents struct {
+	evs []tree.Event
+}
+
+func (e *structEvents) len() int { return len(e.evs) }
+
+func (e *structEvents) has(i int) bool { return i < len(e.evs) && e.evs[i].ID != 0 }
+
+func (e *structEvents) get(i int) (tree.Event, bool) {
+	if !e.has(i) {
+		return tree.Event{}, false
+	}
+	return e.evs[i], true
+}
+
+func (e *structEvents) timeAt(i int) int64 { return e.evs[i].TimeUnixNano }
+
+func (e *structEvents) put(i int, ev tree.Event) {
+	for len(e.evs) <= i {
+		e.evs = append(e.evs, tree.Event{})
+	}
+	e.evs[i] = ev
+}
+
+func (e *structEvents) clear(i int) { e.evs[i] = tree.Event{} }
+
+func (e *structEvents) drop(n int) { e.evs = slices.Clone(e.evs[n:]) }
+
+func (e *structEvents) clone() hotEvents { return &structEvents{evs: slices.Clone(e.evs)} }
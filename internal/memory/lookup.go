@@ -0,0 +1,38 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// LookupField 按 ID 升序返回一页 payload 字段值等于 q.Value 的在线事件 ID。
+// 字段没有索引时返回 *tree.QueryError，不会退化为扫描全部事件。
+func (s *Store) LookupField(q tree.FieldLookup) (tree.IDPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = queryDefaultLimit
+	}
+	limit = min(limit, queryMaxLimit)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	x, ok := s.fields[q.Field]
+	if !ok {
+		return tree.IDPage{}, &tree.QueryError{Reason: fmt.Sprintf("payload field %q is not indexed", q.Field)}
+	}
+	page := tree.IDPage{IDs: []uint64{}}
+	for _, id := range after(x.lists[q.Value], q.AfterID) {
+		// 已归档但尚未压缩掉的 ID
+		if !s.isEventIDValid(id) {
+			continue
+		}
+		if len(page.IDs) == limit {
+			page.NextAfterID = page.IDs[limit-1]
+			break
+		}
+		page.IDs = append(page.IDs, id)
+	}
+	return page, nil
+}
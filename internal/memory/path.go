@@ -0,0 +1,209 @@
+package memory
+
+import (
+	"container/heap"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+const (
+	pathDefaultLimit = 1   // 缺省只返回最短路径
+	pathMaxLimit     = 100 // 一次最多返回的路径数
+)
+
+// CausalPaths 按长度升序返回从 from 到 to 沿父子边的至多 limit 条路径（仅 ID）。
+// from 不是 to 的祖先时 Paths 为空；任一事件不存在时返回包装 storage.ErrNotFound 的错误。
+func (s *Store) CausalPaths(from, to uint64, limit int) (tree.CausalPaths, error) {
+	v := s.openView()
+	defer v.close()
+
+	paths, truncated, err := findPaths(v, from, to, limit)
+	if err != nil {
+		return tree.CausalPaths{}, err
+	}
+	return tree.CausalPaths{From: from, To: to, Length: pathLength(paths), Paths: paths, Truncated: truncated}, nil
+}
+
+// CausalPathsMeta 同 CausalPaths，路径上的每个事件带有元数据。
+func (s *Store) CausalPathsMeta(from, to uint64, limit int) (tree.CausalPathsMeta, error) {
+	v := s.openView()
+	defer v.close()
+
+	paths, truncated, err := findPaths(v, from, to, limit)
+	if err != nil {
+		return tree.CausalPathsMeta{}, err
+	}
+	// 多条路径共享的事件只读取一次
+	events := make(map[uint64]tree.PathEvent)
+	out := make([][]tree.PathEvent, len(paths))
+	for i, path := range paths {
+		out[i] = make([]tree.PathEvent, len(path))
+		for j, id := range path {
+			pe, ok := events[id]
+			if !ok {
+				ev, _ := v.event(id)
+				pe = tree.PathEvent{
+					ID:           id,
+					TimeUnixNano: ev.TimeUnixNano,
+					Type:         ev.Type,
+					Message:      ev.Message,
+					Payload:      expandPayload(ev.Payload),
+					Archived:     ev.Archived,
+				}
+				events[id] = pe
+			}
+			out[i][j] = pe
+		}
+	}
+	return tree.CausalPathsMeta{From: from, To: to, Length: pathLength(paths), Paths: out, Truncated: truncated}, nil
+}
+
+func pathLength(paths [][]uint64) int {
+	if len(paths) == 0 {
+		return 0
+	}
+	return len(paths[0]) - 1
+}
+
+// findPaths 在视图内按长度升序找出从 from 到 to 的至多 limit 条路径，truncated 表示还有路径未返回。
+//
+// 先由 pathSpan 找出位于两者之间的事件，再按 ID 降序（子事件的 ID 总大于父事件）算出每个事件到 to 的最短边数，
+// 最后以它为精确的下界做最佳优先搜索：部分路径按“已走的边数 + 剩余的最短边数”出队，补全的路径因此按长度升序产生，
+// 每条部分路径都一定能走到 to，搜索的代价与返回的路径数成正比，而不是与全部路径数成正比。
+func findPaths(v *readView, from, to uint64, limit int) ([][]uint64, bool, error) {
+	for _, id := range [2]uint64{from, to} {
+		if !v.has(id) {
+			return nil, false, fmt.Errorf("event %d: %w", id, storage.ErrNotFound)
+		}
+	}
+	if limit <= 0 {
+		limit = pathDefaultLimit
+	}
+	limit = min(limit, pathMaxLimit)
+
+	paths := [][]uint64{}
+	if from == to {
+		return append(paths, []uint64{from}), false, nil
+	}
+	if !v.s.reach.reaches(from, to) {
+		return paths, false, nil
+	}
+
+	next := pathSpan(v, from, to)
+	dist := make(map[uint64]int, len(next))
+	ids := slices.Sorted(maps.Keys(next))
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		if id == to {
+			dist[id] = 0
+			continue
+		}
+		// 遍历期间有树被归档时，个别事件可能走不到 to，记为 -1
+		best := -1
+		for _, c := range next[id] {
+			if d := dist[c]; d >= 0 && (best < 0 || d+1 < best) {
+				best = d + 1
+			}
+		}
+		dist[id] = best
+	}
+	if dist[from] < 0 {
+		return paths, false, nil
+	}
+
+	q := &pathQueue{{id: from, bound: dist[from]}}
+	seq := 0
+	for q.Len() > 0 {
+		p := heap.Pop(q).(*pathStep)
+		if p.id == to {
+			if len(paths) == limit {
+				return paths, true, nil
+			}
+			paths = append(paths, p.ids())
+			continue
+		}
+		for _, c := range next[p.id] {
+			if d := dist[c]; d >= 0 {
+				seq++
+				heap.Push(q, &pathStep{id: c, prev: p, depth: p.depth + 1, bound: p.depth + 1 + d, seq: seq})
+			}
+		}
+	}
+	return paths, false, nil
+}
+
+// pathSpan 从 from 出发沿子事件遍历，只保留 to 本身与 to 的祖先（由可达性索引判断），
+// 返回 from 与 to 之间的每个事件 -> 它通往 to 的子事件（升序）；to 对应 nil。
+// 遍历只读取内存中的 children，不读取冷数据段。
+func pathSpan(v *readView, from, to uint64) map[uint64][]uint64 {
+	next := map[uint64][]uint64{from: nil, to: nil}
+	stack := []uint64{from}
+	for len(stack) > 0 {
+		id := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		v.step()
+
+		var kept []uint64
+		for _, c := range v.children(id) {
+			if c != to && (!v.has(c) || !v.s.reach.reaches(c, to)) {
+				continue
+			}
+			kept = append(kept, c)
+			if _, seen := next[c]; !seen {
+				next[c] = nil
+				stack = append(stack, c)
+			}
+		}
+		next[id] = kept
+	}
+	return next
+}
+
+// pathStep 是搜索中的一条部分路径，prev 指回上一步，多条路径共享公共前缀。
+type pathStep struct {
+	id    uint64
+	prev  *pathStep
+	depth int // 已走的边数
+	bound int // depth + 到 to 的最短边数，即这条部分路径能补全成的最短路径长度
+	seq   int // 入队顺序，使结果确定
+}
+
+// ids 返回从 from 到当前事件的 ID 序列。
+func (p *pathStep) ids() []uint64 {
+	out := make([]uint64, p.depth+1)
+	for ; p != nil; p = p.prev {
+		out[p.depth] = p.id
+	}
+	return out
+}
+
+// pathQueue 是部分路径的最小堆：bound 小的先出队；bound 相同时走得更远的先出队，尽快补全路径；再按入队顺序。
+type pathQueue []*pathStep
+
+func (q pathQueue) Len() int { return len(q) }
+
+func (q pathQueue) Less(i, j int) bool {
+	a, b := q[i], q[j]
+	if a.bound != b.bound {
+		return a.bound < b.bound
+	}
+	if a.depth != b.depth {
+		return a.depth > b.depth
+	}
+	return a.seq < b.seq
+}
+
+func (q pathQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+
+func (q *pathQueue) Push(x any) { *q = append(*q, x.(*pathStep)) }
+
+func (q *pathQueue) Pop() any {
+	old := *q
+	p := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return p
+}
@@ -0,0 +1,232 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+)
+
+// pathCounts 由各事件的父事件按 ID 顺序计算从 from 出发到每个事件的路径数，按边数分组；计数在 1<<20 处截断。
+func pathCounts(parents map[uint64][]uint64, ids []uint64, from uint64) map[uint64]map[int]int {
+	counts := map[uint64]map[int]int{from: {0: 1}}
+	for _, id := range ids {
+		if id <= from {
+			continue
+		}
+		for _, p := range parents[id] {
+			for l, c := range counts[p] {
+				if counts[id] == nil {
+					counts[id] = map[int]int{}
+				}
+				counts[id][l+1] = min(counts[id][l+1]+c, 1<<20)
+			}
+		}
+	}
+	return counts
+}
+
+// TestCausalPaths 在不同形状的 DAG 上对抽样的事件对检查路径：每条都沿父子边从 from 走到 to 且互不相同，
+// 长度序列与暴力计数得到的最短的 limit 条相同，Truncated 当且仅当还有更多路径；元数据视图与逐个读取一致。
+// 降冷与重新打开后结果不变。
+func TestCausalPaths(t *testing.T) {
+	type shape func(t *testing.T, s *Store, rng *rand.Rand) map[uint64][]uint64
+	random := func(n, roots, maxParents int) shape {
+		return func(t *testing.T, s *Store, rng *rand.Rand) map[uint64][]uint64 {
+			parents := map[uint64][]uint64{}
+			var ids []uint64
+			for i := range n {
+				var ps []uint64
+				if i >= roots {
+					// 父事件多取自最近的事件，形成较长的链
+					for range 1 + rng.IntN(maxParents) {
+						ps = append(ps, ids[max(0, len(ids)-1-rng.IntN(min(len(ids), 12)))])
+					}
+				}
+				id := mustEmit(t, s, "node", fmt.Sprintf(`{"i":%d}`, i), ps...)
+				ev, _ := s.Get(id)
+				parents[id] = ev.Parents
+				ids = append(ids, id)
+			}
+			return parents
+		}
+	}
+	// diamonds 写入 n 个首尾相接的菱形（2^n 条等长路径），每隔几个菱形有一条跨过它们的捷径
+	diamonds := func(n int) shape {
+		return func(t *testing.T, s *Store, _ *rand.Rand) map[uint64][]uint64 {
+			parents := map[uint64][]uint64{}
+			emit := func(ps ...uint64) uint64 {
+				id := mustEmit(t, s, "node", "", ps...)
+				ev, _ := s.Get(id)
+				parents[id] = ev.Parents
+				return id
+			}
+			top := emit()
+			var tops []uint64
+			for i := range n {
+				tops = append(tops, top)
+				l, r := emit(top), emit(top)
+				ps := []uint64{l, r}
+				if i%3 == 2 {
+					ps = append(ps, tops[i-2])
+				}
+				top = emit(ps...)
+			}
+			return parents
+		}
+	}
+
+	cases := []struct {
+		name  string
+		build shape
+	}{
+		{name: "chain", build: random(60, 1, 1)},
+		{name: "sparse forest", build: random(150, 10, 2)},
+		{name: "dense dag", build: random(120, 2, 4)},
+		{name: "diamonds", build: diamonds(10)},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{DataDir: t.TempDir(), Sync: SyncNever, HotWindow: 20}
+			s := mustOpen(t, opts)
+			rng := rand.New(rand.NewPCG(3, 4))
+			parents := tc.build(t, s, rng)
+			ids := make([]uint64, 0, len(parents))
+			for id := uint64(1); id <= uint64(len(parents)); id++ {
+				ids = append(ids, id)
+			}
+			// 第一个、最后一个与随机抽取的事件两两组合
+			sample := []uint64{ids[0], ids[len(ids)-1]}
+			for range 12 {
+				sample = append(sample, ids[rng.IntN(len(ids))])
+			}
+
+			check := func(stage string) {
+				t.Helper()
+				for _, from := range sample {
+					counts := pathCounts(parents, ids, from)
+					for _, to := range sample {
+						var lengths []int // 全部路径的边数，按升序，最多 pathMaxLimit+1 个
+						for l := 0; len(lengths) <= pathMaxLimit && l <= len(ids); l++ {
+							for range min(counts[to][l], pathMaxLimit+1) {
+								lengths = append(lengths, l)
+							}
+						}
+						for _, limit := range []int{0, 1, 3, 17, pathMaxLimit, 1000} {
+							got, err := s.CausalPaths(from, to, limit)
+							if err != nil {
+								t.Fatal(err)
+							}
+							n := min(max(limit, 1), pathMaxLimit)
+							want := lengths[:min(n, len(lengths))]
+							var gotLengths []int
+							seen := map[string]bool{}
+							for _, p := range got.Paths {
+								if p[0] != from || p[len(p)-1] != to {
+									t.Fatalf("%s: path %v does not run from %d to %d", stage, p, from, to)
+								}
+								for i := 1; i < len(p); i++ {
+									if !slices.Contains(parents[p[i]], p[i-1]) {
+										t.Fatalf("%s: path %v: %d is not a parent of %d", stage, p, p[i-1], p[i])
+									}
+								}
+								if key := fmt.Sprint(p); seen[key] {
+									t.Fatalf("%s: path %v returned twice", stage, p)
+								} else {
+									seen[key] = true
+								}
+								gotLengths = append(gotLengths, len(p)-1)
+							}
+							if !slices.Equal(gotLengths, want) {
+								t.Fatalf("%s: %d -> %d limit %d: lengths %v, want %v", stage, from, to, limit, gotLengths, want)
+							}
+							shortest := 0
+							if len(want) > 0 {
+								shortest = want[0]
+							}
+							if got.Length != shortest {
+								t.Fatalf("%s: %d -> %d: length %d, want %d", stage, from, to, got.Length, shortest)
+							}
+							if truncated := len(lengths) > n; got.Truncated != truncated {
+								t.Fatalf("%s: %d -> %d limit %d: truncated %v, want %v", stage, from, to, limit, got.Truncated, truncated)
+							}
+						}
+					}
+				}
+
+				// 元数据视图与逐个读取一致
+				from, to := ids[0], ids[len(ids)-1]
+				plain, err := s.CausalPaths(from, to, 5)
+				if err != nil {
+					t.Fatal(err)
+				}
+				meta, err := s.CausalPathsMeta(from, to, 5)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if meta.Length != plain.Length || meta.Truncated != plain.Truncated || len(meta.Paths) != len(plain.Paths) {
+					t.Fatalf("%s: meta view %d paths of length %d, plain view %d of length %d", stage, len(meta.Paths), meta.Length, len(plain.Paths), plain.Length)
+				}
+				for i, p := range meta.Paths {
+					for j, pe := range p {
+						ev, ok := s.Get(plain.Paths[i][j])
+						if !ok || pe.ID != ev.ID || pe.Type != ev.Type || pe.TimeUnixNano != ev.TimeUnixNano || string(pe.Payload) != string(ev.Payload) {
+							t.Fatalf("%s: meta path %d step %d = %+v, want event %+v", stage, i, j, pe, ev)
+						}
+					}
+				}
+			}
+			check("after emit")
+			if _, err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			if s.Snapshot().ColdEvents == 0 {
+				t.Fatal("nothing was demoted")
+			}
+			check("after demotion")
+			s.Close()
+			s = mustOpen(t, opts)
+			check("after reopen")
+		})
+	}
+}
+
+// TestCausalPathsErrors 检查不存在或已归档的事件返回 storage.ErrNotFound，没有因果关系时返回空结果而不是错误，
+// 事件到自身是一条只含它的路径，归档的根事件在元数据视图中带有存根。
+func TestCausalPathsErrors(t *testing.T) {
+	s := mustOpen(t, Options{DataDir: t.TempDir(), Sync: SyncNever})
+	a := mustEmit(t, s, "root", "")
+	b := mustEmit(t, s, "child", "", a)
+	gone := mustEmit(t, s, "root", "")
+	member := mustEmit(t, s, "child", "", gone)
+	stub, err := s.Archive(gone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, pair := range [][2]uint64{{a, 99}, {99, b}, {0, b}, {a, member}, {member, member}} {
+		if _, err := s.CausalPaths(pair[0], pair[1], 1); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("CausalPaths(%d, %d): %v, want storage.ErrNotFound", pair[0], pair[1], err)
+		}
+		if _, err := s.CausalPathsMeta(pair[0], pair[1], 1); !errors.Is(err, storage.ErrNotFound) {
+			t.Errorf("CausalPathsMeta(%d, %d): %v, want storage.ErrNotFound", pair[0], pair[1], err)
+		}
+	}
+	for _, pair := range [][2]uint64{{b, a}, {a, gone}, {gone, b}} {
+		got, err := s.CausalPaths(pair[0], pair[1], 10)
+		if err != nil || len(got.Paths) != 0 || got.Paths == nil || got.Length != 0 || got.Truncated {
+			t.Errorf("CausalPaths(%d, %d) = %+v, %v, want no paths", pair[0], pair[1], got, err)
+		}
+	}
+	got, err := s.CausalPaths(a, a, 10)
+	if err != nil || len(got.Paths) != 1 || !slices.Equal(got.Paths[0], []uint64{a}) || got.Length != 0 {
+		t.Fatalf("CausalPaths(a, a) = %+v, %v, want the single path [a]", got, err)
+	}
+	meta, err := s.CausalPathsMeta(gone, gone, 1)
+	if err != nil || len(meta.Paths) != 1 || meta.Paths[0][0].Archived == nil || *meta.Paths[0][0].Archived != stub {
+		t.Fatalf("CausalPathsMeta on an archived root = %+v, %v, want its stub %+v", meta, err, stub)
+	}
+}
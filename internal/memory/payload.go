@@ -0,0 +1,94 @@
+package memory
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+)
+
+// payloadFlate 是压缩存储的 payload 的首字节。合法 JSON 不会以该字节开头，
+// 因此存储形式可以直接放在 tree.Event.Payload 中，未压缩的 payload（包括旧数据）保持原样。
+// 压缩形式：payloadFlate | uvarint(原始长度) | raw deflate 数据。
+const payloadFlate byte = 0x01
+
+var (
+	flateWriters = sync.Pool{New: func() any {
+		w, _ := flate.NewWriter(nil, flate.DefaultCompression)
+		return w
+	}}
+	flateReaders = sync.Pool{New: func() any {
+		return flate.NewReader(nil)
+	}}
+)
+
+// compressPayload 返回 payload 的存储形式：不小于 PayloadCompressMin 字节且压缩后更小时以 flate 压缩，否则原样返回。
+func (s *Store) compressPayload(p json.RawMessage) json.RawMessage {
+	if s.opts.PayloadCompressMin <= 0 || len(p) < s.opts.PayloadCompressMin {
+		return p
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(p) / 2)
+	buf.WriteByte(payloadFlate)
+	buf.Write(binary.AppendUvarint(nil, uint64(len(p))))
+
+	w := flateWriters.Get().(*flate.Writer)
+	w.Reset(&buf)
+	_, _ = w.Write(p)
+	_ = w.Close()
+	flateWriters.Put(w)
+
+	if buf.Len() >= len(p) {
+		return p
+	}
+	return buf.Bytes()
+}
+
+// expandPayload 将存储形式的 payload 还原为原始 JSON；未压缩的 payload 原样返回。
+// 解压失败（只可能源于数据损坏）时记录日志并返回 nil。
+func expandPayload(p json.RawMessage) json.RawMessage {
+	if len(p) == 0 || p[0] != payloadFlate {
+		return p
+	}
+	raw, err := inflatePayload(p)
+	if err != nil {
+		log.Printf("payload: %v", err)
+		return nil
+	}
+	return raw
+}
+
+// inflatePayload 解压一个以 payloadFlate 开头的 payload。
+func inflatePayload(p []byte) (json.RawMessage, error) {
+	n, k := binary.Uvarint(p[1:])
+	if k <= 0 || n > recordMaxSize {
+		return nil, fmt.Errorf("bad compressed payload header")
+	}
+
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+	_ = r.(flate.Resetter).Reset(bytes.NewReader(p[1+k:]), nil)
+
+	raw := make([]byte, n)
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return nil, fmt.Errorf("inflate payload: %w", err)
+	}
+	return raw, nil
+}
+
+// payloadSizes 返回 payload 的原始字节数与存储字节数。
+func payloadSizes(p json.RawMessage) (raw, stored int) {
+	if len(p) == 0 || p[0] != payloadFlate {
+		return len(p), len(p)
+	}
+	n, k := binary.Uvarint(p[1:])
+	if k <= 0 {
+		return len(p), len(p)
+	}
+	return int(n), len(p)
+}
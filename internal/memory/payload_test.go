@@ -0,0 +1,121 @@
+package memory
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// TestPayloadCompression 检查达到阈值的 payload 压缩存储、读取时还原为原始 JSON，
+// Snapshot 的原始与存储字节数反映压缩效果，并在快照、WAL 回放与冷数据段中保持。
+func TestPayloadCompression(t *testing.T) {
+	const compressMin = 256
+	cases := []struct {
+		name       string
+		opts       Options
+		checkpoint bool
+	}{
+		{name: "memory only", opts: Options{PayloadCompressMin: compressMin}},
+		{name: "replayed from the wal", opts: Options{PayloadCompressMin: compressMin}},
+		{name: "loaded from a checkpoint", opts: Options{PayloadCompressMin: compressMin}, checkpoint: true},
+		{name: "cold segments", opts: Options{PayloadCompressMin: compressMin, HotWindow: 5}, checkpoint: true},
+		{name: "compact layout", opts: Options{PayloadCompressMin: compressMin, Layout: LayoutCompact}, checkpoint: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			persistent := tc.name != "memory only"
+			opts := tc.opts
+			if persistent {
+				opts.DataDir, opts.Sync = t.TempDir(), SyncNever
+			}
+			s := mustOpen(t, opts)
+			_, events, cancel := s.Subscribe()
+
+			// 大 payload 各不相同（不触发去重），小 payload 低于阈值原样存储
+			var (
+				ids      []uint64
+				payloads []string
+				raw      int64
+			)
+			parent := uint64(0)
+			for i := range 20 {
+				p := fmt.Sprintf(`{"i":%d}`, i)
+				if i%2 == 0 {
+					p = fmt.Sprintf(`{"i":%d,"config":%q}`, i, strings.Repeat("retry=3;timeout=30s;", 100))
+				}
+				id := mustEmit(t, s, "task", p, parent) // parent 为 0 时被忽略
+				parent = id
+				ids = append(ids, id)
+				payloads = append(payloads, p)
+				raw += int64(len(p))
+			}
+			for i := range ids {
+				if ev := <-events; string(ev.Payload) != payloads[i] {
+					t.Fatalf("subscriber got payload %.40q for event %d, want the raw JSON", ev.Payload, ev.ID)
+				}
+			}
+			cancel()
+
+			check := func(stage string) {
+				t.Helper()
+				for i, id := range ids {
+					ev, ok := s.Get(id)
+					if !ok || string(ev.Payload) != payloads[i] {
+						t.Fatalf("%s: Get(%d) payload = %.40q, want the raw JSON", stage, id, ev.Payload)
+					}
+				}
+				meta, err := s.DescendantsTreeMeta(ids[0])
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i, n := 0, &meta; n != nil; i++ {
+					if string(n.Payload) != payloads[i] {
+						t.Fatalf("%s: meta view payload of %d = %.40q, want the raw JSON", stage, n.ID, n.Payload)
+					}
+					if len(n.Children) == 0 {
+						break
+					}
+					n = &n.Children[0]
+				}
+
+				snap := s.Snapshot()
+				if snap.TotalPayloadBytes != raw {
+					t.Fatalf("%s: total payload bytes = %d, want %d", stage, snap.TotalPayloadBytes, raw)
+				}
+				if snap.ColdEvents == 0 && snap.PayloadBytes != raw {
+					t.Fatalf("%s: payload bytes = %d, want %d", stage, snap.PayloadBytes, raw)
+				}
+				if snap.PayloadStoredBytes*2 >= snap.PayloadBytes || snap.PayloadDedupBytes != 0 {
+					t.Fatalf("%s: stored %d of %d raw bytes (%d deduplicated), want compression and no dedup",
+						stage, snap.PayloadStoredBytes, snap.PayloadBytes, snap.PayloadDedupBytes)
+				}
+				// 内存中的事件保存压缩形式
+				s.mu.RLock()
+				ev, _ := s.lookupLocked(ids[len(ids)-2])
+				s.mu.RUnlock()
+				if !bytes.HasPrefix(ev.Payload, []byte{payloadFlate}) {
+					t.Fatalf("%s: event %d is held uncompressed", stage, ev.ID)
+				}
+				if rep, err := s.Verify(); err != nil || !rep.OK {
+					t.Fatalf("%s: verify: %+v, %v", stage, rep, err)
+				}
+			}
+			check("after emit")
+			if !persistent {
+				return
+			}
+			if tc.checkpoint {
+				if _, err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+			}
+			check("after checkpoint")
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			s = mustOpen(t, opts)
+			check("after reopen")
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"slices"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// SyncPolicy 决定 WAL 何时 fsync 到磁盘。
+type SyncPolicy int
+
+const (
+	SyncInterval SyncPolicy = iota // 由后台 goroutine 按固定间隔 fsync（默认）
+	SyncAlways                     // 每条记录写入后立即 fsync，最安全也最慢
+	SyncNever                      // 从不主动 fsync，交给操作系统回写
+)
+
+// ParseSyncPolicy 将 "always" / "interval" / "never" 解析为 SyncPolicy。
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "", "interval":
+		return SyncInterval, nil
+	case "always":
+		return SyncAlways, nil
+	case "never":
+		return SyncNever, nil
+	default:
+		return 0, fmt.Errorf("unknown sync policy: %s", s)
+	}
+}
+
+func (p SyncPolicy) String() string {
+	switch p {
+	case SyncAlways:
+		return "always"
+	case SyncNever:
+		return "never"
+	default:
+		return "interval"
+	}
+}
+
+// Options 是 Store 的配置。DataDir 为空时 Open 返回纯内存的 Store，只有与持久化无关的选项（如 PayloadCompressMin）生效。
+type Options struct {
+	DataDir            string        // 数据目录，存放 WAL 日志段与快照文件
+	Sync               SyncPolicy    // WAL fsync 策略
+	SyncInterval       time.Duration // Sync == SyncInterval 时的 fsync 间隔
+	CheckpointInterval time.Duration // 定时快照间隔，0 表示只在手动触发时写快照
+	ColdAfter          time.Duration // 早于该时长的事件在快照时移入冷数据层，0 表示不按时间降冷
+	HotWindow          uint64        // 内存中至少保留最新的多少个 ID，更早的在快照时移入冷数据层，0 表示不按 ID 降冷
+	RetainAge          time.Duration // 最新事件早于该时长的根树在定时快照前归档，0 表示不按时间归档
+	RetainEvents       int           // 在线事件数超过该值时从最旧的根树开始归档，0 表示不限制
+	PayloadCompressMin int           // 不小于该字节数的 payload 以 flate 压缩存储，0 表示不压缩
+	MaxEvents          int           // 常驻内存的事件数上限，0 表示不限制
+	MaxMemoryBytes     int64         // 常驻内存事件的估算占用上限，0 表示不限制
+	OnLimit            LimitPolicy   // 达到上限时拒绝写入还是降冷；LimitSpill 需要 DataDir
+	Layout             EventLayout   // 热事件的内存布局，LayoutCompact 以更少的内存保存同样的事件
+	ForestWorkers      int           // 批量后代树/溯源树查询并行构建的最大 goroutine 数，0 表示 GOMAXPROCS
+	PayloadIndexes     []string      // 启动时确保建立索引的 payload 字段路径（如 "task_id"、"meta.run_id"），缺少的在 Open 时回填
+	NoTextIndex        bool          // 不建立 Message 全文索引（每个词每个事件约 8 字节），全文查询返回 storage.ErrNotSupported
+}
+
+// Open 创建 Store，加载最新的有效快照并回放其后的 WAL 恢复 DAG，然后打开 WAL 供后续 Emit 追加。
+func Open(opts Options) (*Store, error) {
+	s := NewStore()
+	s.opts = opts
+	s.events = newHotEvents(opts.Layout, s.types, 0)
+	if opts.NoTextIndex {
+		s.text = nil
+	}
+	for _, field := range opts.PayloadIndexes {
+		if _, err := parseFieldPath(field); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DataDir == "" {
+		if s.limited() && opts.OnLimit == LimitSpill {
+			return nil, fmt.Errorf("limit policy %s requires a data directory", opts.OnLimit)
+		}
+		if err := s.ensureFieldIndexesLocked(); err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	if err := os.MkdirAll(opts.DataDir, 0o755); err != nil {
+		return nil, err
+	}
+
+	seq, dict, err := s.recover(true)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.ensureFieldIndexesLocked(); err != nil {
+		return nil, err
+	}
+	w, err := openWAL(opts.DataDir, seq, opts.Sync, dict)
+	if err != nil {
+		return nil, err
+	}
+	s.wal = w
+
+	s.bgStop = make(chan struct{})
+	if opts.Sync == SyncInterval {
+		interval := opts.SyncInterval
+		if interval <= 0 {
+			interval = time.Second
+		}
+		s.bgWG.Add(1)
+		go s.syncLoop(interval)
+	}
+	if opts.CheckpointInterval > 0 {
+		s.bgWG.Add(1)
+		go s.checkpointLoop(opts.CheckpointInterval)
+	}
+	if s.spilling() {
+		s.spillCh = make(chan struct{}, 1)
+		s.bgWG.Add(1)
+		go s.spillLoop()
+	}
+	return s, nil
+}
+
+// Close 停止后台 goroutine 并关闭 WAL 与冷数据段。纯内存 Store 调用 Close 为空操作。
+func (s *Store) Close() error {
+	if s.bgStop != nil {
+		close(s.bgStop)
+		s.bgWG.Wait()
+		s.bgStop = nil
+	}
+	if s.wal == nil {
+		return nil
+	}
+	// 等待进行中的组提交完成
+	s.commitGate.Lock()
+	defer s.commitGate.Unlock()
+	err := s.wal.close()
+	if cerr := s.cold.close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// recover 加载最新的有效快照并回放其后的 WAL，返回应继续追加的日志段序号及该日志段的 payload 字典。
+// repair 为 true 时删除孤儿冷数据段并截断最后一个日志段的残缺尾部；为 false 时不修改任何文件（供 Fsck 使用）。
+func (s *Store) recover(repair bool) (uint64, *payloadDict, error) {
+	dir := s.opts.DataDir
+	fromSeq, err := s.loadLatestCheckpoint()
+	if err != nil {
+		return 0, nil, err
+	}
+	if s.cold == nil {
+		s.cold = newColdTier(dir)
+	}
+	// 写入后尚未被快照引用的冷数据段（通常源于崩溃）对应的事件仍在 WAL 中，直接删除
+	if repair {
+		if err := removeOrphanColdSegments(dir, s.cold.metas()); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	seqs, err := listWALSegments(dir)
+	if err != nil {
+		return 0, nil, err
+	}
+	seqs = slices.DeleteFunc(seqs, func(seq uint64) bool { return seq < fromSeq })
+	if fromSeq == 0 && len(seqs) > 0 && seqs[0] > 1 {
+		return 0, nil, fmt.Errorf("no valid checkpoint covers wal segments before %d", seqs[0])
+	}
+	var dict *payloadDict
+	for i, seq := range seqs {
+		path := walSegmentPath(dir, seq)
+		dict = newPayloadDict()
+		var (
+			parts      partAssembler
+			imp        = importLog{path: path}
+			start, end int64 // 当前原始记录在日志段中的起止偏移
+		)
+		good, err := readWALSegment(path, func(kind byte, body []byte) error {
+			start, end = end, end+recordHeaderSize+1+int64(len(body))
+			return parts.feed(kind, body, func(kind byte, body []byte) error {
+				switch kind {
+				case walRecordImportBegin, walRecordImportCommit, walRecordImportAbort:
+					return imp.replay(s, kind, body, start, end)
+				case walRecordImportBatch:
+					return nil // 在 commit 记录处读回
+				}
+				return s.replayRecord(kind, body, dict)
+			})
+		})
+		if errors.Is(err, errTornRecord) && i == len(seqs)-1 {
+			// 仅最后一个日志段允许存在残缺尾部：截断到最后一条完整记录
+			if repair {
+				log.Printf("wal: truncating torn tail of %s at offset %d", path, good)
+				if err := os.Truncate(path, good); err != nil {
+					return 0, nil, err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return 0, nil, fmt.Errorf("replay %s: %w", path, err)
+		}
+	}
+
+	if len(seqs) > 0 {
+		return seqs[len(seqs)-1], dict, nil
+	}
+	return max(fromSeq, 1), nil, nil
+}
+
+// loadLatestCheckpoint 从新到旧尝试加载快照，返回第一个有效快照之后的 WAL 日志段序号；没有有效快照时返回 0。
+func (s *Store) loadLatestCheckpoint() (uint64, error) {
+	seqs, err := listCheckpoints(s.opts.DataDir)
+	if err != nil {
+		return 0, err
+	}
+	for i := len(seqs) - 1; i >= 0; i-- {
+		path := checkpointPath(s.opts.DataDir, seqs[i])
+		st, info, err := readCheckpoint(path)
+		if err != nil {
+			log.Printf("checkpoint: skipping invalid %s: %v", path, err)
+			continue
+		}
+		if err := s.loadCheckpoint(st); err != nil {
+			return 0, fmt.Errorf("load %s: %w", path, err)
+		}
+		s.lastCkpt.Store(&info)
+		return st.seq, nil
+	}
+	return 0, nil
+}
+
+// syncLoop 按固定间隔将 WAL fsync 到磁盘，直到 Close 被调用。
+func (s *Store) syncLoop(interval time.Duration) {
+	defer s.bgWG.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.bgStop:
+			return
+		case <-ticker.C:
+			if err := s.wal.sync(); err != nil {
+				log.Printf("wal: sync failed: %v", err)
+			}
+		}
+	}
+}
+
+// replayRecord 以所在日志段的 payload 字典回放一条 WAL 记录到内存结构中（仅在 Open 期间单线程调用）。
+func (s *Store) replayRecord(kind byte, body []byte, dict *payloadDict) error {
+	switch kind {
+	case walRecordEvent:
+		ev, _, err := decodeEvent(body, dict)
+		if err != nil {
+			return err
+		}
+		return s.restoreEvent(ev)
+	case walRecordArchive:
+		d := decoder{buf: body}
+		stub := tree.ArchiveStub{Root: d.uvarint(), ArchivedAt: d.varint(), LastEventID: d.uvarint()}
+		ids := d.ids()
+		if d.err != nil {
+			return d.err
+		}
+		stub.Events = len(ids)
+		if _, ok := s.roots[stub.Root]; !ok {
+			return fmt.Errorf("archive: %d is not a root", stub.Root)
+		}
+		for _, id := range ids {
+			if !s.isEventIDValid(id) {
+				return fmt.Errorf("archive %d: event %d not found", stub.Root, id)
+			}
+		}
+		s.archiveLocked(stub, ids)
+		return nil
+	case walRecordRehydrate:
+		d := decoder{buf: body}
+		root := d.uvarint()
+		n := d.uvarint()
+		if d.err == nil && n > uint64(len(body)) {
+			return errShortRecord
+		}
+		events := make([]tree.Event, 0, n)
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			ev, _, err := decodeEvent(d.bytes(), dict)
+			if d.err == nil && err != nil {
+				return err
+			}
+			events = append(events, ev)
+		}
+		if d.err != nil {
+			return d.err
+		}
+		if _, ok := s.archived[root]; !ok {
+			return fmt.Errorf("rehydrate: tree %d is not archived", root)
+		}
+		s.rehydrateLocked(root, events)
+		return nil
+	case walRecordBatch:
+		events, err := decodeEvents(body, dict)
+		if err != nil {
+			return err
+		}
+		for _, ev := range events {
+			if err := s.restoreEvent(ev); err != nil {
+				return err
+			}
+		}
+		return nil
+	case walRecordFieldIndex:
+		d := decoder{buf: body}
+		field := string(d.bytes())
+		if d.err != nil {
+			return d.err
+		}
+		return s.buildFieldIndexLocked(field)
+	case walRecordFieldDrop:
+		d := decoder{buf: body}
+		field := string(d.bytes())
+		delete(s.fields, field)
+		s.publishFieldsLocked()
+		return d.err
+	default:
+		return fmt.Errorf("unknown wal record kind %d", kind)
+	}
+}
+
+// restoreEvent 将一个已持久化的事件按原 ID 放回 DAG，并推进 nextID。
+func (s *Store) restoreEvent(ev tree.Event) error {
+	if ev.ID == 0 {
+		return fmt.Errorf("event id must be non-zero")
+	}
+	if ev.ID < s.hotBase {
+		return fmt.Errorf("event %d is below the cold watermark %d", ev.ID, s.hotBase)
+	}
+	if s.isEventIDValid(ev.ID) {
+		return fmt.Errorf("duplicate event %d", ev.ID)
+	}
+	for _, p := range ev.Parents {
+		if !s.isEventIDValid(p) {
+			return fmt.Errorf("event %d: parent %d not found", ev.ID, p)
+		}
+	}
+
+	ev.Type = s.internType(ev.Type)
+	s.applyLocked(ev, indexKeys{})
+	if ev.ID > s.nextID {
+		s.nextID = ev.ID
+	}
+	return nil
+}
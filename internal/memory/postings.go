@@ -0,0 +1,106 @@
+package memory
+
+import (
+	"maps"
+	"slices"
+)
+
+// postingEntryBytes 是倒排表中每个键的估算固定开销：map 项中的字符串头与切片头，以及桶的摊销。
+const postingEntryBytes = 48
+
+// postings 是字符串键 -> 升序在线事件 ID 列表的倒排表，字段索引与全文索引共用。
+// 维护方式与 typeIndex 相同：applyLocked 追加，归档只累加过期数，过期项超过一半时整体压缩，乱序追加由 settle 合并。
+// 键的种类可能很多（每个任务一个 task_id、每个词一个列表），过期数按整个表而非每个键统计，压缩的代价摊到被归档的事件上。
+// 除末尾追加外的修改总是分配新数组，Checkpoint 只需拷贝 map 即可得到一致视图（需持有 s.mu）。
+type postings struct {
+	lists    map[string][]uint64
+	n        int            // 全部列表的 ID 总数，含过期项
+	stale    int            // 列表中已不在线的 ID 数
+	keyBytes int            // 全部键的字节数
+	dirty    map[string]int // 有乱序追加的键 -> 仍然有序的前缀长度
+}
+
+func newPostings() *postings {
+	return &postings{lists: make(map[string][]uint64)}
+}
+
+// add 把事件 id 加入键 key 的列表，乱序时先追加在末尾，由调用方在同一次持锁期间调用 settle 合并。
+func (p *postings) add(key string, id uint64) {
+	l, ok := p.lists[key]
+	if !ok {
+		p.keyBytes += len(key)
+	}
+	if _, dirty := p.dirty[key]; !dirty && len(l) > 0 && l[len(l)-1] >= id {
+		if p.dirty == nil {
+			p.dirty = make(map[string]int)
+		}
+		p.dirty[key] = len(l)
+	}
+	p.lists[key] = append(l, id)
+	p.n++
+}
+
+// settle 将乱序追加的 ID 排序后并入有序前缀，归档后尚未压缩掉的 ID 被恢复时只保留一个并扣减过期数。
+func (p *postings) settle() {
+	for key, n := range p.dirty {
+		l := p.lists[key]
+		tail := slices.Clone(l[n:])
+		slices.Sort(tail)
+		merged, dups := mergeSorted(l[:n], tail)
+		p.lists[key] = merged
+		p.n -= dups
+		p.stale -= dups
+	}
+	clear(p.dirty)
+}
+
+// expire 记录 n 个 ID 离开了在线存储，列表本身在 compact 时才更新。
+func (p *postings) expire(n int) {
+	p.stale += n
+}
+
+// compact 在过期项超过一半时重建全部列表，live 判断 ID 是否仍在线。
+func (p *postings) compact(live func(uint64) bool) {
+	if p.stale == 0 || p.stale*2 <= p.n {
+		return
+	}
+	lists := make(map[string][]uint64, len(p.lists))
+	p.n, p.keyBytes = 0, 0
+	for key, l := range p.lists {
+		var kept []uint64
+		for _, id := range l {
+			if live(id) {
+				kept = append(kept, id)
+			}
+		}
+		if len(kept) > 0 {
+			lists[key] = kept
+			p.n += len(kept)
+			p.keyBytes += len(key)
+		}
+	}
+	p.lists, p.stale = lists, 0
+}
+
+// load 载入快照中的列表，丢弃其中已不在线的 ID，过期数从 0 开始。
+func (p *postings) load(lists map[string][]uint64, live func(uint64) bool) {
+	p.lists, p.n, p.stale, p.keyBytes = make(map[string][]uint64, len(lists)), 0, 0, 0
+	clear(p.dirty)
+	for key, l := range lists {
+		if l = slices.DeleteFunc(l, func(id uint64) bool { return !live(id) }); len(l) > 0 {
+			p.lists[key] = l
+			p.n += len(l)
+			p.keyBytes += len(key)
+		}
+	}
+}
+
+// clone 返回列表的浅拷贝（共享底层数组，Checkpoint 写出时使用）。
+func (p *postings) clone() map[string][]uint64 {
+	return maps.Clone(p.lists)
+}
+
+// memBytes 估算倒排表占用的内存：每个 ID 8 字节，加上键本身与每个键的固定开销。
+func (p *postings) memBytes() int64 {
+	return int64(p.n)*8 + int64(p.keyBytes) + int64(len(p.lists))*postingEntryBytes
+}
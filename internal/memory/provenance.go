@@ -2,120 +2,109 @@ package memory
 
 import "github.com/Mr-xiaotian/CelestialTree/internal/tree"
 
-// provenanceTreeLocked 递归构建以 rootID 为起点的溯源树（仅 ID），向上追溯所有祖先。
-func (s *Store) provenanceTreeLocked(rootID uint64, visited map[uint64]struct{}) tree.ProvenanceTree {
-	if _, seen := visited[rootID]; seen {
-		return tree.ProvenanceTree{ID: rootID, IsRef: true, Parents: nil}
-	}
-	visited[rootID] = struct{}{}
-
-	node := tree.ProvenanceTree{ID: rootID, Parents: []tree.ProvenanceTree{}}
-
-	ev := s.events[rootID]
+// parentsInView 返回 id 在视图内的父事件，保持 Parents 中的顺序。
+func parentsInView(v *readView, id uint64) []uint64 {
+	ev, _ := v.event(id)
+	out := make([]uint64, 0, len(ev.Parents))
 	for _, pid := range ev.Parents {
-		if !s.isEventIDValid(pid) {
-			continue
+		if v.has(pid) {
+			out = append(out, pid)
 		}
-		node.Parents = append(node.Parents, s.provenanceTreeLocked(pid, visited))
 	}
-	return node
+	return out
 }
 
-// provenanceTreeMetaLocked 递归构建以 rootID 为起点的溯源树（含元数据）。
-func (s *Store) provenanceTreeMetaLocked(rootID uint64, visited map[uint64]struct{}) tree.ProvenanceTreeMeta {
-	ev := s.events[rootID]
+// provenanceShape 构建溯源树（仅 ID）：下一层是视图内的父事件，向上追溯所有祖先。
+var provenanceShape = treeShape[tree.ProvenanceTree]{
+	kind:  cursorProvenance,
+	edges: parentsInView,
+	node: func(_ *readView, id uint64, ref bool) tree.ProvenanceTree {
+		if ref {
+			return tree.ProvenanceTree{ID: id, IsRef: true, Parents: nil}
+		}
+		return tree.ProvenanceTree{ID: id, Parents: []tree.ProvenanceTree{}}
+	},
+	attach:   func(p *tree.ProvenanceTree, c tree.ProvenanceTree) { p.Parents = append(p.Parents, c) },
+	truncate: func(n *tree.ProvenanceTree) { n.Truncated = true },
+	fail:     func(id uint64, err error) tree.ProvenanceTree { return tree.ProvenanceTree{ID: id, Error: err.Error()} },
+}
 
-	if _, seen := visited[rootID]; seen {
-		return tree.ProvenanceTreeMeta{
-			ID:           rootID,
+// provenanceMetaShape 构建溯源树（含元数据）。
+var provenanceMetaShape = treeShape[tree.ProvenanceTreeMeta]{
+	kind:  cursorProvenance,
+	edges: parentsInView,
+	node: func(v *readView, id uint64, ref bool) tree.ProvenanceTreeMeta {
+		ev, _ := v.event(id)
+		node := tree.ProvenanceTreeMeta{
+			ID:           id,
 			TimeUnixNano: ev.TimeUnixNano,
 			Type:         ev.Type,
 			Message:      ev.Message,
-			Payload:      ev.Payload,
-			IsRef:        true,
+			Payload:      expandPayload(ev.Payload),
+			IsRef:        ref,
 		}
-	}
-	visited[rootID] = struct{}{}
-
-	node := tree.ProvenanceTreeMeta{
-		ID:           rootID,
-		TimeUnixNano: ev.TimeUnixNano,
-		Type:         ev.Type,
-		Message:      ev.Message,
-		Payload:      ev.Payload,
-		IsRef:        false,
-		Parents:      []tree.ProvenanceTreeMeta{},
-	}
-
-	for _, pid := range ev.Parents {
-		if !s.isEventIDValid(pid) {
-			continue
+		if !ref {
+			node.Parents = []tree.ProvenanceTreeMeta{}
 		}
-		node.Parents = append(node.Parents, s.provenanceTreeMetaLocked(pid, visited))
-	}
-	return node
+		return node
+	},
+	attach:   func(p *tree.ProvenanceTreeMeta, c tree.ProvenanceTreeMeta) { p.Parents = append(p.Parents, c) },
+	truncate: func(n *tree.ProvenanceTreeMeta) { n.Truncated = true },
+	fail: func(id uint64, err error) tree.ProvenanceTreeMeta {
+		return tree.ProvenanceTreeMeta{ID: id, Error: err.Error()}
+	},
 }
 
 // ProvenanceTree 返回以 rootID 为起点的溯源树（仅包含 ID 和结构）。
 func (s *Store) ProvenanceTree(rootID uint64) (tree.ProvenanceTree, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	v := s.openView()
+	defer v.close()
 
 	err := s.validateRootIDLocked(rootID)
 	if err != nil {
 		return tree.ProvenanceTree{}, err
 	}
 
-	visited := make(map[uint64]struct{})
-	return s.provenanceTreeLocked(rootID, visited), nil
+	return walkTree(v, provenanceShape, rootID), nil
 }
 
 // ProvenanceTreeMeta 返回以 rootID 为起点的溯源树（含事件元数据）。
 func (s *Store) ProvenanceTreeMeta(rootID uint64) (tree.ProvenanceTreeMeta, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	v := s.openView()
+	defer v.close()
 
 	err := s.validateRootIDLocked(rootID)
 	if err != nil {
 		return tree.ProvenanceTreeMeta{}, err
 	}
 
-	visited := make(map[uint64]struct{})
-	return s.provenanceTreeMetaLocked(rootID, visited), nil
+	return walkTree(v, provenanceMetaShape, rootID), nil
 }
 
-// ProvenanceForest 批量返回多个起点的溯源树（仅 ID）。
-func (s *Store) ProvenanceForest(rootIDs []uint64) ([]tree.ProvenanceTree, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	err := s.validateRootIDsLocked(rootIDs)
-	if err != nil {
-		return nil, err
-	}
-
-	out := make([]tree.ProvenanceTree, 0, len(rootIDs))
-	for _, id := range rootIDs {
-		visited := make(map[uint64]struct{})
-		out = append(out, s.provenanceTreeLocked(id, visited))
-	}
-	return out, nil
+// ProvenanceForest 批量返回多个起点的溯源树（仅 ID），各树并行构建；根 ID 无效的树只在对应位置带上 Error。
+func (s *Store) ProvenanceForest(rootIDs []uint64) []tree.ProvenanceTree {
+	return buildForest(s, provenanceShape, rootIDs)
 }
 
-// ProvenanceForestMeta 批量返回多个起点的溯源树（含元数据）。
-func (s *Store) ProvenanceForestMeta(rootIDs []uint64) ([]tree.ProvenanceTreeMeta, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// ProvenanceForestMeta 批量返回多个起点的溯源树（含元数据），各树并行构建；根 ID 无效的树只在对应位置带上 Error。
+func (s *Store) ProvenanceForestMeta(rootIDs []uint64) []tree.ProvenanceTreeMeta {
+	return buildForest(s, provenanceMetaShape, rootIDs)
+}
 
-	err := s.validateRootIDsLocked(rootIDs)
+// ProvenancePage 按 opts 的深度与节点数限制返回溯源树（仅 ID）的一页。
+func (s *Store) ProvenancePage(rootID uint64, opts tree.TraverseOptions) (tree.ProvenancePage, error) {
+	trees, truncated, cursor, err := treePage(s, provenanceShape, rootID, opts)
 	if err != nil {
-		return nil, err
+		return tree.ProvenancePage{}, err
 	}
+	return tree.ProvenancePage{Trees: trees, Truncated: truncated, Cursor: cursor}, nil
+}
 
-	out := make([]tree.ProvenanceTreeMeta, 0, len(rootIDs))
-	for _, id := range rootIDs {
-		visited := make(map[uint64]struct{})
-		out = append(out, s.provenanceTreeMetaLocked(id, visited))
+// ProvenancePageMeta 按 opts 的深度与节点数限制返回溯源树（含元数据）的一页。
+func (s *Store) ProvenancePageMeta(rootID uint64, opts tree.TraverseOptions) (tree.ProvenanceMetaPage, error) {
+	trees, truncated, cursor, err := treePage(s, provenanceMetaShape, rootID, opts)
+	if err != nil {
+		return tree.ProvenanceMetaPage{}, err
 	}
-	return out, nil
+	return tree.ProvenanceMetaPage{Trees: trees, Truncated: truncated, Cursor: cursor}, nil
 }
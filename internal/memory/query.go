@@ -0,0 +1,255 @@
+package memory
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+const (
+	queryDefaultLimit = 100  // EventQuery.Limit 为 0 时每页返回的事件数
+	queryMaxLimit     = 1000 // 每页最多返回的事件数
+)
+
+// QueryEvents 按 ID 升序返回一页满足 q 的在线事件：类型条件由类型索引取出匹配类型的 ID 列表，全文查询由全文索引取出
+// 每个词的 ID 列表，时间条件由时间索引限定 ID 范围并跳过不相交的块，同时给出时取交集。条件无效时返回 *tree.QueryError，
+// 全文索引关闭时全文查询返回 storage.ErrNotSupported；没有匹配的事件时返回空页。
+func (s *Store) QueryEvents(q tree.EventQuery) (tree.EventPage, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = queryDefaultLimit
+	}
+	return s.queryPage(q, atomic.LoadUint64(&s.nextID), min(limit, queryMaxLimit))
+}
+
+// StreamEvents 按 ID 升序对满足 q 的每个在线事件调用 fn，不限数量（忽略 q.Limit），第一次调用之前校验条件。
+// 以开始时已分配的最大 ID 为水位线，之后写入的事件不会出现；每批在锁内读取、锁外回调，流式输出期间写入不会被长时间阻塞。
+// fn 返回错误时停止并返回该错误。
+func (s *Store) StreamEvents(q tree.EventQuery, fn func(tree.Event) error) error {
+	upTo := atomic.LoadUint64(&s.nextID)
+	for {
+		page, err := s.queryPage(q, upTo, exportBatch)
+		if err != nil {
+			return err
+		}
+		for _, ev := range page.Events {
+			if err := fn(ev); err != nil {
+				return err
+			}
+		}
+		if page.NextAfterID == 0 {
+			return nil
+		}
+		q.AfterID = page.NextAfterID
+	}
+}
+
+// queryPage 在一次读锁内取出 ID 不超过 upTo 的一页结果，最多 limit 个事件。
+// 取满后再向后找一个满足条件的事件：找到时 NextAfterID 为本页最后一个事件的 ID，否则为 0。
+func (s *Store) queryPage(q tree.EventQuery, upTo uint64, limit int) (tree.EventPage, error) {
+	page := tree.EventPage{Events: []tree.Event{}}
+
+	// 全文查询的解析与分词不依赖存储状态，在锁外完成
+	var tq *textQuery
+	if text := strings.TrimSpace(q.Text); text != "" {
+		var err error
+		if tq, err = parseTextQuery(text); err != nil {
+			return tree.EventPage{}, err
+		}
+	}
+
+	s.mu.RLock()
+	sc, err := s.newScanLocked(q, tq, upTo)
+	if err != nil {
+		s.mu.RUnlock()
+		return tree.EventPage{}, err
+	}
+	for {
+		ev, ok := sc.next()
+		if !ok {
+			break
+		}
+		if len(page.Events) == limit {
+			page.NextAfterID = page.Events[limit-1].ID
+			break
+		}
+		page.Events = append(page.Events, ev)
+	}
+	s.mu.RUnlock()
+
+	for i := range page.Events {
+		page.Events[i].Payload = expandPayload(page.Events[i].Payload)
+	}
+	return page, nil
+}
+
+// eventScan 按 ID 升序产出满足查询条件的在线事件，只在创建它的那次持锁期间有效。
+type eventScan struct {
+	s        *Store
+	indexed  bool         // 有类型或全文条件：候选 ID 来自 lists，否则逐个 ID 扫描
+	lists    mergeIDs     // 候选 ID 为这些列表之并，已定位到起始 ID 之后
+	last     uint64       // 上一个候选 ID：前缀展开的多个词的列表之间可能重复
+	filters  [][][]uint64 // 其余条件：候选 ID 必须出现在每一组的某个列表中
+	prefixes []string     // 不作为候选来源的前缀条件：消息中必须有以之开头的词
+	phrases  [][]string   // 消息必须包含的短语
+	id, hi   uint64       // 下一个候选 ID 与 ID 上限（含）
+	timed    bool
+	from, to int64 // 时间范围 [from, to)
+}
+
+// scanClause 是一个查询条件：满足条件的事件出现在 lists 的某个列表中。prefix 非空表示全文前缀条件，
+// 它不作为候选来源时改为检查候选事件的 Message，不在可能多达上万个词的列表中逐个二分查找。
+type scanClause struct {
+	lists  [][]uint64
+	prefix string
+}
+
+// newScanLocked 校验 q 并创建扫描器（需持有 s.mu 的读锁），tq 是已解析的 q.Text，没有全文查询时为 nil。
+// 类型、时间范围与全文查询至少给出一个。类型条件与全文查询的每个词、每个前缀各是一个条件，以 ID 总数最少的条件为候选来源，
+// 其余的词与类型条件逐个二分查找，前缀条件在读出事件后按 Message 检查。
+func (s *Store) newScanLocked(q tree.EventQuery, tq *textQuery, upTo uint64) (*eventScan, error) {
+	pattern := strings.TrimSpace(q.Type)
+	sc := &eventScan{s: s, id: q.AfterID + 1, hi: upTo, from: math.MinInt64, to: math.MaxInt64}
+	if q.From != 0 {
+		sc.from, sc.timed = q.From, true
+	}
+	if q.To != 0 {
+		sc.to, sc.timed = q.To, true
+	}
+	switch {
+	case pattern == "" && tq == nil && !sc.timed:
+		return nil, &tree.QueryError{Reason: "type, time range or search text is required"}
+	case sc.from >= sc.to:
+		return nil, &tree.QueryError{Reason: "from must be before to"}
+	}
+	if q.AfterID >= upTo {
+		sc.hi = 0
+	}
+
+	if sc.timed {
+		lo, hi, ok := s.byTime.idRange(sc.from, sc.to)
+		if !ok {
+			sc.hi = 0
+		}
+		sc.id, sc.hi = max(sc.id, lo), min(sc.hi, hi)
+	}
+	var clauses []scanClause
+	if pattern != "" {
+		types, err := matchTypes(s.types, pattern)
+		if err != nil {
+			return nil, err
+		}
+		lists := make([][]uint64, 0, len(types))
+		for _, t := range types {
+			if int(t) < len(s.byType.ids) {
+				lists = append(lists, s.byType.ids[t])
+			}
+		}
+		clauses = append(clauses, scanClause{lists: lists})
+	}
+	if tq != nil {
+		if s.text == nil {
+			return nil, fmt.Errorf("full-text index is disabled: %w", storage.ErrNotSupported)
+		}
+		clauses = append(clauses, s.textClausesLocked(tq)...)
+		sc.phrases = tq.phrases
+	}
+	if len(clauses) > 0 {
+		best := 0
+		counts := make([]int, len(clauses))
+		for i, c := range clauses {
+			if counts[i] = idCount(c.lists); counts[i] < counts[best] {
+				best = i
+			}
+		}
+		sc.indexed = true
+		lists := make([][]uint64, 0, len(clauses[best].lists))
+		for _, l := range clauses[best].lists {
+			lists = append(lists, after(l, sc.id-1))
+		}
+		sc.lists = newMergeIDs(lists)
+		for i, c := range clauses {
+			switch {
+			case i == best:
+			case c.prefix != "":
+				sc.prefixes = append(sc.prefixes, c.prefix)
+			default:
+				sc.filters = append(sc.filters, c.lists)
+			}
+		}
+	}
+	return sc, nil
+}
+
+// idCount 返回一组列表的 ID 总数。
+func idCount(lists [][]uint64) int {
+	n := 0
+	for _, l := range lists {
+		n += len(l)
+	}
+	return n
+}
+
+// next 返回下一个满足条件的在线事件（payload 为存储形式）。
+func (sc *eventScan) next() (tree.Event, bool) {
+	s := sc.s
+	for {
+		var id uint64
+		if sc.indexed {
+			var ok bool
+			if id, ok = sc.lists.next(); !ok || id > sc.hi {
+				return tree.Event{}, false
+			}
+			if id == sc.last {
+				continue
+			}
+			if sc.last = id; !sc.matchFilters(id) {
+				continue
+			}
+		} else {
+			if sc.id > sc.hi {
+				return tree.Event{}, false
+			}
+			id = sc.id
+			sc.id++
+		}
+
+		if sc.timed && !s.byTime.overlaps(int(id/timeBlockIDs), sc.from, sc.to) {
+			if !sc.indexed {
+				// 整块跳过
+				sc.id = (id/timeBlockIDs + 1) * timeBlockIDs
+			}
+			continue
+		}
+		// 索引中已归档但尚未压缩掉的 ID、逐个扫描时的空槽位，都在这里跳过
+		if !s.isEventIDValid(id) {
+			continue
+		}
+		ev, ok := s.eventLocked(id)
+		if !ok || ev.TimeUnixNano < sc.from || ev.TimeUnixNano >= sc.to || !matchText(ev.Message, sc.prefixes, sc.phrases) {
+			continue
+		}
+		return ev, true
+	}
+}
+
+// matchFilters 判断 id 是否出现在每一组列表的某个列表中。
+func (sc *eventScan) matchFilters(id uint64) bool {
+	for _, lists := range sc.filters {
+		found := false
+		for _, l := range lists {
+			if _, found = slices.BinarySearch(l, id); found {
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,100 @@
+package memory
+
+import (
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// queryIDs 翻页取出满足 q 的全部事件 ID，并检查每页不超过 q.Limit、还有下一页时本页是满的。
+func queryIDs(t *testing.T, s *Store, q tree.EventQuery) []uint64 {
+	t.Helper()
+	limit := q.Limit
+	if limit <= 0 {
+		limit = queryDefaultLimit
+	}
+	limit = min(limit, queryMaxLimit)
+	var ids []uint64
+	for {
+		page, err := s.QueryEvents(q)
+		if err != nil {
+			t.Fatalf("QueryEvents(%+v): %v", q, err)
+		}
+		if n := len(page.Events); n > limit || page.NextAfterID != 0 && n < limit {
+			t.Fatalf("QueryEvents(%+v): page of %d events with next %d, limit %d", q, n, page.NextAfterID, limit)
+		}
+		for _, ev := range page.Events {
+			ids = append(ids, ev.ID)
+		}
+		if page.NextAfterID == 0 {
+			return ids
+		}
+		q.AfterID = page.NextAfterID
+	}
+}
+
+// TestSearchWidePrefix 检查展开成大量词的前缀：作为候选来源时合并全部词的列表，作为过滤条件时按 Message 检查，都不限词数。
+func TestSearchWidePrefix(t *testing.T) {
+	const words = 3 * 256
+	s := NewStore()
+	var conn, refused, task []uint64
+	for i := range words {
+		msg := fmt.Sprintf("conn%04d", i)
+		typ := "net"
+		if i%3 == 0 {
+			msg += " refused"
+		}
+		if i%5 == 0 {
+			typ = "task"
+		}
+		id := emitMessage(t, s, typ, msg)
+		conn = append(conn, id)
+		if i%3 == 0 {
+			refused = append(refused, id)
+		}
+		if typ == "task" {
+			task = append(task, id)
+		}
+	}
+	// 不匹配前缀的噪声：同样含有 refused 与 task 类型
+	for range 50 {
+		emitMessage(t, s, "task", "timeout refused")
+	}
+	both := func(a, b []uint64) []uint64 {
+		return slices.DeleteFunc(slices.Clone(a), func(id uint64) bool { return !slices.Contains(b, id) })
+	}
+
+	tests := []struct {
+		name string
+		q    tree.EventQuery
+		want []uint64
+	}{
+		{"prefix only", tree.EventQuery{Text: "conn*"}, conn},
+		{"prefix filters a smaller term", tree.EventQuery{Text: "conn* refused"}, refused},
+		{"prefix filters a type", tree.EventQuery{Type: "task", Text: "conn*"}, task},
+		{"prefix, term and type", tree.EventQuery{Type: "task", Text: "refused conn*"}, both(refused, task)},
+		{"narrower prefix", tree.EventQuery{Text: "conn05*"}, conn[500:600]},
+		{"two prefixes", tree.EventQuery{Text: "conn* ref*"}, refused},
+		{"no match", tree.EventQuery{Text: "conn* timeout"}, nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := queryIDs(t, s, tc.q)
+			if !slices.Equal(got, tc.want) {
+				t.Fatalf("got %d ids %v, want %d ids %v", len(got), got, len(tc.want), tc.want)
+			}
+		})
+	}
+}
+
+// emitMessage 写入一个带 Message 的根事件并返回其 ID。
+func emitMessage(t *testing.T, s *Store, typ, msg string) uint64 {
+	t.Helper()
+	ev, err := s.Emit(tree.EmitRequest{Type: typ, Message: msg})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ev.ID
+}
@@ -0,0 +1,262 @@
+package memory
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"unsafe"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// reachIndex 是增量维护的可达性索引（链标签）。
+//
+// 每个事件被放在一条链上：链上相邻的两个事件是父子关系，因此链上位置靠前的事件一定是靠后事件的祖先。
+// 新事件优先接在某个仍是链尾的父事件之后，否则开一条新链。除自身的链与位置外，每个事件还记录 anc：
+// 它的严格祖先在其他每条链上的最大位置。于是 u 是 v 的祖先，当且仅当 u、v 同链且 u 的位置更小，
+// 或 v.anc 中 u 所在链的位置不小于 u 的位置——一次二分查找即可回答。
+//
+// 事件写入后不可变、新事件总是汇点，所以已有事件的标签永远不需要修改。
+//
+// anc 的长度取决于 DAG 的宽度，极宽的 DAG 上可达 事件数 × 宽度。合并结果超过 reachAncMax 条的事件
+// 改为“宽标签”：anc 只保存父事件 ID 并以 reachWide 结尾，查询经 searchWide 沿父事件回溯，
+// 直到遇到普通标签为止。于是 anc 的总量不超过 事件数 × reachAncMax 加上边数，代价是宽事件之下的查询变慢。
+type reachIndex struct {
+	labels []reachLabel // 下标为事件 ID；chain 为 0 表示没有标签
+	tails  []uint64     // 下标为链号，值为链尾事件 ID；链号从 1 开始
+	ancLen int          // 新分配的 anc 条目总数（共享的 anc 只计一次）
+	wide   int          // 新分配的宽标签数
+}
+
+const (
+	reachAncMax = 128        // 单个标签 anc 的最大条目数，超过时改为宽标签
+	reachWide   = ^uint64(0) // 宽标签 anc 的结尾标记，排在任何 chain<<32|pos 之后
+)
+
+// reachLabel 是单个事件的链标签。
+type reachLabel struct {
+	chain uint32
+	pos   uint32
+	// anc 按链号升序保存 chain<<32|pos，不含自身所在的链；
+	// 接在父事件之后的事件直接共享父事件的 anc，因此不可原地修改。
+	// 宽标签的 anc 是父事件 ID 加上结尾的 reachWide（见 isWide）。
+	anc []uint64
+}
+
+// isWide 报告 anc 是否属于宽标签。
+func isWide(anc []uint64) bool {
+	return len(anc) > 0 && anc[len(anc)-1] == reachWide
+}
+
+func packReach(chain, pos uint32) uint64 { return uint64(chain)<<32 | uint64(pos) }
+
+func reachChain(e uint64) uint32 { return uint32(e >> 32) }
+
+// has 报告 id 是否已有标签。
+func (x *reachIndex) has(id uint64) bool {
+	return id < uint64(len(x.labels)) && x.labels[id].chain != 0
+}
+
+// add 为新事件计算标签；父事件必须都已有标签（父事件的 ID 总小于自身，按 ID 顺序加入即可保证）。
+func (x *reachIndex) add(id uint64, parents []uint64) {
+	if x.tails == nil {
+		x.tails = []uint64{0}
+	}
+	for uint64(len(x.labels)) <= id {
+		x.labels = append(x.labels, reachLabel{})
+	}
+
+	var lab reachLabel
+	// 接在第一个仍是链尾的父事件之后
+	for _, p := range parents {
+		if pl := x.labels[p]; x.tails[pl.chain] == p {
+			lab.chain, lab.pos = pl.chain, pl.pos+1
+			break
+		}
+	}
+	if lab.chain == 0 {
+		lab.chain = uint32(len(x.tails))
+		x.tails = append(x.tails, id)
+	} else {
+		x.tails[lab.chain] = id
+	}
+
+	switch {
+	case len(parents) == 0:
+	case len(parents) == 1 && x.labels[parents[0]].chain == lab.chain:
+		// 唯一的父事件在同一条链上：其他链上的祖先与父事件完全相同
+		lab.anc = x.labels[parents[0]].anc
+	default:
+		lab.anc = x.mergeParents(parents, lab.chain)
+		if lab.anc == nil {
+			// 有宽的父事件或合并结果过长：只记录父事件，查询时回溯
+			lab.anc = append(slices.Clone(parents), reachWide)
+			x.wide++
+		}
+		x.ancLen += len(lab.anc)
+	}
+	x.labels[id] = lab
+}
+
+// mergeParents 合并各父事件的 anc 与父事件自身的位置，每条链取最大位置，并去掉 own 链。
+// 某个父事件是宽标签，或合并结果超过 reachAncMax 条时返回 nil。
+func (x *reachIndex) mergeParents(parents []uint64, own uint32) []uint64 {
+	n := 0
+	for _, p := range parents {
+		if isWide(x.labels[p].anc) {
+			return nil
+		}
+		n += len(x.labels[p].anc) + 1
+	}
+	buf := make([]uint64, 0, n)
+	for _, p := range parents {
+		pl := x.labels[p]
+		buf = append(buf, pl.anc...)
+		buf = append(buf, packReach(pl.chain, pl.pos))
+	}
+	// 排序后同一条链的条目相邻，位置最大的在最后
+	slices.Sort(buf)
+	out := buf[:0]
+	for i, e := range buf {
+		c := reachChain(e)
+		if c == own || (i+1 < len(buf) && reachChain(buf[i+1]) == c) {
+			continue
+		}
+		out = append(out, e)
+	}
+	if len(out) > reachAncMax {
+		return nil
+	}
+	return slices.Clip(out)
+}
+
+// memBytes 估算索引占用的内存：每个 ID 一个标签，加上链尾与 anc 条目。
+func (x *reachIndex) memBytes() int64 {
+	return int64(len(x.labels))*int64(unsafe.Sizeof(reachLabel{})) + int64(len(x.tails)+x.ancLen)*8
+}
+
+// reaches 报告 from 是否是 to 的严格祖先；两者都必须已有标签。
+func (x *reachIndex) reaches(from, to uint64) bool {
+	if from >= to {
+		return false
+	}
+	lf, lt := x.labels[from], x.labels[to]
+	if lf.chain == lt.chain {
+		return lf.pos < lt.pos
+	}
+	if isWide(lt.anc) {
+		return x.searchWide(from, lt.anc)
+	}
+	return ancReaches(lt.anc, lf)
+}
+
+// ancReaches 报告普通标签的 anc 是否包含 from 所在链上不早于 from 的位置。
+func ancReaches(anc []uint64, lf reachLabel) bool {
+	i, ok := slices.BinarySearchFunc(anc, lf.chain, func(e uint64, c uint32) int {
+		return cmp.Compare(reachChain(e), c)
+	})
+	return ok && uint32(anc[i]) >= lf.pos
+}
+
+// searchWide 报告 from 是否是宽标签 anc 中某个父事件或其祖先；from 不在该标签所在的链上。
+// 沿宽标签的父事件回溯，遇到普通标签时用二分查找作答；ID 小于 from 的事件不可能是 from 的后代，直接剪枝。
+func (x *reachIndex) searchWide(from uint64, anc []uint64) bool {
+	lf := x.labels[from]
+	seen := make(map[uint64]struct{})
+	stack := [][]uint64{anc[:len(anc)-1]}
+	for len(stack) > 0 {
+		ps := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, p := range ps {
+			if p == from {
+				return true
+			}
+			if p < from {
+				continue
+			}
+			lp := x.labels[p]
+			switch {
+			case lp.chain == lf.chain:
+				return true // 同链且 ID 更大，位置必然在 from 之后
+			case !isWide(lp.anc):
+				if ancReaches(lp.anc, lf) {
+					return true
+				}
+			default:
+				if _, ok := seen[p]; !ok {
+					seen[p] = struct{}{}
+					stack = append(stack, lp.anc[:len(lp.anc)-1])
+				}
+			}
+		}
+	}
+	return false
+}
+
+// rebuildReachLocked 按 ID 顺序为所有在线事件重建可达性索引（需持有 s.mu）。
+// 快照不保存索引，加载快照后由 children 反推每个事件的父事件，无需读取冷数据段。
+func (s *Store) rebuildReachLocked() {
+	n := s.nextID + 1
+	// 以 CSR 形式保存父事件：parents[start[c]:start[c+1]] 是 c 的父事件，按 ID 升序
+	start := make([]uint32, n+1)
+	for _, cs := range s.children {
+		for _, c := range cs {
+			start[c+1]++
+		}
+	}
+	for i := uint64(1); i <= n; i++ {
+		start[i] += start[i-1]
+	}
+	parents := make([]uint64, start[n])
+	fill := slices.Clone(start[:n])
+	for p := uint64(1); p < n; p++ {
+		for _, c := range s.children[p] {
+			parents[fill[c]] = p
+			fill[c]++
+		}
+	}
+
+	s.reach = reachIndex{labels: make([]reachLabel, 0, n)}
+	for id := uint64(1); id < n; id++ {
+		if s.isEventIDValid(id) {
+			s.reach.add(id, parents[start[id]:start[id+1]])
+		}
+	}
+}
+
+// Reachable 报告 from 是否是 to 的祖先（存在从 from 到 to 的有向路径；事件不是自身的祖先）。
+// 任一事件不存在时返回包装 storage.ErrNotFound 的错误。
+func (s *Store) Reachable(from, to uint64) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.validateReachLocked(from, to); err != nil {
+		return false, err
+	}
+	return s.reach.reaches(from, to), nil
+}
+
+// ReachableBatch 对每一对事件回答 Reachable；任一事件不存在时整批返回错误。
+func (s *Store) ReachableBatch(pairs []tree.ReachPair) ([]bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	out := make([]bool, len(pairs))
+	for i, p := range pairs {
+		if err := s.validateReachLocked(p.From, p.To); err != nil {
+			return nil, fmt.Errorf("pair %d: %w", i, err)
+		}
+		out[i] = s.reach.reaches(p.From, p.To)
+	}
+	return out, nil
+}
+
+func (s *Store) validateReachLocked(from, to uint64) error {
+	for _, id := range [2]uint64{from, to} {
+		if !s.isEventIDValid(id) {
+			return fmt.Errorf("event %d: %w", id, storage.ErrNotFound)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"errors"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// bruteAncestors 由各事件的父事件按 ID 顺序计算严格祖先集合。
+func bruteAncestors(parents map[uint64][]uint64, ids []uint64) map[uint64]map[uint64]bool {
+	anc := make(map[uint64]map[uint64]bool, len(ids))
+	for _, id := range ids {
+		set := map[uint64]bool{}
+		for _, p := range parents[id] {
+			set[p] = true
+			for a := range anc[p] {
+				set[a] = true
+			}
+		}
+		anc[id] = set
+	}
+	return anc
+}
+
+// TestReachable 在不同形状的 DAG 上对所有事件对比较 Reachable 与暴力计算的祖先集合，包括合并后超过 reachAncMax
+// 而改为回溯的宽标签；重新打开后（WAL 回放逐个加入标签、加载快照时整体重建）结果不变。
+func TestReachable(t *testing.T) {
+	// 每个 shape 写入一个 DAG，返回事件的父事件
+	type shape func(t *testing.T, s *Store, rng *rand.Rand) map[uint64][]uint64
+	random := func(n, roots, maxParents int) shape {
+		return func(t *testing.T, s *Store, rng *rand.Rand) map[uint64][]uint64 {
+			parents := map[uint64][]uint64{}
+			var ids []uint64
+			for i := range n {
+				var ps []uint64
+				if i >= roots {
+					for range 1 + rng.IntN(maxParents) {
+						ps = append(ps, ids[rng.IntN(len(ids))])
+					}
+				}
+				id := mustEmit(t, s, "node", "", ps...)
+				ev, _ := s.Get(id)
+				parents[id] = ev.Parents
+				ids = append(ids, id)
+			}
+			return parents
+		}
+	}
+	// wide 先写入 width 个根与一个以它们全部为父事件的汇合事件，再在其上随机生长
+	wide := func(width, n int) shape {
+		return func(t *testing.T, s *Store, rng *rand.Rand) map[uint64][]uint64 {
+			parents := map[uint64][]uint64{}
+			var ids []uint64
+			for range width {
+				id := mustEmit(t, s, "root", "")
+				parents[id] = nil
+				ids = append(ids, id)
+			}
+			join := mustEmit(t, s, "join", "", ids...)
+			parents[join] = ids
+			ids = append(ids, join)
+			for range n {
+				// 一半接在汇合事件之下，一半接在任意事件之下
+				ps := []uint64{ids[rng.IntN(len(ids))]}
+				if rng.IntN(2) == 0 {
+					ps = append(ps, join+uint64(rng.IntN(len(ids)-width)))
+				}
+				if rng.IntN(3) == 0 {
+					ps = append(ps, ids[rng.IntN(width)])
+				}
+				id := mustEmit(t, s, "node", "", ps...)
+				ev, _ := s.Get(id)
+				parents[id] = ev.Parents
+				ids = append(ids, id)
+			}
+			return parents
+		}
+	}
+
+	cases := []struct {
+		name  string
+		build shape
+		wide  bool
+	}{
+		{name: "chain", build: random(300, 1, 1)},
+		{name: "sparse forest", build: random(500, 20, 2)},
+		{name: "dense dag", build: random(500, 3, 4)},
+		{name: "wide labels", build: wide(reachAncMax+50, 400), wide: true},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{DataDir: t.TempDir(), Sync: SyncNever}
+			s := mustOpen(t, opts)
+			rng := rand.New(rand.NewPCG(1, 2))
+			parents := tc.build(t, s, rng)
+			ids := make([]uint64, 0, len(parents))
+			for id := uint64(1); id <= uint64(len(parents)); id++ {
+				ids = append(ids, id)
+			}
+			anc := bruteAncestors(parents, ids)
+			if wide := s.Snapshot().ReachWideLabels; (wide > 0) != tc.wide {
+				t.Fatalf("%d wide labels, want wide labels %v", wide, tc.wide)
+			}
+
+			check := func(stage string) {
+				t.Helper()
+				var pairs []tree.ReachPair
+				var want []bool
+				for _, to := range ids {
+					for _, from := range ids {
+						got, err := s.Reachable(from, to)
+						if err != nil {
+							t.Fatal(err)
+						}
+						if got != anc[to][from] {
+							t.Fatalf("%s: Reachable(%d, %d) = %v, want %v", stage, from, to, got, anc[to][from])
+						}
+						if rng.IntN(50) == 0 {
+							pairs = append(pairs, tree.ReachPair{From: from, To: to})
+							want = append(want, got)
+						}
+					}
+				}
+				got, err := s.ReachableBatch(pairs)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for i := range got {
+					if got[i] != want[i] {
+						t.Fatalf("%s: batch pair %d %+v = %v, want %v", stage, i, pairs[i], got[i], want[i])
+					}
+				}
+			}
+			check("after emit")
+
+			s.Close()
+			s = mustOpen(t, opts)
+			check("after wal replay")
+			if _, err := s.Checkpoint(); err != nil {
+				t.Fatal(err)
+			}
+			s.Close()
+			s = mustOpen(t, opts)
+			check("after loading a checkpoint")
+			if rep, err := s.Verify(); err != nil || !rep.OK {
+				t.Fatalf("verify: %+v, %v", rep, err)
+			}
+		})
+	}
+}
+
+// TestReachableErrors 检查不存在的事件返回 storage.ErrNotFound，批量查询中任一对出错时整批失败。
+func TestReachableErrors(t *testing.T) {
+	s := NewStore()
+	a := mustEmit(t, s, "root", "")
+	b := mustEmit(t, s, "child", "", a)
+	if ok, err := s.Reachable(a, a); ok || err != nil {
+		t.Fatalf("Reachable(a, a) = %v, %v, want false", ok, err)
+	}
+	if ok, err := s.Reachable(b, a); ok || err != nil {
+		t.Fatalf("Reachable(child, root) = %v, %v, want false", ok, err)
+	}
+	if _, err := s.Reachable(a, 99); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("missing event: %v, want storage.ErrNotFound", err)
+	}
+	if _, err := s.ReachableBatch([]tree.ReachPair{{From: a, To: b}, {From: 99, To: b}}); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("batch with a missing event: %v, want storage.ErrNotFound", err)
+	}
+}
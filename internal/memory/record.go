@@ -0,0 +1,80 @@
+package memory
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+)
+
+// 所有持久化文件（WAL、快照）共用同一种记录分帧：
+// uint32(len) | uint32(crc32c) | kind(1B) | body，其中 len 与 crc 覆盖 kind+body，整数均为小端序。
+const (
+	recordHeaderSize = 8
+	recordMaxSize    = 64 << 20
+	maxRecordBody    = recordMaxSize - 1 // 单条记录 body 的上限（len 还覆盖 1 字节 kind）
+)
+
+var (
+	crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+	// errTornRecord 表示存在不完整或校验失败的记录（通常是写入过程中进程崩溃）。
+	errTornRecord = errors.New("torn record")
+
+	// errRecordTooLarge 表示记录超过 recordMaxSize。写入时拒绝此类记录，因此读到头部完整、长度超限的记录说明文件已损坏，
+	// 不能当作残缺尾部截断。
+	errRecordTooLarge = errors.New("record too large")
+)
+
+// appendRecord 将一条记录分帧后追加到 buf 末尾。
+func appendRecord(buf []byte, kind byte, body []byte) []byte {
+	start := len(buf)
+	buf = binary.LittleEndian.AppendUint32(buf, uint32(len(body)+1))
+	buf = binary.LittleEndian.AppendUint32(buf, 0)
+	buf = append(buf, kind)
+	buf = append(buf, body...)
+	binary.LittleEndian.PutUint32(buf[start+4:start+8], crc32.Checksum(buf[start+recordHeaderSize:], crcTable))
+	return buf
+}
+
+// readRecords 顺序读取 r 中的所有记录并回调 fn，回调中的 body 仅在本次回调内有效。
+// 返回最后一条完整记录的结束偏移（相对 r 的起点）；遇到不完整或校验失败的记录时返回 errTornRecord，
+// 头部完整但长度超过 recordMaxSize 时返回 errRecordTooLarge。
+func readRecords(r io.Reader, fn func(kind byte, body []byte) error) (int64, error) {
+	var (
+		good   int64
+		header [recordHeaderSize]byte
+		buf    []byte
+	)
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF {
+				return good, nil
+			}
+			return good, errTornRecord
+		}
+		n := binary.LittleEndian.Uint32(header[0:4])
+		sum := binary.LittleEndian.Uint32(header[4:8])
+		if n == 0 {
+			return good, errTornRecord
+		}
+		if n > recordMaxSize {
+			return good, fmt.Errorf("%w: %d bytes at offset %d", errRecordTooLarge, n, good)
+		}
+		if cap(buf) < int(n) {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return good, errTornRecord
+		}
+		if crc32.Checksum(buf, crcTable) != sum {
+			return good, errTornRecord
+		}
+		if err := fn(buf[0], buf[1:]); err != nil {
+			return good, err
+		}
+		good += recordHeaderSize + int64(n)
+	}
+}
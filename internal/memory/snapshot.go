@@ -8,28 +8,88 @@ import (
 )
 
 // Snapshot 返回当前系统状态的只读快照，包含节点/边/订阅者等统计信息。
+// 计数都是增量维护的，耗时与事件数无关，只有类型分布需要拷贝一份（类型数通常很少）。
 func (s *Store) Snapshot() tree.Snapshot {
-	s.mu.Lock()
+	now := time.Now()
+
+	s.mu.RLock()
 	roots := len(s.roots)
 	heads := len(s.heads)
 	nextEventID := s.nextID
-	edges := 0
-	for _, set := range s.children {
-		edges += len(set)
+	hotEvents := s.hotCount + len(s.revived)
+	payloadRaw, payloadStored, payloadDedup := s.payloadRaw, s.payloadStored, s.payloadDedup
+	payloadUnique, payloadShared := len(s.payloads), s.payloadShared
+	memBytes, rejected, warnings := s.memBytesLocked(), s.rejected, s.limitWarningsLocked()
+	eventBytes, indexBytes := s.eventBytes, s.indexMemBytesLocked()
+	var textTerms, textPostings int
+	var textBytes int64
+	if s.text != nil {
+		textTerms, textPostings, textBytes = len(s.text.lists), s.text.n, s.text.memBytes()
+	}
+	reachBytes, reachWide := s.reach.memBytes(), s.reach.wide
+	edges, maxFanout := s.stats.edges, s.stats.maxFanout
+	totalPayload, typeCounts := s.stats.payloadBytes, s.stats.typeCounts()
+	rate1m, rate5m, rate15m := s.rate.perSecond(now, 60), s.rate.perSecond(now, 5*60), s.rate.perSecond(now, 15*60)
+	s.mu.RUnlock()
+
+	var bytesPerEvent float64
+	if hotEvents > 0 {
+		bytesPerEvent = float64(eventBytes) / float64(hotEvents)
+	}
+
+	var coldEvents, coldSegments int
+	if s.cold != nil {
+		coldEvents, coldSegments = s.cold.stats()
 	}
-	s.mu.Unlock()
 
 	s.subsMu.Lock()
-	subscribers := len(s.subs)
+	subscribers, dropped := len(s.subs), s.dropped
 	s.subsMu.Unlock()
 
 	return tree.Snapshot{
-		TS:          time.Now().Unix(),
+		TS:          now.Unix(),
 		GoRoutines:  runtime.NumGoroutine(),
 		Edges:       edges,
 		Roots:       roots,
 		Heads:       heads,
 		Subscribers: subscribers,
 		NextEventID: nextEventID,
+		SSEDropped:  dropped,
+
+		TotalEvents:       hotEvents + coldEvents,
+		TotalPayloadBytes: totalPayload,
+		TypeCounts:        typeCounts,
+		MaxFanout:         maxFanout,
+		EmitRate1m:        rate1m,
+		EmitRate5m:        rate5m,
+		EmitRate15m:       rate15m,
+
+		HotEvents:    hotEvents,
+		ColdEvents:   coldEvents,
+		ColdSegments: coldSegments,
+
+		PayloadBytes:       payloadRaw,
+		PayloadStoredBytes: payloadStored,
+		PayloadDedupBytes:  payloadDedup,
+		PayloadUnique:      payloadUnique,
+		PayloadSharedRefs:  payloadShared,
+
+		EventLayout:   s.opts.Layout.String(),
+		EventBytes:    eventBytes,
+		BytesPerEvent: bytesPerEvent,
+
+		TextTerms:      textTerms,
+		TextPostings:   textPostings,
+		TextIndexBytes: textBytes,
+
+		ReachIndexBytes: reachBytes,
+		ReachWideLabels: reachWide,
+
+		IndexBytes:     indexBytes,
+		MemoryBytes:    memBytes,
+		MaxEvents:      s.opts.MaxEvents,
+		MaxMemoryBytes: s.opts.MaxMemoryBytes,
+		RejectedEmits:  rejected,
+		Warnings:       warnings,
 	}
 }
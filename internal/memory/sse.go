@@ -37,6 +37,7 @@ func (s *Store) broadcast(ev tree.Event) {
 		case ch <- ev:
 		default:
 			// v0：订阅者太慢就丢弃，保证 Emit 不被卡住
+			s.dropped++
 		}
 	}
 }
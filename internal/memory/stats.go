@@ -0,0 +1,119 @@
+package memory
+
+import (
+	"maps"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// dagStats 是随写入增量维护的在线事件统计（热数据、恢复事件与冷数据，不含已归档的事件），
+// Snapshot 直接读取，不再遍历 children。事件进入在线存储（applyLocked）时累加，归档时扣减（需持有 s.mu）。
+// 在线事件数本身由 hotCount、revived 与冷数据层的计数给出，这里不重复维护。
+type dagStats struct {
+	edges        int
+	payloadBytes int64          // payload 的原始字节数
+	types        map[string]int // 类型 -> 事件数
+	fanout       map[int]int    // 子事件数 -> 拥有这么多子事件的父事件数，用于在删除边时维护 maxFanout
+	maxFanout    int
+}
+
+func newDAGStats() dagStats {
+	return dagStats{types: make(map[string]int), fanout: make(map[int]int)}
+}
+
+// addEvent 计入一个进入在线存储的事件。
+func (st *dagStats) addEvent(ev tree.Event) {
+	raw, _ := payloadSizes(ev.Payload)
+	st.payloadBytes += int64(raw)
+	st.types[ev.Type]++
+}
+
+// removeEvent 扣减一个离开在线存储的事件。
+func (st *dagStats) removeEvent(ev tree.Event) {
+	raw, _ := payloadSizes(ev.Payload)
+	st.payloadBytes -= int64(raw)
+	if st.types[ev.Type]--; st.types[ev.Type] <= 0 {
+		delete(st.types, ev.Type)
+	}
+}
+
+// addEdge 在父事件的子事件数从 n 增加到 n+1 后调用。
+func (st *dagStats) addEdge(n int) {
+	st.edges++
+	st.moveFanout(n, n+1)
+	st.maxFanout = max(st.maxFanout, n+1)
+}
+
+// removeEdges 在父事件的 n 条子事件边被整体删除后调用。
+func (st *dagStats) removeEdges(n int) {
+	if n == 0 {
+		return
+	}
+	st.edges -= n
+	st.moveFanout(n, 0)
+	for st.maxFanout > 0 && st.fanout[st.maxFanout] == 0 {
+		st.maxFanout--
+	}
+}
+
+func (st *dagStats) moveFanout(from, to int) {
+	if from > 0 {
+		if st.fanout[from]--; st.fanout[from] <= 0 {
+			delete(st.fanout, from)
+		}
+	}
+	if to > 0 {
+		st.fanout[to]++
+	}
+}
+
+// countEdges 由 children 重新计算边数与扇出（加载快照后调用）。
+func (st *dagStats) countEdges(children map[uint64][]uint64) {
+	st.edges, st.maxFanout = 0, 0
+	clear(st.fanout)
+	for _, cs := range children {
+		if n := len(cs); n > 0 {
+			st.edges += n
+			st.fanout[n]++
+			st.maxFanout = max(st.maxFanout, n)
+		}
+	}
+}
+
+// typeCounts 返回类型分布的拷贝（需持有 s.mu）。
+func (st *dagStats) typeCounts() map[string]int {
+	return maps.Clone(st.types)
+}
+
+// emitRateWindow 是写入速率统计覆盖的最长时间（秒）。
+const emitRateWindow = 15 * 60
+
+// emitRate 按秒记录最近 emitRateWindow 秒内 Emit / EmitBatch 写入的事件数，环形缓冲，槽位按秒数取模复用。
+type emitRate struct {
+	count [emitRateWindow]uint32
+	sec   [emitRateWindow]int64 // 槽位当前对应的 Unix 秒，不等于查询窗口内的秒时视为 0
+}
+
+// add 计入 now 这一秒写入的 n 个事件（需持有 s.mu 的写锁）。
+func (r *emitRate) add(now time.Time, n int) {
+	sec := now.Unix()
+	i := sec % emitRateWindow
+	if r.sec[i] != sec {
+		r.sec[i], r.count[i] = sec, 0
+	}
+	r.count[i] += uint32(n)
+}
+
+// perSecond 返回截至 now 最近 window 秒（不超过 emitRateWindow）的平均每秒写入数。
+// 进程启动不足 window 秒时同样按整个窗口平均。
+func (r *emitRate) perSecond(now time.Time, window int64) float64 {
+	end := now.Unix()
+	var total uint64
+	for i, sec := range r.sec {
+		if sec > end-window && sec <= end {
+			total += uint64(r.count[i])
+		}
+	}
+	return float64(total) / float64(window)
+}
@@ -2,40 +2,105 @@ package memory
 
 import (
 	"sync"
+	"sync/atomic"
 
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
 	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
 )
 
+var (
+	_ storage.Backend      = (*Store)(nil)
+	_ storage.Checkpointer = (*Store)(nil)
+	_ storage.Archiver     = (*Store)(nil)
+	_ storage.Exporter     = (*Store)(nil)
+	_ storage.Importer     = (*Store)(nil)
+	_ storage.Verifier     = (*Store)(nil)
+	_ storage.TreeStreamer = (*Store)(nil)
+	_ storage.BatchEmitter = (*Store)(nil)
+	_ storage.Reacher      = (*Store)(nil)
+	_ storage.PathFinder   = (*Store)(nil)
+	_ storage.EventQuerier = (*Store)(nil)
+	_ storage.FieldIndexer = (*Store)(nil)
+)
+
 // Store 是 CelestialTree 的内存存储实现：
-// - events:    id -> tree.Event
+// - events:    热数据，槽位为 id - hotBase，存储布局由 Options.Layout 决定（见 layout.go）
+// - cold:      ID 小于 hotBase 的冷事件（磁盘上的不可变数据段）
 // - children:  parent -> set(child)
 // - heads:     当前没有子节点的事件集合（叶子集合）
+// - reach:     可达性索引（链标签），回答“A 是否是 B 的祖先”
 // - subs:      订阅者集合（用于 SSE 广播）
+// - wal:       预写日志（仅由 Open 打开，NewStore 创建的纯内存 Store 为 nil）
 type Store struct {
-	mu sync.Mutex // More write and less read, maybe use RWMutex in future, not now.
+	mu sync.RWMutex // 写入持写锁；读取持读锁，长遍历通过 readView 分批持锁
+
+	// Emit 与 EmitBatch 从分配 ID 到发布全程持有 commitGate 的读锁；切段、归档、恢复、导入提交、Verify 与 Close
+	// 持有写锁，期间没有已暂存、未发布的写入。加锁顺序为 ckptMu → commitGate → s.mu
+	commitGate sync.RWMutex
+
+	nextID        uint64
+	reserved      int   // 已分配 ID、等待 WAL 组提交的事件数，新 ID 从 nextID + reserved + 1 开始
+	reservedBytes int64 // 这些事件的内存估算，计入内存上限检查
 
-	nextID uint64
+	hotBase  uint64 // events[0] 对应的事件 ID
+	hotCount int    // events 中的有效事件数
+	cold     *coldTier
 
-	events   []tree.Event
+	payloads      map[payloadKey]*sharedPayload // payload 去重表：内容相同的内存事件共享一份存储
+	payloadRaw    int64                         // 内存中（热数据与恢复事件）payload 的原始字节数
+	payloadStored int64                         // 内存中 payload 实际占用的字节数（压缩且去重后）
+	payloadDedup  int64                         // 去重节省的字节数
+	payloadShared int                           // 引用去重表的内存事件数
+	eventBytes    int64                         // 内存事件除 payload 外的估算占用，见 hotMemSize / eventMemSize
+	rejected      uint64                        // 因内存上限被拒绝的写入次数
+
+	archived map[uint64]archiveEntry // 已归档根树：根 ID -> 存根
+	revived  map[uint64]tree.Event   // 从归档恢复、ID 已低于 hotBase 且不在冷数据段中的事件
+
+	events   hotEvents
 	children map[uint64][]uint64
 	roots    map[uint64]struct{}
 	heads    map[uint64]struct{}
+	reach    reachIndex                    // 可达性索引，覆盖所有在线事件，见 reach.go
+	stats    dagStats                      // 增量维护的边数、扇出、payload 字节数与类型分布，见 stats.go
+	byType   typeIndex                     // 类型 -> 在线事件 ID（升序），见 typeindex.go
+	byTime   timeIndex                     // 按 ID 分块的时间戳范围，见 timeindex.go
+	fields   map[string]*fieldIndex        // payload 字段路径 -> 二级索引，见 fieldindex.go
+	fieldSet atomic.Pointer[[]*fieldIndex] // fields 的只读快照，供锁外提取字段值，随 fields 一起更新
+	text     *textIndex                    // Message 全文索引：词 -> 在线事件 ID 与有序词表，关闭时为 nil，见 textindex.go
+	rate     emitRate                      // 最近 15 分钟每秒写入的事件数
+
+	subsMu  sync.Mutex
+	subs    map[uint64]chan tree.Event
+	subSeq  uint64
+	dropped uint64 // 因订阅者缓冲区已满而丢弃的 SSE 事件数
 
-	subsMu sync.Mutex
-	subs   map[uint64]chan tree.Event
-	subSeq uint64
+	types *typeTable // 事件类型驻留表，紧凑布局按编号引用
 
-	typeIntern map[string]string
+	opts     Options
+	wal      *wal
+	ckptMu   sync.Mutex // 串行化 Checkpoint，归档、恢复、导入、Verify 与字段索引的建立和删除也持有它
+	lastCkpt atomic.Pointer[tree.CheckpointInfo]
+	bgStop   chan struct{} // 关闭后通知后台 fsync / 快照 goroutine 退出
+	spillCh  chan struct{} // LimitSpill 下通知后台降冷
+	bgWG     sync.WaitGroup
 }
 
-// NewStore 创建并返回一个空的 Store 实例，events 预分配 1024 容量。
+// NewStore 创建并返回一个空的 Store 实例，热数据使用默认布局并预分配 1024 容量。
 func NewStore() *Store {
+	types := newTypeTable()
 	return &Store{
-		events:     make([]tree.Event, 0, 1024),
-		children:   make(map[uint64][]uint64),
-		roots:      make(map[uint64]struct{}),
-		heads:      make(map[uint64]struct{}),
-		subs:       make(map[uint64]chan tree.Event),
-		typeIntern: make(map[string]string),
+		events:   newHotEvents(LayoutStruct, types, 0),
+		children: make(map[uint64][]uint64),
+		roots:    make(map[uint64]struct{}),
+		heads:    make(map[uint64]struct{}),
+		stats:    newDAGStats(),
+		subs:     make(map[uint64]chan tree.Event),
+		types:    types,
+		archived: make(map[uint64]archiveEntry),
+		revived:  make(map[uint64]tree.Event),
+		payloads: make(map[payloadKey]*sharedPayload),
+		fields:   make(map[string]*fieldIndex),
+		text:     newTextIndex(),
 	}
 }
@@ -0,0 +1,382 @@
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage/storagetest"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestBackendConformance 在纯内存、持久化与紧凑布局三种配置的 Store 上运行 storage.Backend 一致性检查。
+func TestBackendConformance(t *testing.T) {
+	cases := []struct {
+		name string
+		open func(t *testing.T) (storage.Backend, error)
+	}{
+		{"memory", func(*testing.T) (storage.Backend, error) {
+			return NewStore(), nil
+		}},
+		{"data-dir", func(t *testing.T) (storage.Backend, error) {
+			return Open(Options{DataDir: t.TempDir(), Sync: SyncNever})
+		}},
+		{"compact", func(*testing.T) (storage.Backend, error) {
+			return Open(Options{Layout: LayoutCompact})
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if err := storagetest.TestBackend(func() (storage.Backend, error) {
+				return c.open(t)
+			}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+// mustOpen 打开 opts 描述的 Store，测试结束时关闭。
+func mustOpen(t *testing.T, opts Options) *Store {
+	t.Helper()
+	s, err := Open(opts)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// mustEmit 写入一个事件并返回其 ID。
+func mustEmit(t *testing.T, s *Store, typ string, payload string, parents ...uint64) uint64 {
+	t.Helper()
+	req := tree.EmitRequest{Type: typ, Parents: parents}
+	if payload != "" {
+		req.Payload = json.RawMessage(payload)
+	}
+	ev, err := s.Emit(req)
+	if err != nil {
+		t.Fatalf("emit %s: %v", typ, err)
+	}
+	return ev.ID
+}
+
+// sorted 返回升序排列的 ids 副本，用于比较 Roots / Heads 等无序结果。
+func sorted(ids []uint64) []uint64 {
+	out := slices.Clone(ids)
+	slices.Sort(out)
+	return out
+}
+
+// TestReopen 检查关闭后重新打开数据目录时事件、roots、heads 与 payload 都按原 ID 恢复。
+func TestReopen(t *testing.T) {
+	for _, sync := range []SyncPolicy{SyncAlways, SyncInterval, SyncNever} {
+		t.Run(sync.String(), func(t *testing.T) {
+			dir := t.TempDir()
+			s, err := Open(Options{DataDir: dir, Sync: sync})
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := mustEmit(t, s, "root", `{"k":1}`)
+			b := mustEmit(t, s, "child", `{"k":2}`, a)
+			c := mustEmit(t, s, "root", "")
+			d := mustEmit(t, s, "join", `{"k":3}`, b, c)
+			want := make(map[uint64]tree.Event)
+			for _, id := range []uint64{a, b, c, d} {
+				want[id], _ = s.Get(id)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			s = mustOpen(t, Options{DataDir: dir, Sync: sync})
+			if got := s.Snapshot().NextEventID; got != d {
+				t.Fatalf("next event id = %d, want %d", got, d)
+			}
+			for id, ev := range want {
+				got, ok := s.Get(id)
+				if !ok {
+					t.Fatalf("event %d missing after reopen", id)
+				}
+				if got.Type != ev.Type || got.TimeUnixNano != ev.TimeUnixNano || !slices.Equal(got.Parents, ev.Parents) || string(got.Payload) != string(ev.Payload) {
+					t.Fatalf("event %d = %+v, want %+v", id, got, ev)
+				}
+			}
+			if got := sorted(s.Roots()); !slices.Equal(got, []uint64{a, c}) {
+				t.Fatalf("roots = %v, want %v", got, []uint64{a, c})
+			}
+			if got := sorted(s.Heads()); !slices.Equal(got, []uint64{d}) {
+				t.Fatalf("heads = %v, want %v", got, []uint64{d})
+			}
+			if id := mustEmit(t, s, "after", "", d); id != d+1 {
+				t.Fatalf("first id after reopen = %d, want %d", id, d+1)
+			}
+		})
+	}
+}
+
+// TestTornTail 检查最后一条记录写到一半时，重新打开会截断残缺尾部并保留之前的记录。
+func TestTornTail(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(Options{DataDir: dir, Sync: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := mustEmit(t, s, "root", `{"k":1}`)
+	b := mustEmit(t, s, "child", "", a)
+	path := walSegmentPath(dir, s.wal.seq)
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	good := fi.Size()
+	mustEmit(t, s, "lost", `{"k":2}`, b)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 只保留第三条记录的前几个字节，模拟写入过程中崩溃
+	if err := os.Truncate(path, good+5); err != nil {
+		t.Fatal(err)
+	}
+	s = mustOpen(t, Options{DataDir: dir, Sync: SyncAlways})
+	if got := s.Snapshot().NextEventID; got != b {
+		t.Fatalf("next event id = %d, want %d", got, b)
+	}
+	if _, ok := s.Get(a); !ok {
+		t.Fatalf("event %d lost", a)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Size() != good {
+		t.Fatalf("segment size after recovery = %v (%v), want %d", fi.Size(), err, good)
+	}
+	if id := mustEmit(t, s, "again", "", b); id != b+1 {
+		t.Fatalf("id after torn tail = %d, want %d", id, b+1)
+	}
+}
+
+// TestFailedAppend 检查 WAL 写入失败时 Emit 返回服务端错误、不消耗 ID，且无法截断的 WAL 拒绝之后的写入。
+func TestFailedAppend(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(Options{DataDir: dir, Sync: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := mustEmit(t, s, "root", "")
+
+	// 换成只读句柄：write 与 ftruncate 都会失败
+	ro, err := os.Open(s.wal.f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.wal.f.Close()
+	s.wal.f = ro
+
+	for i := 0; i < 2; i++ {
+		_, err := s.Emit(tree.EmitRequest{Type: "fail", Parents: []uint64{a}})
+		var emitErr *tree.EmitError
+		if err == nil || errors.As(err, &emitErr) {
+			t.Fatalf("emit %d with a broken wal: err = %v, want a non-EmitError", i, err)
+		}
+		if got := s.Snapshot().NextEventID; got != a {
+			t.Fatalf("next event id after failed emit = %d, want %d", got, a)
+		}
+	}
+	if s.wal.failed == nil {
+		t.Fatal("wal not marked failed after truncate error")
+	}
+	s.Close()
+
+	s = mustOpen(t, Options{DataDir: dir, Sync: SyncAlways})
+	if id := mustEmit(t, s, "ok", "", a); id != a+1 {
+		t.Fatalf("id after failed append = %d, want %d", id, a+1)
+	}
+}
+
+// TestGroupCommit 让一次写出正在进行时暂存另外两个写入：它们由下一个领头者一起写出。写出失败时整组以及之后暂存的写入都失败，
+// 预留的 ID 被释放；成功时三个写入的 ID 连续。
+func TestGroupCommit(t *testing.T) {
+	for _, broken := range []bool{false, true} {
+		s := mustOpen(t, Options{DataDir: t.TempDir(), Sync: SyncAlways})
+		a := mustEmit(t, s, "root", "")
+		w := s.wal
+		waitFor := func(cond func() bool) {
+			for {
+				w.mu.Lock()
+				ok := cond()
+				w.mu.Unlock()
+				if ok {
+					return
+				}
+				runtime.Gosched()
+			}
+		}
+
+		// 持有 io：第一个写入成为领头者后停在写出之前
+		w.io.Lock()
+		errs := make(chan error, 3)
+		ids := make(chan uint64, 3)
+		emit := func() {
+			ev, err := s.Emit(tree.EmitRequest{Type: "child", Parents: []uint64{a}})
+			if err == nil {
+				ids <- ev.ID
+			}
+			errs <- err
+		}
+		go emit()
+		waitFor(func() bool { return w.flushing })
+		go emit()
+		go emit()
+		waitFor(func() bool { return len(w.waiting) == 2 })
+		if broken {
+			ro, err := os.Open(w.f.Name())
+			if err != nil {
+				t.Fatal(err)
+			}
+			w.f.Close()
+			w.f = ro
+		}
+		w.io.Unlock()
+
+		for range 3 {
+			if err := <-errs; (err != nil) != broken {
+				t.Fatalf("broken %v: emit err = %v", broken, err)
+			}
+		}
+		s.mu.RLock()
+		reserved, next := s.reserved, s.nextID
+		s.mu.RUnlock()
+		if reserved != 0 {
+			t.Fatalf("broken %v: %d ids still reserved", broken, reserved)
+		}
+		if broken {
+			if next != a {
+				t.Fatalf("next id after a failed group = %d, want %d", next, a)
+			}
+			continue
+		}
+		close(ids)
+		var got []uint64
+		for id := range ids {
+			got = append(got, id)
+		}
+		if want := []uint64{a + 1, a + 2, a + 3}; !slices.Equal(sorted(got), want) || next != a+3 {
+			t.Fatalf("ids = %v, next = %d, want %v", got, next, want)
+		}
+	}
+}
+
+// TestConcurrentEmits 在 SyncAlways 下并发写入单个事件与批次，同时写快照：ID 不重复、不留空洞，订阅者按 ID 顺序收到事件，
+// 重新打开后内容一致。
+func TestConcurrentEmits(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(Options{DataDir: dir, Sync: SyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, events, cancel := s.Subscribe()
+	received := make(chan []uint64)
+	go func() {
+		var ids []uint64
+		for ev := range events {
+			ids = append(ids, ev.ID)
+		}
+		received <- ids
+	}()
+
+	const writers, rounds = 8, 25
+	var wg sync.WaitGroup
+	errs := make(chan error, writers+1)
+	for i := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range rounds {
+				var err error
+				if i%2 == 0 {
+					_, err = s.Emit(tree.EmitRequest{Type: "one"})
+				} else {
+					_, err = s.EmitBatch([]tree.BatchEmitItem{
+						{EmitRequest: tree.EmitRequest{Type: "batch"}},
+						{EmitRequest: tree.EmitRequest{Type: "batch"}, LocalParents: []int{0}},
+					})
+				}
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for range 5 {
+			if _, err := s.Checkpoint(); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	total := uint64(writers / 2 * rounds * 3)
+	if got := s.Snapshot().NextEventID; got != total {
+		t.Fatalf("next event id = %d, want %d", got, total)
+	}
+	// 订阅者太慢时会丢事件，但收到的事件必须按 ID 升序
+	cancel()
+	ids := <-received
+	for i := 1; i < len(ids); i++ {
+		if ids[i] <= ids[i-1] {
+			t.Fatalf("subscriber got event %d after %d", ids[i], ids[i-1])
+		}
+	}
+	if dropped := s.Snapshot().SSEDropped; uint64(len(ids))+dropped != total {
+		t.Fatalf("subscriber got %d events and %d were dropped, want %d in total", len(ids), dropped, total)
+	}
+	if rep, err := s.Verify(); err != nil || !rep.OK {
+		t.Fatalf("verify: %+v, %v", rep, err)
+	}
+	s.Close()
+
+	s = mustOpen(t, Options{DataDir: dir})
+	if got := s.Snapshot().NextEventID; got != total {
+		t.Fatalf("next event id after reopen = %d, want %d", got, total)
+	}
+	if rep, err := s.Verify(); err != nil || !rep.OK {
+		t.Fatalf("verify after reopen: %+v, %v", rep, err)
+	}
+}
+
+// TestEmitErrorKinds 检查请求无效时 Emit 与 EmitBatch 返回 *tree.EmitError。
+func TestEmitErrorKinds(t *testing.T) {
+	s := NewStore()
+	root := mustEmit(t, s, "root", "")
+	cases := []struct {
+		name string
+		emit func() error
+	}{
+		{"no type", func() error { _, err := s.Emit(tree.EmitRequest{}); return err }},
+		{"missing parent", func() error { _, err := s.Emit(tree.EmitRequest{Type: "x", Parents: []uint64{root + 10}}); return err }},
+		{"empty batch", func() error { _, err := s.EmitBatch(nil); return err }},
+		{"bad local parent", func() error {
+			_, err := s.EmitBatch([]tree.BatchEmitItem{{EmitRequest: tree.EmitRequest{Type: "x"}, LocalParents: []int{0}}})
+			return err
+		}},
+	}
+	for _, c := range cases {
+		var emitErr *tree.EmitError
+		if err := c.emit(); !errors.As(err, &emitErr) {
+			t.Errorf("%s: err = %v, want *tree.EmitError", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package memory
+
+import (
+	"fmt"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// idSet 是 [lo, hi] 内事件 ID 的位图，流式遍历用它代替 map 记录已访问的节点：每个 ID 只占 1 bit。
+type idSet struct {
+	lo   uint64
+	bits []uint64
+}
+
+func newIDSet(lo, hi uint64) *idSet {
+	if hi < lo {
+		return &idSet{lo: lo}
+	}
+	return &idSet{lo: lo, bits: make([]uint64, (hi-lo)/64+1)}
+}
+
+// add 将 id 加入集合，返回它之前是否已在集合中。
+func (s *idSet) add(id uint64) bool {
+	i := id - s.lo
+	w, m := i/64, uint64(1)<<(i%64)
+	seen := s.bits[w]&m != 0
+	s.bits[w] |= m
+	return seen
+}
+
+// streamFrame 是流式遍历的栈帧，只保存 ID，不保存已输出的节点。
+type streamFrame struct {
+	id    uint64
+	depth int
+	edges []uint64
+	next  int
+}
+
+// streamRecord 是等待在锁外输出的记录；meta 视图下 ev 是事件的拷贝，payload 为存储形式。
+type streamRecord struct {
+	rec tree.TreeRecord
+	ev  tree.Event
+}
+
+// StreamDescendants 按前序对以 rootID 为根的后代树的每个节点调用 fn。
+func (s *Store) StreamDescendants(rootID uint64, opts tree.StreamOptions, fn func(tree.TreeRecord) error) error {
+	return s.streamTree(rootID, opts, (*readView).children, func(v *readView) *idSet {
+		// 后代的 ID 总是大于祖先
+		return newIDSet(rootID, v.upTo)
+	}, fn)
+}
+
+// StreamProvenance 按前序对以 rootID 为起点的溯源树的每个节点调用 fn。
+func (s *Store) StreamProvenance(rootID uint64, opts tree.StreamOptions, fn func(tree.TreeRecord) error) error {
+	return s.streamTree(rootID, opts, parentsInView, func(*readView) *idSet {
+		// 祖先的 ID 总是小于后代
+		return newIDSet(1, rootID)
+	}, fn)
+}
+
+// streamTree 在读视图中以显式栈做前序 DFS，输出与 walkTree 相同的节点序列，但不构建嵌套的树：
+// 记录每攒满 readYield 条就释放读锁、在锁外交给 fn，峰值内存只有一批记录、遍历栈与已访问位图。
+// 锁外期间被归档的节点在重新持锁后跳过（连同尚未输出的子树）；仍在线的事件读不出来（冷数据段读取失败）时返回错误。
+func (s *Store) streamTree(rootID uint64, opts tree.StreamOptions, edges func(*readView, uint64) []uint64, newSeen func(*readView) *idSet, fn func(tree.TreeRecord) error) error {
+	var v *readView
+	if opts.UntilID != 0 {
+		v = s.openViewAt(opts.UntilID)
+	} else {
+		v = s.openView()
+	}
+	defer v.close()
+
+	if err := s.validateRootIDLocked(rootID); err != nil {
+		return err
+	}
+	if rootID > v.upTo {
+		return &tree.RootIDError{ID: rootID, Reason: "event is above the watermark"}
+	}
+
+	seen := newSeen(v)
+	batch := make([]streamRecord, 0, readYield)
+	flush := func() error {
+		err := v.unlocked(func() error {
+			for _, r := range batch {
+				if opts.Meta {
+					r.rec.TimeUnixNano = r.ev.TimeUnixNano
+					r.rec.Type = r.ev.Type
+					r.rec.Message = r.ev.Message
+					r.rec.Payload = expandPayload(r.ev.Payload)
+					r.rec.Archived = r.ev.Archived
+				}
+				if err := fn(r.rec); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		batch = batch[:0]
+		return err
+	}
+	emit := func(rec tree.TreeRecord) error {
+		r := streamRecord{rec: rec}
+		if opts.Meta {
+			var ok bool
+			if r.ev, ok = v.event(rec.ID); !ok {
+				return fmt.Errorf("event %d could not be read", rec.ID)
+			}
+		}
+		batch = append(batch, r)
+		if len(batch) == cap(batch) {
+			return flush()
+		}
+		return nil
+	}
+	// visit 输出一个新节点，返回它需要展开的边；达到最大深度时不展开
+	visit := func(id, from uint64, depth int, watermark uint64) ([]uint64, error) {
+		next := edges(v, id)
+		truncated := opts.MaxDepth > 0 && depth >= opts.MaxDepth && len(next) > 0
+		if truncated {
+			next = nil
+		}
+		err := emit(tree.TreeRecord{ID: id, From: from, Depth: depth, Truncated: truncated, Watermark: watermark})
+		return next, err
+	}
+
+	seen.add(rootID)
+	rootEdges, err := visit(rootID, 0, 0, v.upTo)
+	if err != nil {
+		return err
+	}
+	stack := []streamFrame{{id: rootID, edges: rootEdges}}
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next == len(top.edges) {
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		id := top.edges[top.next]
+		top.next++
+
+		// 栈中的边是在之前的持锁期间取出的，其间可能有树被归档
+		if !v.has(id) {
+			continue
+		}
+		if seen.add(id) {
+			if err := emit(tree.TreeRecord{ID: id, From: top.id, Depth: top.depth + 1, IsRef: true}); err != nil {
+				return err
+			}
+			continue
+		}
+		from, depth := top.id, top.depth+1
+		next, err := visit(id, from, depth, 0)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, streamFrame{id: id, depth: depth, edges: next})
+	}
+	return flush()
+}
@@ -0,0 +1,192 @@
+package memory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// buildDiamonds 写入一棵以 root 为根、每层 width 个节点的 DAG：每个节点以上一层相邻的两个节点为父事件，
+// 因此后代树与溯源树中都有大量 IsRef 引用。返回根与最后一层的第一个节点。
+func buildDiamonds(t *testing.T, s *Store, layers, width int) (root, leaf uint64) {
+	t.Helper()
+	root = mustEmit(t, s, "root", `{}`)
+	prev := []uint64{root}
+	for range layers {
+		cur := make([]uint64, width)
+		for i := range cur {
+			a, b := prev[i%len(prev)], prev[(i+1)%len(prev)]
+			cur[i] = mustEmit(t, s, "node", `{"k":1}`, a, b)
+		}
+		prev = cur
+	}
+	return root, prev[0]
+}
+
+// nestRecords 按 From 与 Depth 把前序输出的记录还原为嵌套的树，new 构建节点，attach 把子节点挂到父节点下。
+func nestRecords[N any](t *testing.T, recs []tree.TreeRecord, newNode func(tree.TreeRecord) *N, attach func(p, c *N)) *N {
+	t.Helper()
+	type open struct {
+		id   uint64
+		node *N
+	}
+	var stack []open
+	var root *N
+	for i, rec := range recs {
+		n := newNode(rec)
+		if i == 0 {
+			if rec.Depth != 0 || rec.From != 0 || rec.Watermark == 0 {
+				t.Fatalf("first record = %+v, want the root with a watermark", rec)
+			}
+			root = n
+			stack = append(stack, open{rec.ID, n})
+			continue
+		}
+		if rec.Depth < 1 || rec.Depth > len(stack) {
+			t.Fatalf("record %d = %+v: depth out of order", i, rec)
+		}
+		stack = stack[:rec.Depth]
+		if p := stack[rec.Depth-1]; p.id != rec.From {
+			t.Fatalf("record %d = %+v: from %d, want %d", i, rec, rec.From, p.id)
+		} else {
+			attach(p.node, n)
+		}
+		stack = append(stack, open{rec.ID, n})
+	}
+	return root
+}
+
+func descendantsNode(rec tree.TreeRecord) *tree.DescendantsTree {
+	n := &tree.DescendantsTree{ID: rec.ID, IsRef: rec.IsRef, Truncated: rec.Truncated}
+	if !rec.IsRef {
+		n.Children = []tree.DescendantsTree{}
+	}
+	return n
+}
+
+func provenanceNode(rec tree.TreeRecord) *tree.ProvenanceTree {
+	n := &tree.ProvenanceTree{ID: rec.ID, IsRef: rec.IsRef, Truncated: rec.Truncated}
+	if !rec.IsRef {
+		n.Parents = []tree.ProvenanceTree{}
+	}
+	return n
+}
+
+// 子节点在其子树输出完之后才算完整，因此按指针挂接、最后再整体拷贝
+type descendantsBuild struct {
+	tree.DescendantsTree
+	kids []*descendantsBuild
+}
+
+func (b *descendantsBuild) value() tree.DescendantsTree {
+	n := b.DescendantsTree
+	for _, k := range b.kids {
+		n.Children = append(n.Children, k.value())
+	}
+	return n
+}
+
+type provenanceBuild struct {
+	tree.ProvenanceTree
+	kids []*provenanceBuild
+}
+
+func (b *provenanceBuild) value() tree.ProvenanceTree {
+	n := b.ProvenanceTree
+	for _, k := range b.kids {
+		n.Parents = append(n.Parents, k.value())
+	}
+	return n
+}
+
+func collect(t *testing.T, stream func(uint64, tree.StreamOptions, func(tree.TreeRecord) error) error, id uint64, opts tree.StreamOptions) []tree.TreeRecord {
+	t.Helper()
+	var recs []tree.TreeRecord
+	if err := stream(id, opts, func(rec tree.TreeRecord) error {
+		recs = append(recs, rec)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return recs
+}
+
+// TestStreamMatchesNestedTree 检查流式输出还原后与嵌套的后代树/溯源树完全相同，包括 IsRef 与深度截断的 Truncated；
+// 节点数远超 readYield，遍历跨越多次释放读锁。
+func TestStreamMatchesNestedTree(t *testing.T) {
+	s := NewStore()
+	root, leaf := buildDiamonds(t, s, 12, 64)
+
+	for _, depth := range []int{0, 1, 5} {
+		opts := tree.StreamOptions{MaxDepth: depth}
+
+		recs := collect(t, s.StreamDescendants, root, opts)
+		if depth == 0 && len(recs) <= readYield {
+			t.Fatalf("descendants: only %d records, want more than one batch", len(recs))
+		}
+		got := nestRecords(t, recs, func(rec tree.TreeRecord) *descendantsBuild {
+			return &descendantsBuild{DescendantsTree: *descendantsNode(rec)}
+		}, func(p, c *descendantsBuild) { p.kids = append(p.kids, c) }).value()
+		page, err := s.DescendantsPage(root, tree.TraverseOptions{MaxDepth: depth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, page.Trees[0]) {
+			t.Fatalf("max_depth %d: streamed descendants differ from the nested tree", depth)
+		}
+		if depth == 0 {
+			want, err := s.DescendantsTree(root)
+			if err != nil || !reflect.DeepEqual(got, want) {
+				t.Fatalf("streamed descendants differ from DescendantsTree (err %v)", err)
+			}
+		}
+
+		recs = collect(t, s.StreamProvenance, leaf, opts)
+		gotP := nestRecords(t, recs, func(rec tree.TreeRecord) *provenanceBuild {
+			return &provenanceBuild{ProvenanceTree: *provenanceNode(rec)}
+		}, func(p, c *provenanceBuild) { p.kids = append(p.kids, c) }).value()
+		pageP, err := s.ProvenancePage(leaf, tree.TraverseOptions{MaxDepth: depth})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(gotP, pageP.Trees[0]) {
+			t.Fatalf("max_depth %d: streamed provenance differs from the nested tree", depth)
+		}
+	}
+}
+
+// TestStreamSkipsArchivedNodes 在第一批记录输出时（读锁已释放）归档整棵树：之后的节点被跳过，不输出空事件也不报错。
+func TestStreamSkipsArchivedNodes(t *testing.T) {
+	s := mustOpen(t, Options{DataDir: t.TempDir(), Sync: SyncNever})
+	root, _ := buildDiamonds(t, s, 8, 64)
+
+	for _, meta := range []bool{false, true} {
+		var recs []tree.TreeRecord
+		archived := false
+		err := s.StreamDescendants(root, tree.StreamOptions{Meta: meta}, func(rec tree.TreeRecord) error {
+			if !archived {
+				if _, err := s.Archive(root); err != nil {
+					return err
+				}
+				archived = true
+			}
+			if meta && rec.Type == "" {
+				return errors.New("record without event metadata")
+			}
+			recs = append(recs, rec)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("meta %v: %v", meta, err)
+		}
+		// 只有归档前取出的第一批（归档后根事件成为存根，仍然输出）
+		if len(recs) != readYield {
+			t.Fatalf("meta %v: %d records, want the first batch of %d", meta, len(recs), readYield)
+		}
+		if _, err := s.Rehydrate(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
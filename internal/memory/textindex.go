@@ -0,0 +1,267 @@
+package memory
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+const (
+	textMaxTermBytes = 64   // 更长的词（哈希、base64 等）截断到这个长度再索引
+	textDictMerge    = 4096 // 词表中尚未并入有序部分的新词数上限
+)
+
+// textIndex 是 Message 全文索引：词 -> 在线事件 ID 的倒排表，加上有序词表。
+// 前缀查询在词表中二分查找以前缀开头的范围，代价与匹配的词数而非词表大小成正比。
+// 新词先记入 recent，攒满 textDictMerge 个后排序并入 terms，合并的代价摊到每个新词上（需持有 s.mu）。
+type textIndex struct {
+	*postings
+	terms  []string // 升序的词
+	recent []string // 尚未并入 terms 的新词，无序
+}
+
+func newTextIndex() *textIndex {
+	return &textIndex{postings: newPostings()}
+}
+
+// add 把事件 id 加入词 t 的列表，新词同时记入词表。
+func (x *textIndex) add(t string, id uint64) {
+	if _, ok := x.lists[t]; !ok {
+		x.recent = append(x.recent, t)
+		if len(x.recent) >= textDictMerge {
+			x.mergeRecent()
+		}
+	}
+	x.postings.add(t, id)
+}
+
+// mergeRecent 将 recent 排序后从尾部原地归并进 terms。
+func (x *textIndex) mergeRecent() {
+	slices.Sort(x.recent)
+	n, m := len(x.terms), len(x.recent)
+	x.terms = slices.Grow(x.terms, m)[:n+m]
+	for i, j, k := n-1, m-1, n+m-1; j >= 0; k-- {
+		if i >= 0 && x.terms[i] > x.recent[j] {
+			x.terms[k], i = x.terms[i], i-1
+		} else {
+			x.terms[k], j = x.recent[j], j-1
+		}
+	}
+	x.recent = x.recent[:0]
+}
+
+// rebuildTerms 由倒排表的键重建词表，在 compact、load 删除了词之后调用。
+func (x *textIndex) rebuildTerms() {
+	x.terms = slices.Sorted(maps.Keys(x.lists))
+	x.recent = nil
+}
+
+// compact 同 postings.compact；有词被整体删除时重建词表。
+func (x *textIndex) compact(live func(uint64) bool) {
+	x.postings.compact(live)
+	if len(x.lists) != len(x.terms)+len(x.recent) {
+		x.rebuildTerms()
+	}
+}
+
+// load 同 postings.load，并重建词表。
+func (x *textIndex) load(lists map[string][]uint64, live func(uint64) bool) {
+	x.postings.load(lists, live)
+	x.rebuildTerms()
+}
+
+// prefixLists 返回以 prefix 开头的全部词的列表。
+func (x *textIndex) prefixLists(prefix string) [][]uint64 {
+	var lists [][]uint64
+	i, _ := slices.BinarySearch(x.terms, prefix)
+	for ; i < len(x.terms) && strings.HasPrefix(x.terms[i], prefix); i++ {
+		lists = append(lists, x.lists[x.terms[i]])
+	}
+	for _, t := range x.recent {
+		if strings.HasPrefix(t, prefix) {
+			lists = append(lists, x.lists[t])
+		}
+	}
+	return lists
+}
+
+// memBytes 在倒排表之外加上词表：每个词一个字符串头，字符串内容与倒排表的键共享。
+func (x *textIndex) memBytes() int64 {
+	return x.postings.memBytes() + int64(len(x.terms)+len(x.recent))*16
+}
+
+// tokenize 将文本切分为小写的词：字母、数字与下划线的连续片段为一个词，汉字、假名与谚文每个字单独成词
+// （这些文字不以空格分词，连续的字由短语匹配保证相邻），其余字符都是分隔符。
+func tokenize(text string) []string {
+	var out []string
+	start := -1
+	flush := func(end int) {
+		if start >= 0 {
+			out = append(out, clipTerm(strings.ToLower(text[start:end])))
+			start = -1
+		}
+	}
+	for i, r := range text {
+		switch {
+		case isIdeograph(r):
+			flush(i)
+			out = append(out, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			if start < 0 {
+				start = i
+			}
+		default:
+			flush(i)
+		}
+	}
+	flush(len(text))
+	return out
+}
+
+func isIdeograph(r rune) bool {
+	return r >= 0x2E80 && (unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+		unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r))
+}
+
+// clipTerm 将过长的词截断到 textMaxTermBytes 以内（不拆开多字节字符）。
+func clipTerm(t string) string {
+	if len(t) <= textMaxTermBytes {
+		return t
+	}
+	n := textMaxTermBytes
+	for n > 0 && !utf8.RuneStart(t[n]) {
+		n--
+	}
+	return t[:n]
+}
+
+// distinctTerms 返回文本中不重复的词（升序），即事件在全文索引中出现的列表。
+func distinctTerms(text string) []string {
+	terms := tokenize(text)
+	slices.Sort(terms)
+	return slices.Compact(terms)
+}
+
+// textQuery 是解析后的全文查询，各条件之间为“与”的关系。
+type textQuery struct {
+	terms    []string   // 必须出现的词（含短语中的词）
+	prefixes []string   // 必须有词以之开头
+	phrases  [][]string // 必须按顺序相邻出现的词序列
+}
+
+// parseTextQuery 解析全文查询：以空白分隔的词、以 "*" 结尾的前缀（"conn*"）与双引号包围的短语（"connection refused"）。
+// 一个词切分出多个词时（"disk-full"、"数据库"）按短语处理。没有任何词、引号不成对或前缀不合法时返回 *tree.QueryError。
+func parseTextQuery(q string) (*textQuery, error) {
+	tq := &textQuery{}
+	addTerms := func(terms []string) {
+		for _, t := range terms {
+			if !slices.Contains(tq.terms, t) {
+				tq.terms = append(tq.terms, t)
+			}
+		}
+		if len(terms) > 1 {
+			tq.phrases = append(tq.phrases, terms)
+		}
+	}
+	for rest := strings.TrimSpace(q); rest != ""; rest = strings.TrimSpace(rest) {
+		if rest[0] == '"' {
+			phrase, tail, ok := strings.Cut(rest[1:], `"`)
+			if !ok {
+				return nil, &tree.QueryError{Reason: "unterminated phrase in search query"}
+			}
+			addTerms(tokenize(phrase))
+			rest = tail
+			continue
+		}
+		word := rest
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word, rest = rest[:i], rest[i:]
+		} else {
+			rest = ""
+		}
+		if prefix, ok := strings.CutSuffix(word, "*"); ok {
+			terms := tokenize(prefix)
+			if len(terms) != 1 || terms[0] != clipTerm(strings.ToLower(prefix)) {
+				return nil, &tree.QueryError{Reason: fmt.Sprintf("bad prefix %q: want a single word followed by *", word)}
+			}
+			tq.prefixes = append(tq.prefixes, terms[0])
+			continue
+		}
+		addTerms(tokenize(word))
+	}
+	if len(tq.terms) == 0 && len(tq.prefixes) == 0 {
+		return nil, &tree.QueryError{Reason: "search query has no words"}
+	}
+	return tq, nil
+}
+
+// textClausesLocked 将查询展开为若干个条件：每个词一个（一个列表），每个前缀一个（以之开头的全部词的列表，不限词数）。
+// 满足查询的事件出现在每个条件的某个列表中；不存在的词得到空条件，结果为空（需持有 s.mu）。
+func (s *Store) textClausesLocked(tq *textQuery) []scanClause {
+	clauses := make([]scanClause, 0, len(tq.terms)+len(tq.prefixes))
+	for _, t := range tq.terms {
+		clauses = append(clauses, scanClause{lists: [][]uint64{s.text.lists[t]}})
+	}
+	for _, prefix := range tq.prefixes {
+		clauses = append(clauses, scanClause{lists: s.text.prefixLists(prefix), prefix: prefix})
+	}
+	return clauses
+}
+
+// matchText 判断文本是否含有以每个前缀开头的词，并按顺序相邻地包含每个短语。
+func matchText(text string, prefixes []string, phrases [][]string) bool {
+	if len(prefixes) == 0 && len(phrases) == 0 {
+		return true
+	}
+	tokens := tokenize(text)
+	for _, prefix := range prefixes {
+		if !slices.ContainsFunc(tokens, func(t string) bool { return strings.HasPrefix(t, prefix) }) {
+			return false
+		}
+	}
+	for _, phrase := range phrases {
+		found := false
+		for i := 0; i+len(phrase) <= len(tokens) && !found; i++ {
+			found = slices.Equal(tokens[i:i+len(phrase)], phrase)
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// messageTerms 在锁外切分事件消息，返回需要计入全文索引的词；全文索引关闭时返回 nil。
+func (s *Store) messageTerms(message string) []string {
+	if s.opts.NoTextIndex || message == "" {
+		return nil
+	}
+	return distinctTerms(message)
+}
+
+// indexTextLocked 把事件消息中的每个词计入全文索引；全文索引关闭时什么也不做（需持有 s.mu）。
+// terms 是调用方用 messageTerms 预先切分的结果，为 nil 时在锁内切分。
+func (s *Store) indexTextLocked(ev tree.Event, terms []string) {
+	if s.text == nil || ev.Message == "" {
+		return
+	}
+	if terms == nil {
+		terms = distinctTerms(ev.Message)
+	}
+	for _, t := range terms {
+		s.text.add(t, ev.ID)
+	}
+}
+
+// unindexTextLocked 记录事件离开了在线存储，列表中的 ID 在压缩时才删除（需持有 s.mu）。
+func (s *Store) unindexTextLocked(ev tree.Event) {
+	if s.text == nil || ev.Message == "" {
+		return
+	}
+	s.text.expire(len(distinctTerms(ev.Message)))
+}
@@ -0,0 +1,60 @@
+package memory
+
+import (
+	"math"
+)
+
+// timeBlockIDs 是时间索引每块覆盖的连续 ID 数。
+const timeBlockIDs = 1024
+
+// timeIndex 是按 ID 分块的时间戳范围索引：每 timeBlockIDs 个连续 ID 一块，记录块内在线事件时间戳的最小值与最大值，
+// 覆盖热数据、恢复事件与冷数据。事件的时间戳大体随 ID 递增，但并不保证单调：时钟回拨，以及 Import 与归档恢复的事件
+// 保留原时间戳。索引只要求每个在线事件的时间戳落在所在块的范围内，乱序只会让块的范围变宽、查询多扫描几个块，
+// 不影响结果的正确性。归档不收缩范围（需持有 s.mu）。
+type timeIndex struct {
+	min, max []int64 // 下标为 id / timeBlockIDs；没有事件的块 min > max
+}
+
+// add 将事件 id 的时间戳 t 计入所在块的范围。
+func (x *timeIndex) add(id uint64, t int64) {
+	b := int(id / timeBlockIDs)
+	for len(x.min) <= b {
+		x.min = append(x.min, math.MaxInt64)
+		x.max = append(x.max, math.MinInt64)
+	}
+	x.min[b] = min(x.min[b], t)
+	x.max[b] = max(x.max[b], t)
+}
+
+// overlaps 报告第 b 块是否可能含有时间戳在 [from, to) 内的事件。
+func (x *timeIndex) overlaps(b int, from, to int64) bool {
+	return b < len(x.min) && x.min[b] <= x.max[b] && x.max[b] >= from && x.min[b] < to
+}
+
+// idRange 返回可能含有时间戳在 [from, to) 内的事件的 ID 范围 [lo, hi]；没有这样的块时 ok 为 false。
+// 逐块检查，块数约为事件数的千分之一。
+func (x *timeIndex) idRange(from, to int64) (lo, hi uint64, ok bool) {
+	first, last := -1, -1
+	for b := range x.min {
+		if x.overlaps(b, from, to) {
+			if first < 0 {
+				first = b
+			}
+			last = b
+		}
+	}
+	if first < 0 {
+		return 0, 0, false
+	}
+	return uint64(first) * timeBlockIDs, uint64(last+1)*timeBlockIDs - 1, true
+}
+
+// memBytes 估算索引占用的内存：每块一对时间戳。
+func (x *timeIndex) memBytes() int64 {
+	return int64(len(x.min)) * 16
+}
+
+// clone 返回索引的拷贝（Checkpoint 写出时使用，块的范围会原地更新，不能共享）。
+func (x *timeIndex) clone() *timeIndex {
+	return &timeIndex{min: append([]int64(nil), x.min...), max: append([]int64(nil), x.max...)}
+}
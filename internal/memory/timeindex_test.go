@@ -0,0 +1,123 @@
+package memory
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// TestQueryByTime 导入跨越多个时间索引块、时间戳乱序并带有远离其余事件的离群值的事件，检查各种时间范围（可与类型条件组合）
+// 翻页与流式输出得到的事件与逐个读取的结果相同；归档、降冷、重新打开与恢复之后，以及之后新写入的事件，仍然如此。
+func TestQueryByTime(t *testing.T) {
+	const base = int64(1_700_000_000_000_000_000)
+	ms := func(n int64) int64 { return base + n*int64(time.Millisecond) }
+
+	// ID 1..1500 与 2600..3800（中间的空缺使第 2 块只有一部分事件），大体每个 ID 晚 1ms；
+	// 每 50 个事件有一个早 300ms，落进前面的块的时间范围，另有两个离群值
+	var events []tree.Event
+	var roots []uint64
+	last := map[int]uint64{}
+	for id := uint64(1); id <= 3800; id++ {
+		if id == 1501 {
+			id = 2600
+		}
+		ts := ms(int64(id))
+		switch {
+		case id == 100:
+			ts = base - 5*int64(time.Second)
+		case id == 3000:
+			ts = ms(10_000)
+		case id%50 == 0:
+			ts = ms(int64(id) - 300)
+		}
+		ev := tree.Event{ID: id, Type: []string{"a", "b", "c"}[id%3], TimeUnixNano: ts}
+		if tr := int(id % 3); last[tr] != 0 {
+			ev.Parents = []uint64{last[tr]}
+		} else {
+			roots = append(roots, id)
+		}
+		last[int(id%3)] = id
+		events = append(events, ev)
+	}
+
+	opts := Options{DataDir: t.TempDir(), Sync: SyncNever, HotWindow: 500}
+	s := mustOpen(t, opts)
+	if _, err := s.Import(source(events, -1)); err != nil {
+		t.Fatal(err)
+	}
+
+	windows := []struct {
+		name string
+		q    tree.EventQuery
+	}{
+		{"everything", tree.EventQuery{From: base - 10*int64(time.Second), To: ms(20_000)}},
+		{"inside one block", tree.EventQuery{From: ms(500), To: ms(520)}},
+		{"across a block boundary", tree.EventQuery{From: ms(1000), To: ms(1050)}},
+		{"over the id gap", tree.EventQuery{From: ms(1400), To: ms(2700)}},
+		{"early outlier", tree.EventQuery{From: base - 6*int64(time.Second), To: base}},
+		{"late outlier", tree.EventQuery{From: ms(5000), To: ms(20_000)}},
+		{"between the outliers and the rest", tree.EventQuery{From: ms(4000), To: ms(9000)}},
+		{"from only", tree.EventQuery{From: ms(3500)}},
+		{"to only", tree.EventQuery{To: ms(200)}},
+		{"with a type", tree.EventQuery{Type: "c", From: ms(900), To: ms(2800)}},
+		{"with a type pattern", tree.EventQuery{Type: "*", From: ms(3700)}},
+	}
+	check := func(s *Store, stage string) {
+		t.Helper()
+		for _, w := range windows {
+			to := w.q.To
+			if to == 0 {
+				to = 1<<63 - 1
+			}
+			want := liveEvents(s, func(ev tree.Event) bool {
+				return ev.TimeUnixNano >= w.q.From && ev.TimeUnixNano < to && (w.q.Type == "" || w.q.Type == "*" || ev.Type == w.q.Type)
+			})
+			for _, limit := range []int{1, 0, 1000} {
+				q := w.q
+				q.Limit = limit
+				if got := queryIDs(t, s, q); !slices.Equal(got, want) {
+					t.Fatalf("%s: %s with limit %d = %d events, want %d", stage, w.name, limit, len(got), len(want))
+				}
+			}
+			var streamed []uint64
+			if err := s.StreamEvents(w.q, func(ev tree.Event) error {
+				streamed = append(streamed, ev.ID)
+				return nil
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(streamed, want) {
+				t.Fatalf("%s: streaming %s = %d events, want %d", stage, w.name, len(streamed), len(want))
+			}
+		}
+	}
+	s = indexStages(t, opts, s, roots[:1], check)
+
+	// 新写入的事件使用当前时间，与导入的历史时间戳一起查询
+	start := time.Now().UnixNano()
+	var fresh []uint64
+	for range 20 {
+		fresh = append(fresh, mustEmit(t, s, "a", "", roots[1]))
+	}
+	if got := queryIDs(t, s, tree.EventQuery{From: start, Limit: 3}); !slices.Equal(got, fresh) {
+		t.Fatalf("events since %d = %v, want %v", start, got, fresh)
+	}
+	windows = append(windows, struct {
+		name string
+		q    tree.EventQuery
+	}{"history and new events", tree.EventQuery{Type: "a", From: ms(3000)}})
+	check(s, "after new emits")
+
+	for _, q := range []tree.EventQuery{{From: ms(10), To: ms(10)}, {From: ms(10), To: ms(5)}, {Type: "a", To: -1, From: 1}} {
+		var qe *tree.QueryError
+		if _, err := s.QueryEvents(q); !errors.As(err, &qe) {
+			t.Errorf("QueryEvents(%+v): err = %v, want *tree.QueryError", q, err)
+		}
+		if err := s.StreamEvents(q, func(tree.Event) error { return nil }); !errors.As(err, &qe) {
+			t.Errorf("StreamEvents(%+v): err = %v, want *tree.QueryError", q, err)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+package memory
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// 续页游标中记录的遍历方向。
+const (
+	cursorDescendants byte = 'd'
+	cursorProvenance  byte = 'p'
+)
+
+// treeShape 描述一种树（后代树/溯源树，仅 ID/含元数据）如何由 DAG 构建，供 treeWalker 使用。
+type treeShape[N any] struct {
+	kind     byte                                     // 续页游标中的遍历方向
+	edges    func(v *readView, id uint64) []uint64    // 节点在视图内的下一层 ID（子事件或父事件）
+	node     func(v *readView, id uint64, ref bool) N // 构建节点；ref 节点的下一层为 nil，其余为空切片
+	attach   func(parent *N, child N)                 // 把已完成的子节点挂到父节点下
+	truncate func(n *N)                               // 标记节点的下一层未完整返回
+	fail     func(id uint64, err error) N             // 批量查询中根 ID 无效时代替整棵树返回的节点
+}
+
+// cursorEntry 是一个尚未遍历完的节点：从它的第 skip 条边继续，depth 为它在原树中的深度。
+type cursorEntry struct {
+	id    uint64
+	depth int
+	skip  int
+}
+
+// walkFrame 是迭代遍历的栈帧。
+type walkFrame[N any] struct {
+	node  N
+	id    uint64
+	depth int
+	edges []uint64
+	next  int
+}
+
+// treeWalker 以显式栈做前序 DFS，深度不受 goroutine 栈限制，并按 TraverseOptions 截断。
+// 同一个 walker 内共享 visited：已访问的节点再次出现时输出为 IsRef 引用，不再展开。
+type treeWalker[N any] struct {
+	v         *readView
+	shape     treeShape[N]
+	maxDepth  int
+	maxNodes  int
+	visited   map[uint64]struct{}
+	count     int           // 已输出的节点数（不含续页的接点）
+	truncated bool          // 是否有节点被截断
+	pending   []cursorEntry // 因节点数限制未遍历完的节点，深的在前
+}
+
+func newTreeWalker[N any](v *readView, shape treeShape[N], opts tree.TraverseOptions) *treeWalker[N] {
+	return &treeWalker[N]{
+		v:        v,
+		shape:    shape,
+		maxDepth: max(opts.MaxDepth, 0),
+		maxNodes: max(opts.MaxNodes, 0),
+		visited:  make(map[uint64]struct{}),
+	}
+}
+
+// full 报告本页的节点数是否已用完。
+func (w *treeWalker[N]) full() bool {
+	return w.maxNodes > 0 && w.count >= w.maxNodes
+}
+
+// expand 返回深度为 depth 的节点 id 需要展开的边；达到最大深度时不展开，有边则标记截断。
+func (w *treeWalker[N]) expand(n *N, id uint64, depth int) []uint64 {
+	edges := w.shape.edges(w.v, id)
+	if w.maxDepth > 0 && depth >= w.maxDepth && len(edges) > 0 {
+		w.shape.truncate(n)
+		w.truncated = true
+		return nil
+	}
+	return edges
+}
+
+// walk 从 e 开始遍历，返回以 e.id 为根的树。anchor 为 true 表示 e 是续页的接点：
+// 它已在之前的页中返回过，不计入节点数，且本页节点数用完时不再输出（留给下一页）。
+func (w *treeWalker[N]) walk(e cursorEntry, anchor bool) (N, bool) {
+	var zero N
+	if anchor {
+		if w.full() {
+			return zero, false
+		}
+	} else {
+		w.count++
+	}
+	w.visited[e.id] = struct{}{}
+	w.v.step()
+
+	root := w.shape.node(w.v, e.id, false)
+	edges := w.expand(&root, e.id, e.depth)
+	stack := []walkFrame[N]{{node: root, id: e.id, depth: e.depth, edges: edges, next: min(e.skip, len(edges))}}
+
+	for len(stack) > 0 {
+		top := &stack[len(stack)-1]
+		if top.next < len(top.edges) {
+			if w.full() {
+				break
+			}
+			childID := top.edges[top.next]
+			top.next++
+			w.count++
+
+			if _, seen := w.visited[childID]; seen {
+				w.shape.attach(&top.node, w.shape.node(w.v, childID, true))
+				continue
+			}
+			w.visited[childID] = struct{}{}
+			w.v.step()
+
+			child := w.shape.node(w.v, childID, false)
+			depth := top.depth + 1
+			childEdges := w.expand(&child, childID, depth)
+			stack = append(stack, walkFrame[N]{node: child, id: childID, depth: depth, edges: childEdges})
+			continue
+		}
+
+		done := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if len(stack) == 0 {
+			return done.node, true
+		}
+		w.shape.attach(&stack[len(stack)-1].node, done.node)
+	}
+
+	// 节点数用完：自底向上收起栈，仍有边未遍历的节点标记截断并记入续页游标
+	for i := len(stack) - 1; i >= 0; i-- {
+		f := &stack[i]
+		if f.next < len(f.edges) {
+			w.shape.truncate(&f.node)
+			w.truncated = true
+			w.pending = append(w.pending, cursorEntry{id: f.id, depth: f.depth, skip: f.next})
+		}
+		if i > 0 {
+			w.shape.attach(&stack[i-1].node, f.node)
+		}
+	}
+	return stack[0].node, true
+}
+
+// walkTree 完整遍历以 rootID 为根的树，调用方需已校验 rootID。
+func walkTree[N any](v *readView, shape treeShape[N], rootID uint64) N {
+	n, _ := newTreeWalker(v, shape, tree.TraverseOptions{}).walk(cursorEntry{id: rootID}, false)
+	return n
+}
+
+// treePage 按 opts 返回以 rootID 为根的树的一页：第一页是一棵完整的根树，
+// 续页是若干以此前被截断的节点为根、只含其剩余下一层的子树。
+func treePage[N any](s *Store, shape treeShape[N], rootID uint64, opts tree.TraverseOptions) (trees []N, truncated bool, cursor string, err error) {
+	var (
+		upTo    uint64
+		entries []cursorEntry
+	)
+	if opts.Cursor != "" {
+		upTo, entries, err = decodeCursor(opts.Cursor, shape.kind, rootID)
+		if err != nil {
+			return nil, false, "", err
+		}
+	}
+
+	var v *readView
+	if opts.Cursor != "" {
+		v = s.openViewAt(upTo)
+	} else {
+		v = s.openView()
+	}
+	defer v.close()
+
+	if err := s.validateRootIDLocked(rootID); err != nil {
+		return nil, false, "", err
+	}
+
+	w := newTreeWalker(v, shape, opts)
+	if opts.Cursor == "" {
+		n, _ := w.walk(cursorEntry{id: rootID}, false)
+		trees = append(trees, n)
+	} else {
+		trees = []N{}
+		for i, e := range entries {
+			if !v.has(e.id) {
+				continue // 接点在两页之间被归档
+			}
+			n, ok := w.walk(e, true)
+			if !ok {
+				w.pending = append(w.pending, entries[i:]...)
+				break
+			}
+			trees = append(trees, n)
+		}
+	}
+
+	if len(w.pending) > 0 {
+		cursor = encodeCursor(shape.kind, rootID, v.upTo, w.pending)
+	}
+	return trees, w.truncated, cursor, nil
+}
+
+// encodeCursor 将续页状态编码为不透明的游标：
+// kind | uvarint(rootID) | uvarint(upTo) | uvarint(n) | n × (uvarint(id), uvarint(depth), uvarint(skip))，再做 base64url。
+func encodeCursor(kind byte, rootID, upTo uint64, entries []cursorEntry) string {
+	buf := []byte{kind}
+	buf = binary.AppendUvarint(buf, rootID)
+	buf = binary.AppendUvarint(buf, upTo)
+	buf = binary.AppendUvarint(buf, uint64(len(entries)))
+	for _, e := range entries {
+		buf = binary.AppendUvarint(buf, e.id)
+		buf = binary.AppendUvarint(buf, uint64(e.depth))
+		buf = binary.AppendUvarint(buf, uint64(e.skip))
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decodeCursor 解析 encodeCursor 生成的游标，并校验它属于 kind 方向、以 rootID 为根的遍历。
+func decodeCursor(s string, kind byte, rootID uint64) (uint64, []cursorEntry, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) == 0 {
+		return 0, nil, &tree.CursorError{Reason: "malformed"}
+	}
+	if buf[0] != kind {
+		return 0, nil, &tree.CursorError{Reason: "cursor belongs to a different traversal"}
+	}
+	buf = buf[1:]
+
+	bad := false
+	next := func() uint64 {
+		v, n := binary.Uvarint(buf)
+		if n <= 0 {
+			bad = true
+			return 0
+		}
+		buf = buf[n:]
+		return v
+	}
+
+	root := next()
+	upTo := next()
+	n := next()
+	// 每个条目至少 3 字节，先据此限制条目数，避免畸形游标导致过大的分配
+	if bad || n == 0 || n > uint64(len(buf)/3) {
+		return 0, nil, &tree.CursorError{Reason: "malformed"}
+	}
+	if root != rootID {
+		return 0, nil, &tree.CursorError{Reason: "cursor belongs to a different root"}
+	}
+
+	entries := make([]cursorEntry, 0, n)
+	for range n {
+		e := cursorEntry{id: next(), depth: int(next()), skip: int(next())}
+		if bad || e.id == 0 || e.depth < 0 || e.skip < 0 {
+			return 0, nil, &tree.CursorError{Reason: "malformed"}
+		}
+		entries = append(entries, e)
+	}
+	if len(buf) != 0 {
+		return 0, nil, &tree.CursorError{Reason: "malformed"}
+	}
+	return upTo, entries, nil
+}
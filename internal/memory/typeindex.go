@@ -0,0 +1,219 @@
+package memory
+
+import (
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// typeIndex 是按事件类型组织的在线事件 ID 索引：下标为 typeTable 分配的编号，每个类型一个升序的 ID 列表，
+// 覆盖热数据、恢复事件与冷数据。事件进入在线存储（applyLocked）时加入；归档时不立即删除，只累加该类型的过期数，
+// 查询按 isEventIDValid 跳过过期项，过期项超过列表一半时整体压缩。
+// 除末尾追加外的修改（合并、压缩）总是分配新数组，因此 Checkpoint 只需拷贝 slice 头即可得到一致视图（需持有 s.mu）。
+type typeIndex struct {
+	ids   [][]uint64
+	stale []int          // 每个类型的列表中已不在线的 ID 数
+	dirty map[uint32]int // 有乱序追加的类型 -> 仍然有序的前缀长度，由 settle 合并
+}
+
+// grow 保证编号 t 有对应的列表。
+func (x *typeIndex) grow(t uint32) {
+	for uint32(len(x.ids)) <= t {
+		x.ids = append(x.ids, nil)
+		x.stale = append(x.stale, 0)
+	}
+}
+
+// add 把事件 id 加入类型 t 的列表。Emit、EmitBatch、Import 与 WAL 回放的 ID 总是最大，直接追加；
+// 归档恢复与重建索引时 ID 可能更小，先追加在末尾，由调用方在同一次持锁期间调用 settle 合并。
+func (x *typeIndex) add(t uint32, id uint64) {
+	x.grow(t)
+	l := x.ids[t]
+	if _, dirty := x.dirty[t]; !dirty && len(l) > 0 && l[len(l)-1] >= id {
+		if x.dirty == nil {
+			x.dirty = make(map[uint32]int)
+		}
+		x.dirty[t] = len(l)
+	}
+	x.ids[t] = append(l, id)
+}
+
+// settle 将乱序追加的 ID 排序后并入有序前缀。归档后尚未压缩掉的 ID 被恢复时会在列表中出现两次，只保留一个并扣减过期数。
+func (x *typeIndex) settle() {
+	for t, n := range x.dirty {
+		l := x.ids[t]
+		tail := slices.Clone(l[n:])
+		slices.Sort(tail)
+		merged, dups := mergeSorted(l[:n], tail)
+		x.ids[t] = merged
+		x.stale[t] -= dups
+	}
+	clear(x.dirty)
+}
+
+// remove 记录类型 t 的一个事件离开了在线存储，列表本身在 compact 时才更新。
+func (x *typeIndex) remove(t uint32) {
+	if int(t) < len(x.stale) {
+		x.stale[t]++
+	}
+}
+
+// compact 压缩过期项超过一半的列表，live 判断 ID 是否仍在线。归档移除整棵树之后调用，摊销成本与归档的事件数成正比。
+func (x *typeIndex) compact(live func(uint64) bool) {
+	for t, l := range x.ids {
+		if x.stale[t] == 0 || x.stale[t]*2 <= len(l) {
+			continue
+		}
+		kept := make([]uint64, 0, len(l)-x.stale[t])
+		for _, id := range l {
+			if live(id) {
+				kept = append(kept, id)
+			}
+		}
+		x.ids[t], x.stale[t] = kept, 0
+	}
+}
+
+// memBytes 估算索引占用的内存：每个 ID 8 字节，加上每个类型的切片头。
+func (x *typeIndex) memBytes() int64 {
+	n := int64(len(x.ids)) * 32
+	for _, l := range x.ids {
+		n += int64(len(l)) * 8
+	}
+	return n
+}
+
+// byName 返回以类型名为键的列表（共享底层数组，Checkpoint 写出时使用）。
+func (x *typeIndex) byName(types *typeTable) map[string][]uint64 {
+	out := make(map[string][]uint64, len(x.ids))
+	for t, l := range x.ids {
+		if len(l) > 0 {
+			out[types.names[t]] = l
+		}
+	}
+	return out
+}
+
+// matchTypes 返回 pattern 匹配的类型编号（升序）。pattern 为类型名、以 ".*" 结尾的点分前缀（"task.*" 匹配
+// "task.failed"、"task.retry.scheduled"，不匹配 "task" 本身），或匹配全部类型的 "*"；其他位置的 "*" 返回 *tree.QueryError。
+// 调用方保证 pattern 非空且已去除首尾空白。
+func matchTypes(types *typeTable, pattern string) ([]uint32, error) {
+	switch {
+	case pattern == "*":
+		out := make([]uint32, 0, len(types.names)-1)
+		for t := 1; t < len(types.names); t++ {
+			out = append(out, uint32(t))
+		}
+		return out, nil
+	case strings.HasSuffix(pattern, ".*"):
+		prefix := strings.TrimSuffix(pattern, "*")
+		if prefix == "." || strings.Contains(prefix, "*") {
+			return nil, &tree.QueryError{Reason: "bad type pattern " + pattern}
+		}
+		var out []uint32
+		for t := 1; t < len(types.names); t++ {
+			if strings.HasPrefix(types.names[t], prefix) {
+				out = append(out, uint32(t))
+			}
+		}
+		return out, nil
+	case strings.Contains(pattern, "*"):
+		return nil, &tree.QueryError{Reason: "bad type pattern " + pattern + ": only a trailing .* is supported"}
+	default:
+		if t, ok := types.ids[pattern]; ok {
+			return []uint32{t}, nil
+		}
+		return nil, nil
+	}
+}
+
+// loadTypeIndexLocked 载入快照中的类型索引，丢弃其中已不在线的 ID（需在冷数据层与热数据加载完成后调用）。
+func (s *Store) loadTypeIndexLocked(lists map[string][]uint64) {
+	s.byType = typeIndex{}
+	for _, name := range slices.Sorted(maps.Keys(lists)) {
+		t := s.types.intern(name)
+		s.byType.grow(t)
+		s.byType.ids[t] = slices.DeleteFunc(lists[name], func(id uint64) bool { return !s.isEventIDValid(id) })
+	}
+}
+
+// mergeIDs 按升序依次取出多个升序 ID 列表的元素。非空列表按首元素组成最小堆，每取一个 ID 的代价为 O(log k)，
+// 前缀展开成上万个词时也不随词数线性增长。不同类型的列表互不重复；前缀展开的多个词的列表之间有重复时，相同的 ID 连续取出，由调用方跳过。
+type mergeIDs [][]uint64
+
+// newMergeIDs 丢弃空列表并建堆，lists 被原地复用。
+func newMergeIDs(lists [][]uint64) mergeIDs {
+	m := mergeIDs(slices.DeleteFunc(lists, func(l []uint64) bool { return len(l) == 0 }))
+	for i := len(m)/2 - 1; i >= 0; i-- {
+		m.down(i)
+	}
+	return m
+}
+
+func (m *mergeIDs) next() (uint64, bool) {
+	h := *m
+	if len(h) == 0 {
+		return 0, false
+	}
+	id := h[0][0]
+	if h[0] = h[0][1:]; len(h[0]) == 0 {
+		n := len(h) - 1
+		h[0], h[n] = h[n], nil
+		h = h[:n]
+		*m = h
+	}
+	if len(h) > 0 {
+		h.down(0)
+	}
+	return id, true
+}
+
+// down 将位置 i 的列表按首元素下沉到堆中的正确位置。
+func (m mergeIDs) down(i int) {
+	for {
+		c := 2*i + 1
+		if c >= len(m) {
+			return
+		}
+		if r := c + 1; r < len(m) && m[r][0] < m[c][0] {
+			c = r
+		}
+		if m[i][0] <= m[c][0] {
+			return
+		}
+		m[i], m[c] = m[c], m[i]
+		i = c
+	}
+}
+
+// mergeSorted 将两个升序列表合并到新分配的数组中，两边都有的 ID 只保留一个，返回合并结果与重复的个数。
+func mergeSorted(head, tail []uint64) ([]uint64, int) {
+	merged := make([]uint64, 0, len(head)+len(tail))
+	dups := 0
+	for len(head) > 0 || len(tail) > 0 {
+		switch {
+		case len(tail) == 0 || len(head) > 0 && head[0] < tail[0]:
+			merged = append(merged, head[0])
+			head = head[1:]
+		case len(head) == 0 || tail[0] < head[0]:
+			merged = append(merged, tail[0])
+			tail = tail[1:]
+		default:
+			merged = append(merged, head[0])
+			head, tail = head[1:], tail[1:]
+			dups++
+		}
+	}
+	return merged, dups
+}
+
+// after 返回列表中大于 id 的部分。
+func after(l []uint64, id uint64) []uint64 {
+	i, found := slices.BinarySearch(l, id)
+	if found {
+		i++
+	}
+	return l[i:]
+}
@@ -0,0 +1,141 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// indexStages 依次执行会改变索引的操作，每一步之后调用 check：写入后、归档 archive 中的树后、写快照使旧事件降冷后、
+// 从快照重新打开后、恢复这些树后、从 WAL 回放重新打开后。返回最后打开的 Store。
+func indexStages(t *testing.T, opts Options, s *Store, archive []uint64, check func(s *Store, stage string)) *Store {
+	t.Helper()
+	check(s, "after emit")
+	for _, root := range archive {
+		if _, err := s.Archive(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(s, "after archive")
+	if _, err := s.Checkpoint(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Snapshot().ColdEvents == 0 {
+		t.Fatal("nothing was demoted")
+	}
+	check(s, "after demotion")
+	s.Close()
+	s = mustOpen(t, opts)
+	check(s, "after loading a checkpoint")
+	for _, root := range archive {
+		if _, err := s.Rehydrate(root); err != nil {
+			t.Fatal(err)
+		}
+	}
+	check(s, "after rehydrate")
+	s.Close()
+	s = mustOpen(t, opts)
+	check(s, "after replaying the rehydrate")
+	if rep, err := s.Verify(); err != nil || !rep.OK {
+		t.Fatalf("verify: %+v, %v", rep, err)
+	}
+	return s
+}
+
+// liveEvents 按 ID 升序返回所有在线事件中满足 keep 的事件 ID。
+func liveEvents(s *Store, keep func(tree.Event) bool) []uint64 {
+	var ids []uint64
+	for id := uint64(1); id <= s.Snapshot().NextEventID; id++ {
+		if ev, ok := s.Get(id); ok && keep(ev) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// TestQueryByType 检查类型名、点分前缀与 "*" 的查询在各种每页条数下翻页得到的事件与逐个读取的结果相同；
+// 归档两棵树（失效 ID 超过一半而被压缩）、降冷、重新打开与恢复之后，以及失效 ID 未压缩时恢复同一棵树之后仍然如此。
+func TestQueryByType(t *testing.T) {
+	types := []string{"task.created", "task.failed", "task.retry.failed", "taskx", "job.done"}
+	opts := Options{DataDir: t.TempDir(), Sync: SyncNever, HotWindow: 100}
+	s := mustOpen(t, opts)
+	var roots []uint64
+	for range 3 {
+		roots = append(roots, mustEmit(t, s, "run", ""))
+	}
+	last := slices.Clone(roots)
+	for i := range 3 * 80 {
+		tr := i % 3
+		last[tr] = mustEmit(t, s, types[i/3%len(types)], fmt.Sprintf(`{"i":%d}`, i), last[tr])
+	}
+
+	patterns := []struct {
+		pattern string
+		match   func(typ string) bool
+	}{
+		{"task.failed", func(typ string) bool { return typ == "task.failed" }},
+		{" task.failed ", func(typ string) bool { return typ == "task.failed" }},
+		{"task.*", func(typ string) bool { return strings.HasPrefix(typ, "task.") }},
+		{"task.retry.*", func(typ string) bool { return typ == "task.retry.failed" }},
+		{"*", func(string) bool { return true }},
+		{"run", func(typ string) bool { return typ == "run" }},
+		{"task", func(string) bool { return false }},
+		{"unknown.*", func(string) bool { return false }},
+	}
+	staleIDs := func(s *Store) int {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		n := 0
+		for _, c := range s.byType.stale {
+			n += c
+		}
+		return n
+	}
+	check := func(s *Store, stage string) {
+		t.Helper()
+		for _, p := range patterns {
+			want := liveEvents(s, func(ev tree.Event) bool { return p.match(ev.Type) })
+			for _, limit := range []int{1, 7, 0, 2000} {
+				got := queryIDs(t, s, tree.EventQuery{Type: p.pattern, Limit: limit})
+				if !slices.Equal(got, want) {
+					t.Fatalf("%s: type %q with limit %d = %d events %v, want %d events %v",
+						stage, p.pattern, limit, len(got), got, len(want), want)
+				}
+			}
+		}
+	}
+	s = indexStages(t, opts, s, roots[:2], func(s *Store, stage string) {
+		t.Helper()
+		check(s, stage)
+		if n := staleIDs(s); n != 0 {
+			t.Fatalf("%s: %d stale ids left in the type index", stage, n)
+		}
+	})
+
+	// 只归档一棵树时失效 ID 不到一半，留在列表中；随即恢复，重复的 ID 合并为一个
+	if _, err := s.Archive(roots[2]); err != nil {
+		t.Fatal(err)
+	}
+	if staleIDs(s) == 0 {
+		t.Fatal("archiving one tree compacted the type index")
+	}
+	check(s, "with stale ids")
+	if _, err := s.Rehydrate(roots[2]); err != nil {
+		t.Fatal(err)
+	}
+	if n := staleIDs(s); n != 0 {
+		t.Fatalf("%d stale ids left after rehydrating them", n)
+	}
+	check(s, "after rehydrating stale ids")
+
+	for _, pattern := range []string{"task*", "*.failed", "task.*.failed", ".*", "t*.*"} {
+		var qe *tree.QueryError
+		if _, err := s.QueryEvents(tree.EventQuery{Type: pattern}); !errors.As(err, &qe) {
+			t.Errorf("type %q: err = %v, want *tree.QueryError", pattern, err)
+		}
+	}
+}
@@ -0,0 +1,652 @@
+package memory
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// maxVerifyViolations 是报告中最多列出的违规数，超出部分只计数。
+const maxVerifyViolations = 1000
+
+// verifier 收集一次检查中发现的违规与警告。
+type verifier struct {
+	rep tree.VerifyReport
+}
+
+// violation 记录一条违规。
+func (v *verifier) violation(check string, id uint64, file, format string, args ...any) {
+	if len(v.rep.Violations) >= maxVerifyViolations {
+		v.rep.Omitted++
+		return
+	}
+	v.rep.Violations = append(v.rep.Violations, tree.Violation{Check: check, ID: id, File: file, Detail: fmt.Sprintf(format, args...)})
+}
+
+// warning 记录一条警告：下次 Open 会自动处理，或不影响数据正确性。
+func (v *verifier) warning(check string, id uint64, file, format string, args ...any) {
+	if len(v.rep.Warnings) >= maxVerifyViolations {
+		return
+	}
+	v.rep.Warnings = append(v.rep.Warnings, tree.Violation{Check: check, ID: id, File: file, Detail: fmt.Sprintf(format, args...)})
+}
+
+// report 返回最终报告。
+func (v *verifier) report() tree.VerifyReport {
+	rep := v.rep
+	rep.OK = len(rep.Violations) == 0 && rep.Omitted == 0
+	if rep.Violations == nil {
+		rep.Violations = []tree.Violation{}
+	}
+	return rep
+}
+
+// Verify 检查内存 DAG 的不变量；持久化 Store 还会校验数据目录中每个文件的记录校验和，以及存根与归档文件是否一致。
+// 不变量检查期间写入被阻塞到检查结束：纯内存 Store 持有 s.mu 的读锁；持久化 Store 关闭提交闸门，
+// 写入在闸门处等待而不占用 s.mu，冷事件读盘时释放读锁，读取不会排在检查之后。
+func (s *Store) Verify() (tree.VerifyReport, error) {
+	var v verifier
+	if s.wal == nil {
+		s.mu.RLock()
+		s.verifyDAGLocked(&v)
+		s.mu.RUnlock()
+		return v.report(), nil
+	}
+
+	// 与快照、降冷、归档串行，检查期间不会有文件被创建或删除
+	s.ckptMu.Lock()
+	defer s.ckptMu.Unlock()
+
+	if err := verifyLogFiles(s.opts.DataDir, &v); err != nil {
+		return tree.VerifyReport{}, err
+	}
+	if err := s.verifyPersisted(&v); err != nil {
+		return tree.VerifyReport{}, err
+	}
+	return v.report(), nil
+}
+
+// Fsck 离线检查数据目录：只读地加载快照并回放 WAL，然后执行与 Verify 相同的检查，不会修改任何文件。
+// 数据目录无法恢复（例如 WAL 中间的记录损坏）时，报告中包含 replay 违规以及能完成的文件检查。
+func Fsck(dir string) (tree.VerifyReport, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return tree.VerifyReport{}, err
+	}
+
+	var v verifier
+	if err := verifyLogFiles(dir, &v); err != nil {
+		return tree.VerifyReport{}, err
+	}
+
+	s := NewStore()
+	s.opts = Options{DataDir: dir}
+	if _, _, err := s.recover(false); err != nil {
+		v.violation("replay", 0, "", "%v", err)
+		return v.report(), nil
+	}
+	defer s.cold.close()
+
+	if err := s.verifyPersisted(&v); err != nil {
+		return tree.VerifyReport{}, err
+	}
+	return v.report(), nil
+}
+
+// verifyPersisted 检查内存 DAG 的不变量，以及它引用的冷数据段与归档文件（需持有 ckptMu 或在 Fsck 中单线程调用）。
+// ckptMu 挡住归档、恢复、降冷与字段索引的变化，提交闸门挡住写入，DAG 在检查期间不变。
+func (s *Store) verifyPersisted(v *verifier) error {
+	s.commitGate.Lock()
+	s.mu.RLock()
+	s.verifyDAGLocked(v)
+	segs := s.cold.metas()
+	stubs := make([]tree.ArchiveStub, 0, len(s.archived))
+	for _, a := range s.archived {
+		stubs = append(stubs, a.stub)
+	}
+	s.mu.RUnlock()
+	s.commitGate.Unlock()
+
+	if err := verifyColdSegments(s.opts.DataDir, segs, v); err != nil {
+		return err
+	}
+	return verifyArchives(s.opts.DataDir, stubs, v)
+}
+
+// verifyDAGLocked 检查 events、children、roots、heads 之间的一致性（需持有 s.mu 的读锁；有冷数据层时还需持有
+// ckptMu 与提交闸门，冷事件读盘时释放读锁）：
+//   - 每个事件的父事件都存在、互不重复、ID 小于自身，且 children[p] 列出了该事件；
+//   - children[p] 中的每个子事件都存在且其 Parents 含有 p，列表内不重复；
+//   - roots 恰好是没有父事件的事件，heads 恰好是没有子事件的事件；
+//   - hotCount、在线事件数、nextID 与实际内容一致，存根指向在线的根事件。
+func (s *Store) verifyDAGLocked(v *verifier) {
+	// 读不出的冷事件只在第一遍遍历时报告，并仍计入在线事件数，避免派生出重复的计数违规
+	coldErrs, reportCold := 0, true
+	lookup := func(id uint64) (tree.Event, bool) {
+		if _, revived := s.revived[id]; id >= s.hotBase || revived || s.cold == nil {
+			return s.lookupLocked(id)
+		}
+		// DAG 在检查期间不变（见 verifyPersisted），读盘时不必持锁
+		s.mu.RUnlock()
+		ev, ok, err := s.cold.get(id)
+		s.mu.RLock()
+		if err != nil {
+			log.Printf("verify: read cold event %d: %v", id, err)
+		}
+		return ev, ok && err == nil
+	}
+	forEachLive := func(fn func(ev tree.Event)) {
+		for i := range s.events.len() {
+			if ev, ok := s.events.get(i); ok {
+				fn(ev)
+			}
+		}
+		for _, id := range slices.Sorted(maps.Keys(s.revived)) {
+			fn(s.revived[id])
+		}
+		if s.cold == nil {
+			return
+		}
+		for _, m := range s.cold.metas() {
+			for id := m.first; id <= m.last; id++ {
+				if !s.cold.has(id) {
+					continue
+				}
+				ev, ok := lookup(id)
+				if !ok {
+					if reportCold {
+						v.violation("cold", id, filepath.Base(coldSegmentPath(s.opts.DataDir, m)), "event marked present but cannot be read")
+						coldErrs++
+					}
+					continue
+				}
+				fn(ev)
+			}
+		}
+	}
+
+	// 槽位与 ID 对应关系
+	hot := 0
+	for i := range s.events.len() {
+		ev, ok := s.events.get(i)
+		if !ok {
+			continue
+		}
+		hot++
+		if want := s.hotBase + uint64(i); ev.ID != want {
+			v.violation("event.id", want, "", "slot holds event %d", ev.ID)
+		}
+	}
+	if hot != s.hotCount {
+		v.violation("event.count", 0, "", "hotCount=%d, hot slots hold %d events", s.hotCount, hot)
+	}
+	for id, ev := range s.revived {
+		if ev.ID != id || id >= s.hotBase {
+			v.violation("event.id", id, "", "revived entry holds event %d (hotBase=%d)", ev.ID, s.hotBase)
+		}
+	}
+
+	// 内存中 payload 的字节统计与去重表引用数
+	var (
+		payloadRaw, payloadStored, payloadDedup int64
+		payloadShared                           int
+		refs                                    = make(map[payloadKey]int, len(s.payloads))
+	)
+	countPayload := func(ev tree.Event) {
+		raw, stored := payloadSizes(ev.Payload)
+		payloadRaw += int64(raw)
+		if len(ev.Payload) < payloadDedupMin {
+			payloadStored += int64(stored)
+			return
+		}
+		key := payloadKey(sha256.Sum256(ev.Payload))
+		if refs[key] == 0 {
+			payloadStored += int64(stored)
+		} else {
+			payloadDedup += int64(stored)
+		}
+		refs[key]++
+		payloadShared++
+	}
+	var eventBytes int64
+	for i := range s.events.len() {
+		if ev, ok := s.events.get(i); ok {
+			countPayload(ev)
+			eventBytes += s.hotMemSize(ev)
+		}
+	}
+	for _, ev := range s.revived {
+		countPayload(ev)
+		eventBytes += eventMemSize(ev)
+	}
+	if eventBytes != s.eventBytes {
+		v.violation("memory.count", 0, "", "store reports %d event bytes in memory, found %d", s.eventBytes, eventBytes)
+	}
+	if payloadRaw != s.payloadRaw || payloadStored != s.payloadStored || payloadDedup != s.payloadDedup || payloadShared != s.payloadShared {
+		v.violation("payload.count", 0, "", "store reports %d/%d/%d raw/stored/deduplicated payload bytes and %d shared refs, found %d/%d/%d and %d",
+			s.payloadRaw, s.payloadStored, s.payloadDedup, s.payloadShared, payloadRaw, payloadStored, payloadDedup, payloadShared)
+	}
+	for _, key := range slices.SortedFunc(maps.Keys(s.payloads), func(a, b payloadKey) int { return bytes.Compare(a[:], b[:]) }) {
+		if sp := s.payloads[key]; sp.refs != refs[key] {
+			v.violation("payload.refs", 0, "", "shared payload %x has %d refs, %d events use it", key[:8], sp.refs, refs[key])
+		}
+	}
+	if len(refs) != len(s.payloads) {
+		v.violation("payload.refs", 0, "", "dedup table holds %d payloads, events use %d", len(s.payloads), len(refs))
+	}
+
+	// 事件 -> 父事件方向
+	var live, edges int
+	var maxID uint64
+	recount := newDAGStats()
+	fieldEvents := make(map[*fieldIndex]int, len(s.fields))
+	textPostings := 0
+	forEachLive(func(ev tree.Event) {
+		live++
+		maxID = max(maxID, ev.ID)
+		recount.addEvent(ev)
+		for i, p := range ev.Parents {
+			switch {
+			case p == 0 || p >= ev.ID:
+				v.violation("event.parent", ev.ID, "", "parent %d is not below the event id", p)
+			case slices.Contains(ev.Parents[:i], p):
+				v.violation("event.parent", ev.ID, "", "duplicate parent %d", p)
+			case !s.isEventIDValid(p):
+				v.violation("event.parent", ev.ID, "", "parent %d not found", p)
+			default:
+				edges++
+				if s.reach.has(ev.ID) && s.reach.has(p) && !s.reach.reaches(p, ev.ID) {
+					v.violation("reach", ev.ID, "", "index does not show parent %d as an ancestor", p)
+				}
+			}
+		}
+		if !s.reach.has(ev.ID) {
+			v.violation("reach", ev.ID, "", "event has no reachability label")
+		}
+		if t, ok := s.types.ids[ev.Type]; !ok || int(t) >= len(s.byType.ids) {
+			v.violation("types", ev.ID, "", "type %q is not indexed", ev.Type)
+		} else if _, found := slices.BinarySearch(s.byType.ids[t], ev.ID); !found {
+			v.violation("types", ev.ID, "", "event missing from the %q index", ev.Type)
+		}
+		if b := int(ev.ID / timeBlockIDs); !s.byTime.overlaps(b, ev.TimeUnixNano, ev.TimeUnixNano+1) {
+			v.violation("times", ev.ID, "", "timestamp %d outside its block range", ev.TimeUnixNano)
+		}
+		s.forEachFieldValue(ev, func(x *fieldIndex, val string) {
+			fieldEvents[x]++
+			if _, found := slices.BinarySearch(x.lists[val], ev.ID); !found {
+				v.violation("fields", ev.ID, "", "event missing from the %q index under %q", x.field, val)
+			}
+		})
+		if s.text != nil && ev.Message != "" {
+			for _, t := range distinctTerms(ev.Message) {
+				textPostings++
+				if _, found := slices.BinarySearch(s.text.lists[t], ev.ID); !found {
+					v.violation("text", ev.ID, "", "event missing from the full-text index under %q", t)
+				}
+			}
+		}
+		if _, ok := s.roots[ev.ID]; ok != (len(ev.Parents) == 0) {
+			v.violation("roots", ev.ID, "", "in roots=%t but has %d parents", ok, len(ev.Parents))
+		}
+		if _, ok := s.heads[ev.ID]; ok != (len(s.children[ev.ID]) == 0) {
+			v.violation("heads", ev.ID, "", "in heads=%t but has %d children", ok, len(s.children[ev.ID]))
+		}
+	})
+	live += coldErrs
+	reportCold = false
+
+	// 父事件 -> 子事件方向
+	childEdges := 0
+	for _, p := range slices.Sorted(maps.Keys(s.children)) {
+		cs := s.children[p]
+		if !s.isEventIDValid(p) {
+			v.violation("children.orphan", p, "", "children entry for missing event lists %d children", len(cs))
+			continue
+		}
+		seen := make(map[uint64]struct{}, len(cs))
+		for _, c := range cs {
+			if _, dup := seen[c]; dup {
+				v.violation("children.duplicate", p, "", "child %d listed more than once", c)
+				continue
+			}
+			seen[c] = struct{}{}
+			ev, ok := lookup(c)
+			if !ok {
+				v.violation("children.orphan", p, "", "child %d not found", c)
+				continue
+			}
+			if !slices.Contains(ev.Parents, p) {
+				v.violation("children.orphan", p, "", "child %d does not list %d as a parent", c, p)
+				continue
+			}
+			childEdges++
+		}
+	}
+	// 两个方向的边数不一致时，逐条定位 children 中缺失的边（只在出错时付出这次额外扫描）
+	if childEdges != edges {
+		forEachLive(func(ev tree.Event) {
+			for _, p := range ev.Parents {
+				if s.isEventIDValid(p) && !slices.Contains(s.children[p], ev.ID) {
+					v.violation("children.missing", ev.ID, "", "children[%d] does not list %d", p, ev.ID)
+				}
+			}
+		})
+	}
+
+	for _, id := range slices.Sorted(maps.Keys(s.roots)) {
+		if !s.isEventIDValid(id) {
+			v.violation("roots", id, "", "root is not a live event")
+		}
+	}
+	for _, id := range slices.Sorted(maps.Keys(s.heads)) {
+		if !s.isEventIDValid(id) {
+			v.violation("heads", id, "", "head is not a live event")
+		}
+	}
+
+	if n := s.liveEventsLocked(); n != live {
+		v.violation("event.count", 0, "", "store reports %d live events, found %d", n, live)
+	}
+	// 增量统计与重新计算的结果必须一致（读不出的冷事件不计入重新计算，此时 cold 检查已报告）
+	recount.countEdges(s.children)
+	if coldErrs == 0 && (recount.payloadBytes != s.stats.payloadBytes || !maps.Equal(recount.types, s.stats.types)) {
+		v.violation("stats", 0, "", "store reports %d payload bytes over %d types, found %d over %d types",
+			s.stats.payloadBytes, len(s.stats.types), recount.payloadBytes, len(recount.types))
+	}
+	if recount.edges != s.stats.edges || recount.maxFanout != s.stats.maxFanout || !maps.Equal(recount.fanout, s.stats.fanout) {
+		v.violation("stats", 0, "", "store reports %d edges with max fan-out %d, found %d and %d",
+			s.stats.edges, s.stats.maxFanout, recount.edges, recount.maxFanout)
+	}
+	// 类型索引：列表严格升序，其中不在线的 ID 数等于过期计数，在线的 ID 数等于该类型的事件数
+	if len(s.byType.dirty) > 0 {
+		v.violation("types", 0, "", "%d type lists have unsettled entries", len(s.byType.dirty))
+	}
+	for t, l := range s.byType.ids {
+		name := s.types.names[t]
+		stale := 0
+		for i, id := range l {
+			if i > 0 && id <= l[i-1] {
+				v.violation("types", id, "", "%q index is not strictly increasing", name)
+			}
+			if !s.isEventIDValid(id) {
+				stale++
+			}
+		}
+		if coldErrs == 0 && (stale != s.byType.stale[t] || len(l)-stale != recount.types[name]) {
+			v.violation("types", 0, "", "%q index holds %d live and %d stale ids (stale count %d), type has %d events",
+				name, len(l)-stale, stale, s.byType.stale[t], recount.types[name])
+		}
+	}
+	// 字段索引与全文索引：同上，过期计数与 ID 总数按整个索引比对
+	for _, field := range slices.Sorted(maps.Keys(s.fields)) {
+		x := s.fields[field]
+		stale := s.verifyPostingsLocked(v, "fields", fmt.Sprintf("%q index", field), x.postings)
+		if coldErrs == 0 && (stale != x.stale || x.n-stale != fieldEvents[x]) {
+			v.violation("fields", 0, "", "%q index holds %d live and %d stale ids (stale count %d), %d events carry the field",
+				field, x.n-stale, stale, x.stale, fieldEvents[x])
+		}
+	}
+	if s.text != nil {
+		stale := s.verifyPostingsLocked(v, "text", "full-text index", s.text.postings)
+		if n := len(s.text.terms) + len(s.text.recent); n != len(s.text.lists) {
+			v.violation("text", 0, "", "full-text dictionary holds %d words, index has %d", n, len(s.text.lists))
+		}
+		if coldErrs == 0 && (stale != s.text.stale || s.text.n-stale != textPostings) {
+			v.violation("text", 0, "", "full-text index holds %d live and %d stale ids (stale count %d), events have %d distinct words",
+				s.text.n-stale, stale, s.text.stale, textPostings)
+		}
+	}
+	nextID := atomic.LoadUint64(&s.nextID)
+	if maxID > nextID {
+		v.violation("next_id", maxID, "", "event id above next id %d", nextID)
+	}
+	for _, root := range slices.Sorted(maps.Keys(s.archived)) {
+		a := s.archived[root]
+		if _, ok := s.roots[root]; !ok || !s.isEventIDValid(root) {
+			v.violation("archive.stub", root, "", "stub does not point at a live root event")
+		}
+		if a.stub.LastEventID > nextID {
+			v.violation("archive.stub", root, "", "last event id %d above next id %d", a.stub.LastEventID, nextID)
+		}
+	}
+	v.rep.Events = live
+}
+
+// verifyPostingsLocked 检查倒排表没有未合并的乱序追加、每个列表严格升序且 ID 总数与计数一致，返回其中不在线的 ID 数。
+func (s *Store) verifyPostingsLocked(v *verifier, check, name string, p *postings) int {
+	if len(p.dirty) > 0 {
+		v.violation(check, 0, "", "%s has %d unsettled lists", name, len(p.dirty))
+	}
+	total, stale := 0, 0
+	for key, l := range p.lists {
+		total += len(l)
+		for i, id := range l {
+			if i > 0 && id <= l[i-1] {
+				v.violation(check, id, "", "%s under %q is not strictly increasing", name, key)
+			}
+			if !s.isEventIDValid(id) {
+				stale++
+			}
+		}
+	}
+	if total != p.n {
+		v.violation(check, 0, "", "%s holds %d ids, count is %d", name, total, p.n)
+	}
+	return stale
+}
+
+// verifyLogFiles 校验 WAL 日志段与快照文件中每条记录的校验和与格式。只读，不依赖内存状态。
+// 最后一个日志段的残缺尾部是崩溃的正常结果（下次 Open 会截断），只记为警告。
+func verifyLogFiles(dir string, v *verifier) error {
+	seqs, err := listWALSegments(dir)
+	if err != nil {
+		return err
+	}
+	for i, seq := range seqs {
+		path := walSegmentPath(dir, seq)
+		name := filepath.Base(path)
+		v.rep.Files++
+		dict, imp := newPayloadDict(), newPayloadDict()
+		var parts partAssembler
+		good, err := readWALSegment(path, func(kind byte, body []byte) error {
+			return parts.feed(kind, body, func(kind byte, body []byte) error {
+				// 导入批次使用从 begin 记录开始的私有字典
+				switch kind {
+				case walRecordImportBegin:
+					imp = newPayloadDict()
+				case walRecordImportBatch:
+					return checkWALRecord(kind, body, imp)
+				}
+				return checkWALRecord(kind, body, dict)
+			})
+		})
+		switch {
+		case errors.Is(err, errTornRecord) && i == len(seqs)-1:
+			if fi, serr := os.Stat(path); serr == nil && fi.Size() > good {
+				v.warning("wal", 0, name, "torn tail at offset %d (%d bytes), will be truncated on next open", good, fi.Size()-good)
+			}
+		case err != nil:
+			v.violation("wal", 0, name, "at offset %d: %v", good, err)
+		}
+	}
+
+	ckpts, err := listCheckpoints(dir)
+	if err != nil {
+		return err
+	}
+	for _, seq := range ckpts {
+		path := checkpointPath(dir, seq)
+		v.rep.Files++
+		if _, _, err := readCheckpoint(path); err != nil {
+			v.violation("checkpoint", 0, filepath.Base(path), "%v", err)
+		}
+	}
+	return nil
+}
+
+// checkWALRecord 以所在日志段的 payload 字典校验一条 WAL 记录的类型与 body 能否解码。
+func checkWALRecord(kind byte, body []byte, dict *payloadDict) error {
+	switch kind {
+	case walRecordEvent:
+		_, _, err := decodeEvent(body, dict)
+		return err
+	case walRecordArchive:
+		d := decoder{buf: body}
+		d.uvarint()
+		d.varint()
+		d.uvarint()
+		d.ids()
+		return d.err
+	case walRecordRehydrate:
+		d := decoder{buf: body}
+		d.uvarint()
+		n := d.uvarint()
+		for i := uint64(0); i < n && d.err == nil; i++ {
+			if b := d.bytes(); d.err == nil {
+				if _, _, err := decodeEvent(b, dict); err != nil {
+					return err
+				}
+			}
+		}
+		return d.err
+	case walRecordBatch, walRecordImportBatch:
+		_, err := decodeEvents(body, dict)
+		return err
+	case walRecordImportBegin, walRecordImportCommit, walRecordImportAbort:
+		d := decoder{buf: body}
+		for d.off < len(body) && d.err == nil {
+			d.uvarint()
+		}
+		return d.err
+	case walRecordFieldIndex, walRecordFieldDrop:
+		d := decoder{buf: body}
+		_, err := parseFieldPath(string(d.bytes()))
+		if d.err != nil {
+			return d.err
+		}
+		return err
+	default:
+		return fmt.Errorf("unknown wal record kind %d", kind)
+	}
+}
+
+// verifyColdSegments 完整读取被引用的每个冷数据段，校验记录校验和、ID 顺序、存在性位图与事件数；
+// 未被引用的数据段记为警告（下次 Open 会删除）。
+func verifyColdSegments(dir string, segs []coldSegMeta, v *verifier) error {
+	want := make(map[string]struct{}, len(segs))
+	for _, m := range segs {
+		name := filepath.Base(coldSegmentPath(dir, m))
+		want[name] = struct{}{}
+		v.rep.Files++
+		if err := verifyColdSegment(dir, m); err != nil {
+			v.violation("cold", 0, name, "%v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, coldFilePrefix) || !strings.HasSuffix(name, coldFileSuffix) {
+			continue
+		}
+		if _, ok := want[name]; !ok {
+			v.warning("cold", 0, name, "segment not referenced by any checkpoint")
+		}
+	}
+	return nil
+}
+
+// verifyColdSegment 校验单个冷数据段：逐块解码（payload 字典按块重置），块之间首尾相接并覆盖全部事件记录。
+func verifyColdSegment(dir string, m coldSegMeta) error {
+	seg, presence, err := openColdSegment(dir, m)
+	if err != nil {
+		return err
+	}
+	defer seg.f.Close()
+
+	if seg.index[0].off != int64(len(coldMagic)) {
+		return fmt.Errorf("index starts at offset %d", seg.index[0].off)
+	}
+	var (
+		n    int
+		prev uint64
+	)
+	for block, e := range seg.index {
+		events, err := seg.readBlock(block)
+		if err != nil {
+			return err
+		}
+		if len(events) == 0 || events[0].ID != e.id {
+			return fmt.Errorf("block %d does not start at event %d", block, e.id)
+		}
+		for _, ev := range events {
+			if ev.ID < m.first || ev.ID > m.last || ev.ID <= prev {
+				return fmt.Errorf("event %d out of order", ev.ID)
+			}
+			if rel := ev.ID - m.first; presence[rel/8]&(1<<(rel%8)) == 0 {
+				return fmt.Errorf("event %d missing from presence bitmap", ev.ID)
+			}
+			prev = ev.ID
+			n++
+		}
+	}
+	if n != seg.count {
+		return fmt.Errorf("index says %d events, read %d", seg.count, n)
+	}
+	return nil
+}
+
+// verifyArchives 校验每个存根对应的归档文件存在且内容一致；没有存根的归档文件记为警告
+// （归档或恢复在写 WAL 前后崩溃时会留下这种文件）。
+func verifyArchives(dir string, stubs []tree.ArchiveStub, v *verifier) error {
+	want := make(map[string]struct{}, len(stubs))
+	for _, stub := range stubs {
+		path := archivePath(dir, stub.Root)
+		name := filepath.Join(archiveSubdir, filepath.Base(path))
+		want[name] = struct{}{}
+		v.rep.Files++
+		if _, err := readArchive(path, stub); err != nil {
+			v.violation("archive", stub.Root, name, "%v", err)
+		}
+	}
+
+	entries, err := os.ReadDir(filepath.Join(dir, archiveSubdir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := filepath.Join(archiveSubdir, e.Name())
+		if e.IsDir() || !strings.HasSuffix(name, archiveFileSuffix) {
+			continue
+		}
+		if _, ok := want[name]; ok {
+			continue
+		}
+		v.rep.Files++
+		root, _, err := readArchiveFile(filepath.Join(dir, name))
+		switch {
+		case err != nil:
+			v.violation("archive", 0, name, "%v", err)
+		case name != filepath.Join(archiveSubdir, filepath.Base(archivePath(dir, root))):
+			v.violation("archive", root, name, "file holds tree %d", root)
+		default:
+			v.warning("archive", root, name, "archive file has no stub")
+		}
+	}
+	return nil
+}
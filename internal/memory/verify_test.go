@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// checks 返回报告中的检查项名称（去重、排序）。
+func checks(vs []tree.Violation) []string {
+	var out []string
+	for _, v := range vs {
+		if !slices.Contains(out, v.Check) {
+			out = append(out, v.Check)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// TestVerifyDAG 在内存 DAG 中制造各类不一致，检查 Verify 报告对应的检查项；未破坏时报告 OK。
+func TestVerifyDAG(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(s *Store, root, a, b, c uint64)
+		want    string
+	}{
+		{"clean", func(*Store, uint64, uint64, uint64, uint64) {}, ""},
+		{"child without the parent", func(s *Store, root, a, b, c uint64) { s.children[a] = append(s.children[a], b) }, "children.orphan"},
+		{"child listed twice", func(s *Store, root, a, b, c uint64) { s.children[a] = append(s.children[a], c) }, "children.duplicate"},
+		{"edge missing from children", func(s *Store, root, a, b, c uint64) { s.children[b] = nil }, "children.missing"},
+		{"children of a missing event", func(s *Store, root, a, b, c uint64) { s.children[c+10] = []uint64{c} }, "children.orphan"},
+		{"head dropped", func(s *Store, root, a, b, c uint64) { delete(s.heads, c) }, "heads"},
+		{"non-leaf head", func(s *Store, root, a, b, c uint64) { s.heads[a] = struct{}{} }, "heads"},
+		{"root dropped", func(s *Store, root, a, b, c uint64) { delete(s.roots, root) }, "roots"},
+		{"root with parents", func(s *Store, root, a, b, c uint64) { s.roots[c] = struct{}{} }, "roots"},
+		{"type index out of step", func(s *Store, root, a, b, c uint64) { s.byType.ids[s.types.ids["node"]] = nil }, "types"},
+		{"hot count", func(s *Store, root, a, b, c uint64) { s.hotCount++ }, "event.count"},
+		{"next id", func(s *Store, root, a, b, c uint64) { s.nextID = b }, "next_id"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStore()
+			root := mustEmit(t, s, "root", `{}`)
+			a := mustEmit(t, s, "node", `{}`, root)
+			b := mustEmit(t, s, "node", `{}`, root)
+			c := mustEmit(t, s, "node", `{}`, a, b)
+			s.mu.Lock()
+			tc.corrupt(s, root, a, b, c)
+			s.mu.Unlock()
+
+			rep, err := s.Verify()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Events != 4 && tc.want != "event.count" {
+				t.Fatalf("checked %d events, want 4", rep.Events)
+			}
+			if tc.want == "" {
+				if !rep.OK || len(rep.Violations) != 0 {
+					t.Fatalf("clean store: %+v", rep)
+				}
+				return
+			}
+			if rep.OK || !slices.Contains(checks(rep.Violations), tc.want) {
+				t.Fatalf("violations %v, want %q", rep.Violations, tc.want)
+			}
+		})
+	}
+}
+
+// TestFsck 损坏关闭后数据目录中的各类文件，检查 Fsck 报告对应的违规或警告：中间日志段的损坏是违规，
+// 最后一个日志段的残缺尾部与未被引用的冷数据段只是警告。
+func TestFsck(t *testing.T) {
+	// flip 翻转文件中间的一个字节
+	flip := func(t *testing.T, path string) {
+		t.Helper()
+		b, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b[len(b)/2] ^= 0xff
+		if err := os.WriteFile(path, b, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// segment 返回第 i 个 WAL 日志段（负数从末尾数起）
+	segment := func(t *testing.T, dir string, i int) string {
+		t.Helper()
+		seqs, err := listWALSegments(dir)
+		if err != nil || len(seqs) < 2 {
+			t.Fatalf("wal segments %v, %v: want at least two", seqs, err)
+		}
+		if i < 0 {
+			i += len(seqs)
+		}
+		return walSegmentPath(dir, seqs[i])
+	}
+	glob := func(t *testing.T, pattern string) string {
+		t.Helper()
+		m, err := filepath.Glob(pattern)
+		if err != nil || len(m) == 0 {
+			t.Fatalf("no file matches %s", pattern)
+		}
+		return m[0]
+	}
+
+	cases := []struct {
+		name             string
+		damage           func(t *testing.T, dir string)
+		violation, warns string
+	}{
+		{name: "clean", damage: func(*testing.T, string) {}},
+		{
+			name:      "corrupt record in an earlier wal segment",
+			damage:    func(t *testing.T, dir string) { flip(t, segment(t, dir, 0)) },
+			violation: "wal",
+		},
+		{
+			name: "torn tail of the last wal segment",
+			damage: func(t *testing.T, dir string) {
+				f, err := os.OpenFile(segment(t, dir, -1), os.O_APPEND|os.O_WRONLY, 0)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer f.Close()
+				if _, err := f.Write([]byte{1, 2, 3}); err != nil {
+					t.Fatal(err)
+				}
+			},
+			warns: "wal",
+		},
+		{
+			name:      "corrupt checkpoint",
+			damage:    func(t *testing.T, dir string) { flip(t, glob(t, filepath.Join(dir, "checkpoint-*"))) },
+			violation: "checkpoint",
+		},
+		{
+			name:      "corrupt cold segment",
+			damage:    func(t *testing.T, dir string) { flip(t, glob(t, filepath.Join(dir, coldFilePrefix+"*"))) },
+			violation: "cold",
+		},
+		{
+			name: "unreferenced cold segment",
+			damage: func(t *testing.T, dir string) {
+				if err := os.WriteFile(filepath.Join(dir, coldFilePrefix+"stray"+coldFileSuffix), nil, 0o644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			warns: "cold",
+		},
+		{
+			name: "missing archive file",
+			damage: func(t *testing.T, dir string) {
+				if err := os.Remove(glob(t, filepath.Join(dir, archiveSubdir, "*"))); err != nil {
+					t.Fatal(err)
+				}
+			},
+			violation: "archive",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			opts := Options{DataDir: t.TempDir(), Sync: SyncNever, HotWindow: 20}
+			s := mustOpen(t, opts)
+			_, roots := buildLayers(t, s, 2, 5, 4, nil)
+			if _, err := s.Archive(roots[0]); err != nil {
+				t.Fatal(err)
+			}
+			// 两次快照，两个日志段都被保留
+			for range 2 {
+				if _, err := s.Checkpoint(); err != nil {
+					t.Fatal(err)
+				}
+				buildLayers(t, s, 1, 2, 2, nil)
+			}
+			if err := s.Close(); err != nil {
+				t.Fatal(err)
+			}
+			tc.damage(t, opts.DataDir)
+
+			rep, err := Fsck(opts.DataDir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if rep.Files == 0 {
+				t.Fatal("no files checked")
+			}
+			if got := checks(rep.Violations); tc.violation == "" && len(got) != 0 || tc.violation != "" && !slices.Contains(got, tc.violation) {
+				t.Fatalf("violations %+v, want %q", rep.Violations, tc.violation)
+			}
+			if rep.OK != (tc.violation == "") {
+				t.Fatalf("ok = %v with violations %+v", rep.OK, rep.Violations)
+			}
+			if got := checks(rep.Warnings); tc.warns == "" && len(got) != 0 || tc.warns != "" && !slices.Contains(got, tc.warns) {
+				t.Fatalf("warnings %+v, want %q", rep.Warnings, tc.warns)
+			}
+		})
+	}
+}
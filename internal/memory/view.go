@@ -0,0 +1,78 @@
+package memory
+
+import (
+	"slices"
+	"sync/atomic"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// readYield 是长读取每次持有读锁时最多访问的节点数，之后短暂释放读锁，让等待中的写入先行。
+const readYield = 256
+
+// readView 是一次长读取（后代树、溯源树、祖先查询）的读视图。
+// 它持有 s.mu 的读锁，但每访问 readYield 个节点就释放一次，写入最多等待一个批次而不是整次遍历。
+// 视图只看 ID 不超过 upTo（打开视图时已提交的最大 ID）的事件：事件写入后不可变、children 只在末尾追加，
+// ID 在写锁内按提交顺序分配，因此释放锁期间新写入的事件不会混入结果。
+// 例外是遍历期间被归档的树，其后代会从结果中消失。
+type readView struct {
+	s     *Store
+	upTo  uint64
+	steps int
+}
+
+// openView 获取读锁并打开读视图，调用方必须在结束时调用 close。
+func (s *Store) openView() *readView {
+	s.mu.RLock()
+	return &readView{s: s, upTo: atomic.LoadUint64(&s.nextID)}
+}
+
+// openViewAt 获取读锁并打开截至 upTo 的读视图，用于续页沿用第一页的视图；upTo 不会超过当前已分配的最大 ID。
+func (s *Store) openViewAt(upTo uint64) *readView {
+	s.mu.RLock()
+	return &readView{s: s, upTo: min(upTo, atomic.LoadUint64(&s.nextID))}
+}
+
+// close 释放读锁。
+func (v *readView) close() {
+	v.s.mu.RUnlock()
+}
+
+// step 记录访问了一个节点，每 readYield 个节点释放并重新获取一次读锁。
+// 调用方不能跨越 step 持有指向 Store 内部结构（events、children 等）的引用。
+func (v *readView) step() {
+	v.steps++
+	if v.steps%readYield == 0 {
+		v.s.mu.RUnlock()
+		v.s.mu.RLock()
+	}
+}
+
+// unlocked 暂时释放读锁执行 fn，之后重新获取读锁，用于在锁外输出已拷贝的结果。
+// 与 step 相同，调用方不能跨越 unlocked 持有指向 Store 内部结构的引用。
+func (v *readView) unlocked(fn func() error) error {
+	v.s.mu.RUnlock()
+	defer v.s.mu.RLock()
+	return fn()
+}
+
+// has 报告 id 是否是视图内的在线事件。
+func (v *readView) has(id uint64) bool {
+	return id != 0 && id <= v.upTo && v.s.isEventIDValid(id)
+}
+
+// event 读取视图内的事件，payload 为存储形式。
+func (v *readView) event(id uint64) (tree.Event, bool) {
+	if id > v.upTo {
+		return tree.Event{}, false
+	}
+	return v.s.eventLocked(id)
+}
+
+// children 返回 id 在视图内的直接子事件（升序拷贝）。
+func (v *readView) children(id uint64) []uint64 {
+	out := sortedChildIDs(v.s.children[id])
+	// 视图之后写入的子事件 ID 更大，排序后位于末尾
+	end, _ := slices.BinarySearch(out, v.upTo+1)
+	return out[:end]
+}
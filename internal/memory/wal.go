@@ -0,0 +1,438 @@
+package memory
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// WAL 记录类型。每条记录的首字节标识其类型，便于后续扩展新的记录种类。
+const (
+	walRecordEvent      byte = 1 // 一个完整的 tree.Event（appendEvent 编码，payload 按日志段字典去重）
+	walRecordArchive    byte = 2 // uvarint(root) | varint(archivedAt) | uvarint(lastEventID) | appendIDs(后代 ID)
+	walRecordRehydrate  byte = 3 // uvarint(root) | uvarint(n) | bytes(appendEvent)...，与事件记录共用日志段字典
+	walRecordBatch      byte = 4 // uvarint(n) | bytes(appendEvent)...，EmitBatch 整批写入的事件
+	walRecordFieldIndex byte = 5 // bytes(field)，建立 payload 字段索引，回放时遍历在线事件回填
+	walRecordFieldDrop  byte = 6 // bytes(field)，删除 payload 字段索引
+	walRecordPart       byte = 7 // kind(1B) | uvarint(seq) | last(1B) | 数据：超过单条记录上限的逻辑记录拆成的片段，见 appendLarge
+
+	// Import 的记录：begin 与 commit 之间的导入批次只在读到 commit 时生效，见 export.go
+	walRecordImportBegin  byte = 8  // uvarint(firstID)
+	walRecordImportBatch  byte = 9  // 同 walRecordBatch，但 payload 按从 begin 开始的私有字典去重
+	walRecordImportCommit byte = 10 // uvarint(events) | uvarint(lastID)
+	walRecordImportAbort  byte = 11 // 空 body，放弃进行中的导入
+)
+
+// walPartSize 是 appendLarge 拆分逻辑记录时每个片段携带的数据字节数。
+const walPartSize = 16 << 20
+
+const (
+	walFilePrefix = "wal-"
+	walFileSuffix = ".log"
+)
+
+// wal 是追加式预写日志（Write-Ahead Log），记录格式见 record.go。
+// 写入有两条路径：Emit 与 EmitBatch 在持有 s.mu 时经 stage 编码并暂存记录，释放 s.mu 后经 commit 以组提交落盘；
+// 其余记录经 write 直接写出。io 串行化文件操作，mu 保护字典与暂存区，加锁顺序为 s.mu → io → mu。
+type wal struct {
+	io     sync.Mutex
+	mu     sync.Mutex
+	dir    string
+	seq    uint64
+	f      *os.File // 持有 io 与 mu 时才会替换
+	policy SyncPolicy
+	dirty  bool  // 持有 io
+	size   int64 // 当前日志段已写入的字节数，写入失败时截断回这里（持有 io）
+	failed error // 写入失败且无法截断回写入前的长度时记录原因，之后的写入都返回错误（持有 io 与 mu 时设置）
+	buf    []byte
+	body   []byte
+	dict   *payloadDict // 当前日志段的 payload 字典，切段时重置
+
+	// 组提交：pend 是已暂存、尚未写出的记录，waiting 与其一一对应；flushing 表示有领头者正在写出一组记录
+	pend     []byte
+	spare    []byte
+	pendMark int // pend 中第一条记录登记字典序号之前的 mark
+	waiting  []*walCommit
+	flushing bool
+	cond     *sync.Cond // 基于 mu，组提交完成时广播
+}
+
+// walCommit 是一条经 stage 暂存、等待组提交的记录。
+type walCommit struct {
+	apply func(err error) // 领头者在持有 s.mu 时调用：err 为 nil 时发布写入，否则释放预留
+	err   error
+	done  bool
+}
+
+// walSegmentPath 返回序号为 seq 的日志段文件路径。
+func walSegmentPath(dir string, seq uint64) string {
+	return filepath.Join(dir, fmt.Sprintf("%s%016d%s", walFilePrefix, seq, walFileSuffix))
+}
+
+// listWALSegments 返回 dir 下所有日志段的序号（升序）。
+func listWALSegments(dir string) ([]uint64, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var seqs []uint64
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, walFilePrefix) || !strings.HasSuffix(name, walFileSuffix) {
+			continue
+		}
+		seq, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, walFilePrefix), walFileSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		seqs = append(seqs, seq)
+	}
+	slices.Sort(seqs)
+	return seqs, nil
+}
+
+// openWAL 以追加模式打开（或创建）序号为 seq 的日志段。dict 是回放该日志段时得到的 payload 字典，
+// 新写入的记录继续沿用其中的序号。
+func openWAL(dir string, seq uint64, policy SyncPolicy, dict *payloadDict) (*wal, error) {
+	f, err := os.OpenFile(walSegmentPath(dir, seq), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	w := &wal{dir: dir, seq: seq, f: f, size: fi.Size(), policy: policy, dict: dict.writer()}
+	w.cond = sync.NewCond(&w.mu)
+	return w, nil
+}
+
+// append 写入一条记录；SyncAlways 策略下写入后立即 fsync。
+func (w *wal) append(kind byte, body []byte) error {
+	return w.appendWith(kind, func(buf []byte, _ *payloadDict) []byte {
+		return append(buf, body...)
+	})
+}
+
+// appendWith 以 encode 生成记录 body 并写入，编码时持有 w.mu，保证字典序号与日志段中的记录顺序一致；
+// 写入或 fsync 失败、记录超过 recordMaxSize（回放时无法读回）时撤销本条记录登记的序号，已写出的字节被截断，
+// 调用方可以把同一个 ID 分配给下一条记录。
+func (w *wal) appendWith(kind byte, encode func(buf []byte, dict *payloadDict) []byte) error {
+	return w.write(kind, encode, false)
+}
+
+// appendLarge 与 appendWith 相同，但 body 超过单条记录上限时拆成按序编号的 walRecordPart 片段写入，
+// 回放时由 partAssembler 拼回。片段只在最后一片写完后才生效，写入中途失败或崩溃时已写出的片段在回放时被丢弃。
+func (w *wal) appendLarge(kind byte, encode func(buf []byte, dict *payloadDict) []byte) error {
+	return w.write(kind, encode, true)
+}
+
+// write 实现 appendWith 与 appendLarge；split 为 false 时拒绝超过上限的 body。
+// 编码在 mu 内完成，写出与 fsync 只持有 io，不阻塞并发的 stage。
+func (w *wal) write(kind byte, encode func(buf []byte, dict *payloadDict) []byte, split bool) error {
+	w.io.Lock()
+	defer w.io.Unlock()
+
+	w.mu.Lock()
+	if w.f == nil {
+		w.mu.Unlock()
+		return os.ErrClosed
+	}
+	if w.failed != nil {
+		w.mu.Unlock()
+		return w.failed
+	}
+	mark := w.dict.mark()
+	w.body = encode(w.body[:0], w.dict)
+	switch {
+	case len(w.body) <= maxRecordBody:
+		w.buf = appendRecord(w.buf[:0], kind, w.body)
+	case split:
+		w.buf = appendParts(w.buf[:0], kind, w.body)
+	default:
+		w.dict.rollback(mark)
+		w.mu.Unlock()
+		return fmt.Errorf("%w: %d bytes exceeds %d", errRecordTooLarge, len(w.body)+1, recordMaxSize)
+	}
+	// 登记了字典序号的记录（归档恢复）只在提交闸门关闭时写入，此时没有并发的 stage，失败时可以直接回滚
+	used := w.dict.mark() != mark
+	w.mu.Unlock()
+
+	err := w.flushLocked(w.buf)
+	if err != nil && used {
+		w.mu.Lock()
+		w.dict.rollback(mark)
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// flushLocked 把 buf 追加到日志段，SyncAlways 策略下随即 fsync（需持有 io）。
+// 写入或 fsync 失败时把日志段截断回写入前的长度：部分写出的字节若留在日志段中，回放时会成为中间的残缺记录
+// （其后已确认的记录被一并截掉），或者与下一条记录重复使用同一个 ID；因此截断失败时 WAL 进入失败状态，
+// 之后的写入全部返回错误，需要重启后由回放修复。
+func (w *wal) flushLocked(buf []byte) error {
+	if w.failed != nil {
+		return w.failed
+	}
+	err := func() error {
+		if _, err := w.f.Write(buf); err != nil {
+			return err
+		}
+		if w.policy == SyncAlways {
+			return w.f.Sync()
+		}
+		w.dirty = true
+		return nil
+	}()
+	if err == nil {
+		w.size += int64(len(buf))
+		return nil
+	}
+	if terr := w.f.Truncate(w.size); terr != nil {
+		w.mu.Lock()
+		w.failed = fmt.Errorf("wal: %s is unusable after a failed write (%v): truncate: %w", w.f.Name(), err, terr)
+		w.mu.Unlock()
+		return w.failed
+	}
+	return err
+}
+
+// stage 编码一条记录并放入待提交的 pend（需持有 s.mu）：字典序号与 pend 中的记录顺序即调用方分配 ID 的顺序。
+// 返回的 walCommit 交给 commit 等待落盘；apply 由写出该记录的领头者在持有 s.mu 时按暂存顺序调用。
+func (w *wal) stage(kind byte, encode func(buf []byte, dict *payloadDict) []byte, apply func(err error)) (*walCommit, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil, os.ErrClosed
+	}
+	if w.failed != nil {
+		return nil, w.failed
+	}
+	mark := w.dict.mark()
+	w.body = encode(w.body[:0], w.dict)
+	if len(w.body) > maxRecordBody {
+		w.dict.rollback(mark)
+		return nil, fmt.Errorf("%w: %d bytes exceeds %d", errRecordTooLarge, len(w.body)+1, recordMaxSize)
+	}
+	if len(w.waiting) == 0 {
+		w.pendMark = mark
+	}
+	w.pend = appendRecord(w.pend, kind, w.body)
+	c := &walCommit{apply: apply}
+	w.waiting = append(w.waiting, c)
+	return c, nil
+}
+
+// commit 等待 stage 暂存的记录落盘（调用方不持有 mu 所指的 s.mu），返回写出或 fsync 的错误。
+// 没有领头者时调用方成为领头者：取走目前暂存的全部记录，在锁外一次写出并 fsync，再持有 s.mu 按暂存顺序调用各记录的 apply。
+// 写出期间新暂存的记录组成下一组，由下一个领头者写出，因此 SyncAlways 下并发的写入共用一次 fsync。
+// 写出失败时，之后暂存的记录可能引用了本组登记的字典序号，也一并失败；日志段已截断回写出前的长度。
+func (w *wal) commit(c *walCommit, mu sync.Locker) error {
+	w.mu.Lock()
+	for !c.done && w.flushing {
+		w.cond.Wait()
+	}
+	if c.done {
+		w.mu.Unlock()
+		return c.err
+	}
+	w.flushing = true
+	buf, group, mark := w.pend, w.waiting, w.pendMark
+	w.pend, w.waiting = w.spare[:0], nil
+	w.mu.Unlock()
+
+	w.io.Lock()
+	err := w.flushLocked(buf)
+	w.io.Unlock()
+
+	mu.Lock()
+	w.mu.Lock()
+	if err != nil {
+		group = append(group, w.waiting...)
+		w.pend, w.waiting = w.pend[:0], nil
+		w.dict.rollback(mark)
+	}
+	for _, g := range group {
+		g.apply(err)
+	}
+	mu.Unlock()
+	for _, g := range group {
+		g.err, g.done = err, true
+	}
+	w.spare = buf
+	w.flushing = false
+	w.cond.Broadcast()
+	w.mu.Unlock()
+	return err
+}
+
+// position 返回当前日志段的路径与已写入的字节数，即下一条记录的起始偏移。
+func (w *wal) position() (string, int64) {
+	w.io.Lock()
+	defer w.io.Unlock()
+	return w.f.Name(), w.size
+}
+
+// fail 让 WAL 进入失败状态：内存与日志已经不一致，之后的写入都返回 err，需要重启后由回放修复。
+func (w *wal) fail(err error) {
+	w.io.Lock()
+	defer w.io.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.failed == nil {
+		w.failed = err
+	}
+}
+
+// appendParts 把 body 拆成每片 walPartSize 字节的 walRecordPart 记录追加到 buf，序号从 0 开始，最后一片的 last 为 1。
+func appendParts(buf []byte, kind byte, body []byte) []byte {
+	var part []byte
+	for seq := uint64(0); len(body) > 0; seq++ {
+		n := min(len(body), walPartSize)
+		var last byte
+		if n == len(body) {
+			last = 1
+		}
+		part = append(part[:0], kind)
+		part = binary.AppendUvarint(part, seq)
+		part = append(part, last)
+		part = append(part, body[:n]...)
+		buf = appendRecord(buf, walRecordPart, part)
+		body = body[n:]
+	}
+	return buf
+}
+
+// partAssembler 在读取日志段时把 walRecordPart 片段拼回原来的逻辑记录，每个日志段使用一个。
+// 片段序列被其他记录打断、序号不连续或到日志段末尾仍未收齐，都说明该逻辑记录没有写完（调用方已收到错误），收集到的片段被丢弃。
+type partAssembler struct {
+	open bool
+	kind byte
+	next uint64
+	body []byte
+}
+
+// feed 处理一条记录：普通记录直接交给 fn；片段先收集，收齐后以拼接出的逻辑记录调用 fn。
+func (a *partAssembler) feed(kind byte, body []byte, fn func(kind byte, body []byte) error) error {
+	if kind != walRecordPart {
+		a.reset()
+		return fn(kind, body)
+	}
+
+	if len(body) == 0 {
+		return errShortRecord
+	}
+	d := decoder{buf: body, off: 1}
+	seq := d.uvarint()
+	if d.err == nil && d.off >= len(body) {
+		d.err = errShortRecord
+	}
+	if d.err != nil {
+		return d.err
+	}
+	inner, last, data := body[0], body[d.off] == 1, body[d.off+1:]
+
+	switch {
+	case seq == 0:
+		a.reset()
+		a.open, a.kind = true, inner
+	case !a.open || seq != a.next || inner != a.kind:
+		// 缺少前面的片段：属于一次没有写完的逻辑记录
+		a.reset()
+		return nil
+	}
+	a.body = append(a.body, data...)
+	a.next = seq + 1
+	if !last {
+		return nil
+	}
+	full := a.body
+	a.reset()
+	return fn(inner, full)
+}
+
+// reset 丢弃已收集的片段。
+func (a *partAssembler) reset() {
+	*a = partAssembler{}
+}
+
+// sync 将尚未落盘的写入 fsync 到磁盘；无脏数据时为空操作。
+func (w *wal) sync() error {
+	w.io.Lock()
+	defer w.io.Unlock()
+
+	if w.f == nil || !w.dirty {
+		return nil
+	}
+	w.dirty = false
+	return w.f.Sync()
+}
+
+// close 落盘并关闭当前日志段（调用方持有提交闸门，没有暂存的记录）。
+func (w *wal) close() error {
+	w.io.Lock()
+	defer w.io.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return nil
+	}
+	err := w.f.Sync()
+	if cerr := w.f.Close(); err == nil {
+		err = cerr
+	}
+	w.f = nil
+	return err
+}
+
+// readWALSegment 顺序读取日志段中的所有记录并回调 fn。
+// 返回最后一条完整记录的结束偏移；遇到不完整或校验失败的记录时返回 errTornRecord，长度超限时返回 errRecordTooLarge。
+func readWALSegment(path string, fn func(kind byte, body []byte) error) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	return readRecords(bufio.NewReader(f), fn)
+}
+
+// rotate 落盘并关闭当前日志段，切换到序号 +1 的新日志段，返回新序号。
+// 暂存的记录使用旧日志段的字典，调用方须持有提交闸门，保证切段时没有暂存的记录。
+func (w *wal) rotate() (uint64, error) {
+	w.io.Lock()
+	defer w.io.Unlock()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.f == nil {
+		return 0, os.ErrClosed
+	}
+	if w.failed != nil {
+		return 0, w.failed
+	}
+	if err := w.f.Sync(); err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(walSegmentPath(w.dir, w.seq+1), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return 0, err
+	}
+	_ = w.f.Close()
+	w.f = f
+	w.seq++
+	w.size = 0
+	w.dirty = false
+	w.dict = newPayloadDict()
+	return w.seq, nil
+}
@@ -0,0 +1,159 @@
+package storage
+
+import (
+	"errors"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+var (
+	// ErrNotSupported 表示当前存储后端（或其当前配置）不支持某项可选能力。
+	ErrNotSupported = errors.New("not supported by storage backend")
+	// ErrNotFound 表示操作的对象（如归档的根树）不存在。
+	ErrNotFound = errors.New("not found")
+	// ErrConflict 表示操作与当前状态冲突，例如归档一棵与外部事件相连的树。
+	ErrConflict = errors.New("conflict")
+	// ErrCapacity 表示存储已达到配置的容量上限（如内存预算），新的写入被拒绝。
+	ErrCapacity = errors.New("storage capacity exhausted")
+)
+
+// Backend 是 CelestialTree 存储引擎的抽象。HTTP 与 gRPC 层只依赖此接口，
+// 具体实现（如 internal/memory）由 cmd/celestialtree 通过 -storage 参数选择。
+//
+// 新实现必须通过 storagetest.TestBackend 的一致性检查。
+type Backend interface {
+	// Emit 追加一个事件；Type 必填，Parents 中的 0 与重复 ID 会被忽略。请求无效（缺少类型、引用不存在的父事件等）时返回
+	// *tree.EmitError，达到容量上限时返回包装 ErrCapacity 的错误，其余错误（如持久化失败）属于服务端故障。
+	// ID 只分配给成功的写入：连续、与提交顺序一致，被拒绝的写入不消耗 ID。
+	Emit(req tree.EmitRequest) (tree.Event, error)
+	// Get 根据 ID 获取单个事件。
+	Get(id uint64) (tree.Event, bool)
+	// Children 返回事件的直接子事件 ID；事件不存在时返回 false。
+	Children(id uint64) ([]uint64, bool)
+	// Ancestors 返回事件可达的所有根事件 ID（升序）；事件不存在时返回 false。
+	Ancestors(id uint64) ([]uint64, bool)
+	// Roots 返回所有无父事件的事件 ID。
+	Roots() []uint64
+	// Heads 返回所有无子事件的事件 ID。
+	Heads() []uint64
+
+	DescendantsTree(rootID uint64) (tree.DescendantsTree, error)
+	DescendantsTreeMeta(rootID uint64) (tree.DescendantsTreeMeta, error)
+	// DescendantsForest / ProvenanceForest 批量构建多棵树，结果与 rootIDs 一一对应；
+	// 根 ID 无效时只有对应的树带上 Error，其余树照常返回。
+	DescendantsForest(rootIDs []uint64) []tree.DescendantsTree
+	DescendantsForestMeta(rootIDs []uint64) []tree.DescendantsTreeMeta
+
+	ProvenanceTree(rootID uint64) (tree.ProvenanceTree, error)
+	ProvenanceTreeMeta(rootID uint64) (tree.ProvenanceTreeMeta, error)
+	ProvenanceForest(rootIDs []uint64) []tree.ProvenanceTree
+	ProvenanceForestMeta(rootIDs []uint64) []tree.ProvenanceTreeMeta
+
+	// DescendantsPage / ProvenancePage 按 opts 的深度与节点数限制分页遍历，树过大时返回续页游标；
+	// opts.Cursor 无法解析或不属于本次遍历时返回 *tree.CursorError。
+	// 引用节点（IsRef）只在一页之内去重，跨页拼接的结果可能重复展开同一事件，与完整遍历不完全相同。
+	DescendantsPage(rootID uint64, opts tree.TraverseOptions) (tree.DescendantsPage, error)
+	DescendantsPageMeta(rootID uint64, opts tree.TraverseOptions) (tree.DescendantsMetaPage, error)
+	ProvenancePage(rootID uint64, opts tree.TraverseOptions) (tree.ProvenancePage, error)
+	ProvenancePageMeta(rootID uint64, opts tree.TraverseOptions) (tree.ProvenanceMetaPage, error)
+
+	// Subscribe 注册一个新事件订阅者，cancel 之后 ch 会被关闭。
+	Subscribe() (subID uint64, ch <-chan tree.Event, cancel func())
+	// Snapshot 返回运行时统计快照。
+	Snapshot() tree.Snapshot
+	// Close 释放后端持有的资源（文件、后台 goroutine 等）。
+	Close() error
+}
+
+// BatchEmitter 是支持原子批量写入的后端实现的可选接口。
+type BatchEmitter interface {
+	// EmitBatch 以一次提交写入 items：要么全部成功，要么全部失败且不留下任何状态。
+	// 各项的校验规则与错误约定同 Emit；LocalParents 只能引用更早的项。成功时按顺序返回事件，ID 连续。
+	EmitBatch(items []tree.BatchEmitItem) ([]tree.Event, error)
+}
+
+// Reacher 是支持可达性查询的后端实现的可选接口。
+type Reacher interface {
+	// Reachable 报告 from 是否是 to 的祖先（事件不是自身的祖先）；任一事件不存在时返回包装 ErrNotFound 的错误。
+	Reachable(from, to uint64) (bool, error)
+	// ReachableBatch 按顺序回答每一对事件，任一事件不存在时整批返回错误。
+	ReachableBatch(pairs []tree.ReachPair) ([]bool, error)
+}
+
+// PathFinder 是支持查询两个事件之间因果路径的后端实现的可选接口。
+type PathFinder interface {
+	// CausalPaths 按长度升序返回从 from 到 to 沿父子边的至多 limit 条路径（limit 不大于 0 时只返回最短的一条，
+	// 后端可以设置上限）；from 不是 to 的祖先时 Paths 为空。任一事件不存在时返回包装 ErrNotFound 的错误。
+	CausalPaths(from, to uint64, limit int) (tree.CausalPaths, error)
+	// CausalPathsMeta 同 CausalPaths，路径上的每个事件带有元数据。
+	CausalPathsMeta(from, to uint64, limit int) (tree.CausalPathsMeta, error)
+}
+
+// EventQuerier 是支持按条件查询事件的后端实现的可选接口。
+type EventQuerier interface {
+	// QueryEvents 按 ID 升序返回一页满足 q 的事件，NextAfterID 非零时可用它作为 AfterID 继续翻页；
+	// 条件无效时返回 *tree.QueryError，不支持全文查询（q.Text）时返回 ErrNotSupported。
+	QueryEvents(q tree.EventQuery) (tree.EventPage, error)
+	// StreamEvents 按 ID 升序对满足 q 的每个事件调用 fn，不分页（忽略 q.Limit）；条件无效时在第一次调用之前返回
+	// *tree.QueryError，fn 返回错误时停止并返回该错误。
+	StreamEvents(q tree.EventQuery, fn func(tree.Event) error) error
+}
+
+// FieldIndexer 是支持 payload 字段二级索引的后端实现的可选接口。字段为点分路径，如 "task_id"、"meta.run_id"。
+type FieldIndexer interface {
+	// AddFieldIndex 为字段建立索引并回填已有事件，之后写入的事件随写入维护；字段已有索引时直接返回其概况。
+	// 字段路径不合法时返回 *tree.QueryError。
+	AddFieldIndex(field string) (tree.FieldIndexInfo, error)
+	// DropFieldIndex 删除字段索引；字段没有索引时返回 ErrNotFound。
+	DropFieldIndex(field string) error
+	// FieldIndexes 返回全部字段索引的概况（按字段名排序）。
+	FieldIndexes() []tree.FieldIndexInfo
+	// LookupField 按 ID 升序返回一页字段值等于 q.Value 的事件 ID；字段没有索引时返回 *tree.QueryError，不会退化为全量扫描。
+	LookupField(q tree.FieldLookup) (tree.IDPage, error)
+}
+
+// Checkpointer 是支持持久化快照的后端可选实现的接口。
+type Checkpointer interface {
+	Checkpoint() (tree.CheckpointInfo, error)
+	LastCheckpoint() (tree.CheckpointInfo, bool)
+}
+
+// Archiver 是支持按根树归档的后端实现的可选接口。
+// 一棵树指 Roots() 中的一个根事件加上它的全部后代；归档后根事件作为存根保留，后代移出在线存储。
+type Archiver interface {
+	// Archive 立即归档以 rootID 为根的树；树与外部事件相连时返回 ErrConflict。
+	Archive(rootID uint64) (tree.ArchiveStub, error)
+	// Rehydrate 将已归档的树恢复到在线存储；rootID 未归档时返回 ErrNotFound。
+	Rehydrate(rootID uint64) (tree.ArchiveStub, error)
+	// Archives 返回所有已归档树的存根（按根 ID 升序）。
+	Archives() []tree.ArchiveStub
+}
+
+// Exporter 是支持按 ID 顺序流式导出事件的后端实现的可选接口。
+type Exporter interface {
+	// Export 按 ID 升序对 (sinceID, untilID] 内的每个事件调用 fn；untilID 为 0 表示截至当前最大 ID。fn 返回错误时停止导出。
+	Export(sinceID, untilID uint64, fn func(tree.Event) error) error
+}
+
+// TreeStreamer 是支持流式遍历后代树/溯源树的后端实现的可选接口。
+// 与 *Tree 方法不同，结果不会整体构建在内存中，服务端峰值内存与树的大小无关。
+type TreeStreamer interface {
+	// StreamDescendants 按前序对后代树的每个节点调用 fn，第一次调用之前校验 rootID（失败返回 *tree.RootIDError）。
+	// fn 返回错误时停止遍历并返回该错误。
+	StreamDescendants(rootID uint64, opts tree.StreamOptions, fn func(tree.TreeRecord) error) error
+	// StreamProvenance 按前序对溯源树的每个节点调用 fn，约定同 StreamDescendants。
+	StreamProvenance(rootID uint64, opts tree.StreamOptions, fn func(tree.TreeRecord) error) error
+}
+
+// Importer 是支持按原 ID 导入事件的后端实现的可选接口。
+type Importer interface {
+	// Import 从 next 逐个读取按 ID 升序排列的事件并按原 ID 载入，重建 roots/heads；next 返回 io.EOF 表示输入结束，
+	// 返回其他错误时导入中止并返回该错误。导入全有或全无；ID 与已有事件重叠时返回 ErrConflict，事件无效时返回 *tree.EmitError。
+	Import(next func() (tree.Event, error)) (tree.ImportResult, error)
+}
+
+// Verifier 是支持一致性检查的后端实现的可选接口。
+type Verifier interface {
+	// Verify 检查存储内部结构之间的不变量及持久化文件的校验和，发现的问题以结构化报告返回；error 仅表示检查本身无法进行。
+	Verify() (tree.VerifyReport, error)
+}
@@ -0,0 +1,1011 @@
+// Package storagetest 提供 storage.Backend 的一致性检查套件。
+//
+// 与 testing/fstest 类似，TestBackend 不依赖 testing 包，任何后端都可以在自己的测试中调用：
+//
+//	if err := storagetest.TestBackend(func() (storage.Backend, error) {
+//		return memory.NewStore(), nil
+//	}); err != nil {
+//		t.Fatal(err)
+//	}
+package storagetest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"time"
+
+	"github.com/Mr-xiaotian/CelestialTree/internal/storage"
+	"github.com/Mr-xiaotian/CelestialTree/internal/tree"
+)
+
+// check 是一项独立的一致性检查，每项检查都在一个全新的空后端上运行。
+type check struct {
+	name string
+	fn   func(b storage.Backend) error
+}
+
+var checks = []check{
+	{"empty", checkEmpty},
+	{"emit-validation", checkEmitValidation},
+	{"emit-get", checkEmitGet},
+	{"parents-normalized", checkParentsNormalized},
+	{"topology", checkTopology},
+	{"ancestors", checkAncestors},
+	{"descendants", checkDescendants},
+	{"provenance", checkProvenance},
+	{"forest-validation", checkForestValidation},
+	{"bounded-traversal", checkBoundedTraversal},
+	{"subscribe", checkSubscribe},
+	{"snapshot", checkSnapshot},
+	{"event-query", checkEventQuery},
+	{"event-time-query", checkEventTimeQuery},
+	{"field-lookup", checkFieldLookup},
+	{"event-text-search", checkEventTextSearch},
+	{"causal-paths", checkCausalPaths},
+}
+
+// TestBackend 依次在 newBackend 创建的全新空后端上运行所有检查，返回全部失败项（errors.Join）。
+func TestBackend(newBackend func() (storage.Backend, error)) error {
+	var errs []error
+	for _, c := range checks {
+		b, err := newBackend()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: new backend: %w", c.name, err))
+			continue
+		}
+		if err := c.fn(b); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.name, err))
+		}
+		if err := b.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: close: %w", c.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// emitAll 依次写入 reqs，返回分配的 ID；任一写入失败即返回错误。
+func emitAll(b storage.Backend, reqs ...tree.EmitRequest) ([]uint64, error) {
+	ids := make([]uint64, 0, len(reqs))
+	for _, req := range reqs {
+		ev, err := b.Emit(req)
+		if err != nil {
+			return nil, fmt.Errorf("emit %+v: %w", req, err)
+		}
+		ids = append(ids, ev.ID)
+	}
+	return ids, nil
+}
+
+// diamond 构造如下 DAG，返回 [a, b, c, d]：
+//
+//	a ──▶ b ──▶ d
+//	 \          ▲
+//	  ──▶ c ────┘
+func diamond(b storage.Backend) ([]uint64, error) {
+	a, err := b.Emit(tree.EmitRequest{Type: "a"})
+	if err != nil {
+		return nil, err
+	}
+	bc, err := emitAll(b,
+		tree.EmitRequest{Type: "b", Parents: []uint64{a.ID}},
+		tree.EmitRequest{Type: "c", Parents: []uint64{a.ID}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	d, err := b.Emit(tree.EmitRequest{Type: "d", Parents: bc})
+	if err != nil {
+		return nil, err
+	}
+	return []uint64{a.ID, bc[0], bc[1], d.ID}, nil
+}
+
+func sorted(ids []uint64) []uint64 {
+	out := slices.Clone(ids)
+	slices.Sort(out)
+	return out
+}
+
+func expectIDs(what string, got, want []uint64) error {
+	if !slices.Equal(sorted(got), sorted(want)) {
+		return fmt.Errorf("%s = %v, want %v", what, sorted(got), sorted(want))
+	}
+	return nil
+}
+
+func checkEmpty(b storage.Backend) error {
+	if roots := b.Roots(); len(roots) != 0 {
+		return fmt.Errorf("Roots() = %v, want empty", roots)
+	}
+	if heads := b.Heads(); len(heads) != 0 {
+		return fmt.Errorf("Heads() = %v, want empty", heads)
+	}
+	if _, ok := b.Get(1); ok {
+		return fmt.Errorf("Get(1) found an event in an empty backend")
+	}
+	if _, ok := b.Children(1); ok {
+		return fmt.Errorf("Children(1) succeeded in an empty backend")
+	}
+	if snap := b.Snapshot(); snap.NextEventID != 0 || snap.Edges != 0 {
+		return fmt.Errorf("Snapshot() = %+v, want zero next_event_id and edges", snap)
+	}
+	return nil
+}
+
+func checkEmitValidation(b storage.Backend) error {
+	if _, err := b.Emit(tree.EmitRequest{Type: "  "}); err == nil {
+		return fmt.Errorf("Emit with blank type succeeded")
+	}
+	if _, err := b.Emit(tree.EmitRequest{Type: "x", Parents: []uint64{42}}); err == nil {
+		return fmt.Errorf("Emit with missing parent succeeded")
+	}
+	if roots := b.Roots(); len(roots) != 0 {
+		return fmt.Errorf("rejected emits left roots %v", roots)
+	}
+
+	// 被拒绝的写入不消耗 ID
+	first, err := b.Emit(tree.EmitRequest{Type: "x"})
+	if err != nil {
+		return err
+	}
+	if _, err := b.Emit(tree.EmitRequest{Type: "x", Parents: []uint64{first.ID + 100}}); err == nil {
+		return fmt.Errorf("Emit with missing parent succeeded")
+	}
+	second, err := b.Emit(tree.EmitRequest{Type: "x", Parents: []uint64{first.ID}})
+	if err != nil {
+		return err
+	}
+	if second.ID != first.ID+1 {
+		return fmt.Errorf("id after a rejected emit = %d, want %d", second.ID, first.ID+1)
+	}
+	return nil
+}
+
+func checkEmitGet(b storage.Backend) error {
+	req := tree.EmitRequest{
+		Type:    "task.created",
+		Message: "hello",
+		Payload: json.RawMessage(`{"task_id":"A-001"}`),
+	}
+	before := time.Now().UnixNano()
+	ev, err := b.Emit(req)
+	if err != nil {
+		return err
+	}
+	if ev.ID == 0 {
+		return fmt.Errorf("Emit returned id 0")
+	}
+	if ev.TimeUnixNano < before {
+		return fmt.Errorf("TimeUnixNano %d is before emit started (%d)", ev.TimeUnixNano, before)
+	}
+	got, ok := b.Get(ev.ID)
+	if !ok {
+		return fmt.Errorf("Get(%d) not found", ev.ID)
+	}
+	if got.ID != ev.ID || got.Type != req.Type || got.Message != req.Message || got.TimeUnixNano != ev.TimeUnixNano {
+		return fmt.Errorf("Get(%d) = %+v, want %+v", ev.ID, got, ev)
+	}
+	if string(got.Payload) != string(req.Payload) {
+		return fmt.Errorf("Get(%d).Payload = %s, want %s", ev.ID, got.Payload, req.Payload)
+	}
+	if len(got.Parents) != 0 {
+		return fmt.Errorf("Get(%d).Parents = %v, want empty", ev.ID, got.Parents)
+	}
+
+	next, err := b.Emit(tree.EmitRequest{Type: "task.started", Parents: []uint64{ev.ID}})
+	if err != nil {
+		return err
+	}
+	if next.ID <= ev.ID {
+		return fmt.Errorf("ids not increasing: %d then %d", ev.ID, next.ID)
+	}
+	if _, ok := b.Get(0); ok {
+		return fmt.Errorf("Get(0) found an event")
+	}
+	return nil
+}
+
+func checkParentsNormalized(b storage.Backend) error {
+	root, err := b.Emit(tree.EmitRequest{Type: "root"})
+	if err != nil {
+		return err
+	}
+	ev, err := b.Emit(tree.EmitRequest{Type: "child", Parents: []uint64{0, root.ID, root.ID, 0}})
+	if err != nil {
+		return err
+	}
+	if !slices.Equal(ev.Parents, []uint64{root.ID}) {
+		return fmt.Errorf("Parents = %v, want [%d]", ev.Parents, root.ID)
+	}
+	children, _ := b.Children(root.ID)
+	return expectIDs("Children(root)", children, []uint64{ev.ID})
+}
+
+func checkTopology(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	a, bb, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	if err := expectIDs("Roots()", b.Roots(), []uint64{a}); err != nil {
+		return err
+	}
+	if err := expectIDs("Heads()", b.Heads(), []uint64{d}); err != nil {
+		return err
+	}
+	children, ok := b.Children(a)
+	if !ok {
+		return fmt.Errorf("Children(%d) not found", a)
+	}
+	if err := expectIDs("Children(a)", children, []uint64{bb, c}); err != nil {
+		return err
+	}
+	children, ok = b.Children(d)
+	if !ok || len(children) != 0 {
+		return fmt.Errorf("Children(d) = %v, %v; want empty, true", children, ok)
+	}
+	if _, ok := b.Children(d + 1000); ok {
+		return fmt.Errorf("Children of missing event succeeded")
+	}
+
+	// 第二个根：roots 增加，heads 增加
+	e, err := b.Emit(tree.EmitRequest{Type: "e"})
+	if err != nil {
+		return err
+	}
+	if err := expectIDs("Roots()", b.Roots(), []uint64{a, e.ID}); err != nil {
+		return err
+	}
+	return expectIDs("Heads()", b.Heads(), []uint64{d, e.ID})
+}
+
+func checkAncestors(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	other, err := b.Emit(tree.EmitRequest{Type: "other"})
+	if err != nil {
+		return err
+	}
+	join, err := b.Emit(tree.EmitRequest{Type: "join", Parents: []uint64{ids[3], other.ID}})
+	if err != nil {
+		return err
+	}
+
+	got, ok := b.Ancestors(join.ID)
+	if !ok {
+		return fmt.Errorf("Ancestors(%d) not found", join.ID)
+	}
+	if want := sorted([]uint64{ids[0], other.ID}); !slices.Equal(got, want) {
+		return fmt.Errorf("Ancestors(join) = %v, want %v (sorted)", got, want)
+	}
+	got, ok = b.Ancestors(ids[0])
+	if !ok || !slices.Equal(got, []uint64{ids[0]}) {
+		return fmt.Errorf("Ancestors(root) = %v, %v; want [%d], true", got, ok, ids[0])
+	}
+	if _, ok := b.Ancestors(join.ID + 1000); ok {
+		return fmt.Errorf("Ancestors of missing event succeeded")
+	}
+	return nil
+}
+
+func checkDescendants(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	a, bb, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	got, err := b.DescendantsTree(a)
+	if err != nil {
+		return err
+	}
+	// children 按 ID 升序；d 第二次出现时是引用节点
+	want := tree.DescendantsTree{ID: a, Children: []tree.DescendantsTree{
+		{ID: bb, Children: []tree.DescendantsTree{{ID: d, Children: []tree.DescendantsTree{}}}},
+		{ID: c, Children: []tree.DescendantsTree{{ID: d, IsRef: true}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("DescendantsTree(a) = %+v, want %+v", got, want)
+	}
+
+	meta, err := b.DescendantsTreeMeta(a)
+	if err != nil {
+		return err
+	}
+	if meta.ID != a || meta.Type != "a" || len(meta.Children) != 2 || meta.Children[0].Type != "b" {
+		return fmt.Errorf("DescendantsTreeMeta(a) = %+v", meta)
+	}
+
+	forest := b.DescendantsForest([]uint64{bb, c})
+	if len(forest) != 2 || forest[0].ID != bb || forest[1].ID != c || forest[1].Children[0].IsRef {
+		return fmt.Errorf("DescendantsForest = %+v: every tree must use its own visited set", forest)
+	}
+	metaForest := b.DescendantsForestMeta([]uint64{d})
+	if len(metaForest) != 1 || metaForest[0].Type != "d" || len(metaForest[0].Children) != 0 {
+		return fmt.Errorf("DescendantsForestMeta = %+v", metaForest)
+	}
+	return nil
+}
+
+func checkProvenance(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	a, bb, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	got, err := b.ProvenanceTree(d)
+	if err != nil {
+		return err
+	}
+	// parents 保持 Emit 时的顺序；a 第二次出现时是引用节点
+	want := tree.ProvenanceTree{ID: d, Parents: []tree.ProvenanceTree{
+		{ID: bb, Parents: []tree.ProvenanceTree{{ID: a, Parents: []tree.ProvenanceTree{}}}},
+		{ID: c, Parents: []tree.ProvenanceTree{{ID: a, IsRef: true}}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		return fmt.Errorf("ProvenanceTree(d) = %+v, want %+v", got, want)
+	}
+
+	meta, err := b.ProvenanceTreeMeta(d)
+	if err != nil {
+		return err
+	}
+	if meta.ID != d || meta.Type != "d" || len(meta.Parents) != 2 || meta.Parents[1].Type != "c" {
+		return fmt.Errorf("ProvenanceTreeMeta(d) = %+v", meta)
+	}
+
+	forest := b.ProvenanceForest([]uint64{bb, a})
+	if len(forest) != 2 || forest[0].ID != bb || forest[1].ID != a || len(forest[1].Parents) != 0 {
+		return fmt.Errorf("ProvenanceForest = %+v", forest)
+	}
+	metaForest := b.ProvenanceForestMeta([]uint64{c})
+	if len(metaForest) != 1 || metaForest[0].Type != "c" || metaForest[0].Parents[0].Type != "a" {
+		return fmt.Errorf("ProvenanceForestMeta = %+v", metaForest)
+	}
+	return nil
+}
+
+func checkForestValidation(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	missing := ids[3] + 1000
+
+	var rootErr *tree.RootIDError
+	if _, err := b.DescendantsTree(missing); !errors.As(err, &rootErr) {
+		return fmt.Errorf("DescendantsTree(missing) error = %v, want *tree.RootIDError", err)
+	}
+	if _, err := b.ProvenanceTreeMeta(0); !errors.As(err, &rootErr) {
+		return fmt.Errorf("ProvenanceTreeMeta(0) error = %v, want *tree.RootIDError", err)
+	}
+
+	// 批量查询中无效的根只让对应的树带上错误，其余树照常返回
+	forest := b.DescendantsForest([]uint64{ids[0], missing, 0})
+	if len(forest) != 3 || forest[0].Error != "" || len(forest[0].Children) != 2 {
+		return fmt.Errorf("DescendantsForest with invalid ids = %+v, want the tree of %d intact", forest, ids[0])
+	}
+	if forest[1].ID != missing || forest[1].Error == "" || forest[2].Error == "" {
+		return fmt.Errorf("DescendantsForest with invalid ids = %+v, want errors on ids %d and 0", forest, missing)
+	}
+	metaForest := b.ProvenanceForestMeta([]uint64{missing, ids[3]})
+	if len(metaForest) != 2 || metaForest[0].Error == "" || metaForest[1].Error != "" || metaForest[1].Type != "d" {
+		return fmt.Errorf("ProvenanceForestMeta with a missing id = %+v", metaForest)
+	}
+	return nil
+}
+
+// collectDescendants 将树中非引用节点的 ID 加入 seen。
+func collectDescendants(t tree.DescendantsTree, seen map[uint64]bool) {
+	if !t.IsRef {
+		seen[t.ID] = true
+	}
+	for _, c := range t.Children {
+		collectDescendants(c, seen)
+	}
+}
+
+func checkBoundedTraversal(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	a, bb, c, d := ids[0], ids[1], ids[2], ids[3]
+
+	page, err := b.DescendantsPage(a, tree.TraverseOptions{MaxDepth: 1})
+	if err != nil {
+		return err
+	}
+	want := tree.DescendantsPage{Truncated: true, Trees: []tree.DescendantsTree{{ID: a, Children: []tree.DescendantsTree{
+		{ID: bb, Truncated: true, Children: []tree.DescendantsTree{}},
+		{ID: c, Truncated: true, Children: []tree.DescendantsTree{}},
+	}}}}
+	if !reflect.DeepEqual(page, want) {
+		return fmt.Errorf("DescendantsPage(a, max_depth=1) = %+v, want %+v", page, want)
+	}
+
+	full, err := b.DescendantsPage(a, tree.TraverseOptions{})
+	if err != nil {
+		return err
+	}
+	whole, err := b.DescendantsTree(a)
+	if err != nil {
+		return err
+	}
+	if full.Truncated || full.Cursor != "" || len(full.Trees) != 1 || !reflect.DeepEqual(full.Trees[0], whole) {
+		return fmt.Errorf("DescendantsPage(a) without limits = %+v, want the full tree", full)
+	}
+
+	// 按 max_nodes 翻页，所有页合起来必须覆盖全部后代
+	seen := make(map[uint64]bool)
+	opts := tree.TraverseOptions{MaxNodes: 2}
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			return fmt.Errorf("DescendantsPage(a, max_nodes=2) did not terminate")
+		}
+		page, err := b.DescendantsPage(a, opts)
+		if err != nil {
+			return err
+		}
+		if pages == 0 && (!page.Truncated || page.Cursor == "") {
+			return fmt.Errorf("DescendantsPage(a, max_nodes=2) = %+v, want a truncated page with cursor", page)
+		}
+		for _, t := range page.Trees {
+			collectDescendants(t, seen)
+		}
+		if page.Cursor == "" {
+			break
+		}
+		opts.Cursor = page.Cursor
+	}
+	for _, id := range ids {
+		if !seen[id] {
+			return fmt.Errorf("paged descendants of a miss %d (got %v)", id, seen)
+		}
+	}
+
+	first, err := b.ProvenancePage(d, tree.TraverseOptions{MaxNodes: 1})
+	if err != nil {
+		return err
+	}
+	if len(first.Trees) != 1 || first.Trees[0].ID != d || !first.Trees[0].Truncated || first.Cursor == "" {
+		return fmt.Errorf("ProvenancePage(d, max_nodes=1) = %+v", first)
+	}
+	next, err := b.ProvenancePageMeta(d, tree.TraverseOptions{MaxNodes: 1, Cursor: first.Cursor})
+	if err != nil {
+		return err
+	}
+	if len(next.Trees) != 1 || next.Trees[0].ID != d || len(next.Trees[0].Parents) != 1 || next.Trees[0].Parents[0].Type != "b" {
+		return fmt.Errorf("ProvenancePageMeta(d) continuation = %+v", next)
+	}
+
+	var cursorErr *tree.CursorError
+	if _, err := b.ProvenancePage(c, tree.TraverseOptions{Cursor: first.Cursor}); !errors.As(err, &cursorErr) {
+		return fmt.Errorf("ProvenancePage with another root's cursor error = %v, want *tree.CursorError", err)
+	}
+	if _, err := b.DescendantsPageMeta(d, tree.TraverseOptions{Cursor: first.Cursor}); !errors.As(err, &cursorErr) {
+		return fmt.Errorf("DescendantsPageMeta with a provenance cursor error = %v, want *tree.CursorError", err)
+	}
+	if _, err := b.DescendantsPage(a, tree.TraverseOptions{Cursor: "not a cursor"}); !errors.As(err, &cursorErr) {
+		return fmt.Errorf("DescendantsPage with malformed cursor error = %v, want *tree.CursorError", err)
+	}
+	return nil
+}
+
+func checkSubscribe(b storage.Backend) error {
+	_, ch, cancel := b.Subscribe()
+
+	ev, err := b.Emit(tree.EmitRequest{Type: "ping"})
+	if err != nil {
+		cancel()
+		return err
+	}
+	select {
+	case got := <-ch:
+		if got.ID != ev.ID || got.Type != "ping" {
+			cancel()
+			return fmt.Errorf("subscriber received %+v, want %+v", got, ev)
+		}
+	case <-time.After(time.Second):
+		cancel()
+		return fmt.Errorf("subscriber did not receive event %d", ev.ID)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			return fmt.Errorf("channel still delivers events after cancel")
+		}
+	case <-time.After(time.Second):
+		return fmt.Errorf("channel not closed after cancel")
+	}
+	return nil
+}
+
+func checkSnapshot(b storage.Backend) error {
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	snap := b.Snapshot()
+	if snap.Edges != 4 || snap.Roots != 1 || snap.Heads != 1 {
+		return fmt.Errorf("Snapshot() = %+v, want edges=4 roots=1 heads=1", snap)
+	}
+	if snap.NextEventID < ids[3] {
+		return fmt.Errorf("Snapshot().NextEventID = %d, want >= %d", snap.NextEventID, ids[3])
+	}
+	if snap.TotalEvents != 4 || snap.MaxFanout != 2 {
+		return fmt.Errorf("Snapshot() total_events=%d max_fanout=%d, want 4 and 2", snap.TotalEvents, snap.MaxFanout)
+	}
+	want := map[string]int{"a": 1, "b": 1, "c": 1, "d": 1}
+	if !maps.Equal(snap.TypeCounts, want) {
+		return fmt.Errorf("Snapshot().TypeCounts = %v, want %v", snap.TypeCounts, want)
+	}
+	if snap.EmitRate1m <= 0 {
+		return fmt.Errorf("Snapshot().EmitRate1m = %g, want > 0 right after emitting", snap.EmitRate1m)
+	}
+	return nil
+}
+
+// checkEventQuery 检查按类型查询事件：精确匹配、点分前缀、按 ID 升序翻页与无效的类型模式。
+// 后端未实现 storage.EventQuerier 时跳过。
+func checkEventQuery(b storage.Backend) error {
+	qr, ok := b.(storage.EventQuerier)
+	if !ok {
+		return nil
+	}
+	ids, err := emitAll(b,
+		tree.EmitRequest{Type: "task.failed"},
+		tree.EmitRequest{Type: "task"},
+		tree.EmitRequest{Type: "job.failed"},
+		tree.EmitRequest{Type: "task.retry.scheduled"},
+		tree.EmitRequest{Type: "task.failed"},
+	)
+	if err != nil {
+		return err
+	}
+	query := func(q tree.EventQuery) ([]uint64, uint64, error) {
+		page, err := qr.QueryEvents(q)
+		if err != nil {
+			return nil, 0, fmt.Errorf("QueryEvents(%+v): %w", q, err)
+		}
+		out := make([]uint64, 0, len(page.Events))
+		for _, ev := range page.Events {
+			out = append(out, ev.ID)
+		}
+		return out, page.NextAfterID, nil
+	}
+
+	for _, tc := range []struct {
+		pattern string
+		want    []uint64
+	}{
+		{"task.failed", []uint64{ids[0], ids[4]}},
+		{"task.*", []uint64{ids[0], ids[3], ids[4]}},
+		{"*", ids},
+		{"missing", []uint64{}},
+	} {
+		got, next, err := query(tree.EventQuery{Type: tc.pattern})
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(got, tc.want) || next != 0 {
+			return fmt.Errorf("QueryEvents(type=%q) = %v next=%d, want %v in id order and no next page", tc.pattern, got, next, tc.want)
+		}
+	}
+
+	// 翻页：每页 2 个，NextAfterID 作为下一页的 AfterID，最后一页不再返回 NextAfterID
+	var all []uint64
+	q := tree.EventQuery{Type: "task.*", Limit: 2}
+	for range 3 {
+		got, next, err := query(q)
+		if err != nil {
+			return err
+		}
+		all = append(all, got...)
+		if next == 0 {
+			break
+		}
+		q.AfterID = next
+	}
+	if want := []uint64{ids[0], ids[3], ids[4]}; !slices.Equal(all, want) {
+		return fmt.Errorf("paged QueryEvents(type=task.*) = %v, want %v", all, want)
+	}
+
+	var queryErr *tree.QueryError
+	for _, pattern := range []string{"", "task*", "*.failed"} {
+		if _, err := qr.QueryEvents(tree.EventQuery{Type: pattern}); !errors.As(err, &queryErr) {
+			return fmt.Errorf("QueryEvents(type=%q) error = %v, want *tree.QueryError", pattern, err)
+		}
+	}
+	return nil
+}
+
+// checkEventTimeQuery 检查按时间范围 [From, To) 查询（可与类型条件组合）、翻页与流式输出的结果一致，
+// 期望值由各事件实际的时间戳算出（同一纳秒写入多个事件时也成立）。不支持 storage.EventQuerier 的后端跳过。
+func checkEventTimeQuery(b storage.Backend) error {
+	qr, ok := b.(storage.EventQuerier)
+	if !ok {
+		return nil
+	}
+	var evs []tree.Event
+	for _, typ := range []string{"a", "b", "a", "b", "a"} {
+		ev, err := b.Emit(tree.EmitRequest{Type: typ})
+		if err != nil {
+			return fmt.Errorf("emit: %w", err)
+		}
+		evs = append(evs, ev)
+	}
+	want := func(q tree.EventQuery) []uint64 {
+		out := []uint64{}
+		for _, ev := range evs {
+			if (q.Type == "" || ev.Type == q.Type) &&
+				(q.From == 0 || ev.TimeUnixNano >= q.From) && (q.To == 0 || ev.TimeUnixNano < q.To) {
+				out = append(out, ev.ID)
+			}
+		}
+		return out
+	}
+	t := func(i int) int64 { return evs[i].TimeUnixNano }
+
+	for _, q := range []tree.EventQuery{
+		{From: t(1)},
+		{To: t(3)},
+		{From: t(1), To: t(4)},
+		{Type: "a", From: t(1)},
+		{Type: "b", To: t(4)},
+		{From: t(4) + 1},
+		{To: t(0)},
+	} {
+		var got []uint64
+		page, err := qr.QueryEvents(q)
+		if err != nil {
+			return fmt.Errorf("QueryEvents(%+v): %w", q, err)
+		}
+		for _, ev := range page.Events {
+			got = append(got, ev.ID)
+		}
+		if w := want(q); !slices.Equal(got, w) || page.NextAfterID != 0 {
+			return fmt.Errorf("QueryEvents(%+v) = %v next=%d, want %v", q, got, page.NextAfterID, w)
+		}
+
+		// 每页 1 个翻页、流式输出，结果都与一次取回的相同
+		var paged []uint64
+		pq := q
+		pq.Limit = 1
+		for range len(evs) + 1 {
+			page, err := qr.QueryEvents(pq)
+			if err != nil {
+				return fmt.Errorf("QueryEvents(%+v): %w", pq, err)
+			}
+			for _, ev := range page.Events {
+				paged = append(paged, ev.ID)
+			}
+			if page.NextAfterID == 0 {
+				break
+			}
+			pq.AfterID = page.NextAfterID
+		}
+		var streamed []uint64
+		if err := qr.StreamEvents(q, func(ev tree.Event) error {
+			streamed = append(streamed, ev.ID)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("StreamEvents(%+v): %w", q, err)
+		}
+		if !slices.Equal(paged, got) || !slices.Equal(streamed, got) {
+			return fmt.Errorf("query %+v: paged %v, streamed %v, want %v", q, paged, streamed, got)
+		}
+	}
+
+	var queryErr *tree.QueryError
+	for _, q := range []tree.EventQuery{
+		{},
+		{From: t(2), To: t(2)},
+		{Type: "a*", From: t(0)},
+	} {
+		if _, err := qr.QueryEvents(q); !errors.As(err, &queryErr) {
+			return fmt.Errorf("QueryEvents(%+v) error = %v, want *tree.QueryError", q, err)
+		}
+		called := false
+		if err := qr.StreamEvents(q, func(tree.Event) error { called = true; return nil }); !errors.As(err, &queryErr) || called {
+			return fmt.Errorf("StreamEvents(%+v) error = %v (called=%t), want *tree.QueryError before any event", q, err, called)
+		}
+	}
+	return nil
+}
+
+// checkFieldLookup 检查 payload 字段索引：建立时回填已有事件、之后随写入维护、嵌套字段与非字符串值、翻页，
+// 以及未建索引的字段返回 *tree.QueryError 而不是扫描。不支持 storage.FieldIndexer 的后端跳过。
+func checkFieldLookup(b storage.Backend) error {
+	fi, ok := b.(storage.FieldIndexer)
+	if !ok {
+		return nil
+	}
+	var queryErr *tree.QueryError
+	if _, err := fi.LookupField(tree.FieldLookup{Field: "task_id", Value: "A-001"}); !errors.As(err, &queryErr) {
+		return fmt.Errorf("LookupField on an unindexed field error = %v, want *tree.QueryError", err)
+	}
+
+	ids, err := emitAll(b,
+		tree.EmitRequest{Type: "t", Payload: json.RawMessage(`{"task_id":"A-001"}`)},
+		tree.EmitRequest{Type: "t", Payload: json.RawMessage(`{"task_id":"A-002","meta":{"run":7}}`)},
+		tree.EmitRequest{Type: "t"},
+		tree.EmitRequest{Type: "t", Payload: json.RawMessage(`{"task_id":"A-001","meta":{"run":null}}`)},
+	)
+	if err != nil {
+		return err
+	}
+	for _, field := range []string{"task_id", "meta.run"} {
+		if _, err := fi.AddFieldIndex(field); err != nil {
+			return fmt.Errorf("AddFieldIndex(%q): %w", field, err)
+		}
+	}
+	// 建立索引之后写入的事件随写入维护
+	late, err := emitAll(b, tree.EmitRequest{Type: "t", Payload: json.RawMessage(`{"task_id":"A-001","meta":{"run":7}}`)})
+	if err != nil {
+		return err
+	}
+
+	lookup := func(q tree.FieldLookup) ([]uint64, error) {
+		var all []uint64
+		for range 10 {
+			page, err := fi.LookupField(q)
+			if err != nil {
+				return nil, fmt.Errorf("LookupField(%+v): %w", q, err)
+			}
+			all = append(all, page.IDs...)
+			if page.NextAfterID == 0 {
+				return all, nil
+			}
+			q.AfterID = page.NextAfterID
+		}
+		return nil, fmt.Errorf("LookupField(%+v) did not finish paging", q)
+	}
+	for _, tc := range []struct {
+		field, value string
+		want         []uint64
+	}{
+		{"task_id", "A-001", []uint64{ids[0], ids[3], late[0]}},
+		{"task_id", "A-002", []uint64{ids[1]}},
+		{"task_id", "B-999", nil},
+		{"meta.run", "7", []uint64{ids[1], late[0]}},
+	} {
+		got, err := lookup(tree.FieldLookup{Field: tc.field, Value: tc.value, Limit: 1})
+		if err != nil {
+			return err
+		}
+		if !slices.Equal(got, tc.want) {
+			return fmt.Errorf("LookupField(%s=%s) = %v, want %v", tc.field, tc.value, got, tc.want)
+		}
+	}
+	if got := fi.FieldIndexes(); len(got) != 2 || got[0].Field != "meta.run" || got[1].Field != "task_id" || got[1].Events != 4 {
+		return fmt.Errorf("FieldIndexes() = %+v, want meta.run and task_id with 4 events", got)
+	}
+
+	if err := fi.DropFieldIndex("task_id"); err != nil {
+		return fmt.Errorf("DropFieldIndex: %w", err)
+	}
+	if err := fi.DropFieldIndex("task_id"); !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("second DropFieldIndex error = %v, want ErrNotFound", err)
+	}
+	if _, err := fi.LookupField(tree.FieldLookup{Field: "task_id", Value: "A-001"}); !errors.As(err, &queryErr) {
+		return fmt.Errorf("LookupField after drop error = %v, want *tree.QueryError", err)
+	}
+	for _, field := range []string{"", "meta.", "a..b"} {
+		if _, err := fi.AddFieldIndex(field); !errors.As(err, &queryErr) {
+			return fmt.Errorf("AddFieldIndex(%q) error = %v, want *tree.QueryError", field, err)
+		}
+	}
+	return nil
+}
+
+// checkEventTextSearch 检查按 Message 全文查询事件：大小写无关的词、前缀、短语（含不以空格分词的中文）、
+// 与类型和时间范围组合、翻页与流式输出，以及不合法的查询。不支持 storage.EventQuerier 或关闭了全文索引的后端跳过。
+func checkEventTextSearch(b storage.Backend) error {
+	qr, ok := b.(storage.EventQuerier)
+	if !ok {
+		return nil
+	}
+	if _, err := qr.QueryEvents(tree.EventQuery{Text: "probe"}); errors.Is(err, storage.ErrNotSupported) {
+		return nil
+	}
+	var evs []tree.Event
+	for _, req := range []tree.EmitRequest{
+		{Type: "task.failed", Message: "Connection refused by db-01"},
+		{Type: "task.retry", Message: "connection reset"},
+		{Type: "task.failed", Message: "Disk full on /var"},
+		{Type: "alert", Message: "数据库连接失败"},
+		{Type: "task.failed", Message: "refused: CONNECTION"},
+		{Type: "task.failed"},
+	} {
+		ev, err := b.Emit(req)
+		if err != nil {
+			return fmt.Errorf("emit: %w", err)
+		}
+		evs = append(evs, ev)
+	}
+	ids := func(idx ...int) []uint64 {
+		out := []uint64{}
+		for _, i := range idx {
+			out = append(out, evs[i].ID)
+		}
+		return out
+	}
+
+	for _, tc := range []struct {
+		q    tree.EventQuery
+		want []uint64
+	}{
+		{tree.EventQuery{Text: "connection"}, ids(0, 1, 4)},
+		{tree.EventQuery{Text: "CONNECTION refused"}, ids(0, 4)},
+		{tree.EventQuery{Text: `"connection refused"`}, ids(0)},
+		{tree.EventQuery{Text: "conn*"}, ids(0, 1, 4)},
+		{tree.EventQuery{Text: "conn* re*"}, ids(0, 1, 4)},
+		{tree.EventQuery{Text: "db-01"}, ids(0)},
+		{tree.EventQuery{Text: "01-db"}, ids()},
+		{tree.EventQuery{Text: "数据库"}, ids(3)},
+		{tree.EventQuery{Text: "库数据"}, ids()},
+		{tree.EventQuery{Text: "missing"}, ids()},
+		{tree.EventQuery{Text: "conn*", Type: "task.failed"}, ids(0, 4)},
+		{tree.EventQuery{Text: "connection", From: evs[1].TimeUnixNano}, nil},
+	} {
+		want := tc.want
+		if want == nil {
+			// 时间范围的期望值由各事件实际的时间戳算出
+			want = []uint64{}
+			for _, i := range []int{0, 1, 4} {
+				if evs[i].TimeUnixNano >= tc.q.From {
+					want = append(want, evs[i].ID)
+				}
+			}
+		}
+		var paged []uint64
+		q := tc.q
+		q.Limit = 1
+		for range len(evs) + 1 {
+			page, err := qr.QueryEvents(q)
+			if err != nil {
+				return fmt.Errorf("QueryEvents(%+v): %w", q, err)
+			}
+			for _, ev := range page.Events {
+				paged = append(paged, ev.ID)
+			}
+			if page.NextAfterID == 0 {
+				break
+			}
+			q.AfterID = page.NextAfterID
+		}
+		var streamed []uint64
+		if err := qr.StreamEvents(tc.q, func(ev tree.Event) error {
+			streamed = append(streamed, ev.ID)
+			return nil
+		}); err != nil {
+			return fmt.Errorf("StreamEvents(%+v): %w", tc.q, err)
+		}
+		if !slices.Equal(paged, want) || !slices.Equal(streamed, want) {
+			return fmt.Errorf("search %+v = %v paged, %v streamed, want %v", tc.q, paged, streamed, want)
+		}
+	}
+
+	var queryErr *tree.QueryError
+	for _, text := range []string{`"connection`, "!!!", "conn-re*", "*"} {
+		if _, err := qr.QueryEvents(tree.EventQuery{Text: text}); !errors.As(err, &queryErr) {
+			return fmt.Errorf("QueryEvents(text=%q) error = %v, want *tree.QueryError", text, err)
+		}
+	}
+	return nil
+}
+
+// checkCausalPaths 检查因果路径查询：最短路径、按长度升序的多条路径与数量限制、元数据视图，
+// 以及没有因果联系（含方向相反）、同一事件与不存在的事件。不支持 storage.PathFinder 的后端跳过。
+func checkCausalPaths(b storage.Backend) error {
+	pf, ok := b.(storage.PathFinder)
+	if !ok {
+		return nil
+	}
+	// a ──▶ b ──▶ d ──▶ g，另有 a ──▶ c ──▶ d 与 a ──▶ e ──▶ f ──▶ g；x 与其他事件无关
+	ids, err := diamond(b)
+	if err != nil {
+		return err
+	}
+	a, bb, c, d := ids[0], ids[1], ids[2], ids[3]
+	ef, err := emitAll(b, tree.EmitRequest{Type: "e", Parents: []uint64{a}})
+	if err != nil {
+		return err
+	}
+	rest, err := emitAll(b,
+		tree.EmitRequest{Type: "f", Parents: ef},
+		tree.EmitRequest{Type: "x"},
+	)
+	if err != nil {
+		return err
+	}
+	e, f, x := ef[0], rest[0], rest[1]
+	gs, err := emitAll(b, tree.EmitRequest{Type: "g", Parents: []uint64{d, f}})
+	if err != nil {
+		return err
+	}
+	g := gs[0]
+
+	short := [][]uint64{{a, bb, d}, {a, c, d}}
+	res, err := pf.CausalPaths(a, d, 0)
+	if err != nil {
+		return fmt.Errorf("CausalPaths(a, d): %w", err)
+	}
+	if res.From != a || res.To != d || res.Length != 2 || len(res.Paths) != 1 || !res.Truncated ||
+		!slices.ContainsFunc(short, func(p []uint64) bool { return slices.Equal(p, res.Paths[0]) }) {
+		return fmt.Errorf("CausalPaths(a, d) = %+v, want one of %v with length 2, truncated", res, short)
+	}
+
+	want := [][]uint64{{a, e, f, g}, {a, bb, d, g}, {a, c, d, g}}
+	for _, tc := range []struct {
+		limit     int
+		n         int
+		truncated bool
+	}{{1, 1, true}, {2, 2, true}, {3, 3, false}, {10, 3, false}} {
+		res, err := pf.CausalPaths(a, g, tc.limit)
+		if err != nil {
+			return fmt.Errorf("CausalPaths(a, g, %d): %w", tc.limit, err)
+		}
+		if res.Length != 3 || len(res.Paths) != tc.n || res.Truncated != tc.truncated {
+			return fmt.Errorf("CausalPaths(a, g, %d) = %+v, want %d paths of length 3, truncated=%t", tc.limit, res, tc.n, tc.truncated)
+		}
+		for _, p := range res.Paths {
+			if !slices.ContainsFunc(want, func(w []uint64) bool { return slices.Equal(w, p) }) {
+				return fmt.Errorf("CausalPaths(a, g, %d) returned %v, want paths from %v", tc.limit, p, want)
+			}
+		}
+	}
+	res, err = pf.CausalPaths(a, g, 10)
+	if err != nil {
+		return fmt.Errorf("CausalPaths(a, g): %w", err)
+	}
+	meta, err := pf.CausalPathsMeta(a, g, 10)
+	if err != nil {
+		return fmt.Errorf("CausalPathsMeta(a, g): %w", err)
+	}
+	if meta.Length != res.Length || meta.Truncated != res.Truncated || len(meta.Paths) != len(res.Paths) {
+		return fmt.Errorf("CausalPathsMeta(a, g) = %+v, want the same paths as %+v", meta, res)
+	}
+	types := map[uint64]string{a: "a", bb: "b", c: "c", d: "d", e: "e", f: "f", g: "g"}
+	for i, p := range meta.Paths {
+		got := make([]uint64, len(p))
+		for j, pe := range p {
+			got[j] = pe.ID
+			if pe.Type != types[pe.ID] || pe.TimeUnixNano == 0 {
+				return fmt.Errorf("CausalPathsMeta(a, g) event %+v, want type %q and a timestamp", pe, types[pe.ID])
+			}
+		}
+		if !slices.Equal(got, res.Paths[i]) {
+			return fmt.Errorf("CausalPathsMeta(a, g) path %d = %v, want %v", i, got, res.Paths[i])
+		}
+	}
+
+	// 没有因果联系：方向相反、兄弟事件、无关的事件
+	for _, pair := range [][2]uint64{{d, a}, {bb, c}, {a, x}} {
+		res, err := pf.CausalPaths(pair[0], pair[1], 10)
+		if err != nil || res.Paths == nil || len(res.Paths) != 0 {
+			return fmt.Errorf("CausalPaths(%d, %d) = %+v, %v, want empty paths", pair[0], pair[1], res, err)
+		}
+	}
+	if res, err := pf.CausalPaths(a, a, 0); err != nil || res.Length != 0 || len(res.Paths) != 1 || !slices.Equal(res.Paths[0], []uint64{a}) {
+		return fmt.Errorf("CausalPaths(a, a) = %+v, %v, want the single path [a]", res, err)
+	}
+	if _, err := pf.CausalPaths(a, 999999, 0); !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("CausalPaths to a missing event error = %v, want ErrNotFound", err)
+	}
+	if _, err := pf.CausalPathsMeta(999999, a, 0); !errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("CausalPathsMeta from a missing event error = %v, want ErrNotFound", err)
+	}
+	return nil
+}
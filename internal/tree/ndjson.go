@@ -0,0 +1,31 @@
+package tree
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// NDJSONReader 从 r 中逐个解码换行分隔的 JSON 事件（/export 的输出格式），不把整个输入读入内存。
+type NDJSONReader struct {
+	dec *json.Decoder
+	n   int
+}
+
+// NewNDJSONReader 返回从 r 读取事件的 NDJSONReader。
+func NewNDJSONReader(r io.Reader) *NDJSONReader {
+	return &NDJSONReader{dec: json.NewDecoder(r)}
+}
+
+// Next 返回下一个事件；输入结束时返回 io.EOF，解码失败时返回带有记录序号（从 1 开始）的错误。
+func (r *NDJSONReader) Next() (Event, error) {
+	var ev Event
+	if err := r.dec.Decode(&ev); err != nil {
+		if err == io.EOF {
+			return Event{}, io.EOF
+		}
+		return Event{}, fmt.Errorf("record %d: %w", r.n+1, err)
+	}
+	r.n++
+	return ev, nil
+}
@@ -13,6 +13,9 @@ type Event struct {
 	Message      string          `json:"message,omitempty"`
 	Payload      json.RawMessage `json:"payload,omitempty"`
 	Parents      []uint64        `json:"parents"`
+
+	// Archived 非空表示该事件是一棵已归档根树的存根：后代事件已移入归档文件。
+	Archived *ArchiveStub `json:"archived,omitempty"`
 }
 
 // ===============================
@@ -27,10 +30,51 @@ type EmitRequest struct {
 	Parents []uint64        `json:"parents"`
 }
 
+// BatchEmitItem 是批量写入中的一项：Parents 引用已存在的事件，
+// LocalParents 按下标（从 0 开始）引用同一批中更早的项。
+type BatchEmitItem struct {
+	EmitRequest
+	LocalParents []int `json:"local_parents,omitempty"`
+}
+
+// EmitBatchRequest 是 /emit/batch 的请求体。
+type EmitBatchRequest struct {
+	Events []BatchEmitItem `json:"events"`
+}
+
 // TreeBatchRequest 用于批量查询 descendants/provenance。
+// MaxDepth / MaxNodes 非零时对每棵树分别生效，响应改为每个 ID 一页（见 TraverseOptions）。
 type TreeBatchRequest struct {
-	IDs  []uint64 `json:"ids"`
-	View string   `json:"view,omitempty"`
+	IDs      []uint64 `json:"ids"`
+	View     string   `json:"view,omitempty"`
+	MaxDepth int      `json:"max_depth,omitempty"`
+	MaxNodes int      `json:"max_nodes,omitempty"`
+}
+
+// TraverseOptions 限制一次后代树/溯源树遍历的规模，零值表示完整遍历。
+type TraverseOptions struct {
+	MaxDepth int    // 最大深度（根为 0），更深的节点不返回，0 表示不限制
+	MaxNodes int    // 本页最多返回的节点数，0 表示不限制
+	Cursor   string // 上一页返回的续页游标，为空表示第一页
+}
+
+// EventQuery 是按条件查询事件（/events、/search）的条件，结果按 ID 升序分页返回。
+// Type、时间范围与 Text 至少给出一个，同时给出时取交集。
+type EventQuery struct {
+	Type    string // 类型名，或以 ".*" 结尾的点分前缀（如 "task.*"），"*" 匹配全部类型；为空表示不按类型过滤
+	Text    string // Message 全文查询：词、以 "*" 结尾的前缀与双引号包围的短语，全部满足才匹配；为空表示不按内容过滤
+	From    int64  // 时间范围下界（Unix 纳秒，含），0 表示不限
+	To      int64  // 时间范围上界（Unix 纳秒，不含），0 表示不限
+	AfterID uint64 // 只返回 ID 大于它的事件，翻页时传入上一页的 NextAfterID
+	Limit   int    // 本页最多返回的事件数，0 表示由后端取默认值
+}
+
+// FieldLookup 是按 payload 字段值查找事件（/lookup）的条件，字段必须已建立索引。
+type FieldLookup struct {
+	Field   string // 点分的字段路径，如 "task_id"、"meta.run_id"
+	Value   string // 字符串字段比较其内容，数字与布尔字段比较 JSON 原文（如 "42"、"true"）
+	AfterID uint64 // 只返回 ID 大于它的事件，翻页时传入上一页的 NextAfterID
+	Limit   int    // 本页最多返回的 ID 数，0 表示由后端取默认值
 }
 
 // ===============================
@@ -42,11 +86,96 @@ type EmitResponse struct {
 	ID uint64 `json:"id"`
 }
 
+// EmitBatchResponse 是 /emit/batch 返回的响应体，IDs 与请求中的项一一对应。
+type EmitBatchResponse struct {
+	IDs []uint64 `json:"ids"`
+}
+
+// ReachPair 是一次可达性查询：From 是否是 To 的祖先。
+type ReachPair struct {
+	From uint64 `json:"from"`
+	To   uint64 `json:"to"`
+}
+
+// ReachResult 是 /reachable 的响应体。
+type ReachResult struct {
+	From      uint64 `json:"from"`
+	To        uint64 `json:"to"`
+	Reachable bool   `json:"reachable"`
+}
+
+// ReachBatchRequest 是 POST /reachable 的请求体。
+type ReachBatchRequest struct {
+	Pairs []ReachPair `json:"pairs"`
+}
+
+// ReachBatchResponse 是 POST /reachable 的响应体，Results 与 Pairs 一一对应。
+type ReachBatchResponse struct {
+	Results []ReachResult `json:"results"`
+}
+
+// CausalPaths 是 /path 的响应体：从 From 到 To 沿父子边的事件链，每条路径以 From 开头、以 To 结尾，按长度升序。
+// From 不是 To 的祖先时 Paths 为空；From 与 To 相同时只有一条仅含该事件的路径。
+type CausalPaths struct {
+	From      uint64     `json:"from"`
+	To        uint64     `json:"to"`
+	Length    int        `json:"length"` // 最短路径的边数
+	Paths     [][]uint64 `json:"paths"`
+	Truncated bool       `json:"truncated"` // 还有路径因数量限制未返回
+}
+
+// CausalPathsMeta 是 CausalPaths 的元数据视图，路径上的每个事件带有元数据。
+type CausalPathsMeta struct {
+	From      uint64        `json:"from"`
+	To        uint64        `json:"to"`
+	Length    int           `json:"length"`
+	Paths     [][]PathEvent `json:"paths"`
+	Truncated bool          `json:"truncated"`
+}
+
+// PathEvent 是 CausalPathsMeta 中路径上的一个事件。
+type PathEvent struct {
+	ID           uint64          `json:"id"`
+	TimeUnixNano int64           `json:"time_unix_nano"`
+	Type         string          `json:"type"`
+	Message      string          `json:"message,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Archived     *ArchiveStub    `json:"archived,omitempty"`
+}
+
+// ImportResult 是 /import 与 import 子命令的结果。
+type ImportResult struct {
+	Imported int    `json:"imported"`
+	FirstID  uint64 `json:"first_id"`
+	LastID   uint64 `json:"last_id"`
+}
+
+// EventPage 是一页按 ID 升序排列的查询结果。
+type EventPage struct {
+	Events      []Event `json:"events"`
+	NextAfterID uint64  `json:"next_after_id,omitempty"` // 可能还有更多结果时，作为下一页的 after_id
+}
+
+// IDPage 是一页按升序排列的事件 ID。
+type IDPage struct {
+	IDs         []uint64 `json:"ids"`
+	NextAfterID uint64   `json:"next_after_id,omitempty"` // 可能还有更多结果时，作为下一页的 after_id
+}
+
+// FieldIndexInfo 描述一个 payload 字段索引。
+type FieldIndexInfo struct {
+	Field  string `json:"field"`
+	Values int    `json:"values"` // 不同字段值的个数
+	Events int    `json:"events"` // 被索引的在线事件数
+}
+
 // DescendantsTree 用于表示某个事件及其所有后代（树形结构）
 type DescendantsTree struct {
-	ID       uint64            `json:"id"`
-	IsRef    bool              `json:"is_ref"`
-	Children []DescendantsTree `json:"children"`
+	ID        uint64            `json:"id"`
+	IsRef     bool              `json:"is_ref"`
+	Truncated bool              `json:"truncated,omitempty"` // 因深度或节点数限制，部分子事件未返回
+	Children  []DescendantsTree `json:"children"`
+	Error     string            `json:"error,omitempty"` // 仅批量查询的顶层树：根 ID 无效的原因，此时其余字段为空
 }
 
 // DescendantsTreeMeta 用于表示某个事件及其所有后代（树形结构），并且包含时间戳
@@ -57,14 +186,19 @@ type DescendantsTreeMeta struct {
 	IsRef        bool                  `json:"is_ref"`
 	Message      string                `json:"message,omitempty"`
 	Payload      json.RawMessage       `json:"payload,omitempty"`
+	Archived     *ArchiveStub          `json:"archived,omitempty"`
+	Truncated    bool                  `json:"truncated,omitempty"`
 	Children     []DescendantsTreeMeta `json:"children"`
+	Error        string                `json:"error,omitempty"`
 }
 
 // ProvenanceTree 用于表示某个事件及其所有祖先（树形结构，向上追溯）
 type ProvenanceTree struct {
-	ID      uint64           `json:"id"`
-	IsRef   bool             `json:"is_ref"`
-	Parents []ProvenanceTree `json:"parents"`
+	ID        uint64           `json:"id"`
+	IsRef     bool             `json:"is_ref"`
+	Truncated bool             `json:"truncated,omitempty"` // 因深度或节点数限制，部分父事件未返回
+	Parents   []ProvenanceTree `json:"parents"`
+	Error     string           `json:"error,omitempty"` // 仅批量查询的顶层树：根 ID 无效的原因，此时其余字段为空
 }
 
 // ProvenanceTreeMeta 用于表示某个事件及其所有祖先（树形结构），并且包含时间戳和类型
@@ -75,7 +209,61 @@ type ProvenanceTreeMeta struct {
 	IsRef        bool                 `json:"is_ref"`
 	Message      string               `json:"message,omitempty"`
 	Payload      json.RawMessage      `json:"payload,omitempty"`
+	Truncated    bool                 `json:"truncated,omitempty"`
 	Parents      []ProvenanceTreeMeta `json:"parents"`
+	Error        string               `json:"error,omitempty"`
+}
+
+// DescendantsPage 是一页有界的后代树遍历结果。第一页只有一棵以请求 ID 为根的树；
+// 续页中的每棵树以此前某页中被截断的节点为根，只包含它尚未返回的子事件，客户端按 ID 把它们接回原树。
+// 游标不携带已访问集合：之前页中已展开的节点在续页中再次出现时会被再次展开，而不是像完整遍历那样输出为引用节点。
+type DescendantsPage struct {
+	Trees     []DescendantsTree `json:"trees"`
+	Truncated bool              `json:"truncated"`        // 本页有节点被深度或节点数限制截断
+	Cursor    string            `json:"cursor,omitempty"` // 因节点数限制未返回的部分可用该游标继续
+}
+
+// DescendantsMetaPage 是 DescendantsPage 的元数据视图。
+type DescendantsMetaPage struct {
+	Trees     []DescendantsTreeMeta `json:"trees"`
+	Truncated bool                  `json:"truncated"`
+	Cursor    string                `json:"cursor,omitempty"`
+}
+
+// ProvenancePage 是一页有界的溯源树遍历结果，续页规则与 DescendantsPage 相同。
+type ProvenancePage struct {
+	Trees     []ProvenanceTree `json:"trees"`
+	Truncated bool             `json:"truncated"`
+	Cursor    string           `json:"cursor,omitempty"`
+}
+
+// ProvenanceMetaPage 是 ProvenancePage 的元数据视图。
+type ProvenanceMetaPage struct {
+	Trees     []ProvenanceTreeMeta `json:"trees"`
+	Truncated bool                 `json:"truncated"`
+	Cursor    string               `json:"cursor,omitempty"`
+}
+
+// StreamOptions 控制后代树/溯源树的流式遍历。
+type StreamOptions struct {
+	Meta     bool   // 记录中携带事件元数据
+	MaxDepth int    // 最大深度（根为 0），0 表示不限制
+	UntilID  uint64 // 水位线：只遍历 ID 不超过它的事件，0 表示开始遍历时已分配的最大 ID
+}
+
+// TreeRecord 是流式遍历输出的一个节点。记录按前序输出，客户端可按 From 与 Depth 还原嵌套的树。
+type TreeRecord struct {
+	ID           uint64          `json:"id"`
+	From         uint64          `json:"from"` // 树中的上一层节点（后代树中是父事件，溯源树中是子事件），根为 0
+	Depth        int             `json:"depth"`
+	IsRef        bool            `json:"is_ref"`
+	Truncated    bool            `json:"truncated,omitempty"`
+	Watermark    uint64          `json:"watermark,omitempty"` // 仅根记录携带：本次遍历的 ID 水位线
+	TimeUnixNano int64           `json:"time_unix_nano,omitempty"`
+	Type         string          `json:"type,omitempty"`
+	Message      string          `json:"message,omitempty"`
+	Payload      json.RawMessage `json:"payload,omitempty"`
+	Archived     *ArchiveStub    `json:"archived,omitempty"`
 }
 
 // Snapshot 是系统运行时状态的快照，用于监控和调试。
@@ -87,6 +275,79 @@ type Snapshot struct {
 	Heads       int    `json:"heads"`
 	Subscribers int    `json:"subscribers"`
 	NextEventID uint64 `json:"next_event_id"`
+	SSEDropped  uint64 `json:"sse_dropped"` // 因订阅者跟不上而丢弃的 SSE 事件数
+
+	TotalEvents       int            `json:"total_events"`        // 在线事件总数（HotEvents + ColdEvents，不含已归档的事件）
+	TotalPayloadBytes int64          `json:"total_payload_bytes"` // 在线事件 payload 的原始字节数（含冷数据）
+	TypeCounts        map[string]int `json:"type_counts"`         // 各类型的在线事件数
+	MaxFanout         int            `json:"max_fanout"`          // 单个事件的最大子事件数
+	EmitRate1m        float64        `json:"emit_rate_1m"`        // 最近 1 分钟平均每秒写入的事件数
+	EmitRate5m        float64        `json:"emit_rate_5m"`        // 最近 5 分钟平均每秒写入的事件数
+	EmitRate15m       float64        `json:"emit_rate_15m"`       // 最近 15 分钟平均每秒写入的事件数
+
+	HotEvents    int `json:"hot_events"`    // 常驻内存的事件数
+	ColdEvents   int `json:"cold_events"`   // 已移入磁盘冷数据段的事件数
+	ColdSegments int `json:"cold_segments"` // 冷数据段文件数
+
+	PayloadBytes       int64 `json:"payload_bytes"`        // 内存中事件 payload 的原始字节数
+	PayloadStoredBytes int64 `json:"payload_stored_bytes"` // 同上，按实际存储（压缩且去重后）计算的字节数
+	PayloadDedupBytes  int64 `json:"payload_dedup_bytes"`  // 去重节省的字节数
+	PayloadUnique      int   `json:"payload_unique"`       // 去重表中的不同 payload 数
+	PayloadSharedRefs  int   `json:"payload_shared_refs"`  // 引用去重表的内存事件数
+
+	EventLayout   string  `json:"event_layout"`    // 热事件的内存布局：struct 或 compact
+	EventBytes    int64   `json:"event_bytes"`     // 常驻内存事件除 payload 外的估算占用
+	BytesPerEvent float64 `json:"bytes_per_event"` // EventBytes / HotEvents，即每个事件除 payload 外的平均占用
+
+	TextTerms      int   `json:"text_terms"`       // Message 全文索引中不同的词数，索引关闭时为 0
+	TextPostings   int   `json:"text_postings"`    // 全文索引中的（词, 事件）项数，含尚未压缩掉的已归档事件
+	TextIndexBytes int64 `json:"text_index_bytes"` // 全文索引的估算内存占用
+
+	ReachIndexBytes int64 `json:"reach_index_bytes"` // 可达性索引（链标签）的估算内存占用
+	ReachWideLabels int   `json:"reach_wide_labels"` // 祖先过多、查询时改为回溯的宽标签数
+
+	IndexBytes     int64    `json:"index_bytes"`                // children、heads/roots、可达性标签、各类索引与去重表的估算占用
+	MemoryBytes    int64    `json:"memory_bytes"`               // 估算内存占用：常驻内存事件（含 payload）加 IndexBytes
+	MaxEvents      int      `json:"max_events,omitempty"`       // 常驻内存事件数上限
+	MaxMemoryBytes int64    `json:"max_memory_bytes,omitempty"` // 常驻内存占用上限
+	RejectedEmits  uint64   `json:"rejected_emits,omitempty"`   // 因达到上限被拒绝的写入次数
+	Warnings       []string `json:"warnings,omitempty"`         // 软限制告警：内存占用超过上限的 90%
+}
+
+// CheckpointInfo 描述一次持久化快照（checkpoint）的元信息。
+type CheckpointInfo struct {
+	ID          uint64  `json:"id"`            // 快照编号，等于快照之后第一个 WAL 日志段的序号
+	LastEventID uint64  `json:"last_event_id"` // 快照覆盖到的最大事件 ID
+	Events      int     `json:"events"`
+	SizeBytes   int64   `json:"size_bytes"`
+	CreatedAt   int64   `json:"created_at"` // Unix 秒
+	AgeSeconds  float64 `json:"age_seconds"`
+}
+
+// VerifyReport 是一致性检查（/admin/verify 与 fsck 子命令）的结果，OK 为 false 时 Violations 非空。
+type VerifyReport struct {
+	OK         bool        `json:"ok"`
+	Events     int         `json:"events"`             // 检查的在线事件数
+	Files      int         `json:"files"`              // 校验的持久化文件数
+	Violations []Violation `json:"violations"`         // 不变量被破坏或文件损坏
+	Warnings   []Violation `json:"warnings,omitempty"` // 可自动修复或无害的异常，如 WAL 残缺尾部、孤儿文件
+	Omitted    int         `json:"omitted,omitempty"`  // 超出上限未列出的违规数
+}
+
+// Violation 描述一条检查失败：Check 是稳定的检查项名称，ID 与 File 指出出错的事件或文件。
+type Violation struct {
+	Check  string `json:"check"`
+	ID     uint64 `json:"id,omitempty"`
+	File   string `json:"file,omitempty"`
+	Detail string `json:"detail"`
+}
+
+// ArchiveStub 描述一棵已归档的根树：根事件保留在存储中，后代事件移入压缩归档文件。
+type ArchiveStub struct {
+	Root        uint64 `json:"root"`
+	Events      int    `json:"events"`        // 归档的后代事件数（不含根事件）
+	LastEventID uint64 `json:"last_event_id"` // 树中最大的事件 ID
+	ArchivedAt  int64  `json:"archived_at"`   // 归档时间（Unix 秒）
 }
 
 // ===============================
@@ -108,3 +369,31 @@ type RootIDError struct {
 func (e *RootIDError) Error() string {
 	return fmt.Sprintf("invalid id %d: %s", e.ID, e.Reason)
 }
+
+// CursorError 表示续页游标无效：格式错误，或不属于本次请求的根与遍历方向。
+type CursorError struct {
+	Reason string
+}
+
+func (e *CursorError) Error() string {
+	return "invalid cursor: " + e.Reason
+}
+
+// QueryError 表示事件查询的条件无效，例如类型模式不合法。
+type QueryError struct {
+	Reason string
+}
+
+func (e *QueryError) Error() string {
+	return "invalid query: " + e.Reason
+}
+
+// EmitError 表示写入请求本身无效，例如缺少类型、父事件不存在或事件超过大小上限；
+// 与 WAL 写入失败等服务端错误区分，客户端修正请求后可以重试。
+type EmitError struct {
+	Reason string
+}
+
+func (e *EmitError) Error() string {
+	return e.Reason
+}
@@ -134,6 +134,689 @@ func (x *EmitResponse) GetId() uint64 {
 	return 0
 }
 
+// EmitAck 是 EmitStream 对每条请求的应答，与请求一一对应、按请求顺序返回。
+type EmitAck struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Seq           uint64                 `protobuf:"varint,1,opt,name=seq,proto3" json:"seq,omitempty"`    // 请求在流中的序号（从 1 开始）
+	Id            uint64                 `protobuf:"varint,2,opt,name=id,proto3" json:"id,omitempty"`      // 成功时分配的事件 ID
+	Code          uint32                 `protobuf:"varint,3,opt,name=code,proto3" json:"code,omitempty"`  // 失败时的 gRPC 状态码，成功为 0（OK）
+	Error         string                 `protobuf:"bytes,4,opt,name=error,proto3" json:"error,omitempty"` // 失败原因
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmitAck) Reset() {
+	*x = EmitAck{}
+	mi := &file_proto_celestialtree_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmitAck) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmitAck) ProtoMessage() {}
+
+func (x *EmitAck) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmitAck.ProtoReflect.Descriptor instead.
+func (*EmitAck) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *EmitAck) GetSeq() uint64 {
+	if x != nil {
+		return x.Seq
+	}
+	return 0
+}
+
+func (x *EmitAck) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *EmitAck) GetCode() uint32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *EmitAck) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+// EmitBatchItem 是批量写入中的一项，字段同 EmitRequest。
+type EmitBatchItem struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Type          string                 `protobuf:"bytes,1,opt,name=type,proto3" json:"type,omitempty"`
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`
+	Payload       *structpb.Struct       `protobuf:"bytes,3,opt,name=payload,proto3" json:"payload,omitempty"`
+	Parents       []uint64               `protobuf:"varint,4,rep,packed,name=parents,proto3" json:"parents,omitempty"`                               // 已存在的父事件 ID
+	LocalParents  []uint32               `protobuf:"varint,5,rep,packed,name=local_parents,json=localParents,proto3" json:"local_parents,omitempty"` // 同一批中更早的项的下标（从 0 开始）
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmitBatchItem) Reset() {
+	*x = EmitBatchItem{}
+	mi := &file_proto_celestialtree_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmitBatchItem) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmitBatchItem) ProtoMessage() {}
+
+func (x *EmitBatchItem) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmitBatchItem.ProtoReflect.Descriptor instead.
+func (*EmitBatchItem) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *EmitBatchItem) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *EmitBatchItem) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *EmitBatchItem) GetPayload() *structpb.Struct {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *EmitBatchItem) GetParents() []uint64 {
+	if x != nil {
+		return x.Parents
+	}
+	return nil
+}
+
+func (x *EmitBatchItem) GetLocalParents() []uint32 {
+	if x != nil {
+		return x.LocalParents
+	}
+	return nil
+}
+
+// EmitBatchRequest 以一次提交写入 events，全部成功或全部失败。
+type EmitBatchRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Events        []*EmitBatchItem       `protobuf:"bytes,1,rep,name=events,proto3" json:"events,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmitBatchRequest) Reset() {
+	*x = EmitBatchRequest{}
+	mi := &file_proto_celestialtree_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmitBatchRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmitBatchRequest) ProtoMessage() {}
+
+func (x *EmitBatchRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmitBatchRequest.ProtoReflect.Descriptor instead.
+func (*EmitBatchRequest) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *EmitBatchRequest) GetEvents() []*EmitBatchItem {
+	if x != nil {
+		return x.Events
+	}
+	return nil
+}
+
+type EmitBatchResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Ids           []uint64               `protobuf:"varint,1,rep,packed,name=ids,proto3" json:"ids,omitempty"` // 与 events 一一对应，ID 连续
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *EmitBatchResponse) Reset() {
+	*x = EmitBatchResponse{}
+	mi := &file_proto_celestialtree_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *EmitBatchResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*EmitBatchResponse) ProtoMessage() {}
+
+func (x *EmitBatchResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use EmitBatchResponse.ProtoReflect.Descriptor instead.
+func (*EmitBatchResponse) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *EmitBatchResponse) GetIds() []uint64 {
+	if x != nil {
+		return x.Ids
+	}
+	return nil
+}
+
+// TreeRequest 查询以 id 为根的后代树或溯源树；max_depth、max_nodes 为 0 表示不限制。
+type TreeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	View          string                 `protobuf:"bytes,2,opt,name=view,proto3" json:"view,omitempty"`                          // "struct"（默认）或 "meta"
+	MaxDepth      uint32                 `protobuf:"varint,3,opt,name=max_depth,json=maxDepth,proto3" json:"max_depth,omitempty"` // 最大深度（根为 0）
+	MaxNodes      uint32                 `protobuf:"varint,4,opt,name=max_nodes,json=maxNodes,proto3" json:"max_nodes,omitempty"` // 本页最多返回的节点数
+	Cursor        string                 `protobuf:"bytes,5,opt,name=cursor,proto3" json:"cursor,omitempty"`                      // 上一页返回的续页游标
+	UntilId       uint64                 `protobuf:"varint,6,opt,name=until_id,json=untilId,proto3" json:"until_id,omitempty"`    // 仅流式 RPC：ID 水位线，0 表示当前最大 ID
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TreeRequest) Reset() {
+	*x = TreeRequest{}
+	mi := &file_proto_celestialtree_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TreeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TreeRequest) ProtoMessage() {}
+
+func (x *TreeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TreeRequest.ProtoReflect.Descriptor instead.
+func (*TreeRequest) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *TreeRequest) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TreeRequest) GetView() string {
+	if x != nil {
+		return x.View
+	}
+	return ""
+}
+
+func (x *TreeRequest) GetMaxDepth() uint32 {
+	if x != nil {
+		return x.MaxDepth
+	}
+	return 0
+}
+
+func (x *TreeRequest) GetMaxNodes() uint32 {
+	if x != nil {
+		return x.MaxNodes
+	}
+	return 0
+}
+
+func (x *TreeRequest) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+func (x *TreeRequest) GetUntilId() uint64 {
+	if x != nil {
+		return x.UntilId
+	}
+	return 0
+}
+
+type ArchiveStub struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Root          uint64                 `protobuf:"varint,1,opt,name=root,proto3" json:"root,omitempty"`
+	Events        int64                  `protobuf:"varint,2,opt,name=events,proto3" json:"events,omitempty"`
+	LastEventId   uint64                 `protobuf:"varint,3,opt,name=last_event_id,json=lastEventId,proto3" json:"last_event_id,omitempty"`
+	ArchivedAt    int64                  `protobuf:"varint,4,opt,name=archived_at,json=archivedAt,proto3" json:"archived_at,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ArchiveStub) Reset() {
+	*x = ArchiveStub{}
+	mi := &file_proto_celestialtree_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ArchiveStub) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ArchiveStub) ProtoMessage() {}
+
+func (x *ArchiveStub) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ArchiveStub.ProtoReflect.Descriptor instead.
+func (*ArchiveStub) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ArchiveStub) GetRoot() uint64 {
+	if x != nil {
+		return x.Root
+	}
+	return 0
+}
+
+func (x *ArchiveStub) GetEvents() int64 {
+	if x != nil {
+		return x.Events
+	}
+	return 0
+}
+
+func (x *ArchiveStub) GetLastEventId() uint64 {
+	if x != nil {
+		return x.LastEventId
+	}
+	return 0
+}
+
+func (x *ArchiveStub) GetArchivedAt() int64 {
+	if x != nil {
+		return x.ArchivedAt
+	}
+	return 0
+}
+
+// TreeNode 是后代树或溯源树的节点；children 为下一层（子事件或父事件），元数据字段仅在 view=meta 时填充。
+type TreeNode struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	IsRef         bool                   `protobuf:"varint,2,opt,name=is_ref,json=isRef,proto3" json:"is_ref,omitempty"`
+	Truncated     bool                   `protobuf:"varint,3,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	Children      []*TreeNode            `protobuf:"bytes,4,rep,name=children,proto3" json:"children,omitempty"`
+	TimeUnixNano  int64                  `protobuf:"varint,5,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Type          string                 `protobuf:"bytes,6,opt,name=type,proto3" json:"type,omitempty"`
+	Message       string                 `protobuf:"bytes,7,opt,name=message,proto3" json:"message,omitempty"`
+	Payload       *structpb.Value        `protobuf:"bytes,8,opt,name=payload,proto3" json:"payload,omitempty"`
+	Archived      *ArchiveStub           `protobuf:"bytes,9,opt,name=archived,proto3" json:"archived,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TreeNode) Reset() {
+	*x = TreeNode{}
+	mi := &file_proto_celestialtree_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TreeNode) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TreeNode) ProtoMessage() {}
+
+func (x *TreeNode) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TreeNode.ProtoReflect.Descriptor instead.
+func (*TreeNode) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *TreeNode) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TreeNode) GetIsRef() bool {
+	if x != nil {
+		return x.IsRef
+	}
+	return false
+}
+
+func (x *TreeNode) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *TreeNode) GetChildren() []*TreeNode {
+	if x != nil {
+		return x.Children
+	}
+	return nil
+}
+
+func (x *TreeNode) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *TreeNode) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *TreeNode) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *TreeNode) GetPayload() *structpb.Value {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *TreeNode) GetArchived() *ArchiveStub {
+	if x != nil {
+		return x.Archived
+	}
+	return nil
+}
+
+// TreePage 是一页遍历结果，语义与 HTTP 分页响应相同。
+type TreePage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Trees         []*TreeNode            `protobuf:"bytes,1,rep,name=trees,proto3" json:"trees,omitempty"`
+	Truncated     bool                   `protobuf:"varint,2,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	Cursor        string                 `protobuf:"bytes,3,opt,name=cursor,proto3" json:"cursor,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TreePage) Reset() {
+	*x = TreePage{}
+	mi := &file_proto_celestialtree_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TreePage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TreePage) ProtoMessage() {}
+
+func (x *TreePage) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TreePage.ProtoReflect.Descriptor instead.
+func (*TreePage) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *TreePage) GetTrees() []*TreeNode {
+	if x != nil {
+		return x.Trees
+	}
+	return nil
+}
+
+func (x *TreePage) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *TreePage) GetCursor() string {
+	if x != nil {
+		return x.Cursor
+	}
+	return ""
+}
+
+// TreeRecord 是流式遍历按前序输出的一个节点，from 为树中的上一层节点（根为 0）。
+type TreeRecord struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	From          uint64                 `protobuf:"varint,2,opt,name=from,proto3" json:"from,omitempty"`
+	Depth         uint32                 `protobuf:"varint,3,opt,name=depth,proto3" json:"depth,omitempty"`
+	IsRef         bool                   `protobuf:"varint,4,opt,name=is_ref,json=isRef,proto3" json:"is_ref,omitempty"`
+	Truncated     bool                   `protobuf:"varint,5,opt,name=truncated,proto3" json:"truncated,omitempty"`
+	Watermark     uint64                 `protobuf:"varint,6,opt,name=watermark,proto3" json:"watermark,omitempty"` // 仅根记录携带
+	TimeUnixNano  int64                  `protobuf:"varint,7,opt,name=time_unix_nano,json=timeUnixNano,proto3" json:"time_unix_nano,omitempty"`
+	Type          string                 `protobuf:"bytes,8,opt,name=type,proto3" json:"type,omitempty"`
+	Message       string                 `protobuf:"bytes,9,opt,name=message,proto3" json:"message,omitempty"`
+	Payload       *structpb.Value        `protobuf:"bytes,10,opt,name=payload,proto3" json:"payload,omitempty"`
+	Archived      *ArchiveStub           `protobuf:"bytes,11,opt,name=archived,proto3" json:"archived,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *TreeRecord) Reset() {
+	*x = TreeRecord{}
+	mi := &file_proto_celestialtree_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TreeRecord) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TreeRecord) ProtoMessage() {}
+
+func (x *TreeRecord) ProtoReflect() protoreflect.Message {
+	mi := &file_proto_celestialtree_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TreeRecord.ProtoReflect.Descriptor instead.
+func (*TreeRecord) Descriptor() ([]byte, []int) {
+	return file_proto_celestialtree_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *TreeRecord) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *TreeRecord) GetFrom() uint64 {
+	if x != nil {
+		return x.From
+	}
+	return 0
+}
+
+func (x *TreeRecord) GetDepth() uint32 {
+	if x != nil {
+		return x.Depth
+	}
+	return 0
+}
+
+func (x *TreeRecord) GetIsRef() bool {
+	if x != nil {
+		return x.IsRef
+	}
+	return false
+}
+
+func (x *TreeRecord) GetTruncated() bool {
+	if x != nil {
+		return x.Truncated
+	}
+	return false
+}
+
+func (x *TreeRecord) GetWatermark() uint64 {
+	if x != nil {
+		return x.Watermark
+	}
+	return 0
+}
+
+func (x *TreeRecord) GetTimeUnixNano() int64 {
+	if x != nil {
+		return x.TimeUnixNano
+	}
+	return 0
+}
+
+func (x *TreeRecord) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+func (x *TreeRecord) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *TreeRecord) GetPayload() *structpb.Value {
+	if x != nil {
+		return x.Payload
+	}
+	return nil
+}
+
+func (x *TreeRecord) GetArchived() *ArchiveStub {
+	if x != nil {
+		return x.Archived
+	}
+	return nil
+}
+
 var File_proto_celestialtree_proto protoreflect.FileDescriptor
 
 const file_proto_celestialtree_proto_rawDesc = "" +
@@ -145,9 +828,73 @@ const file_proto_celestialtree_proto_rawDesc = "" +
 	"\apayload\x18\x03 \x01(\v2\x17.google.protobuf.StructR\apayload\x12\x18\n" +
 	"\aparents\x18\x04 \x03(\x04R\aparents\"\x1e\n" +
 	"\fEmitResponse\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\x04R\x02id2]\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\"U\n" +
+	"\aEmitAck\x12\x10\n" +
+	"\x03seq\x18\x01 \x01(\x04R\x03seq\x12\x0e\n" +
+	"\x02id\x18\x02 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04code\x18\x03 \x01(\rR\x04code\x12\x14\n" +
+	"\x05error\x18\x04 \x01(\tR\x05error\"\xaf\x01\n" +
+	"\rEmitBatchItem\x12\x12\n" +
+	"\x04type\x18\x01 \x01(\tR\x04type\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x121\n" +
+	"\apayload\x18\x03 \x01(\v2\x17.google.protobuf.StructR\apayload\x12\x18\n" +
+	"\aparents\x18\x04 \x03(\x04R\aparents\x12#\n" +
+	"\rlocal_parents\x18\x05 \x03(\rR\flocalParents\"K\n" +
+	"\x10EmitBatchRequest\x127\n" +
+	"\x06events\x18\x01 \x03(\v2\x1f.celestialtree.v1.EmitBatchItemR\x06events\"%\n" +
+	"\x11EmitBatchResponse\x12\x10\n" +
+	"\x03ids\x18\x01 \x03(\x04R\x03ids\"\x9e\x01\n" +
+	"\vTreeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04view\x18\x02 \x01(\tR\x04view\x12\x1b\n" +
+	"\tmax_depth\x18\x03 \x01(\rR\bmaxDepth\x12\x1b\n" +
+	"\tmax_nodes\x18\x04 \x01(\rR\bmaxNodes\x12\x16\n" +
+	"\x06cursor\x18\x05 \x01(\tR\x06cursor\x12\x19\n" +
+	"\buntil_id\x18\x06 \x01(\x04R\auntilId\"~\n" +
+	"\vArchiveStub\x12\x12\n" +
+	"\x04root\x18\x01 \x01(\x04R\x04root\x12\x16\n" +
+	"\x06events\x18\x02 \x01(\x03R\x06events\x12\"\n" +
+	"\rlast_event_id\x18\x03 \x01(\x04R\vlastEventId\x12\x1f\n" +
+	"\varchived_at\x18\x04 \x01(\x03R\n" +
+	"archivedAt\"\xc8\x02\n" +
+	"\bTreeNode\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x15\n" +
+	"\x06is_ref\x18\x02 \x01(\bR\x05isRef\x12\x1c\n" +
+	"\ttruncated\x18\x03 \x01(\bR\ttruncated\x126\n" +
+	"\bchildren\x18\x04 \x03(\v2\x1a.celestialtree.v1.TreeNodeR\bchildren\x12$\n" +
+	"\x0etime_unix_nano\x18\x05 \x01(\x03R\ftimeUnixNano\x12\x12\n" +
+	"\x04type\x18\x06 \x01(\tR\x04type\x12\x18\n" +
+	"\amessage\x18\a \x01(\tR\amessage\x120\n" +
+	"\apayload\x18\b \x01(\v2\x16.google.protobuf.ValueR\apayload\x129\n" +
+	"\barchived\x18\t \x01(\v2\x1d.celestialtree.v1.ArchiveStubR\barchived\"r\n" +
+	"\bTreePage\x120\n" +
+	"\x05trees\x18\x01 \x03(\v2\x1a.celestialtree.v1.TreeNodeR\x05trees\x12\x1c\n" +
+	"\ttruncated\x18\x02 \x01(\bR\ttruncated\x12\x16\n" +
+	"\x06cursor\x18\x03 \x01(\tR\x06cursor\"\xda\x02\n" +
+	"\n" +
+	"TreeRecord\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x12\n" +
+	"\x04from\x18\x02 \x01(\x04R\x04from\x12\x14\n" +
+	"\x05depth\x18\x03 \x01(\rR\x05depth\x12\x15\n" +
+	"\x06is_ref\x18\x04 \x01(\bR\x05isRef\x12\x1c\n" +
+	"\ttruncated\x18\x05 \x01(\bR\ttruncated\x12\x1c\n" +
+	"\twatermark\x18\x06 \x01(\x04R\twatermark\x12$\n" +
+	"\x0etime_unix_nano\x18\a \x01(\x03R\ftimeUnixNano\x12\x12\n" +
+	"\x04type\x18\b \x01(\tR\x04type\x12\x18\n" +
+	"\amessage\x18\t \x01(\tR\amessage\x120\n" +
+	"\apayload\x18\n" +
+	" \x01(\v2\x16.google.protobuf.ValueR\apayload\x129\n" +
+	"\barchived\x18\v \x01(\v2\x1d.celestialtree.v1.ArchiveStubR\barchived2\xb9\x04\n" +
 	"\x14CelestialTreeService\x12E\n" +
-	"\x04Emit\x12\x1d.celestialtree.v1.EmitRequest\x1a\x1e.celestialtree.v1.EmitResponseB2Z0github.com/Mr-xiaotian/CelestialTree/proto;protob\x06proto3"
+	"\x04Emit\x12\x1d.celestialtree.v1.EmitRequest\x1a\x1e.celestialtree.v1.EmitResponse\x12T\n" +
+	"\tEmitBatch\x12\".celestialtree.v1.EmitBatchRequest\x1a#.celestialtree.v1.EmitBatchResponse\x12J\n" +
+	"\n" +
+	"EmitStream\x12\x1d.celestialtree.v1.EmitRequest\x1a\x19.celestialtree.v1.EmitAck(\x010\x01\x12H\n" +
+	"\vDescendants\x12\x1d.celestialtree.v1.TreeRequest\x1a\x1a.celestialtree.v1.TreePage\x12G\n" +
+	"\n" +
+	"Provenance\x12\x1d.celestialtree.v1.TreeRequest\x1a\x1a.celestialtree.v1.TreePage\x12R\n" +
+	"\x11DescendantsStream\x12\x1d.celestialtree.v1.TreeRequest\x1a\x1c.celestialtree.v1.TreeRecord0\x01\x12Q\n" +
+	"\x10ProvenanceStream\x12\x1d.celestialtree.v1.TreeRequest\x1a\x1c.celestialtree.v1.TreeRecord0\x01B2Z0github.com/Mr-xiaotian/CelestialTree/proto;protob\x06proto3"
 
 var (
 	file_proto_celestialtree_proto_rawDescOnce sync.Once
@@ -161,21 +908,51 @@ func file_proto_celestialtree_proto_rawDescGZIP() []byte {
 	return file_proto_celestialtree_proto_rawDescData
 }
 
-var file_proto_celestialtree_proto_msgTypes = make([]protoimpl.MessageInfo, 2)
+var file_proto_celestialtree_proto_msgTypes = make([]protoimpl.MessageInfo, 11)
 var file_proto_celestialtree_proto_goTypes = []any{
-	(*EmitRequest)(nil),     // 0: celestialtree.v1.EmitRequest
-	(*EmitResponse)(nil),    // 1: celestialtree.v1.EmitResponse
-	(*structpb.Struct)(nil), // 2: google.protobuf.Struct
+	(*EmitRequest)(nil),       // 0: celestialtree.v1.EmitRequest
+	(*EmitResponse)(nil),      // 1: celestialtree.v1.EmitResponse
+	(*EmitAck)(nil),           // 2: celestialtree.v1.EmitAck
+	(*EmitBatchItem)(nil),     // 3: celestialtree.v1.EmitBatchItem
+	(*EmitBatchRequest)(nil),  // 4: celestialtree.v1.EmitBatchRequest
+	(*EmitBatchResponse)(nil), // 5: celestialtree.v1.EmitBatchResponse
+	(*TreeRequest)(nil),       // 6: celestialtree.v1.TreeRequest
+	(*ArchiveStub)(nil),       // 7: celestialtree.v1.ArchiveStub
+	(*TreeNode)(nil),          // 8: celestialtree.v1.TreeNode
+	(*TreePage)(nil),          // 9: celestialtree.v1.TreePage
+	(*TreeRecord)(nil),        // 10: celestialtree.v1.TreeRecord
+	(*structpb.Struct)(nil),   // 11: google.protobuf.Struct
+	(*structpb.Value)(nil),    // 12: google.protobuf.Value
 }
 var file_proto_celestialtree_proto_depIdxs = []int32{
-	2, // 0: celestialtree.v1.EmitRequest.payload:type_name -> google.protobuf.Struct
-	0, // 1: celestialtree.v1.CelestialTreeService.Emit:input_type -> celestialtree.v1.EmitRequest
-	1, // 2: celestialtree.v1.CelestialTreeService.Emit:output_type -> celestialtree.v1.EmitResponse
-	2, // [2:3] is the sub-list for method output_type
-	1, // [1:2] is the sub-list for method input_type
-	1, // [1:1] is the sub-list for extension type_name
-	1, // [1:1] is the sub-list for extension extendee
-	0, // [0:1] is the sub-list for field type_name
+	11, // 0: celestialtree.v1.EmitRequest.payload:type_name -> google.protobuf.Struct
+	11, // 1: celestialtree.v1.EmitBatchItem.payload:type_name -> google.protobuf.Struct
+	3,  // 2: celestialtree.v1.EmitBatchRequest.events:type_name -> celestialtree.v1.EmitBatchItem
+	8,  // 3: celestialtree.v1.TreeNode.children:type_name -> celestialtree.v1.TreeNode
+	12, // 4: celestialtree.v1.TreeNode.payload:type_name -> google.protobuf.Value
+	7,  // 5: celestialtree.v1.TreeNode.archived:type_name -> celestialtree.v1.ArchiveStub
+	8,  // 6: celestialtree.v1.TreePage.trees:type_name -> celestialtree.v1.TreeNode
+	12, // 7: celestialtree.v1.TreeRecord.payload:type_name -> google.protobuf.Value
+	7,  // 8: celestialtree.v1.TreeRecord.archived:type_name -> celestialtree.v1.ArchiveStub
+	0,  // 9: celestialtree.v1.CelestialTreeService.Emit:input_type -> celestialtree.v1.EmitRequest
+	4,  // 10: celestialtree.v1.CelestialTreeService.EmitBatch:input_type -> celestialtree.v1.EmitBatchRequest
+	0,  // 11: celestialtree.v1.CelestialTreeService.EmitStream:input_type -> celestialtree.v1.EmitRequest
+	6,  // 12: celestialtree.v1.CelestialTreeService.Descendants:input_type -> celestialtree.v1.TreeRequest
+	6,  // 13: celestialtree.v1.CelestialTreeService.Provenance:input_type -> celestialtree.v1.TreeRequest
+	6,  // 14: celestialtree.v1.CelestialTreeService.DescendantsStream:input_type -> celestialtree.v1.TreeRequest
+	6,  // 15: celestialtree.v1.CelestialTreeService.ProvenanceStream:input_type -> celestialtree.v1.TreeRequest
+	1,  // 16: celestialtree.v1.CelestialTreeService.Emit:output_type -> celestialtree.v1.EmitResponse
+	5,  // 17: celestialtree.v1.CelestialTreeService.EmitBatch:output_type -> celestialtree.v1.EmitBatchResponse
+	2,  // 18: celestialtree.v1.CelestialTreeService.EmitStream:output_type -> celestialtree.v1.EmitAck
+	9,  // 19: celestialtree.v1.CelestialTreeService.Descendants:output_type -> celestialtree.v1.TreePage
+	9,  // 20: celestialtree.v1.CelestialTreeService.Provenance:output_type -> celestialtree.v1.TreePage
+	10, // 21: celestialtree.v1.CelestialTreeService.DescendantsStream:output_type -> celestialtree.v1.TreeRecord
+	10, // 22: celestialtree.v1.CelestialTreeService.ProvenanceStream:output_type -> celestialtree.v1.TreeRecord
+	16, // [16:23] is the sub-list for method output_type
+	9,  // [9:16] is the sub-list for method input_type
+	9,  // [9:9] is the sub-list for extension type_name
+	9,  // [9:9] is the sub-list for extension extendee
+	0,  // [0:9] is the sub-list for field type_name
 }
 
 func init() { file_proto_celestialtree_proto_init() }
@@ -189,7 +966,7 @@ func file_proto_celestialtree_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_proto_celestialtree_proto_rawDesc), len(file_proto_celestialtree_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   2,
+			NumMessages:   11,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
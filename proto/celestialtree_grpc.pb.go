@@ -19,7 +19,13 @@ import (
 const _ = grpc.SupportPackageIsVersion9
 
 const (
-	CelestialTreeService_Emit_FullMethodName = "/celestialtree.v1.CelestialTreeService/Emit"
+	CelestialTreeService_Emit_FullMethodName              = "/celestialtree.v1.CelestialTreeService/Emit"
+	CelestialTreeService_EmitBatch_FullMethodName         = "/celestialtree.v1.CelestialTreeService/EmitBatch"
+	CelestialTreeService_EmitStream_FullMethodName        = "/celestialtree.v1.CelestialTreeService/EmitStream"
+	CelestialTreeService_Descendants_FullMethodName       = "/celestialtree.v1.CelestialTreeService/Descendants"
+	CelestialTreeService_Provenance_FullMethodName        = "/celestialtree.v1.CelestialTreeService/Provenance"
+	CelestialTreeService_DescendantsStream_FullMethodName = "/celestialtree.v1.CelestialTreeService/DescendantsStream"
+	CelestialTreeService_ProvenanceStream_FullMethodName  = "/celestialtree.v1.CelestialTreeService/ProvenanceStream"
 )
 
 // CelestialTreeServiceClient is the client API for CelestialTreeService service.
@@ -27,6 +33,12 @@ const (
 // For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
 type CelestialTreeServiceClient interface {
 	Emit(ctx context.Context, in *EmitRequest, opts ...grpc.CallOption) (*EmitResponse, error)
+	EmitBatch(ctx context.Context, in *EmitBatchRequest, opts ...grpc.CallOption) (*EmitBatchResponse, error)
+	EmitStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EmitRequest, EmitAck], error)
+	Descendants(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (*TreePage, error)
+	Provenance(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (*TreePage, error)
+	DescendantsStream(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TreeRecord], error)
+	ProvenanceStream(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TreeRecord], error)
 }
 
 type celestialTreeServiceClient struct {
@@ -47,11 +59,98 @@ func (c *celestialTreeServiceClient) Emit(ctx context.Context, in *EmitRequest,
 	return out, nil
 }
 
+func (c *celestialTreeServiceClient) EmitBatch(ctx context.Context, in *EmitBatchRequest, opts ...grpc.CallOption) (*EmitBatchResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EmitBatchResponse)
+	err := c.cc.Invoke(ctx, CelestialTreeService_EmitBatch_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *celestialTreeServiceClient) EmitStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[EmitRequest, EmitAck], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CelestialTreeService_ServiceDesc.Streams[0], CelestialTreeService_EmitStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[EmitRequest, EmitAck]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CelestialTreeService_EmitStreamClient = grpc.BidiStreamingClient[EmitRequest, EmitAck]
+
+func (c *celestialTreeServiceClient) Descendants(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (*TreePage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TreePage)
+	err := c.cc.Invoke(ctx, CelestialTreeService_Descendants_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *celestialTreeServiceClient) Provenance(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (*TreePage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(TreePage)
+	err := c.cc.Invoke(ctx, CelestialTreeService_Provenance_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *celestialTreeServiceClient) DescendantsStream(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TreeRecord], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CelestialTreeService_ServiceDesc.Streams[1], CelestialTreeService_DescendantsStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TreeRequest, TreeRecord]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CelestialTreeService_DescendantsStreamClient = grpc.ServerStreamingClient[TreeRecord]
+
+func (c *celestialTreeServiceClient) ProvenanceStream(ctx context.Context, in *TreeRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[TreeRecord], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &CelestialTreeService_ServiceDesc.Streams[2], CelestialTreeService_ProvenanceStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[TreeRequest, TreeRecord]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CelestialTreeService_ProvenanceStreamClient = grpc.ServerStreamingClient[TreeRecord]
+
 // CelestialTreeServiceServer is the server API for CelestialTreeService service.
 // All implementations must embed UnimplementedCelestialTreeServiceServer
 // for forward compatibility.
 type CelestialTreeServiceServer interface {
 	Emit(context.Context, *EmitRequest) (*EmitResponse, error)
+	EmitBatch(context.Context, *EmitBatchRequest) (*EmitBatchResponse, error)
+	EmitStream(grpc.BidiStreamingServer[EmitRequest, EmitAck]) error
+	Descendants(context.Context, *TreeRequest) (*TreePage, error)
+	Provenance(context.Context, *TreeRequest) (*TreePage, error)
+	DescendantsStream(*TreeRequest, grpc.ServerStreamingServer[TreeRecord]) error
+	ProvenanceStream(*TreeRequest, grpc.ServerStreamingServer[TreeRecord]) error
 	mustEmbedUnimplementedCelestialTreeServiceServer()
 }
 
@@ -65,6 +164,24 @@ type UnimplementedCelestialTreeServiceServer struct{}
 func (UnimplementedCelestialTreeServiceServer) Emit(context.Context, *EmitRequest) (*EmitResponse, error) {
 	return nil, status.Error(codes.Unimplemented, "method Emit not implemented")
 }
+func (UnimplementedCelestialTreeServiceServer) EmitBatch(context.Context, *EmitBatchRequest) (*EmitBatchResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method EmitBatch not implemented")
+}
+func (UnimplementedCelestialTreeServiceServer) EmitStream(grpc.BidiStreamingServer[EmitRequest, EmitAck]) error {
+	return status.Error(codes.Unimplemented, "method EmitStream not implemented")
+}
+func (UnimplementedCelestialTreeServiceServer) Descendants(context.Context, *TreeRequest) (*TreePage, error) {
+	return nil, status.Error(codes.Unimplemented, "method Descendants not implemented")
+}
+func (UnimplementedCelestialTreeServiceServer) Provenance(context.Context, *TreeRequest) (*TreePage, error) {
+	return nil, status.Error(codes.Unimplemented, "method Provenance not implemented")
+}
+func (UnimplementedCelestialTreeServiceServer) DescendantsStream(*TreeRequest, grpc.ServerStreamingServer[TreeRecord]) error {
+	return status.Error(codes.Unimplemented, "method DescendantsStream not implemented")
+}
+func (UnimplementedCelestialTreeServiceServer) ProvenanceStream(*TreeRequest, grpc.ServerStreamingServer[TreeRecord]) error {
+	return status.Error(codes.Unimplemented, "method ProvenanceStream not implemented")
+}
 func (UnimplementedCelestialTreeServiceServer) mustEmbedUnimplementedCelestialTreeServiceServer() {}
 func (UnimplementedCelestialTreeServiceServer) testEmbeddedByValue()                              {}
 
@@ -104,6 +221,89 @@ func _CelestialTreeService_Emit_Handler(srv interface{}, ctx context.Context, de
 	return interceptor(ctx, in, info, handler)
 }
 
+func _CelestialTreeService_EmitBatch_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EmitBatchRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CelestialTreeServiceServer).EmitBatch(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CelestialTreeService_EmitBatch_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CelestialTreeServiceServer).EmitBatch(ctx, req.(*EmitBatchRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CelestialTreeService_EmitStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(CelestialTreeServiceServer).EmitStream(&grpc.GenericServerStream[EmitRequest, EmitAck]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CelestialTreeService_EmitStreamServer = grpc.BidiStreamingServer[EmitRequest, EmitAck]
+
+func _CelestialTreeService_Descendants_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CelestialTreeServiceServer).Descendants(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CelestialTreeService_Descendants_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CelestialTreeServiceServer).Descendants(ctx, req.(*TreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CelestialTreeService_Provenance_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TreeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CelestialTreeServiceServer).Provenance(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: CelestialTreeService_Provenance_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CelestialTreeServiceServer).Provenance(ctx, req.(*TreeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _CelestialTreeService_DescendantsStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TreeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CelestialTreeServiceServer).DescendantsStream(m, &grpc.GenericServerStream[TreeRequest, TreeRecord]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CelestialTreeService_DescendantsStreamServer = grpc.ServerStreamingServer[TreeRecord]
+
+func _CelestialTreeService_ProvenanceStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(TreeRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(CelestialTreeServiceServer).ProvenanceStream(m, &grpc.GenericServerStream[TreeRequest, TreeRecord]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type CelestialTreeService_ProvenanceStreamServer = grpc.ServerStreamingServer[TreeRecord]
+
 // CelestialTreeService_ServiceDesc is the grpc.ServiceDesc for CelestialTreeService service.
 // It's only intended for direct use with grpc.RegisterService,
 // and not to be introspected or modified (even as a copy)
@@ -115,7 +315,36 @@ var CelestialTreeService_ServiceDesc = grpc.ServiceDesc{
 			MethodName: "Emit",
 			Handler:    _CelestialTreeService_Emit_Handler,
 		},
+		{
+			MethodName: "EmitBatch",
+			Handler:    _CelestialTreeService_EmitBatch_Handler,
+		},
+		{
+			MethodName: "Descendants",
+			Handler:    _CelestialTreeService_Descendants_Handler,
+		},
+		{
+			MethodName: "Provenance",
+			Handler:    _CelestialTreeService_Provenance_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "EmitStream",
+			Handler:       _CelestialTreeService_EmitStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DescendantsStream",
+			Handler:       _CelestialTreeService_DescendantsStream_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "ProvenanceStream",
+			Handler:       _CelestialTreeService_ProvenanceStream_Handler,
+			ServerStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "proto/celestialtree.proto",
 }